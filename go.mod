@@ -5,7 +5,14 @@ go 1.15
 require (
 	github.com/google/go-github/v33 v33.0.0
 	github.com/google/go-querystring v1.0.0
-	github.com/stretchr/testify v1.6.1
-	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
+	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.2.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.2.0
+	go.opentelemetry.io/otel/sdk v1.2.0
+	go.opentelemetry.io/otel/trace v1.2.0
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"issues2stories/internal/passwordhash"
+)
+
+var (
+	ErrMissingCredentials = errors.New("request had no credentials")
+	ErrBadCredentials     = errors.New("request had bad credentials")
+	ErrNoCredentials      = errors.New("no credentials are configured for this endpoint")
+)
+
+// An Authenticator checks the credentials of a request. It returns the label of the credential which matched,
+// so that it can be logged, or an error which explains why the request should be rejected.
+type Authenticator interface {
+	Authenticate(request *http.Request) (label string, err error)
+}
+
+// A ProjectScopedAuthenticator only accepts requests for some Tracker projects, e.g. because the request's
+// credentials were issued for one binding.
+type ProjectScopedAuthenticator interface {
+	Authenticator
+	AllowsProject(request *http.Request, trackerProjectID int64) bool
+}
+
+// EndpointCredentials holds separate credentials for each Tracker-facing endpoint,
+// so that e.g. a leaked webhook URL can be revoked without breaking the import panel.
+type EndpointCredentials struct {
+	TrackerActivity Credentials `yaml:"tracker_activity"`
+	TrackerImport   Credentials `yaml:"tracker_import"`
+}
+
+// A Credential is a username and a hashed password which are accepted during an optional time window.
+// Rotate a credential by adding its replacement with an overlapping window, updating the client, and then
+// letting the old credential expire.
+type Credential struct {
+	// A name for the credential, which appears in logs, e.g. "tracker-webhook-2021-03". Required.
+	Label string `yaml:"label"`
+
+	Username string `yaml:"username"`
+
+	// A bcrypt hash, or an argon2id hash in PHC string format. See the hash-password subcommand.
+	PasswordHash string `yaml:"password_hash"`
+
+	// The credential is only accepted from NotBefore until NotAfter. Both are optional.
+	NotBefore *time.Time `yaml:"not_before"`
+	NotAfter  *time.Time `yaml:"not_after"`
+}
+
+// Credentials accepts any of its credentials which is currently valid.
+type Credentials []Credential
+
+// Returns an error when a credential is missing a required field or has an invalid password hash.
+func (c Credentials) Validate() error {
+	labels := map[string]bool{}
+	for i, credential := range c {
+		if credential.Label == "" {
+			return fmt.Errorf("credential %d has no label", i)
+		}
+		if labels[credential.Label] {
+			return fmt.Errorf("credential label %q is used more than once", credential.Label)
+		}
+		labels[credential.Label] = true
+		if credential.Username == "" {
+			return fmt.Errorf("credential %q has no username", credential.Label)
+		}
+		if err := passwordhash.Validate(credential.PasswordHash); err != nil {
+			return fmt.Errorf("credential %q: %w", credential.Label, err)
+		}
+		if credential.NotBefore != nil && credential.NotAfter != nil && !credential.NotBefore.Before(*credential.NotAfter) {
+			return fmt.Errorf("credential %q: not_before must be before not_after", credential.Label)
+		}
+	}
+	return nil
+}
+
+// Allows tests to control the time.
+var now = time.Now
+
+// Allows tests to observe which hashes are verified.
+var verifyPasswordHash = passwordhash.Verify
+
+func (c Credentials) Authenticate(request *http.Request) (string, error) {
+	username, password, ok := requestCredentials(request)
+	if !ok {
+		return "", ErrMissingCredentials
+	}
+
+	// When a password only matches a credential which is outside of its time window, report that instead,
+	// to make problems with rotation easier to debug.
+	var outsideWindowErr error
+	currentTime := now()
+	usernameMatched := false
+	for _, credential := range c {
+		// Only verify the password hashes of the credentials with the right username, since each verification
+		// is deliberately slow.
+		if !constantTimeEqual(credential.Username, username) {
+			continue
+		}
+		usernameMatched = true
+		matches, err := verifyPasswordHash(credential.PasswordHash, password)
+		if err != nil || !matches {
+			continue
+		}
+		if credential.NotBefore != nil && currentTime.Before(*credential.NotBefore) {
+			outsideWindowErr = fmt.Errorf("credential %q is not valid until %s", credential.Label, credential.NotBefore.Format(time.RFC3339))
+			continue
+		}
+		if credential.NotAfter != nil && !currentTime.Before(*credential.NotAfter) {
+			outsideWindowErr = fmt.Errorf("credential %q expired at %s", credential.Label, credential.NotAfter.Format(time.RFC3339))
+			continue
+		}
+		return credential.Label, nil
+	}
+	if !usernameMatched && len(c) > 0 {
+		// Verify the same hashes as for a request with the first credential's username, and ignore the results, so
+		// that the response takes as long as when the username is right, whichever algorithms and parameters the
+		// hashes use, and its timing doesn't reveal which usernames are configured.
+		for _, credential := range c {
+			if credential.Username == c[0].Username {
+				_, _ = verifyPasswordHash(credential.PasswordHash, password)
+			}
+		}
+	}
+	if outsideWindowErr != nil {
+		return "", outsideWindowErr
+	}
+	return "", ErrBadCredentials
+}
+
+// BasicAuthCredentials is a single plaintext username and password, e.g. from environment variables.
+type BasicAuthCredentials struct {
+	// Optional. Defaults to "basic_auth".
+	Label string
+
+	Username, Password string
+}
+
+func (b *BasicAuthCredentials) Authenticate(request *http.Request) (string, error) {
+	username, password, ok := requestCredentials(request)
+	if !ok {
+		return "", ErrMissingCredentials
+	}
+	// Evaluate both comparisons, so the time taken doesn't reveal whether the username was right.
+	usernameMatches := constantTimeEqual(b.Username, username)
+	passwordMatches := constantTimeEqual(b.Password, password)
+	if !usernameMatches || !passwordMatches {
+		return "", ErrBadCredentials
+	}
+	if b.Label == "" {
+		return "basic_auth", nil
+	}
+	return b.Label, nil
+}
+
+// AnyOf returns an Authenticator which accepts a request when any of the given Authenticators accepts it.
+func AnyOf(authenticators ...Authenticator) Authenticator {
+	return anyOf(authenticators)
+}
+
+type anyOf []Authenticator
+
+func (a anyOf) Authenticate(request *http.Request) (string, error) {
+	var firstErr error
+	for _, authenticator := range a {
+		label, err := authenticator.Authenticate(request)
+		if err == nil {
+			return label, nil
+		}
+		// Prefer a more specific error, e.g. about an expired credential, over the generic ones.
+		if firstErr == nil || (errors.Is(firstErr, ErrBadCredentials) && !errors.Is(err, ErrBadCredentials)) {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return "", ErrBadCredentials
+	}
+	return "", firstErr
+}
+
+// CurrentAuthenticator delegates each request to the Authenticator which the function returns, e.g. the one from the
+// configuration which was loaded most recently. It rejects every request while the function returns nil.
+type CurrentAuthenticator func() Authenticator
+
+func (c CurrentAuthenticator) Authenticate(request *http.Request) (string, error) {
+	authenticator := c()
+	if authenticator == nil {
+		return "", ErrNoCredentials
+	}
+	return authenticator.Authenticate(request)
+}
+
+// Allows every project, unless the current Authenticator is a ProjectScopedAuthenticator.
+func (c CurrentAuthenticator) AllowsProject(request *http.Request, trackerProjectID int64) bool {
+	scoped, ok := c().(ProjectScopedAuthenticator)
+	return !ok || scoped.AllowsProject(request, trackerProjectID)
+}
+
+func requestCredentials(request *http.Request) (username, password string, ok bool) {
+	// Try getting the credentials from the Authorization header.
+	username, password, ok = request.BasicAuth()
+	if ok {
+		return username, password, true
+	}
+
+	// Otherwise try getting the credentials from query parameters.
+	// We do this because Tracker webhooks don't send basic auth
+	// headers, but do allow configuring arbitrary query parameters.
+	queryUser := request.URL.Query()["username"]
+	queryPass := request.URL.Query()["password"]
+	if len(queryUser) > 0 && len(queryPass) > 0 {
+		return queryUser[0], queryPass[0], true
+	}
+
+	// Otherwise there are no credentials.
+	return "", "", false
+}
+
+// Compares the strings in constant time, even when they have different lengths.
+func constantTimeEqual(a, b string) bool {
+	aSum := sha256.Sum256([]byte(a))
+	bSum := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(aSum[:], bSum[:]) == 1
+}
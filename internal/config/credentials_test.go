@@ -0,0 +1,248 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"issues2stories/internal/passwordhash"
+)
+
+// Hashes of "old-password" and "new-password", using a low bcrypt cost and small argon2id parameters to keep the test fast.
+const (
+	oldPasswordHash = "$2a$04$e55Nr7pxHDqaTWN7i0tgeO529bqhm6ldCZMmZpSGoykdZNsBx6gc2"
+	newPasswordHash = "$argon2id$v=19$m=16,t=1,p=1$c29tZXNhbHQ$Y5S1TBs3HFabKfgURSW9Kw"
+)
+
+func TestCredentialsAuthenticate(t *testing.T) {
+	rotationTime := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	overlapEnd := rotationTime.Add(7 * 24 * time.Hour)
+	credentials := Credentials{
+		{Label: "webhook-2021-01", Username: "tracker", PasswordHash: oldPasswordHash, NotAfter: &overlapEnd},
+		{Label: "webhook-2021-03", Username: "tracker", PasswordHash: newPasswordHash, NotBefore: &rotationTime},
+	}
+	require.NoError(t, credentials.Validate())
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		username    string
+		password    string
+		queryParams bool
+		noAuth      bool
+
+		wantLabel          string
+		wantErr            string
+		wantVerifiedHashes []string
+	}{
+		{
+			name:               "old credential before rotation",
+			now:                rotationTime.Add(-time.Hour),
+			username:           "tracker",
+			password:           "old-password",
+			wantLabel:          "webhook-2021-01",
+			wantVerifiedHashes: []string{oldPasswordHash},
+		},
+		{
+			name:     "new credential before its window",
+			now:      rotationTime.Add(-time.Hour),
+			username: "tracker",
+			password: "new-password",
+			wantErr:  `credential "webhook-2021-03" is not valid until 2021-03-01T00:00:00Z`,
+		},
+		{
+			name:      "old credential during overlap",
+			now:       rotationTime.Add(time.Hour),
+			username:  "tracker",
+			password:  "old-password",
+			wantLabel: "webhook-2021-01",
+		},
+		{
+			name:        "new credential during overlap, from query params",
+			now:         rotationTime.Add(time.Hour),
+			username:    "tracker",
+			password:    "new-password",
+			queryParams: true,
+			wantLabel:   "webhook-2021-03",
+		},
+		{
+			name:     "old credential after overlap",
+			now:      overlapEnd,
+			username: "tracker",
+			password: "old-password",
+			wantErr:  `credential "webhook-2021-01" expired at 2021-03-08T00:00:00Z`,
+		},
+		{
+			name:               "wrong password",
+			now:                rotationTime,
+			username:           "tracker",
+			password:           "wrong",
+			wantErr:            "request had bad credentials",
+			wantVerifiedHashes: []string{oldPasswordHash, newPasswordHash},
+		},
+		{
+			name:               "wrong username still verifies the same hashes, so that it takes as long as a wrong password",
+			now:                rotationTime,
+			username:           "wrong",
+			password:           "new-password",
+			wantErr:            "request had bad credentials",
+			wantVerifiedHashes: []string{oldPasswordHash, newPasswordHash},
+		},
+		{
+			name:    "no credentials",
+			now:     rotationTime,
+			noAuth:  true,
+			wantErr: "request had no credentials",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now = func() time.Time { return test.now }
+			t.Cleanup(func() { now = time.Now })
+
+			var verifiedHashes []string
+			verifyPasswordHash = func(hash, password string) (bool, error) {
+				verifiedHashes = append(verifiedHashes, hash)
+				return passwordhash.Verify(hash, password)
+			}
+			t.Cleanup(func() { verifyPasswordHash = passwordhash.Verify })
+
+			request := newRequest(test.username, test.password, test.queryParams, test.noAuth)
+			label, err := credentials.Authenticate(request)
+			if test.wantVerifiedHashes != nil {
+				require.Equal(t, test.wantVerifiedHashes, verifiedHashes)
+			}
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantLabel, label)
+		})
+	}
+}
+
+func TestCredentialsValidate(t *testing.T) {
+	later := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	earlier := later.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		credentials Credentials
+		wantErr     string
+	}{
+		{
+			name:        "missing label",
+			credentials: Credentials{{Username: "tracker", PasswordHash: oldPasswordHash}},
+			wantErr:     "credential 0 has no label",
+		},
+		{
+			name: "duplicate label",
+			credentials: Credentials{
+				{Label: "a", Username: "tracker", PasswordHash: oldPasswordHash},
+				{Label: "a", Username: "tracker", PasswordHash: newPasswordHash},
+			},
+			wantErr: `credential label "a" is used more than once`,
+		},
+		{
+			name:        "missing username",
+			credentials: Credentials{{Label: "a", PasswordHash: oldPasswordHash}},
+			wantErr:     `credential "a" has no username`,
+		},
+		{
+			name:        "plaintext password",
+			credentials: Credentials{{Label: "a", Username: "tracker", PasswordHash: "old-password"}},
+			wantErr:     `credential "a": password hash must be a bcrypt hash or an argon2id hash in PHC string format`,
+		},
+		{
+			name:        "empty window",
+			credentials: Credentials{{Label: "a", Username: "tracker", PasswordHash: oldPasswordHash, NotBefore: &later, NotAfter: &earlier}},
+			wantErr:     `credential "a": not_before must be before not_after`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.EqualError(t, test.credentials.Validate(), test.wantErr)
+		})
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	expired := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	subject := AnyOf(
+		Credentials{{Label: "config", Username: "tracker", PasswordHash: oldPasswordHash, NotAfter: &expired}},
+		&BasicAuthCredentials{Label: "env", Username: "env-user", Password: "env-password"},
+	)
+
+	label, err := subject.Authenticate(newRequest("env-user", "env-password", false, false))
+	require.NoError(t, err)
+	require.Equal(t, "env", label)
+
+	// The more specific error wins over the generic one.
+	_, err = subject.Authenticate(newRequest("tracker", "old-password", false, false))
+	require.EqualError(t, err, `credential "config" expired at 2021-01-01T00:00:00Z`)
+
+	_, err = subject.Authenticate(newRequest("env-user", "wrong", false, false))
+	require.True(t, errors.Is(err, ErrBadCredentials))
+
+	_, err = subject.Authenticate(newRequest("", "", false, true))
+	require.True(t, errors.Is(err, ErrMissingCredentials))
+}
+
+func TestCurrentAuthenticator(t *testing.T) {
+	var current Authenticator
+	subject := CurrentAuthenticator(func() Authenticator { return current })
+	_, err := subject.Authenticate(newRequest("env-user", "env-password", false, false))
+	require.Equal(t, ErrNoCredentials, err)
+	require.True(t, subject.AllowsProject(newRequest("env-user", "env-password", false, false), 123))
+
+	current = &BasicAuthCredentials{Label: "env", Username: "env-user", Password: "env-password"}
+	label, err := subject.Authenticate(newRequest("env-user", "env-password", false, false))
+	require.NoError(t, err)
+	require.Equal(t, "env", label)
+
+	current = &BasicAuthCredentials{Label: "rotated", Username: "env-user", Password: "new-password"}
+	_, err = subject.Authenticate(newRequest("env-user", "env-password", false, false))
+	require.True(t, errors.Is(err, ErrBadCredentials))
+}
+
+func newRequest(username, password string, queryParams, noAuth bool) *http.Request {
+	if noAuth {
+		return httptest.NewRequest(http.MethodGet, "/tracker_activity", nil)
+	}
+	if queryParams {
+		return httptest.NewRequest(http.MethodGet, "/tracker_activity?username="+username+"&password="+password, nil)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/tracker_activity", nil)
+	request.SetBasicAuth(username, password)
+	return request
+}
+
+func TestCredentialsFromYAML(t *testing.T) {
+	configYAML := `
+credentials:
+  tracker_activity:
+    - label: webhook-2021-03
+      username: tracker
+      password_hash: "$2a$04$e55Nr7pxHDqaTWN7i0tgeO529bqhm6ldCZMmZpSGoykdZNsBx6gc2"
+      not_before: 2021-03-01T00:00:00Z
+      not_after: 2021-04-01T00:00:00Z
+  tracker_import:
+    - label: import
+      username: tracker-import
+      password_hash: "$2a$04$e55Nr7pxHDqaTWN7i0tgeO529bqhm6ldCZMmZpSGoykdZNsBx6gc2"
+`
+	configuration := Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(configYAML), &configuration))
+
+	notBefore := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, EndpointCredentials{
+		TrackerActivity: Credentials{{Label: "webhook-2021-03", Username: "tracker", PasswordHash: oldPasswordHash, NotBefore: &notBefore, NotAfter: &notAfter}},
+		TrackerImport:   Credentials{{Label: "import", Username: "tracker-import", PasswordHash: oldPasswordHash}},
+	}, configuration.Credentials)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Returns the config file YAML with the token ID added to webhook_tokens.revoked_token_ids,
+// keeping the rest of the file, including its comments, as it was.
+func AddRevokedWebhookTokenID(configYAML []byte, tokenID string) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(configYAML, &document); err != nil {
+		return nil, err
+	}
+	if document.Kind == 0 {
+		// The file is empty.
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) != 1 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("config file must contain a YAML map")
+	}
+
+	webhookTokens, err := mappingValue(document.Content[0], "webhook_tokens", yaml.MappingNode)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := mappingValue(webhookTokens, "revoked_token_ids", yaml.SequenceNode)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range revoked.Content {
+		if item.Value == tokenID {
+			return configYAML, nil
+		}
+	}
+	revoked.Content = append(revoked.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tokenID, Style: yaml.DoubleQuotedStyle})
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Returns the value of the key in the mapping, adding an empty value of the given kind when the key is missing or null.
+func mappingValue(mapping *yaml.Node, key string, kind yaml.Kind) (*yaml.Node, error) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		value := mapping.Content[i+1]
+		if value.Tag == "!!null" {
+			*value = yaml.Node{Kind: kind}
+		}
+		if value.Kind != kind {
+			return nil, errors.New(key + " has the wrong type")
+		}
+		return value, nil
+	}
+	value := &yaml.Node{Kind: kind}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value, nil
+}
+
+// Replaces the content of an existing config file, keeping its mode. The content is written to a temporary file in
+// the same directory, which is then renamed over the config file, so that the app never reads a partially written
+// file, and an error leaves the original file as it was. A symlink is followed, so that the file it points to is
+// replaced rather than the symlink.
+func WriteFile(path string, content []byte) (err error) {
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	temporary, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temporary.Close()
+			os.Remove(temporary.Name())
+		}
+	}()
+	if err = temporary.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if _, err = temporary.Write(content); err != nil {
+		return err
+	}
+	if err = temporary.Sync(); err != nil {
+		return err
+	}
+	if err = temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
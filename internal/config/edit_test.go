@@ -0,0 +1,103 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddRevokedWebhookTokenID(t *testing.T) {
+	tests := []struct {
+		name       string
+		configYAML string
+		tokenID    string
+
+		wantYAML string
+		wantErr  string
+	}{
+		{
+			name:     "empty file",
+			tokenID:  "0123456789abcdef",
+			wantYAML: "webhook_tokens:\n  revoked_token_ids:\n  - \"0123456789abcdef\"\n",
+		},
+		{
+			name:       "keeps other settings and comments",
+			configYAML: "# Maps Tracker user IDs to GitHub usernames.\nuser_id_mapping:\n  1: alice # the first user\n",
+			tokenID:    "0123456789abcdef",
+			wantYAML: "# Maps Tracker user IDs to GitHub usernames.\nuser_id_mapping:\n  1: alice # the first user\n" +
+				"webhook_tokens:\n  revoked_token_ids:\n  - \"0123456789abcdef\"\n",
+		},
+		{
+			name:       "appends to existing revocations",
+			configYAML: "webhook_tokens:\n  revoked_token_ids:\n  - \"1111111111111111\"\n",
+			tokenID:    "0123456789abcdef",
+			wantYAML:   "webhook_tokens:\n  revoked_token_ids:\n  - \"1111111111111111\"\n  - \"0123456789abcdef\"\n",
+		},
+		{
+			name:       "replaces a null value",
+			configYAML: "webhook_tokens: null\n",
+			tokenID:    "0123456789abcdef",
+			wantYAML:   "webhook_tokens:\n  revoked_token_ids:\n  - \"0123456789abcdef\"\n",
+		},
+		{
+			name:       "already revoked",
+			configYAML: "webhook_tokens:\n    revoked_token_ids: [\"0123456789abcdef\"]\n",
+			tokenID:    "0123456789abcdef",
+			wantYAML:   "webhook_tokens:\n    revoked_token_ids: [\"0123456789abcdef\"]\n",
+		},
+		{
+			name:       "wrong type",
+			configYAML: "webhook_tokens: [1, 2]\n",
+			tokenID:    "0123456789abcdef",
+			wantErr:    "webhook_tokens has the wrong type",
+		},
+		{
+			name:       "not a map",
+			configYAML: "- a\n",
+			tokenID:    "0123456789abcdef",
+			wantErr:    "config file must contain a YAML map",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := AddRevokedWebhookTokenID([]byte(test.configYAML), test.tokenID)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantYAML, string(actual))
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("dry_run: false\n"), 0600))
+	require.NoError(t, os.Chmod(path, 0640))
+	link := filepath.Join(dir, "link.yaml")
+	require.NoError(t, os.Symlink(path, link))
+
+	require.NoError(t, WriteFile(link, []byte("dry_run: true\n")))
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "dry_run: true\n", string(content))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm(), "the mode should be kept")
+	linkInfo, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.Equal(t, os.ModeSymlink, linkInfo.Mode()&os.ModeSymlink, "the symlink should be kept")
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "the temporary file should be gone")
+
+	require.Error(t, WriteFile(filepath.Join(dir, "missing.yaml"), []byte("dry_run: true\n")))
+}
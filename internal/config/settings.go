@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SettingsPrecedence describes the order in which Settings looks for each value, for the startup report.
+const SettingsPrecedence = "environment variable, then the file named by the <NAME>_FILE environment variable " +
+	"(secrets only), then the config file (non-secrets only), then the default"
+
+// Settings resolves the values of the app's settings and secrets, and remembers where each value came from.
+// A value comes from the environment variable, e.g. GITHUB_ORG, when it is set. Otherwise a secret comes from the
+// file named by the environment variable with a _FILE suffix, e.g. GITHUB_API_TOKEN_FILE, as with mounted
+// Kubernetes secrets or Docker secrets, and any other setting comes from the config file or else its default.
+// Secrets never come from the config file, because it is usually stored in a ConfigMap.
+type Settings struct {
+	lookupEnv func(string) (string, bool)
+	readFile  func(string) ([]byte, error)
+
+	sources []SettingSource
+}
+
+// A SettingSource records where the value of a setting came from.
+type SettingSource struct {
+	Name string
+
+	// e.g. "environment variable", "file /etc/secrets/github/token", "config file", "default" or "not set".
+	Source string
+
+	// The value of the setting. Always empty for secrets.
+	Value string
+
+	// The file which the secret was read from, if any.
+	File string
+
+	Secret bool
+}
+
+func NewSettings(lookupEnv func(string) (string, bool), readFile func(string) ([]byte, error)) *Settings {
+	return &Settings{lookupEnv: lookupEnv, readFile: readFile}
+}
+
+// Returns the value of a setting from the environment variable, or else from the config file, or else the default.
+func (s *Settings) Get(name, configFileValue, defaultValue string) string {
+	if value, ok := s.lookupEnv(name); ok && value != "" {
+		s.record(SettingSource{Name: name, Source: "environment variable", Value: value})
+		return value
+	}
+	if configFileValue != "" {
+		s.record(SettingSource{Name: name, Source: "config file", Value: configFileValue})
+		return configFileValue
+	}
+	if defaultValue != "" {
+		s.record(SettingSource{Name: name, Source: "default", Value: defaultValue})
+		return defaultValue
+	}
+	s.record(SettingSource{Name: name, Source: "not set"})
+	return ""
+}
+
+// Returns the value of a secret from the environment variable, or else from the file named by the environment
+// variable with a _FILE suffix. Returns an empty string when neither is set. Trailing newlines are removed from
+// the file's content.
+func (s *Settings) Secret(name string) (string, error) {
+	value, hasValue := s.lookupEnv(name)
+	hasValue = hasValue && value != ""
+	path, hasPath := s.lookupEnv(name + "_FILE")
+	hasPath = hasPath && path != ""
+	switch {
+	case hasValue && hasPath:
+		return "", fmt.Errorf("only one of the environment variables %s and %s_FILE may be set", name, name)
+	case hasValue:
+		s.record(SettingSource{Name: name, Source: "environment variable", Secret: true})
+		return value, nil
+	case hasPath:
+		content, err := s.readFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s from the file named by %s_FILE: %w", name, name, err)
+		}
+		s.record(SettingSource{Name: name, Source: "file " + path, File: path, Secret: true})
+		return strings.TrimRight(string(content), "\r\n"), nil
+	default:
+		s.record(SettingSource{Name: name, Source: "not set", Secret: true})
+		return "", nil
+	}
+}
+
+// Like Secret, but returns an error when the secret is not set.
+func (s *Settings) RequireSecret(name string) (string, error) {
+	value, err := s.Secret(name)
+	if err == nil && value == "" {
+		err = fmt.Errorf("secret not set: set the environment variable %s, or %s_FILE to the path of a file containing it", name, name)
+	}
+	return value, err
+}
+
+// Returns where each value came from, in the order in which they were resolved.
+func (s *Settings) Sources() []SettingSource {
+	return append([]SettingSource{}, s.sources...)
+}
+
+func (s *Settings) record(source SettingSource) {
+	for i := range s.sources {
+		if s.sources[i].Name == source.Name {
+			s.sources[i] = source
+			return
+		}
+	}
+	s.sources = append(s.sources, source)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings(t *testing.T) {
+	env := map[string]string{
+		"GITHUB_ORG":                 "org-from-env",
+		"GITHUB_API_TOKEN_FILE":      "/run/secrets/github",
+		"TRACKER_API_TOKEN":          "tracker-token-from-env",
+		"METRICS_PASSWORD":           "from-env",
+		"METRICS_PASSWORD_FILE":      "/run/secrets/metrics",
+		"BASIC_AUTH_PASSWORD_FILE":   "/run/secrets/missing",
+		"EMPTY_SETTING":              "",
+		"WEBHOOK_TOKEN_KEYS_FILE":    "",
+		"OTEL_EXPORTER_OTLP_HEADERS": "",
+	}
+	files := map[string]string{
+		"/run/secrets/github": "github-token-from-file\n",
+	}
+	subject := NewSettings(
+		func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		func(path string) ([]byte, error) {
+			content, ok := files[path]
+			if !ok {
+				return nil, errors.New("file not found")
+			}
+			return []byte(content), nil
+		})
+
+	require.Equal(t, "org-from-env", subject.Get("GITHUB_ORG", "org-from-config", ""))
+	require.Equal(t, "repo-from-config", subject.Get("GITHUB_REPO", "repo-from-config", ""))
+	require.Equal(t, "info", subject.Get("LOG_LEVEL", "", "info"))
+	require.Equal(t, "", subject.Get("EMPTY_SETTING", "", ""))
+
+	value, err := subject.Secret("GITHUB_API_TOKEN")
+	require.NoError(t, err)
+	require.Equal(t, "github-token-from-file", value)
+
+	value, err = subject.RequireSecret("TRACKER_API_TOKEN")
+	require.NoError(t, err)
+	require.Equal(t, "tracker-token-from-env", value)
+
+	value, err = subject.Secret("WEBHOOK_TOKEN_KEYS")
+	require.NoError(t, err)
+	require.Equal(t, "", value)
+
+	_, err = subject.RequireSecret("WEBHOOK_TOKEN_KEYS")
+	require.EqualError(t, err, "secret not set: set the environment variable WEBHOOK_TOKEN_KEYS, "+
+		"or WEBHOOK_TOKEN_KEYS_FILE to the path of a file containing it")
+
+	_, err = subject.Secret("METRICS_PASSWORD")
+	require.EqualError(t, err, "only one of the environment variables METRICS_PASSWORD and METRICS_PASSWORD_FILE may be set")
+
+	_, err = subject.Secret("BASIC_AUTH_PASSWORD")
+	require.EqualError(t, err, "could not read BASIC_AUTH_PASSWORD from the file named by BASIC_AUTH_PASSWORD_FILE: file not found")
+
+	require.Equal(t, []SettingSource{
+		{Name: "GITHUB_ORG", Source: "environment variable", Value: "org-from-env"},
+		{Name: "GITHUB_REPO", Source: "config file", Value: "repo-from-config"},
+		{Name: "LOG_LEVEL", Source: "default", Value: "info"},
+		{Name: "EMPTY_SETTING", Source: "not set"},
+		{Name: "GITHUB_API_TOKEN", Source: "file /run/secrets/github", File: "/run/secrets/github", Secret: true},
+		{Name: "TRACKER_API_TOKEN", Source: "environment variable", Secret: true},
+		{Name: "WEBHOOK_TOKEN_KEYS", Source: "not set", Secret: true},
+	}, subject.Sources())
+}
@@ -1,34 +1,595 @@
 package config
 
 import (
-	"net/http"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
 )
 
 type Config struct {
+	// The GitHub repository whose issues are linked to Tracker stories. The GITHUB_ORG and GITHUB_REPO
+	// environment variables override these values.
+	GitHub GitHub `yaml:"github"`
+
+	// The log level: debug, info, warn or error. The LOG_LEVEL environment variable overrides it. Optional.
+	LogLevel string `yaml:"log_level"`
+
+	// Settings for exporting trace spans. The OTEL_* environment variables override them. Optional.
+	Tracing Tracing `yaml:"tracing"`
+
 	// Note that UserIDMapping can be nil.
 	UserIDMapping map[int64]string `yaml:"tracker_id_to_github_username_mapping"`
+
+	// Settings for finding the GitHub usernames of story owners who are not in UserIDMapping. Optional.
+	UserResolver UserResolver `yaml:"user_resolver"`
+
+	// The GitHub issue labels which the webhook manages. Optional. Each map which is set replaces the default.
+	Labels LabelMappings `yaml:"labels"`
+
+	// Settings for syncing story descriptions to the bodies of their linked GitHub issues. Optional.
+	DescriptionSync DescriptionSync `yaml:"description_sync"`
+
+	// Settings for reflecting changes to GitHub issues back to their linked Tracker stories. Optional.
+	GitHubSync GitHubSync `yaml:"github_sync"`
+
+	// Settings for telling a GitHub issue about the Tracker story which is created for it. Optional.
+	IssueLink IssueLink `yaml:"issue_link"`
+
+	// Settings for commenting on GitHub issues when their stories make significant transitions. Optional.
+	AuditComments AuditComments `yaml:"audit_comments"`
+
+	// Settings for copying the files which an issue links to on GitHub into its new Tracker story. Optional.
+	AttachmentCopy AttachmentCopy `yaml:"attachment_copy"`
+
+	// Settings for syncing story tasks with the task lists in their linked GitHub issues' bodies. Optional.
+	TaskSync TaskSync `yaml:"task_sync"`
+
+	// Settings for keeping the app's own changes from bouncing back and forth between Tracker and GitHub. Optional.
+	LoopGuard LoopGuard `yaml:"loop_guard"`
+
+	// When DryRun is true, the planned GitHub issue updates are computed and reported
+	// as usual, but they are never sent to GitHub. This applies to every binding.
+	DryRun bool `yaml:"dry_run"`
+
+	// Optional per-project settings. Note that Bindings can be nil.
+	Bindings []Binding `yaml:"bindings"`
+
+	// How often to check that the GitHub and Tracker API tokens still work, for the readiness endpoint.
+	// Optional. Use DefaultReadinessCheckInterval when zero.
+	ReadinessCheckInterval time.Duration `yaml:"readiness_check_interval"`
+
+	// Settings for the HTTP server. Optional.
+	Server Server `yaml:"server"`
+
+	// The credentials which clients must use to call the Tracker-facing endpoints. Optional.
+	// The BASIC_AUTH_USERNAME and BASIC_AUTH_PASSWORD environment variables, when set, are also accepted.
+	Credentials EndpointCredentials `yaml:"credentials"`
+
+	// Settings for the signed tokens which can be embedded in webhook URLs instead of credentials. Optional.
+	WebhookTokens WebhookTokens `yaml:"webhook_tokens"`
+
+	// Settings which protect the endpoints from unwanted clients. Optional.
+	Inbound Inbound `yaml:"inbound"`
+
+	// How often to check whether the config file or the secret files have changed. Optional. Defaults to
+	// DefaultReloadInterval. Set to a negative duration to only reload on SIGHUP.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+const DefaultReloadInterval = 30 * time.Second
+
+// LabelMappings holds the GitHub issue labels to apply for each story state, story type and estimate.
+// When a story changes, the labels of every value in the changed map are removed from the linked issue,
+// and then the labels for the new value are added.
+type LabelMappings struct {
+	States    map[string][]string `yaml:"states"`
+	Types     map[string][]string `yaml:"types"`
+	Estimates map[string][]string `yaml:"estimates"`
 }
 
-type BasicAuthCredentials struct {
-	Username, Password string
+// DescriptionSync holds the policy for updating a linked GitHub issue's body when its story's description changes.
+// Zero values mean "use the default".
+type DescriptionSync struct {
+	// "overwrite" to replace the body with the description, "off" to leave the body unchanged, "managed_section" to
+	// keep the description between HTML comment markers in the body, or "merge" to merge the description's changes
+	// into the body. Defaults to "overwrite".
+	Mode string `yaml:"mode"`
 }
 
-func (b *BasicAuthCredentials) Matches(request *http.Request) bool {
-	// Try getting the credentials from the Authorization header.
-	basicAuthUser, basicAuthPass, ok := request.BasicAuth()
-	if ok {
-		return b.Username == basicAuthUser && b.Password == basicAuthPass
+const (
+	DescriptionSyncOverwrite      = "overwrite"
+	DescriptionSyncOff            = "off"
+	DescriptionSyncManagedSection = "managed_section"
+	DescriptionSyncMerge          = "merge"
+)
+
+var DescriptionSyncModes = []string{DescriptionSyncOverwrite, DescriptionSyncOff, DescriptionSyncManagedSection, DescriptionSyncMerge}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (d DescriptionSync) WithDefaults() DescriptionSync {
+	if d.Mode == "" {
+		d.Mode = DescriptionSyncOverwrite
 	}
+	return d
+}
+
+// GitHubSync holds the policies for updating a linked Tracker story when its GitHub issue changes.
+// Zero values mean "use the default".
+type GitHubSync struct {
+	// When the issue is closed: "finished", "delivered" or "accepted" to move the story forward to that state,
+	// "comment" to comment on the story, or "none". Defaults to "none".
+	OnClose string `yaml:"on_close"`
+
+	// When the issue is reopened while the story is accepted: "rejected" or "started" to move the story back to that
+	// state, "comment" to comment on the story, or "none". Defaults to "none".
+	OnReopen string `yaml:"on_reopen"`
+}
+
+// The values of GitHubSync.OnClose and GitHubSync.OnReopen which aren't story states.
+const (
+	GitHubSyncComment = "comment"
+	GitHubSyncNone    = "none"
+)
+
+var (
+	GitHubSyncOnCloseValues  = []string{"finished", "delivered", "accepted", GitHubSyncComment, GitHubSyncNone}
+	GitHubSyncOnReopenValues = []string{"rejected", "started", GitHubSyncComment, GitHubSyncNone}
+)
 
-	// Otherwise try getting the credentials from query parameters.
-	// We do this because Tracker webhooks don't send basic auth
-	// headers, but do allow configuring arbitrary query parameters.
-	queryUser := request.URL.Query()["username"]
-	queryPass := request.URL.Query()["password"]
-	if len(queryUser) > 0 && len(queryPass) > 0 {
-		return b.Username == queryUser[0] && b.Password == queryPass[0]
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (g GitHubSync) WithDefaults() GitHubSync {
+	if g.OnClose == "" {
+		g.OnClose = GitHubSyncNone
+	}
+	if g.OnReopen == "" {
+		g.OnReopen = GitHubSyncNone
 	}
+	return g
+}
+
+// IssueLink holds the settings for telling a GitHub issue about the Tracker story which is created for it from the
+// import panel, so that people who only use GitHub can find the story. Zero values mean "use the default".
+type IssueLink struct {
+	// Comment on the issue with a link to the story. Defaults to false.
+	Comment bool `yaml:"comment"`
+
+	// The comment, as a Go text/template which is executed with an IssueLinkData. Defaults to
+	// DefaultIssueLinkCommentTemplate.
+	CommentTemplate string `yaml:"comment_template"`
+
+	// A label to add to the issue, e.g. "tracker/linked". Optional.
+	Label string `yaml:"label"`
+}
+
+const DefaultIssueLinkCommentTemplate = "This issue is linked to Tracker {{.StoryType}} [#{{.StoryID}}]({{.StoryURL}}), " +
+	"which is {{.CurrentState}}."
+
+// The values which the issue link comment's template can use.
+type IssueLinkData struct {
+	IssueNumber  int
+	ProjectID    int64
+	StoryID      int64
+	StoryURL     string
+	StoryTitle   string
+	StoryType    string
+	CurrentState string
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (l IssueLink) WithDefaults() IssueLink {
+	if l.CommentTemplate == "" {
+		l.CommentTemplate = DefaultIssueLinkCommentTemplate
+	}
+	return l
+}
+
+// Returns the comment for the story, using the comment template.
+func (l IssueLink) RenderComment(data IssueLinkData) (string, error) {
+	return renderTemplate("comment_template", l.WithDefaults().CommentTemplate, data)
+}
+
+// Executes the text/template. The name is used in error messages.
+func renderTemplate(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var result strings.Builder
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// AuditComments holds the settings for commenting on a GitHub issue when its linked story makes a significant
+// transition, so that the issue's reporter can see why its labels changed. Zero values mean "use the default".
+type AuditComments struct {
+	// The transitions to comment on: "started", "delivered", "rejected" and "accepted" for stories which move to
+	// that state, and "owners" for stories whose owners change. Optional. When empty, no comments are made.
+	Transitions []string `yaml:"transitions"`
+
+	// The comments, by transition, as Go text/templates which are executed with an AuditCommentData. Optional.
+	// Transitions without a template use the one in DefaultAuditCommentTemplates.
+	Templates map[string]string `yaml:"templates"`
+
+	// When an issue was already commented on within this window, the transition is added to that comment instead of
+	// making another one. Defaults to 10 minutes. Set to a negative duration to always make another comment.
+	CoalesceWindow time.Duration `yaml:"coalesce_window"`
+}
+
+// The value of AuditComments.Transitions for changes to a story's owners.
+const AuditTransitionOwners = "owners"
+
+var AuditTransitions = []string{"started", "delivered", "rejected", "accepted", AuditTransitionOwners}
+
+const auditCommentStateTemplate = "{{.PerformedBy}} {{.Transition}} Tracker story [#{{.StoryID}}]({{.StoryURL}})" +
+	"{{if .Iteration}} in iteration {{.Iteration}}{{end}}."
+
+var DefaultAuditCommentTemplates = map[string]string{
+	"started":   auditCommentStateTemplate,
+	"delivered": auditCommentStateTemplate,
+	"rejected":  auditCommentStateTemplate,
+	"accepted":  auditCommentStateTemplate,
+	AuditTransitionOwners: "{{.PerformedBy}} changed the owners of Tracker story [#{{.StoryID}}]({{.StoryURL}}) to {{.Owners}}" +
+		"{{if .Iteration}} in iteration {{.Iteration}}{{end}}.",
+}
+
+// The values which the audit comments' templates can use.
+type AuditCommentData struct {
+	IssueNumber int
+	ProjectID   int64
+	StoryID     int64
+	StoryURL    string
+
+	// One of AuditTransitions.
+	Transition string
+
+	// The story's states before and after the change. Both are empty for changes to the owners.
+	PreviousState string
+	CurrentState  string
+
+	// The name of the Tracker user who made the change.
+	PerformedBy string
+
+	// The number of the project's current iteration when the story is in it, or else 0.
+	Iteration int
+
+	// The story's new owners, as a comma-separated list of GitHub usernames where they are known, or "nobody".
+	Owners string
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (a AuditComments) WithDefaults() AuditComments {
+	if a.CoalesceWindow == 0 {
+		a.CoalesceWindow = 10 * time.Minute
+	}
+	return a
+}
+
+// Returns true when the transition should be commented on.
+func (a AuditComments) Comments(transition string) bool {
+	return contains(a.Transitions, transition)
+}
+
+// Returns the comment for the transition, using its template.
+func (a AuditComments) RenderComment(data AuditCommentData) (string, error) {
+	text, ok := a.Templates[data.Transition]
+	if !ok {
+		text = DefaultAuditCommentTemplates[data.Transition]
+	}
+	return renderTemplate(data.Transition, text, data)
+}
+
+// AttachmentCopy holds the settings for copying the images and other files which a GitHub issue's body links to into
+// the Tracker story which is created for it from the import panel, because GitHub only shows the files of private
+// repositories to people who are logged in to GitHub. Zero values mean "use the default".
+type AttachmentCopy struct {
+	Enabled bool `yaml:"enabled"`
+
+	// The largest file to copy. Larger files are left on GitHub. Defaults to 10 MiB.
+	MaxFileBytes int64 `yaml:"max_file_bytes"`
+
+	// The most to copy for one story, in total. The files which would go over the limit are left on GitHub.
+	// Defaults to 25 MiB.
+	MaxTotalBytes int64 `yaml:"max_total_bytes"`
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (a AttachmentCopy) WithDefaults() AttachmentCopy {
+	if a.MaxFileBytes <= 0 {
+		a.MaxFileBytes = 10 << 20
+	}
+	if a.MaxTotalBytes <= 0 {
+		a.MaxTotalBytes = 25 << 20
+	}
+	return a
+}
+
+// TaskSync holds the settings for syncing a story's tasks with the task list in its linked GitHub issue's body, e.g.
+// "- [ ] Write the docs", in both directions.
+type TaskSync struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// LoopGuard holds the settings for suppressing the webhook events which the app's own changes cause.
+type LoopGuard struct {
+	// When true, all Tracker activity performed by the Tracker user whose API token the app uses is ignored. Only
+	// enable it when that user is used by nothing but the app, e.g. when the app also syncs GitHub issue changes
+	// back to Tracker. Otherwise, only the app's own recent changes are recognized and suppressed.
+	SuppressOwnTrackerUser bool `yaml:"suppress_own_tracker_user"`
 
-	// Otherwise authentication failed.
-	return false
+	// When true, all GitHub issue events sent by the GitHub user whose API token the app uses are ignored. Only enable
+	// it when that user is used by nothing but the app, and not e.g. when the token is a maintainer's own personal
+	// access token. Otherwise, only the app's own recent changes are recognized and suppressed.
+	SuppressOwnGitHubUser bool `yaml:"suppress_own_github_user"`
+}
+
+// The story states and story types which Tracker uses. See https://www.pivotaltracker.com/help/api/rest/v5#story_resource
+var (
+	StoryStates = []string{"unscheduled", "unstarted", "planned", "started", "finished", "delivered", "rejected", "accepted"}
+	StoryTypes  = []string{"feature", "bug", "chore", "release"}
+)
+
+// Returns the config file keys of the top-level sections which differ between the configurations.
+func Diff(old, new *Config) []string {
+	var changed []string
+	oldValue, newValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, strings.Split(oldValue.Type().Field(i).Tag.Get("yaml"), ",")[0])
+		}
+	}
+	return changed
+}
+
+// A Provider returns the current configuration. Since the configuration can be reloaded, callers should call
+// Current once, e.g. per request, and use that configuration throughout.
+type Provider interface {
+	Current() *Config
+}
+
+// A Config is a Provider of itself, for when the configuration never changes.
+func (c *Config) Current() *Config {
+	return c
+}
+
+// A ProviderFunc is a Provider which returns whatever configuration the function returns, e.g. the configuration
+// which was loaded most recently.
+type ProviderFunc func() *Config
+
+func (f ProviderFunc) Current() *Config {
+	return f()
+}
+
+// The confidences which user_resolver.min_confidence accepts, from high to low. They are the confidences of the
+// usermapping package, which can't be imported here because it uses this package.
+var Confidences = []string{"high", "medium", "low"}
+
+// UserResolver holds the settings for finding the GitHub users of Tracker users while the app is running, the same
+// way as the generate-user-mapping subcommand does. Zero values mean "use the default".
+type UserResolver struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Only use matches with at least this confidence: "high", "medium" or "low". Defaults to "high".
+	MinConfidence string `yaml:"min_confidence"`
+
+	// How long to remember the Tracker project members, the repository's commit authors and each result.
+	// Defaults to 1 hour.
+	CacheDuration time.Duration `yaml:"cache_duration"`
+
+	// How many of the repository's most recent commits to compare with the Tracker users. Defaults to 1000.
+	MaxCommits int `yaml:"max_commits"`
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (u UserResolver) WithDefaults() UserResolver {
+	if u.MinConfidence == "" {
+		u.MinConfidence = "high"
+	}
+	if u.CacheDuration <= 0 {
+		u.CacheDuration = time.Hour
+	}
+	if u.MaxCommits <= 0 {
+		u.MaxCommits = 1000
+	}
+	return u
+}
+
+// Inbound holds the settings for rate limiting failed authentication and for restricting which clients
+// may call each endpoint. Zero values mean "use the default".
+type Inbound struct {
+	// The CIDRs of proxies, e.g. load balancers, which are trusted to report the client's IP address in the
+	// X-Forwarded-For header. Optional. When empty, the client is always the peer of the connection.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// Lock out a client IP address after this many failed authentication attempts within FailedAuthWindow.
+	// Defaults to 10. Set to -1 to never lock out clients.
+	MaxFailedAuth int `yaml:"max_failed_auth"`
+
+	// Defaults to 10 minutes.
+	FailedAuthWindow time.Duration `yaml:"failed_auth_window"`
+
+	// How long a client stays locked out. Defaults to 15 minutes.
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+
+	// Per-endpoint settings, by endpoint name: "tracker_activity", "tracker_import", "metrics" or
+	// "github_webhook". Optional.
+	Endpoints map[string]InboundEndpoint `yaml:"endpoints"`
+}
+
+// InboundEndpoint holds the settings for one endpoint.
+type InboundEndpoint struct {
+	// Only accept requests from client IP addresses in these CIDRs. Optional. When empty, any client is accepted.
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+
+	// The largest accepted request body. Defaults to 1 MiB.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (i Inbound) WithDefaults() Inbound {
+	if i.MaxFailedAuth == 0 {
+		i.MaxFailedAuth = 10
+	}
+	if i.FailedAuthWindow <= 0 {
+		i.FailedAuthWindow = 10 * time.Minute
+	}
+	if i.LockoutDuration <= 0 {
+		i.LockoutDuration = 15 * time.Minute
+	}
+	return i
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (e InboundEndpoint) WithDefaults() InboundEndpoint {
+	if e.MaxBodyBytes <= 0 {
+		e.MaxBodyBytes = 1 << 20
+	}
+	return e
+}
+
+type GitHub struct {
+	Org  string `yaml:"org"`
+	Repo string `yaml:"repo"`
+}
+
+// Tracing holds the non-secret settings for exporting trace spans. The OTEL_EXPORTER_OTLP_HEADERS setting
+// often contains credentials, so it can only be set in the environment.
+type Tracing struct {
+	// The base URL of an OTLP/HTTP endpoint, like OTEL_EXPORTER_OTLP_ENDPOINT.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+
+	// Like OTEL_SERVICE_NAME.
+	ServiceName string `yaml:"service_name"`
+}
+
+// WebhookTokens holds the settings for signed webhook tokens. The signing keys are secrets,
+// so they are read from the environment instead. See the webhook-url subcommand.
+type WebhookTokens struct {
+	// The IDs of tokens which are no longer accepted, e.g. because their webhook URL was leaked.
+	RevokedTokenIDs []string `yaml:"revoked_token_ids"`
+}
+
+const DefaultReadinessCheckInterval = time.Minute
+
+// Server holds the HTTP server settings. Zero values mean "use the default".
+type Server struct {
+	// The address to listen on, e.g. ":8080" or "127.0.0.1:8080".
+	ListenAddress string `yaml:"listen_address"`
+
+	// The maximum time to read an entire request, including the body.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+
+	// The maximum time to handle a request and write its response. The webhook makes several API
+	// calls per story change, so this should be generous.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// The maximum time to keep an idle keep-alive connection open.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// After receiving SIGTERM, how long to keep serving while reporting not ready,
+	// so load balancers can stop sending new requests before the server stops listening.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+
+	// After the shutdown delay, how long to wait for in-flight requests to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Serve HTTPS using a certificate from files. Optional. Cannot be combined with ACME.
+	TLS *TLS `yaml:"tls"`
+
+	// Serve HTTPS using a certificate obtained from an ACME certificate authority. Optional.
+	ACME *ACME `yaml:"acme"`
+}
+
+// TLS holds the settings for serving HTTPS with a certificate and key read from files.
+type TLS struct {
+	// Paths to PEM encoded files. The certificate file may contain intermediate certificates after the leaf.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// How often to check whether the files have changed on disk. Optional. Defaults to 1 minute.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// ACME holds the settings for obtaining and renewing a certificate from an ACME certificate authority,
+// such as Let's Encrypt.
+type ACME struct {
+	// The domain names for the certificate. Required.
+	Domains []string `yaml:"domains"`
+
+	// The ACME directory URL. Optional. Defaults to Let's Encrypt's production directory.
+	DirectoryURL string `yaml:"directory_url"`
+
+	// The contact email address for the ACME account. Optional.
+	Email string `yaml:"email"`
+
+	// A directory where the account key, certificate and certificate key are stored between restarts. Optional,
+	// but strongly recommended, because otherwise each restart requests a new certificate.
+	CacheDir string `yaml:"cache_dir"`
+
+	// Either "tls-alpn-01" or "http-01". Optional. Defaults to "tls-alpn-01".
+	Challenge string `yaml:"challenge"`
+
+	// For the "http-01" challenge, the address where the challenge responses are served. Optional.
+	// Defaults to ":80". Requests to any other path on this address are redirected to HTTPS.
+	HTTPChallengeAddress string `yaml:"http_challenge_address"`
+
+	// A PEM file with extra root certificates to trust when connecting to the ACME directory, e.g. for a
+	// local test certificate authority such as Pebble. Optional.
+	CARootFile string `yaml:"ca_root_file"`
+
+	// How long before expiry to renew the certificate. Optional. Defaults to 30 days.
+	RenewBefore time.Duration `yaml:"renew_before"`
+}
+
+// Returns a copy of the settings with the defaults filled in for any zero values.
+func (s Server) WithDefaults() Server {
+	if s.ListenAddress == "" {
+		s.ListenAddress = ":8080"
+	}
+	if s.ReadTimeout <= 0 {
+		s.ReadTimeout = 30 * time.Second
+	}
+	if s.WriteTimeout <= 0 {
+		s.WriteTimeout = 2 * time.Minute
+	}
+	if s.IdleTimeout <= 0 {
+		s.IdleTimeout = 2 * time.Minute
+	}
+	if s.ShutdownDelay < 0 {
+		s.ShutdownDelay = 0
+	}
+	if s.ShutdownTimeout <= 0 {
+		s.ShutdownTimeout = 20 * time.Second
+	}
+	return s
+}
+
+// A Binding holds the settings for one Tracker project which is linked to the GitHub repository.
+type Binding struct {
+	Name             string `yaml:"name"`
+	TrackerProjectID int64  `yaml:"tracker_project_id"`
+
+	// When DryRun is true, only the events from this binding's Tracker project are handled in dry-run mode.
+	DryRun bool `yaml:"dry_run"`
+}
+
+// Returns the binding for the given Tracker project, or nil when there is none.
+func (c *Config) BindingForProject(trackerProjectID int64) *Binding {
+	for i := range c.Bindings {
+		if c.Bindings[i].TrackerProjectID == trackerProjectID {
+			return &c.Bindings[i]
+		}
+	}
+	return nil
+}
+
+// Returns true when changes to GitHub should only be planned, but not applied, for the given Tracker project.
+func (c *Config) IsDryRun(trackerProjectID int64) bool {
+	if c.DryRun {
+		return true
+	}
+	binding := c.BindingForProject(trackerProjectID)
+	return binding != nil && binding.DryRun
 }
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		UserIDMapping: map[int64]string{1: "alice"},
+		Bindings:      []Binding{{Name: "web", TrackerProjectID: 123}},
+	}
+	tests := []struct {
+		name string
+		new  *Config
+		want []string
+	}{
+		{
+			name: "no changes",
+			new: &Config{
+				UserIDMapping: map[int64]string{1: "alice"},
+				Bindings:      []Binding{{Name: "web", TrackerProjectID: 123}},
+			},
+		},
+		{
+			name: "changed sections are reported by their config file keys",
+			new: &Config{
+				UserIDMapping: map[int64]string{1: "bob"},
+				Labels:        LabelMappings{States: map[string][]string{"accepted": {"done"}}},
+				Bindings:      []Binding{{Name: "web", TrackerProjectID: 123, DryRun: true}},
+			},
+			want: []string{"tracker_id_to_github_username_mapping", "labels", "bindings"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, Diff(old, test.new))
+		})
+	}
+}
+
+func TestProviderFunc(t *testing.T) {
+	first, second := &Config{DryRun: true}, &Config{}
+	current := first
+	var subject Provider = ProviderFunc(func() *Config { return current })
+	require.Same(t, first, subject.Current())
+	current = second
+	require.Same(t, second, subject.Current())
+
+	var provider Provider = first
+	require.Same(t, first, provider.Current())
+}
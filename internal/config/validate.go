@@ -0,0 +1,347 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A Problem is one thing which is wrong with a config file.
+type Problem struct {
+	// The line in the config file, starting at 1, or 0 when it is not known.
+	Line int
+
+	// The key which has the problem, e.g. "bindings[1].tracker_project_id", or empty when it is not known.
+	Key string
+
+	Message string
+
+	// The key as a list of map keys and sequence indexes, for finding its line.
+	path []string
+}
+
+func (p Problem) String() string {
+	var prefix string
+	if p.Line > 0 {
+		prefix = fmt.Sprintf("line %d: ", p.Line)
+	}
+	if p.Key != "" {
+		prefix += p.Key + ": "
+	}
+	return prefix + p.Message
+}
+
+// A ValidationError lists every problem which was found in a config file.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.String()
+	}
+	return "invalid config file: " + strings.Join(messages, "; ")
+}
+
+// Matches the per-line errors from the YAML decoder, e.g. "line 3: field foo not found in type config.Config".
+var (
+	yamlLineErrorPattern    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// Parses a config file and validates it. Unlike yaml.Unmarshal, keys which don't belong to the configuration,
+// e.g. because they are misspelled, are errors. Returns a *ValidationError, whose problems have line numbers
+// where possible, when the file is invalid.
+func Parse(configYAML []byte) (*Config, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(configYAML, &document); err != nil {
+		return nil, &ValidationError{Problems: yamlProblems(err)}
+	}
+
+	configuration := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(configYAML))
+	decoder.KnownFields(true)
+	var decodeProblems []Problem
+	if err := decoder.Decode(configuration); err != nil && err != io.EOF {
+		// After a type error, e.g. an unknown key, the rest of the file was still decoded, so it can be validated too.
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return nil, &ValidationError{Problems: yamlProblems(err)}
+		}
+		decodeProblems = yamlProblems(err)
+	}
+
+	problems := configuration.problems()
+	addLines(&document, problems)
+	problems = append(decodeProblems, problems...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return configuration, nil
+}
+
+// The secrets which the app needs to sync the issues and stories of every binding.
+var bindingTokens = []string{"GITHUB_API_TOKEN", "TRACKER_API_TOKEN"}
+
+// Returns a problem for each binding and each API token which it needs but which is not set in the settings, e.g.
+// because TRACKER_API_TOKEN is missing from the environment. The problems have line numbers from the config file,
+// which must already have been parsed into the configuration by Parse.
+func (c *Config) TokenProblems(configYAML []byte, settings *Settings) []Problem {
+	var missing []error
+	for _, name := range bindingTokens {
+		if _, err := settings.RequireSecret(name); err != nil {
+			missing = append(missing, err)
+		}
+	}
+	var problems []Problem
+	for i, binding := range c.Bindings {
+		index := fmt.Sprintf("[%d]", i)
+		for _, err := range missing {
+			problems = append(problems, Problem{Key: "bindings" + index, path: []string{"bindings", index},
+				Message: fmt.Sprintf("binding %q can't be synced without the API tokens: %v", binding.Name, err)})
+		}
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(configYAML, &document); err == nil {
+		addLines(&document, problems)
+	}
+	return problems
+}
+
+// Returns a *ValidationError when the configuration is invalid. Its problems have no line numbers, since the
+// configuration is no longer connected to its file. Use Parse to find the line numbers.
+func (c *Config) Validate() error {
+	if problems := c.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) problems() []Problem {
+	var problems []Problem
+	add := func(message string, path ...string) {
+		key := ""
+		for _, segment := range path {
+			if strings.HasPrefix(segment, "[") {
+				key += segment
+			} else if key == "" {
+				key = segment
+			} else {
+				key += "." + segment
+			}
+		}
+		problems = append(problems, Problem{Key: key, Message: message, path: path})
+	}
+
+	if err := c.Credentials.TrackerActivity.Validate(); err != nil {
+		add(err.Error(), "credentials", "tracker_activity")
+	}
+	if err := c.Credentials.TrackerImport.Validate(); err != nil {
+		add(err.Error(), "credentials", "tracker_import")
+	}
+
+	// GitHub usernames are case-insensitive, so two Tracker users which map to the same username in different cases
+	// would also be assigned to the same GitHub user.
+	trackerIDs := make([]int64, 0, len(c.UserIDMapping))
+	for trackerID := range c.UserIDMapping {
+		trackerIDs = append(trackerIDs, trackerID)
+	}
+	sort.Slice(trackerIDs, func(i, j int) bool { return trackerIDs[i] < trackerIDs[j] })
+	trackerIDsByUsername := map[string]int64{}
+	for _, trackerID := range trackerIDs {
+		username := c.UserIDMapping[trackerID]
+		key := strconv.FormatInt(trackerID, 10)
+		if username == "" {
+			add("GitHub username is empty", "tracker_id_to_github_username_mapping", key)
+			continue
+		}
+		if otherTrackerID, ok := trackerIDsByUsername[strings.ToLower(username)]; ok {
+			add(fmt.Sprintf("GitHub username %q is also mapped from Tracker user ID %d", username, otherTrackerID),
+				"tracker_id_to_github_username_mapping", key)
+			continue
+		}
+		trackerIDsByUsername[strings.ToLower(username)] = trackerID
+	}
+
+	if confidence := c.UserResolver.MinConfidence; confidence != "" && !contains(Confidences, confidence) {
+		add(fmt.Sprintf("%q is not a confidence: expected high, medium or low", confidence), "user_resolver", "min_confidence")
+	}
+
+	if mode := c.DescriptionSync.Mode; mode != "" && !contains(DescriptionSyncModes, mode) {
+		add(fmt.Sprintf("%q is not a description sync mode: expected one of %s", mode, strings.Join(DescriptionSyncModes, ", ")),
+			"description_sync", "mode")
+	}
+
+	if onClose := c.GitHubSync.OnClose; onClose != "" && !contains(GitHubSyncOnCloseValues, onClose) {
+		add(fmt.Sprintf("%q is not a close policy: expected one of %s", onClose, strings.Join(GitHubSyncOnCloseValues, ", ")),
+			"github_sync", "on_close")
+	}
+	if onReopen := c.GitHubSync.OnReopen; onReopen != "" && !contains(GitHubSyncOnReopenValues, onReopen) {
+		add(fmt.Sprintf("%q is not a reopen policy: expected one of %s", onReopen, strings.Join(GitHubSyncOnReopenValues, ", ")),
+			"github_sync", "on_reopen")
+	}
+
+	// Executing the template with example values also finds fields which IssueLinkData doesn't have.
+	if _, err := c.IssueLink.RenderComment(IssueLinkData{IssueNumber: 348, ProjectID: 2453999, StoryID: 176650922,
+		StoryURL: "https://www.pivotaltracker.com/story/show/176650922", StoryTitle: "Example", StoryType: "feature",
+		CurrentState: "unscheduled"}); err != nil {
+		add(fmt.Sprintf("invalid template: %v", err), "issue_link", "comment_template")
+	}
+
+	for i, transition := range c.AuditComments.Transitions {
+		if !contains(AuditTransitions, transition) {
+			add(fmt.Sprintf("%q is not a transition: expected one of %s", transition, strings.Join(AuditTransitions, ", ")),
+				"audit_comments", "transitions", fmt.Sprintf("[%d]", i))
+		}
+	}
+	transitions := make([]string, 0, len(c.AuditComments.Templates))
+	for transition := range c.AuditComments.Templates {
+		transitions = append(transitions, transition)
+	}
+	sort.Strings(transitions)
+	for _, transition := range transitions {
+		if !contains(AuditTransitions, transition) {
+			add(fmt.Sprintf("%q is not a transition: expected one of %s", transition, strings.Join(AuditTransitions, ", ")),
+				"audit_comments", "templates", transition)
+			continue
+		}
+		if _, err := c.AuditComments.RenderComment(AuditCommentData{IssueNumber: 348, ProjectID: 2453999,
+			StoryID: 176650922, StoryURL: "https://www.pivotaltracker.com/story/show/176650922", Transition: transition,
+			PreviousState: "unstarted", CurrentState: "started", PerformedBy: "Example User", Iteration: 12,
+			Owners: "example-user"}); err != nil {
+			add(fmt.Sprintf("invalid template: %v", err), "audit_comments", "templates", transition)
+		}
+	}
+
+	if c.AttachmentCopy.MaxFileBytes < 0 {
+		add("size must not be negative", "attachment_copy", "max_file_bytes")
+	}
+	if c.AttachmentCopy.MaxTotalBytes < 0 {
+		add("size must not be negative", "attachment_copy", "max_total_bytes")
+	}
+
+	validateLabelMap := func(name string, labels map[string][]string, validKey func(string) bool, keyDescription string) {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !validKey(key) {
+				add(fmt.Sprintf("%q is not %s", key, keyDescription), "labels", name, key)
+			}
+			for i, label := range labels[key] {
+				if label == "" {
+					add("label is empty", "labels", name, key, fmt.Sprintf("[%d]", i))
+				}
+			}
+		}
+	}
+	validateLabelMap("states", c.Labels.States, func(key string) bool { return contains(StoryStates, key) },
+		"a Tracker story state: expected one of "+strings.Join(StoryStates, ", "))
+	validateLabelMap("types", c.Labels.Types, func(key string) bool { return contains(StoryTypes, key) },
+		"a Tracker story type: expected one of "+strings.Join(StoryTypes, ", "))
+	validateLabelMap("estimates", c.Labels.Estimates, func(key string) bool {
+		estimate, err := strconv.ParseFloat(key, 64)
+		return err == nil && estimate >= 0 && strconv.FormatFloat(estimate, 'f', -1, 64) == key
+	}, "a Tracker story estimate: expected a number of points, e.g. 3 or 0.5")
+
+	// Webhook tokens, readiness checks and dry-run settings find a binding by its Tracker project ID.
+	names, projectIDs := map[string]bool{}, map[int64]bool{}
+	for i, binding := range c.Bindings {
+		index := fmt.Sprintf("[%d]", i)
+		switch {
+		case binding.Name == "":
+			add("name is required", "bindings", index)
+		case names[binding.Name]:
+			add(fmt.Sprintf("name %q is used by more than one binding", binding.Name), "bindings", index, "name")
+		}
+		names[binding.Name] = true
+		switch {
+		case binding.TrackerProjectID <= 0:
+			add("tracker_project_id is required", "bindings", index)
+		case projectIDs[binding.TrackerProjectID]:
+			add(fmt.Sprintf("Tracker project %d is used by more than one binding", binding.TrackerProjectID),
+				"bindings", index, "tracker_project_id")
+		}
+		projectIDs[binding.TrackerProjectID] = true
+	}
+	return problems
+}
+
+// Converts an error from the YAML decoder into problems, using the line numbers from its messages.
+func yamlProblems(err error) []Problem {
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+	problems := make([]Problem, 0, len(messages))
+	for _, message := range messages {
+		problem := Problem{Message: message}
+		if match := yamlLineErrorPattern.FindStringSubmatch(message); match != nil {
+			problem.Line, _ = strconv.Atoi(match[1])
+			problem.Message = match[2]
+		}
+		if match := yamlUnknownFieldPattern.FindStringSubmatch(problem.Message); match != nil {
+			problem.Message = fmt.Sprintf("unknown key %q", match[1])
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// Sets the line numbers of the problems from the parsed config file.
+func addLines(document *yaml.Node, problems []Problem) {
+	var root *yaml.Node
+	if len(document.Content) == 1 {
+		root = document.Content[0]
+	}
+	for i := range problems {
+		problems[i].Line = lineOf(root, problems[i].path)
+	}
+}
+
+// Returns the line of the deepest node on the path which exists in the file, or 0 when none of it exists.
+func lineOf(node *yaml.Node, path []string) int {
+	line := 0
+	for _, segment := range path {
+		if node == nil {
+			break
+		}
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(strings.Trim(segment, "[]"))
+			if err == nil && index >= 0 && index < len(node.Content) {
+				next = node.Content[index]
+				line = next.Line
+			}
+		}
+		node = next
+	}
+	return line
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		configYAML   string
+		want         *Config
+		wantProblems []string
+		wantError    string
+	}{
+		{
+			name:       "empty file",
+			configYAML: "",
+			want:       &Config{},
+		},
+		{
+			name: "valid file",
+			configYAML: `
+tracker_id_to_github_username_mapping: {3344177: cfryanr, 1234567: someone-else}
+labels:
+  states: {accepted: [done]}
+  estimates: {"0.5": [estimate/XS], "3": [estimate/L]}
+bindings:
+  - {name: web, tracker_project_id: 123}
+  - {name: api, tracker_project_id: 456, dry_run: true}
+`,
+			want: &Config{
+				UserIDMapping: map[int64]string{3344177: "cfryanr", 1234567: "someone-else"},
+				Labels: LabelMappings{
+					States:    map[string][]string{"accepted": {"done"}},
+					Estimates: map[string][]string{"0.5": {"estimate/XS"}, "3": {"estimate/L"}},
+				},
+				Bindings: []Binding{{Name: "web", TrackerProjectID: 123}, {Name: "api", TrackerProjectID: 456, DryRun: true}},
+			},
+		},
+		{
+			name:       "YAML syntax errors",
+			configYAML: "dry_run: true\nbindings: [\n",
+			wantProblems: []string{
+				"line 2: did not find expected node content",
+			},
+		},
+		{
+			name: "unknown keys and wrong types",
+			configYAML: `
+dry_run: maybe
+tracker_id_to_github_usernme_mapping: {3344177: cfryanr}
+bindings:
+  - name: web
+    tracker_project: 123
+`,
+			wantProblems: []string{
+				"line 2: cannot unmarshal !!str `maybe` into bool",
+				`line 3: unknown key "tracker_id_to_github_usernme_mapping"`,
+				"line 5: bindings[0]: tracker_project_id is required",
+				`line 6: unknown key "tracker_project"`,
+			},
+		},
+		{
+			name: "semantic problems",
+			configYAML: `
+tracker_id_to_github_username_mapping:
+  3344177: cfryanr
+  1234567: CFRyanR
+  7654321: ""
+labels:
+  states:
+    acepted: [done]
+  types:
+    feature: [""]
+  estimates:
+    "1.50": [small]
+    "-1": [tiny]
+bindings:
+  - name: web
+    tracker_project_id: 123
+  - tracker_project_id: 456
+  - name: web
+    tracker_project_id: 123
+credentials:
+  tracker_import:
+    - label: import
+user_resolver:
+  enabled: true
+  min_confidence: certain
+github_sync:
+  on_close: closed
+  on_reopen: unstarted
+description_sync:
+  mode: replace
+issue_link:
+  comment_template: "Linked to {{.Story}}"
+audit_comments:
+  transitions: [started, finished]
+  templates:
+    accepted: "{{.PerformedBy}} accepted it in {{.Sprint}}"
+    unstarted: "Back to the backlog"
+attachment_copy:
+  max_total_bytes: -1
+`,
+			wantProblems: []string{
+				`line 3: tracker_id_to_github_username_mapping.3344177: GitHub username "cfryanr" is also mapped from Tracker user ID 1234567`,
+				"line 5: tracker_id_to_github_username_mapping.7654321: GitHub username is empty",
+				`line 8: labels.states.acepted: "acepted" is not a Tracker story state: expected one of ` +
+					"unscheduled, unstarted, planned, started, finished, delivered, rejected, accepted",
+				"line 10: labels.types.feature[0]: label is empty",
+				`line 12: labels.estimates.1.50: "1.50" is not a Tracker story estimate: expected a number of points, e.g. 3 or 0.5`,
+				`line 13: labels.estimates.-1: "-1" is not a Tracker story estimate: expected a number of points, e.g. 3 or 0.5`,
+				"line 17: bindings[1]: name is required",
+				`line 18: bindings[2].name: name "web" is used by more than one binding`,
+				"line 19: bindings[2].tracker_project_id: Tracker project 123 is used by more than one binding",
+				`line 21: credentials.tracker_import: credential "import" has no username`,
+				`line 25: user_resolver.min_confidence: "certain" is not a confidence: expected high, medium or low`,
+				`line 27: github_sync.on_close: "closed" is not a close policy: expected one of finished, delivered, accepted, comment, none`,
+				`line 28: github_sync.on_reopen: "unstarted" is not a reopen policy: expected one of rejected, started, comment, none`,
+				`line 30: description_sync.mode: "replace" is not a description sync mode: expected one of ` +
+					"overwrite, off, managed_section, merge",
+				`line 32: issue_link.comment_template: invalid template: template: comment_template:1:12: executing "comment_template" ` +
+					`at <.Story>: can't evaluate field Story in type config.IssueLinkData`,
+				`line 34: audit_comments.transitions[1]: "finished" is not a transition: expected one of ` +
+					"started, delivered, rejected, accepted, owners",
+				`line 36: audit_comments.templates.accepted: invalid template: template: accepted:1:34: executing "accepted" ` +
+					`at <.Sprint>: can't evaluate field Sprint in type config.AuditCommentData`,
+				`line 37: audit_comments.templates.unstarted: "unstarted" is not a transition: expected one of ` +
+					"started, delivered, rejected, accepted, owners",
+				"line 39: attachment_copy.max_total_bytes: size must not be negative",
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse([]byte(test.configYAML))
+			if test.wantProblems != nil {
+				require.Nil(t, got)
+				require.IsType(t, &ValidationError{}, err)
+				var problems []string
+				for _, problem := range err.(*ValidationError).Problems {
+					problems = append(problems, problem.String())
+				}
+				require.Equal(t, test.wantProblems, problems)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, (&Config{}).Validate())
+
+	err := (&Config{Bindings: []Binding{{Name: "web"}}}).Validate()
+	require.EqualError(t, err, "invalid config file: bindings[0]: tracker_project_id is required")
+}
+
+func TestTokenProblems(t *testing.T) {
+	configYAML := []byte(`
+dry_run: true
+bindings:
+  - {name: web, tracker_project_id: 123}
+  - name: api
+    tracker_project_id: 456
+`)
+	configuration, err := Parse(configYAML)
+	require.NoError(t, err)
+	settings := func(env map[string]string) *Settings {
+		return NewSettings(func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}, func(path string) ([]byte, error) { return []byte("token-from-" + path), nil })
+	}
+
+	require.Empty(t, configuration.TokenProblems(configYAML, settings(map[string]string{
+		"GITHUB_API_TOKEN":       "github-token",
+		"TRACKER_API_TOKEN_FILE": "/run/secrets/tracker-token",
+	})))
+	require.Empty(t, (&Config{}).TokenProblems(nil, settings(nil)), "there are no bindings which need the tokens")
+
+	problems := configuration.TokenProblems(configYAML, settings(map[string]string{"GITHUB_API_TOKEN": "github-token"}))
+	require.Len(t, problems, 2)
+	require.Equal(t, `line 4: bindings[0]: binding "web" can't be synced without the API tokens: secret not set: `+
+		`set the environment variable TRACKER_API_TOKEN, or TRACKER_API_TOKEN_FILE to the path of a file containing it`,
+		problems[0].String())
+	require.Equal(t, 5, problems[1].Line)
+	require.Equal(t, "bindings[1]", problems[1].Key)
+
+	problems = configuration.TokenProblems(configYAML, settings(map[string]string{
+		"GITHUB_API_TOKEN": "github-token", "GITHUB_API_TOKEN_FILE": "/run/secrets/github-token",
+	}))
+	require.Len(t, problems, 4)
+	require.Equal(t, `binding "web" can't be synced without the API tokens: only one of the environment variables `+
+		`GITHUB_API_TOKEN and GITHUB_API_TOKEN_FILE may be set`, problems[0].Message)
+}
@@ -2,14 +2,20 @@ package githubapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"reflect"
+	"time"
 
 	"github.com/google/go-github/v33/github"
 	"github.com/google/go-querystring/query"
 	"issues2stories/internal/importtypes"
+	"issues2stories/internal/tracing"
 )
 
 // A simplified interface of the bigger github.Client API.
@@ -23,28 +29,85 @@ type GitHubAPI interface {
 
 	// List all open issues in a custom format. Internally reads all pages of GitHub's paginated results.
 	ListAllOpenIssuesForRepoInImportFormat(ctx context.Context) ([]importtypes.Issue, error)
+
+	// Returns an error unless the API token is valid and can read the repository.
+	CheckRepoAccess(ctx context.Context) error
+
+	// Returns the logins of the users who show the email address on their GitHub profile.
+	// GitHub only allows verified email addresses to be shown on profiles.
+	FindUsersByEmail(ctx context.Context, email string) ([]string, error)
+
+	// List the authors of up to maxCommits of the repository's most recent commits, newest first.
+	// Internally reads as many pages of GitHub's paginated results as needed.
+	ListCommitAuthors(ctx context.Context, maxCommits int) ([]CommitAuthor, error)
+
+	// Returns the login of the GitHub user whose API token is used, e.g. to recognize the app's own changes.
+	GetAuthenticatedUser(ctx context.Context) (string, error)
+
+	// Add a comment to the issue and return the comment's ID. The body is Markdown.
+	CreateComment(ctx context.Context, issueNumber int, body string) (commentID int64, err error)
+
+	// Replace the body of an issue comment. The body is Markdown.
+	EditComment(ctx context.Context, commentID int64, body string) error
+
+	// Download a file which an issue links to, e.g. an image which was pasted into the issue's body. Returns
+	// ErrAttachmentTooLarge, without downloading the rest of the file, when it is larger than maxBytes.
+	DownloadAttachment(ctx context.Context, fileURL string, maxBytes int64) (*Attachment, error)
+}
+
+// A file which was downloaded from GitHub.
+type Attachment struct {
+	// The Content-Type which GitHub serves the file with, e.g. "image/png".
+	ContentType string
+	Content     []byte
+}
+
+// ErrAttachmentTooLarge is returned when a file is larger than allowed.
+var ErrAttachmentTooLarge = errors.New("the file is larger than allowed")
+
+// The author of a commit, as recorded in the commit, and the GitHub user which GitHub linked it to, if any.
+type CommitAuthor struct {
+	// Empty when the commit's email address is not a verified email address of any GitHub user.
+	Login string
+
+	Name  string
+	Email string
 }
 
 // A simplified version of the bigger github.Issue type.
 type Issue struct {
-	Labels []string
+	Labels    []string `json:"labels"`
+	Assignees []string `json:"assignees"`
+	Body      string   `json:"body"`
 }
 
 type gitHubClient struct {
 	org, repo string
 	client    *github.Client
+
+	// Downloads files without the API token, which is only added to the requests to github.com.
+	token     string
+	downloads *http.Client
 }
 
 func New(apiToken, org, repo string) GitHubAPI {
 	token := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: apiToken})
-	tokenClient := oauth2.NewClient(context.Background(), token)
-	return &gitHubClient{org: org, repo: repo, client: github.NewClient(tokenClient)}
+	// Propagate the trace context of each call to GitHub.
+	baseClient := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+	tokenClient := oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, baseClient), token)
+	return &gitHubClient{org: org, repo: repo, client: github.NewClient(tokenClient), token: apiToken, downloads: baseClient}
 }
 
 // Thin wrapper around github.IssuesService's GetIssue() to only return what we need.
 func (c *gitHubClient) GetIssue(ctx context.Context, issueNumber int) (*Issue, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.GetIssue", tracing.SpanKindClient, "github.issue", issueNumber)
+	defer span.End()
+
 	// See https://docs.github.com/en/rest/reference/issues#get-an-issue
-	issue, _, err := c.client.Issues.Get(ctx, c.org, c.repo, issueNumber)
+	start := time.Now()
+	issue, resp, err := c.client.Issues.Get(ctx, c.org, c.repo, issueNumber)
+	observeAPICall("get_issue", start, resp)
+	span.RecordError(err)
 	if err != nil {
 		return nil, err
 	}
@@ -52,19 +115,188 @@ func (c *gitHubClient) GetIssue(ctx context.Context, issueNumber int) (*Issue, e
 	for _, label := range issue.Labels {
 		labels = append(labels, *label.Name)
 	}
-	return &Issue{Labels: labels}, nil
+	assignees := []string{}
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.GetLogin())
+	}
+	return &Issue{Labels: labels, Assignees: assignees, Body: issue.GetBody()}, nil
 }
 
 // Thin wrapper around github.IssuesService's UpdateIssue().
 func (c *gitHubClient) UpdateIssue(ctx context.Context, issueNumber int, updates *github.IssueRequest) error {
+	ctx, span := tracing.Start(ctx, "githubapi.UpdateIssue", tracing.SpanKindClient, "github.issue", issueNumber)
+	defer span.End()
+
 	// See https://docs.github.com/en/rest/reference/issues#update-an-issue
-	_, _, err := c.client.Issues.Edit(ctx, c.org, c.repo, issueNumber, updates)
+	start := time.Now()
+	_, resp, err := c.client.Issues.Edit(ctx, c.org, c.repo, issueNumber, updates)
+	observeAPICall("update_issue", start, resp)
+	span.RecordError(err)
 	return err
 }
 
+// Thin wrapper around github.IssuesService's CreateComment().
+func (c *gitHubClient) CreateComment(ctx context.Context, issueNumber int, body string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.CreateComment", tracing.SpanKindClient, "github.issue", issueNumber)
+	defer span.End()
+
+	// See https://docs.github.com/en/rest/reference/issues#create-an-issue-comment
+	start := time.Now()
+	comment, resp, err := c.client.Issues.CreateComment(ctx, c.org, c.repo, issueNumber, &github.IssueComment{Body: &body})
+	observeAPICall("create_comment", start, resp)
+	span.RecordError(err)
+	if err != nil {
+		return 0, err
+	}
+	return comment.GetID(), nil
+}
+
+// Thin wrapper around github.IssuesService's EditComment().
+func (c *gitHubClient) EditComment(ctx context.Context, commentID int64, body string) error {
+	ctx, span := tracing.Start(ctx, "githubapi.EditComment", tracing.SpanKindClient, "github.comment", commentID)
+	defer span.End()
+
+	// See https://docs.github.com/en/rest/reference/issues#update-an-issue-comment
+	start := time.Now()
+	_, resp, err := c.client.Issues.EditComment(ctx, c.org, c.repo, commentID, &github.IssueComment{Body: &body})
+	observeAPICall("edit_comment", start, resp)
+	span.RecordError(err)
+	return err
+}
+
+func (c *gitHubClient) DownloadAttachment(ctx context.Context, fileURL string, maxBytes int64) (*Attachment, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.DownloadAttachment", tracing.SpanKindClient)
+	defer span.End()
+
+	attachment, err := c.downloadAttachment(ctx, fileURL, maxBytes)
+	span.RecordError(err)
+	return attachment, err
+}
+
+func (c *gitHubClient) downloadAttachment(ctx context.Context, fileURL string, maxBytes int64) (*Attachment, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The files of private repositories are only served to users who can read the repository. github.com redirects
+	// to where the file is stored, and the token is not sent to the other host.
+	if req.URL.Host == "github.com" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+	start := time.Now()
+	res, err := c.downloads.Do(req)
+	if err != nil {
+		observeAPICall("download_attachment", start, nil)
+		return nil, err
+	}
+	defer res.Body.Close()
+	observeAPICall("download_attachment", start, &github.Response{Response: res})
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub at %s returned status %d", fileURL, res.StatusCode)
+	}
+	if res.ContentLength > maxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("GitHub at %s returned body which cannot be read: %v", fileURL, err)
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	return &Attachment{ContentType: res.Header.Get("Content-Type"), Content: content}, nil
+}
+
+// Thin wrapper around github.RepositoriesService's Get().
+func (c *gitHubClient) CheckRepoAccess(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "githubapi.CheckRepoAccess", tracing.SpanKindClient)
+	defer span.End()
+
+	// See https://docs.github.com/en/rest/reference/repos#get-a-repository
+	start := time.Now()
+	_, resp, err := c.client.Repositories.Get(ctx, c.org, c.repo)
+	observeAPICall("get_repo", start, resp)
+	span.RecordError(err)
+	return err
+}
+
+// Thin wrapper around github.SearchService's Users().
+func (c *gitHubClient) FindUsersByEmail(ctx context.Context, email string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.FindUsersByEmail", tracing.SpanKindClient)
+	defer span.End()
+
+	// See https://docs.github.com/en/rest/reference/search#search-users
+	start := time.Now()
+	result, resp, err := c.client.Search.Users(ctx, fmt.Sprintf("%q in:email", email), nil)
+	observeAPICall("search_users", start, resp)
+	span.RecordError(err)
+	if err != nil {
+		return nil, err
+	}
+	logins := []string{}
+	for _, user := range result.Users {
+		logins = append(logins, user.GetLogin())
+	}
+	return logins, nil
+}
+
+// Thin wrapper around github.UsersService's Get().
+func (c *gitHubClient) GetAuthenticatedUser(ctx context.Context) (string, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.GetAuthenticatedUser", tracing.SpanKindClient)
+	defer span.End()
+
+	// See https://docs.github.com/en/rest/reference/users#get-the-authenticated-user
+	start := time.Now()
+	user, resp, err := c.client.Users.Get(ctx, "")
+	observeAPICall("get_user", start, resp)
+	span.RecordError(err)
+	if err != nil {
+		return "", err
+	}
+	return user.GetLogin(), nil
+}
+
+func (c *gitHubClient) ListCommitAuthors(ctx context.Context, maxCommits int) ([]CommitAuthor, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.ListCommitAuthors", tracing.SpanKindClient)
+	defer span.End()
+
+	// See https://docs.github.com/en/rest/reference/repos#list-commits
+	opt := &github.CommitsListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	var authors []CommitAuthor
+	for len(authors) < maxCommits {
+		start := time.Now()
+		commits, resp, err := c.client.Repositories.ListCommits(ctx, c.org, c.repo, opt)
+		observeAPICall("list_commits", start, resp)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		for _, commit := range commits {
+			if len(authors) == maxCommits {
+				break
+			}
+			authors = append(authors, CommitAuthor{
+				Login: commit.GetAuthor().GetLogin(),
+				Name:  commit.GetCommit().GetAuthor().GetName(),
+				Email: commit.GetCommit().GetAuthor().GetEmail(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	span.SetAttributes("github.commit_count", len(authors))
+	return authors, nil
+}
+
 // List all open issues in the repository.
 // Follow the GitHub API pagination until the end to read all results, and return a custom format tailored to our needs.
 func (c *gitHubClient) ListAllOpenIssuesForRepoInImportFormat(ctx context.Context) ([]importtypes.Issue, error) {
+	ctx, span := tracing.Start(ctx, "githubapi.ListAllOpenIssuesForRepoInImportFormat", tracing.SpanKindClient)
+	defer span.End()
+
 	// See https://docs.github.com/en/rest/reference/issues#list-repository-issues
 	opt := &github.IssueListByRepoOptions{
 		State:       "open",
@@ -76,6 +308,7 @@ func (c *gitHubClient) ListAllOpenIssuesForRepoInImportFormat(ctx context.Contex
 	for {
 		pageOfIssues, resp, err := c.getOnePageOfListAllIssuesForRepo(ctx, opt)
 		if err != nil {
+			span.RecordError(err)
 			return nil, err
 		}
 		allIssues = append(allIssues, pageOfIssues...)
@@ -84,6 +317,7 @@ func (c *gitHubClient) ListAllOpenIssuesForRepoInImportFormat(ctx context.Contex
 		}
 		opt.Page = resp.NextPage
 	}
+	span.SetAttributes("github.issue_count", len(allIssues))
 	return allIssues, nil
 }
 
@@ -104,7 +338,9 @@ func (c *gitHubClient) getOnePageOfListAllIssuesForRepo(ctx context.Context, opt
 	}
 
 	var issues []importtypes.Issue
+	start := time.Now()
 	resp, err := c.client.Do(ctx, req, &issues)
+	observeAPICall("list_issues", start, resp)
 	if err != nil {
 		return nil, resp, err
 	}
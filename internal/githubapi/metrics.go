@@ -0,0 +1,38 @@
+package githubapi
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"issues2stories/internal/metrics"
+)
+
+var (
+	apiRequests = metrics.NewCounterVec(
+		"issues2stories_github_api_requests_total",
+		"GitHub API requests, by operation and HTTP status code. The status is \"error\" when there was no response.",
+		"operation", "status")
+
+	apiRequestDuration = metrics.NewHistogramVec(
+		"issues2stories_github_api_request_duration_seconds",
+		"GitHub API request latency, by operation.",
+		metrics.DefaultBuckets,
+		"operation")
+
+	rateLimitRemaining = metrics.NewGaugeVec(
+		"issues2stories_github_api_rate_limit_remaining",
+		"The number of GitHub API requests remaining in the current rate limit window, as of the most recent response.")
+)
+
+func observeAPICall(operation string, start time.Time, resp *github.Response) {
+	apiRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	status := "error"
+	if resp != nil && resp.Response != nil {
+		status = strconv.Itoa(resp.StatusCode)
+		if resp.Rate.Limit > 0 {
+			rateLimitRemaining.WithLabelValues().Set(float64(resp.Rate.Remaining))
+		}
+	}
+	apiRequests.WithLabelValues(operation, status).Inc()
+}
@@ -0,0 +1,560 @@
+package githubwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/guard"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/tracing"
+	"issues2stories/internal/trackeractivity"
+	"issues2stories/internal/trackerapi"
+	"issues2stories/internal/translate"
+)
+
+type handler struct {
+	trackerAPI   trackerapi.TrackerAPI
+	gitHubClient githubapi.GitHubAPI
+
+	// The repository whose events are handled, e.g. "vmware-tanzu/pinniped".
+	repository string
+
+	// The configuration can be reloaded, so it is read once per event.
+	configuration config.Provider
+	credentials   config.Authenticator
+
+	// Optional.
+	users        UserResolver
+	recentWrites *loopguard.RecentWrites
+
+	// The login of the app's own GitHub user, once it has been found.
+	mu    sync.Mutex
+	login string
+}
+
+// A UserResolver finds the GitHub users of Tracker users, and the Tracker users of GitHub users, who are not in the
+// configured user ID mapping.
+type UserResolver interface {
+	GitHubUsername(ctx context.Context, settings config.UserResolver, trackerProjectID, trackerUserID int64) (string, error)
+	TrackerUserID(ctx context.Context, settings config.UserResolver, trackerProjectID int64, gitHubUsername string) (int64, error)
+}
+
+// The users resolver may be nil, in which case only the configured user ID mapping is used. The recent writes may
+// be nil, in which case only the app's own GitHub user is used to recognize the app's own changes.
+func NewHandler(trackerAPI trackerapi.TrackerAPI, gitHubClient githubapi.GitHubAPI, gitHubOrg, gitHubRepo string, configuration config.Provider, credentials config.Authenticator, users UserResolver, recentWrites *loopguard.RecentWrites) http.Handler {
+	return &handler{
+		trackerAPI:    trackerAPI,
+		gitHubClient:  gitHubClient,
+		repository:    gitHubOrg + "/" + gitHubRepo,
+		configuration: configuration,
+		credentials:   credentials,
+		users:         users,
+		recentWrites:  recentWrites,
+	}
+}
+
+// This endpoint receives GitHub's repository webhook events, and updates the Tracker stories which are linked to
+// the issues in the events. See https://docs.github.com/en/developers/webhooks-and-events/webhooks
+func (h *handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := logging.FromContext(request.Context())
+
+	if request.Method != "POST" {
+		msg := fmt.Sprintf("Request method is not supported: %s", request.Method)
+		logger.Warn(msg)
+		webhookEvents.WithLabelValues(unknownEvent, "", "method_not_allowed").Inc()
+		http.Error(responseWriter, msg, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Checking the signature reads the body, so a body which is too large is found here.
+	credentialLabel, err := h.credentials.Authenticate(request)
+	if errors.Is(err, guard.ErrRequestBodyTooLarge) {
+		logger.Warn("Request body is too large")
+		webhookEvents.WithLabelValues(unknownEvent, "", "body_too_large").Inc()
+		http.Error(responseWriter, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		logger.Warn("Rejecting request due to bad signature.", "error", err)
+		webhookEvents.WithLabelValues(unknownEvent, "", "unauthorized").Inc()
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	event := request.Header.Get("X-GitHub-Event")
+	logger = logger.With("credential_label", credentialLabel, "github_event", event,
+		"github_delivery", request.Header.Get("X-GitHub-Delivery"))
+
+	contentType := request.Header.Get("Content-Type")
+	if contentType != "application/json" {
+		msg := fmt.Sprintf("Request had wrong Content-Type: %s", contentType)
+		logger.Warn(msg)
+		webhookEvents.WithLabelValues(unknownEvent, "", "unsupported_media_type").Inc()
+		http.Error(responseWriter, msg, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		logger.Error("Error reading request body", "error", err)
+		webhookEvents.WithLabelValues(unknownEvent, "", "bad_request").Inc()
+		http.Error(responseWriter, "can't read body", http.StatusBadRequest)
+		return
+	}
+	logger.Debug("Request body", "body", string(body))
+
+	if event != "issues" {
+		// e.g. the "ping" event which GitHub sends when the webhook is created.
+		logger.Info("Ignoring event")
+		webhookEvents.WithLabelValues(event, "", "ignored").Inc()
+		return
+	}
+
+	var issuesEvent IssuesEvent
+	err = json.Unmarshal(body, &issuesEvent)
+	if err != nil {
+		logger.Warn("Error parsing request body", "error", err)
+		webhookEvents.WithLabelValues(event, "", "bad_request").Inc()
+		http.Error(responseWriter, "can't parse json body", http.StatusBadRequest)
+		return
+	}
+
+	logger = logger.With("action", issuesEvent.Action, "issue", issuesEvent.Issue.Number, "sender", issuesEvent.Sender.Login)
+	logger.Info("Saw event")
+
+	if !strings.EqualFold(issuesEvent.Repository.FullName, h.repository) {
+		logger.Warn("Ignoring event from another repository", "repository", issuesEvent.Repository.FullName)
+		webhookEvents.WithLabelValues(event, issuesEvent.Action, "ignored").Inc()
+		return
+	}
+
+	// The outcome is "error" when updating any of the linked stories failed.
+	outcome := "ok"
+	defer func() { webhookEvents.WithLabelValues(event, issuesEvent.Action, outcome).Inc() }()
+
+	configuration := h.configuration.Current()
+	if reason := skipReason(configuration, &issuesEvent, h.resolvingUsers(configuration)); reason != "" {
+		logger.Info("Skipping event: " + reason)
+		outcome = "ignored"
+		return
+	}
+	if len(configuration.Bindings) == 0 {
+		logger.Warn("Skipping event: no bindings are configured, so the issue's Tracker project is unknown")
+		outcome = "ignored"
+		return
+	}
+	// The app's own changes to issues, e.g. closing an issue when its story is accepted, must not be synced back
+	// to the story, or each change could bounce between Tracker and GitHub. Unless the app's GitHub user is
+	// configured to be used only by the app, its own changes are recognized by the recent writes alone.
+	if configuration.LoopGuard.SuppressOwnGitHubUser {
+		if appLogin := h.appLogin(request.Context(), logger); appLogin != "" && strings.EqualFold(issuesEvent.Sender.Login, appLogin) {
+			logger.Info("Suppressing event: it was sent by the app's own GitHub user")
+			loopguard.Suppressed(loopguard.SourceGitHub, loopguard.ReasonOwnUser)
+			outcome = "suppressed"
+			return
+		}
+	}
+	// The app's user might not be known, or the change might have been made with another token, so the change is
+	// also compared with the app's recent updates to the issue.
+	if h.recentWrites.Consume(issuesEventFingerprint(&issuesEvent)) {
+		logger.Info("Suppressing event: it matches a recent update which the app made to the issue")
+		loopguard.Suppressed(loopguard.SourceGitHub, loopguard.ReasonRecentWrite)
+		outcome = "suppressed"
+		return
+	}
+	for _, binding := range configuration.Bindings {
+		if !h.syncStories(request.Context(), logger, responseWriter, configuration, binding.TrackerProjectID, &issuesEvent) {
+			outcome = "error"
+		}
+	}
+}
+
+// Returns why the issue event should not be synced with the current configuration, or an empty string when it
+// should be.
+func skipReason(configuration *config.Config, issuesEvent *IssuesEvent, resolvingUsers bool) string {
+	policies := configuration.GitHubSync.WithDefaults()
+	labels := trackeractivity.LabelMappingsWithDefaults(configuration.Labels)
+	action := issuesEvent.Action
+	switch {
+	case action == "labeled" || action == "unlabeled":
+		if issuesEvent.Label == nil ||
+			(!isMappedLabel(labels.Types, issuesEvent.Label.Name) && !isMappedLabel(labels.Estimates, issuesEvent.Label.Name)) {
+			return "the label is not mapped to a story type or estimate"
+		}
+	case action == "edited":
+		if !configuration.TaskSync.Enabled {
+			return "task_sync is not enabled"
+		}
+		if issuesEvent.Changes == nil || issuesEvent.Changes.Body == nil {
+			return "the issue body did not change"
+		}
+	case action != "assigned" && action != "unassigned" && action != "closed" && action != "reopened":
+		return "the action is not synced"
+	case (action == "assigned" || action == "unassigned") && configuration.UserIDMapping == nil && !resolvingUsers:
+		return "neither tracker_id_to_github_username_mapping nor user_resolver is configured"
+	case action == "closed" && policies.OnClose == config.GitHubSyncNone:
+		return "github_sync.on_close is none"
+	case action == "reopened" && policies.OnReopen == config.GitHubSyncNone:
+		return "github_sync.on_reopen is none"
+	}
+	return ""
+}
+
+func (h *handler) resolvingUsers(configuration *config.Config) bool {
+	return configuration.UserResolver.Enabled && h.users != nil
+}
+
+// Returns the configured user ID mapping, plus the users which the resolver found for the story owners and the issue
+// assignees who are not in it. Users who can't be resolved, e.g. because an API call failed, are left out, so that
+// owners are kept as when they are not mapped.
+func (h *handler) resolveUsers(ctx context.Context, logger *logging.Logger, configuration *config.Config, projectID int64,
+	ownerIDs []int64, assignees []string) map[int64]string {
+	userIDMapping := make(map[int64]string, len(configuration.UserIDMapping)+len(ownerIDs)+len(assignees))
+	mappedUsernames := map[string]bool{}
+	for trackerID, username := range configuration.UserIDMapping {
+		userIDMapping[trackerID] = username
+		mappedUsernames[strings.ToLower(username)] = true
+	}
+	for _, ownerID := range ownerIDs {
+		if _, ok := userIDMapping[ownerID]; ok {
+			continue
+		}
+		username, err := h.users.GitHubUsername(ctx, configuration.UserResolver, projectID, ownerID)
+		if err != nil {
+			logger.Warn("Could not look up the GitHub user of a story owner", "tracker_user_id", ownerID, "error", err)
+			continue
+		}
+		if username != "" {
+			userIDMapping[ownerID] = username
+			mappedUsernames[strings.ToLower(username)] = true
+		}
+	}
+	for _, assignee := range assignees {
+		if mappedUsernames[strings.ToLower(assignee)] {
+			continue
+		}
+		trackerID, err := h.users.TrackerUserID(ctx, configuration.UserResolver, projectID, assignee)
+		if err != nil {
+			logger.Warn("Could not look up the Tracker user of an issue assignee", "github_username", assignee, "error", err)
+			continue
+		}
+		if _, ok := userIDMapping[trackerID]; !ok && trackerID != 0 {
+			userIDMapping[trackerID] = assignee
+			mappedUsernames[strings.ToLower(assignee)] = true
+		}
+	}
+	return userIDMapping
+}
+
+// Returns the login of the GitHub user whose API token the app uses, or an empty string when it can't be found.
+// Once found, it is remembered for later events.
+func (h *handler) appLogin(ctx context.Context, logger *logging.Logger) string {
+	h.mu.Lock()
+	login := h.login
+	h.mu.Unlock()
+	if login != "" {
+		return login
+	}
+
+	// Concurrent events may each look the user up, but the lock is not held during the API call, so they don't
+	// wait for each other. The first one to find the user wins.
+	login, err := h.gitHubClient.GetAuthenticatedUser(ctx)
+	if err != nil {
+		logger.Warn("Could not find the app's GitHub user, so can't recognize the app's own changes", "error", err)
+		return ""
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.login == "" {
+		h.login = login
+	}
+	return h.login
+}
+
+// Update the stories in the Tracker project which are linked to the issue, as planned for the event's action.
+// Returns false when the stories could not be updated, in which case an error has already been written to the
+// response.
+func (h *handler) syncStories(ctx context.Context, logger *logging.Logger, responseWriter http.ResponseWriter,
+	configuration *config.Config, projectID int64, issuesEvent *IssuesEvent) bool {
+	ctx, span := tracing.Start(ctx, "process issue event", tracing.SpanKindInternal,
+		"tracker.project", projectID,
+		"github.issue", issuesEvent.Issue.Number,
+		"github.action", issuesEvent.Action)
+	defer span.End()
+
+	logger = logger.With("project", projectID)
+	stories, err := h.trackerAPI.FindStoriesLinkedToGitHubIssue(ctx, projectID, issuesEvent.Issue.Number)
+	if err != nil {
+		logger.Error("Error calling Tracker API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't find the Tracker stories linked to the GitHub issue", http.StatusBadGateway)
+		return false
+	}
+	if len(stories) == 0 {
+		logger.Info("Issue is not linked to a story in the Tracker project")
+		return true
+	}
+	if issuesEvent.Action == "edited" {
+		// Each task list item is marked with the ID of one task, so the task list can only be synced with one story.
+		if len(stories) > 1 {
+			logger.Warn("Issue is linked to more than one story in the Tracker project, so not syncing its task list",
+				"stories", len(stories))
+			return true
+		}
+		return h.syncTasks(ctx, logger.With("story", stories[0].ID), responseWriter, configuration, projectID, issuesEvent, stories[0].ID)
+	}
+
+	for _, story := range stories {
+		logger := logger.With("story", story.ID)
+		change, err := h.planStoryChange(ctx, logger, configuration, projectID, issuesEvent, story)
+		if err != nil {
+			logger.Error("Error calling Tracker API", "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't get the Tracker project's point scale", http.StatusBadGateway)
+			return false
+		}
+		if change.isEmpty() {
+			logger.Info("No updates planned. Skipping Tracker API call for story")
+			continue
+		}
+		if change.comment != "" {
+			change.comment = h.translateToTracker(ctx, logger, configuration, projectID, change.comment)
+		}
+		if configuration.IsDryRun(projectID) {
+			if change.update != (trackerapi.StoryUpdate{}) &&
+				!writeDryRunPlan(logger, span, responseWriter, "Tracker API call to update story",
+					fmt.Sprintf("update for story #%d", story.ID), change.update) {
+				return false
+			}
+			if change.comment != "" {
+				writeDryRunPlan(logger, span, responseWriter, "Tracker API call to comment on story",
+					fmt.Sprintf("comment on story #%d", story.ID), change.comment)
+			}
+			continue
+		}
+		if change.update != (trackerapi.StoryUpdate{}) {
+			logger.Info("Calling Tracker API to update story")
+			err := h.recentWrites.Write(func() error {
+				return h.trackerAPI.UpdateStory(ctx, projectID, story.ID, &change.update)
+			}, storyUpdateFingerprints(story.ID, &change.update)...)
+			if err != nil {
+				logger.Error("Error calling Tracker API", "error", err)
+				span.RecordError(err)
+				http.Error(responseWriter, "can't update Tracker story via Tracker API", http.StatusBadGateway)
+				return false
+			}
+		}
+		if change.comment != "" {
+			logger.Info("Calling Tracker API to comment on story")
+			if err := h.trackerAPI.AddComment(ctx, projectID, story.ID, change.comment); err != nil {
+				logger.Error("Error calling Tracker API", "error", err)
+				span.RecordError(err)
+				http.Error(responseWriter, "can't comment on Tracker story via Tracker API", http.StatusBadGateway)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Report a planned Tracker API call of a dry run instead of making it, both in the log and in the response. A plan
+// which isn't a string is written as JSON, and a nil plan is left out. Returns false when the plan can't be
+// serialized, after responding with an error.
+func writeDryRunPlan(logger *logging.Logger, span *tracing.Span, responseWriter http.ResponseWriter, skipped, planned string, plan interface{}) bool {
+	if plan == nil {
+		logger.Info("Dry run: skipping " + skipped)
+		fmt.Fprintf(responseWriter, "dry run: planned %s\n", planned)
+		return true
+	}
+	text, ok := plan.(string)
+	if !ok {
+		serialized, err := json.Marshal(plan)
+		if err != nil {
+			logger.Error("Error serializing planned "+planned, "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't serialize planned "+planned, http.StatusInternalServerError)
+			return false
+		}
+		text = string(serialized)
+	}
+	logger.Info("Dry run: skipping "+skipped, "plan", text)
+	fmt.Fprintf(responseWriter, "dry run: planned %s: %s\n", planned, text)
+	return true
+}
+
+// Returns the GitHub text translated for the Tracker project, so that its mentions and issue references make sense
+// in Tracker.
+func (h *handler) translateToTracker(ctx context.Context, logger *logging.Logger, configuration *config.Config, projectID int64, text string) string {
+	translator, err := translate.ForProjects(ctx, h.trackerAPI, configuration.UserIDMapping,
+		"https://github.com/"+h.repository, []int64{projectID}, text)
+	if err != nil {
+		logger.Warn("Could not list the Tracker project's members, so mentions won't be translated", "error", err)
+	}
+	return translator.ToTracker(text)
+}
+
+// The changes to make to one linked story. Either part may be empty.
+type storyChange struct {
+	update  trackerapi.StoryUpdate
+	comment string
+}
+
+func (c storyChange) isEmpty() bool {
+	return c.update == (trackerapi.StoryUpdate{}) && c.comment == ""
+}
+
+// Returns the changes to make to the story for the issue event, according to the configured policies. Returns an
+// error when the project's point scale was needed but could not be read.
+func (h *handler) planStoryChange(ctx context.Context, logger *logging.Logger, configuration *config.Config, projectID int64,
+	issuesEvent *IssuesEvent, story trackerapi.Story) (storyChange, error) {
+	policies := configuration.GitHubSync.WithDefaults()
+	var change storyChange
+	switch issuesEvent.Action {
+	case "assigned", "unassigned":
+		assignees := make([]string, 0, len(issuesEvent.Issue.Assignees))
+		for _, assignee := range issuesEvent.Issue.Assignees {
+			assignees = append(assignees, assignee.Login)
+		}
+		userIDMapping := configuration.UserIDMapping
+		if h.resolvingUsers(configuration) {
+			userIDMapping = h.resolveUsers(ctx, logger, configuration, projectID, story.OwnerIDs, assignees)
+		}
+		newOwners, unmapped := ownersForAssignees(story.OwnerIDs, assignees, userIDMapping)
+		if len(unmapped) > 0 {
+			logger.Info("Some issue assignees have no Tracker user ID configured", "assignees", unmapped)
+		}
+		if equalIDs(story.OwnerIDs, newOwners) {
+			logger.Info("Story owners already match the issue assignees")
+		} else {
+			logger.Info("New owners for story", "owners", newOwners)
+			change.update.OwnerIDs = &newOwners
+		}
+	case "closed":
+		switch {
+		case policies.OnClose == config.GitHubSyncComment:
+			change.comment = fmt.Sprintf("GitHub issue #%d was closed by @%s.", issuesEvent.Issue.Number, issuesEvent.Sender.Login)
+		case storyStateProgress[story.CurrentState] >= storyStateProgress[policies.OnClose]:
+			logger.Info("Story is already at or beyond the state for closed issues", "current_state", story.CurrentState,
+				"on_close", policies.OnClose)
+		default:
+			logger.Info("New state for story", "current_state", policies.OnClose)
+			change.update.CurrentState = &policies.OnClose
+		}
+	case "reopened":
+		switch {
+		case story.CurrentState != "accepted":
+			logger.Info("Story is not accepted, so reopening the issue doesn't change it", "current_state", story.CurrentState)
+		case policies.OnReopen == config.GitHubSyncComment:
+			change.comment = fmt.Sprintf("GitHub issue #%d was reopened by @%s.", issuesEvent.Issue.Number, issuesEvent.Sender.Login)
+		default:
+			logger.Info("New state for story", "current_state", policies.OnReopen)
+			change.update.CurrentState = &policies.OnReopen
+		}
+	case "labeled", "unlabeled":
+		labels := trackeractivity.LabelMappingsWithDefaults(configuration.Labels)
+		issueLabels := make([]string, 0, len(issuesEvent.Issue.Labels))
+		for _, label := range issuesEvent.Issue.Labels {
+			issueLabels = append(issueLabels, label.Name)
+		}
+		changedLabel := issuesEvent.Label.Name
+		if isMappedLabel(labels.Types, changedLabel) {
+			change.update.StoryType = planStoryType(logger, labels.Types, issueLabels, changedLabel, issuesEvent.Action, story)
+		}
+		if isMappedLabel(labels.Estimates, changedLabel) {
+			var err error
+			change.update.Estimate, change.update.Unestimate, err = h.planEstimate(ctx, logger, labels.Estimates, issueLabels,
+				changedLabel, issuesEvent.Action, projectID, story)
+			if err != nil {
+				return change, err
+			}
+		}
+	}
+	return change, nil
+}
+
+// Returns the story type which the issue's labels map to after the label was added or removed, or nil when the
+// story's type should not change.
+func planStoryType(logger *logging.Logger, types map[string][]string, issueLabels []string, changedLabel, action string,
+	story trackerapi.Story) *string {
+	var candidates []string
+	if action == "labeled" {
+		candidates = keysForLabels(types, issueLabels, changedLabel)
+	} else {
+		if !containsLabel(types[story.StoryType], changedLabel) {
+			logger.Info("The removed label is not a label of the story's type", "story_type", story.StoryType)
+			return nil
+		}
+		// A story always has a type, so it only changes when the remaining labels are those of another type.
+		candidates = keysForLabels(types, issueLabels, "")
+	}
+	switch {
+	case len(candidates) == 0:
+		logger.Info("The issue's labels don't match any story type")
+	case len(candidates) > 1:
+		logger.Info("The issue's labels match more than one story type, so leaving the story type unchanged",
+			"story_types", candidates)
+	case candidates[0] == story.StoryType:
+		logger.Info("Story type already matches the issue's labels", "story_type", story.StoryType)
+	default:
+		logger.Info("New type for story", "story_type", candidates[0])
+		return &candidates[0]
+	}
+	return nil
+}
+
+// Returns the estimate which the issue's labels map to after the label was added or removed, or true when the
+// story's estimate should be removed, or neither when it should not change. Labels which map to more than one
+// estimate, e.g. "estimate/L" for 3 and 4 points, are resolved using the project's point scale.
+func (h *handler) planEstimate(ctx context.Context, logger *logging.Logger, estimates map[string][]string,
+	issueLabels []string, changedLabel, action string, projectID int64, story trackerapi.Story) (*float64, bool, error) {
+	currentEstimate := ""
+	if story.Estimate != nil {
+		currentEstimate = strconv.FormatFloat(*story.Estimate, 'f', -1, 64)
+	}
+	var candidates []string
+	if action == "labeled" {
+		candidates = keysForLabels(estimates, issueLabels, changedLabel)
+	} else {
+		if currentEstimate == "" || !containsLabel(estimates[currentEstimate], changedLabel) {
+			logger.Info("The removed label is not a label of the story's estimate", "estimate", currentEstimate)
+			return nil, false, nil
+		}
+		candidates = keysForLabels(estimates, issueLabels, "")
+	}
+	if len(candidates) > 1 {
+		project, err := h.trackerAPI.GetProject(ctx, projectID)
+		if err != nil {
+			return nil, false, err
+		}
+		candidates = estimatesInPointScale(candidates, project.PointScale)
+		logger.Info("Resolved the issue's estimate labels using the project's point scale",
+			"point_scale", project.PointScale, "estimates", candidates)
+	}
+	switch {
+	case len(candidates) == 0 && action == "unlabeled":
+		logger.Info("The issue has no estimate labels left, so removing the story's estimate")
+		return nil, true, nil
+	case len(candidates) == 0:
+		logger.Info("The issue's labels don't match any estimate in the project's point scale")
+	case len(candidates) > 1:
+		logger.Info("The issue's labels match more than one estimate, so leaving the estimate unchanged",
+			"estimates", candidates)
+	case candidates[0] == currentEstimate:
+		logger.Info("Story estimate already matches the issue's labels", "estimate", currentEstimate)
+	default:
+		// The keys of the estimates map are validated to be numbers.
+		estimate, _ := strconv.ParseFloat(candidates[0], 64)
+		logger.Info("New estimate for story", "estimate", candidates[0])
+		return &estimate, false, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,913 @@
+package githubwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/guard"
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/trackerapi"
+)
+
+// Behaves like a body which exceeds the limit enforced by the guard package.
+type readerWhichIsTooLarge int
+
+func (readerWhichIsTooLarge) Read(_ []byte) (n int, err error) {
+	return 0, guard.ErrRequestBodyTooLarge
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile("testdata/" + name + ".json")
+	require.NoError(t, err)
+	return string(content)
+}
+
+// Only implements the methods used by the handler.
+type fakeGitHubAPI struct {
+	githubapi.GitHubAPI
+
+	loginError  error
+	updateError error
+
+	// The issue's current body.
+	issueBody string
+
+	issueUpdates []string
+}
+
+func (f *fakeGitHubAPI) GetIssue(_ context.Context, _ int) (*githubapi.Issue, error) {
+	return &githubapi.Issue{Body: f.issueBody}, nil
+}
+
+func (f *fakeGitHubAPI) GetAuthenticatedUser(_ context.Context) (string, error) {
+	if f.loginError != nil {
+		return "", f.loginError
+	}
+	return "issues2stories-bot", nil
+}
+
+func (f *fakeGitHubAPI) UpdateIssue(_ context.Context, issueNumber int, updates *github.IssueRequest) error {
+	f.issueUpdates = append(f.issueUpdates, fmt.Sprintf("#%d: %s", issueNumber, updates.GetBody()))
+	return f.updateError
+}
+
+type updateStoryCall struct {
+	ProjectID int64
+	StoryID   int64
+	Update    trackerapi.StoryUpdate
+}
+
+// Only implements the methods used by the handler.
+type fakeTrackerAPI struct {
+	trackerapi.TrackerAPI
+
+	// The linked stories by Tracker project ID.
+	stories      map[int64][]trackerapi.Story
+	findError    error
+	updateError  error
+	commentError error
+	pointScale   string
+	projectError error
+	members      []trackerapi.Person
+	membersError error
+	tasks        []trackerapi.Task
+	tasksError   error
+
+	findProjectIDs []int64
+	findIssueIDs   []int
+	updates        []updateStoryCall
+	comments       []string
+	taskChanges    []string
+}
+
+func (f *fakeTrackerAPI) FindStoriesLinkedToGitHubIssue(_ context.Context, trackerProjectID int64, githubIssueID int) ([]trackerapi.Story, error) {
+	f.findProjectIDs = append(f.findProjectIDs, trackerProjectID)
+	f.findIssueIDs = append(f.findIssueIDs, githubIssueID)
+	return f.stories[trackerProjectID], f.findError
+}
+
+func (f *fakeTrackerAPI) UpdateStory(_ context.Context, trackerProjectID, trackerStoryID int64, update *trackerapi.StoryUpdate) error {
+	f.updates = append(f.updates, updateStoryCall{ProjectID: trackerProjectID, StoryID: trackerStoryID, Update: *update})
+	return f.updateError
+}
+
+func (f *fakeTrackerAPI) AddComment(_ context.Context, _, trackerStoryID int64, text string) error {
+	f.comments = append(f.comments, fmt.Sprintf("#%d: %s", trackerStoryID, text))
+	return f.commentError
+}
+
+func (f *fakeTrackerAPI) ListProjectMembers(_ context.Context, _ int64) ([]trackerapi.Person, error) {
+	return f.members, f.membersError
+}
+
+func (f *fakeTrackerAPI) ListTasks(_ context.Context, _, _ int64) ([]trackerapi.Task, error) {
+	return f.tasks, f.tasksError
+}
+
+func (f *fakeTrackerAPI) CreateTask(_ context.Context, _, trackerStoryID int64, task *trackerapi.TaskUpdate) (*trackerapi.Task, error) {
+	update, _ := json.Marshal(task)
+	f.taskChanges = append(f.taskChanges, fmt.Sprintf("#%d: create %s", trackerStoryID, update))
+	return &trackerapi.Task{ID: int64(3000 + len(f.taskChanges))}, nil
+}
+
+func (f *fakeTrackerAPI) UpdateTask(_ context.Context, _, trackerStoryID, trackerTaskID int64, task *trackerapi.TaskUpdate) error {
+	update, _ := json.Marshal(task)
+	f.taskChanges = append(f.taskChanges, fmt.Sprintf("#%d: update %d %s", trackerStoryID, trackerTaskID, update))
+	return nil
+}
+
+func (f *fakeTrackerAPI) DeleteTask(_ context.Context, _, trackerStoryID, trackerTaskID int64) error {
+	f.taskChanges = append(f.taskChanges, fmt.Sprintf("#%d: delete %d", trackerStoryID, trackerTaskID))
+	return nil
+}
+
+func (f *fakeTrackerAPI) GetProject(_ context.Context, trackerProjectID int64) (*trackerapi.Project, error) {
+	if f.projectError != nil {
+		return nil, f.projectError
+	}
+	return &trackerapi.Project{ID: trackerProjectID, PointScale: f.pointScale}, nil
+}
+
+// Resolves the users in its usernames, as if the usermapping.Resolver had found them.
+type fakeUserResolver struct {
+	usernames map[int64]string
+	err       error
+}
+
+func (f *fakeUserResolver) GitHubUsername(_ context.Context, _ config.UserResolver, _, trackerUserID int64) (string, error) {
+	return f.usernames[trackerUserID], f.err
+}
+
+func (f *fakeUserResolver) TrackerUserID(_ context.Context, _ config.UserResolver, _ int64, gitHubUsername string) (int64, error) {
+	for trackerUserID, username := range f.usernames {
+		if strings.EqualFold(username, gitHubUsername) {
+			return trackerUserID, f.err
+		}
+	}
+	return 0, f.err
+}
+
+func TestHandleGitHubWebhook(t *testing.T) {
+	const secret = "It's a Secret to Everybody"
+	mapping := map[int64]string{3344177: "cfryanr", 1234567: "enj", 7777777: "someone-else"}
+	binding := []config.Binding{{Name: "pinniped", TrackerProjectID: 2453999}}
+	members := []trackerapi.Person{{ID: 3344177, Name: "Ryan Richard", Initials: "RR", Username: "ryan"}}
+	story := func(ownerIDs ...int64) map[int64][]trackerapi.Story {
+		return map[int64][]trackerapi.Story{2453999: {{ID: 176651069, ExternalID: "348", OwnerIDs: ownerIDs}}}
+	}
+	storyIn := func(state string) map[int64][]trackerapi.Story {
+		return map[int64][]trackerapi.Story{2453999: {{ID: 176651069, ExternalID: "348", CurrentState: state}}}
+	}
+	moveTo := func(state string) trackerapi.StoryUpdate {
+		return trackerapi.StoryUpdate{CurrentState: &state}
+	}
+	syncing := func(onClose, onReopen string) *config.Config {
+		return &config.Config{Bindings: binding, UserIDMapping: mapping, GitHubSync: config.GitHubSync{OnClose: onClose, OnReopen: onReopen}}
+	}
+	owners := func(ownerIDs ...int64) trackerapi.StoryUpdate {
+		return trackerapi.StoryUpdate{OwnerIDs: &ownerIDs}
+	}
+	storyOfType := func(storyType string, estimate *float64) map[int64][]trackerapi.Story {
+		return map[int64][]trackerapi.Story{2453999: {{ID: 176651069, ExternalID: "348", StoryType: storyType, Estimate: estimate}}}
+	}
+	points := func(estimate float64) *float64 {
+		return &estimate
+	}
+	changeType := func(storyType string) trackerapi.StoryUpdate {
+		return trackerapi.StoryUpdate{StoryType: &storyType}
+	}
+	syncingTasks := &config.Config{Bindings: binding, TaskSync: config.TaskSync{Enabled: true}}
+	tasks := []trackerapi.Task{
+		{ID: 71234566, StoryID: 176651069, Description: "Enable audit logging", Position: 1},
+		{ID: 71234567, StoryID: 176651069, Description: "Check the logs", Position: 2},
+	}
+	markedBody := "Steps:\r\n- [x] Enable audit logging <!-- issues2stories: task 71234566 -->\r\n" +
+		"- [ ] Document it <!-- issues2stories: task 3003 -->\r\n"
+
+	tests := []struct {
+		name string
+
+		configuration *config.Config
+		stories       map[int64][]trackerapi.Story
+		findError     error
+		updateError   error
+		commentError  error
+		loginError    error
+		pointScale    string
+		projectError  error
+		membersError  error
+		tasks         []trackerapi.Task
+		tasksError    error
+		issueError    error
+		issueBody     string
+		recentWrites  []string
+		users         *fakeUserResolver
+
+		method      string
+		event       string
+		contentType string
+		bodyFixture string
+		bodyReader  io.Reader
+		signature   string
+
+		wantStatus       int
+		wantBody         string
+		wantFindProjects []int64
+		wantUpdates      []updateStoryCall
+		wantComments     []string
+		wantTaskChanges  []string
+		wantIssueUpdates []string
+
+		// The fingerprints which should be remembered, or not, after the event.
+		wantRecentWrites    []string
+		wantNotRecentWrites []string
+	}{
+		{
+			name:             "assigning a mapped user adds them to the story owners, keeping owners who aren't mapped",
+			stories:          story(7777777, 9999999),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: owners(9999999, 1234567, 3344177)},
+			},
+		},
+		{
+			name:             "unassigning everyone removes the mapped owners only",
+			stories:          story(3344177, 9999999, 1234567),
+			event:            "issues",
+			bodyFixture:      "issue_unassigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: owners(9999999)},
+			},
+		},
+		{
+			name:             "story owners which already match the assignees are not updated",
+			stories:          story(3344177, 1234567),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "issue which is not linked to a story",
+			stories:          map[int64][]trackerapi.Story{},
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name: "every binding's project is searched for linked stories",
+			configuration: &config.Config{UserIDMapping: mapping, Bindings: []config.Binding{
+				{Name: "pinniped", TrackerProjectID: 2453999},
+				{Name: "other", TrackerProjectID: 1111111},
+			}},
+			stories:          map[int64][]trackerapi.Story{1111111: {{ID: 42, ExternalID: "348"}}},
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999, 1111111},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 1111111, StoryID: 42, Update: owners(1234567, 3344177)},
+			},
+		},
+		{
+			name:             "dry run reports the planned update instead of making it",
+			configuration:    &config.Config{UserIDMapping: mapping, Bindings: binding, DryRun: true},
+			stories:          story(),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantBody:         "dry run: planned update for story #176651069: {\"owner_ids\":[1234567,3344177]}\n",
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "closing the issue moves the story forward to the configured state",
+			configuration:    syncing("finished", ""),
+			stories:          storyIn("started"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: moveTo("finished")},
+			},
+			wantRecentWrites: []string{loopguard.StoryFingerprint(176651069, "current_state", "finished")},
+		},
+		{
+			name:             "closing the issue never moves the story back",
+			configuration:    syncing("delivered", ""),
+			stories:          storyIn("accepted"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "closing the issue comments on the story",
+			configuration:    syncing("comment", ""),
+			stories:          storyIn("started"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantComments:     []string{"#176651069: GitHub issue [#348](https://github.com/vmware-tanzu/Pinniped/issues/348) was closed by @ryan."},
+		},
+		{
+			name:             "when the Tracker project's members can't be listed, the comment doesn't mention anyone in Tracker",
+			configuration:    syncing("comment", ""),
+			stories:          storyIn("started"),
+			membersError:     errors.New("Tracker is down"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantComments:     []string{"#176651069: GitHub issue [#348](https://github.com/vmware-tanzu/Pinniped/issues/348) was closed by `@cfryanr`."},
+		},
+		{
+			name:          "closing the issue is ignored by default",
+			configuration: &config.Config{Bindings: binding},
+			event:         "issues",
+			bodyFixture:   "issue_closed",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:             "reopening the issue of an accepted story moves the story to the configured state",
+			configuration:    syncing("", "rejected"),
+			stories:          storyIn("accepted"),
+			event:            "issues",
+			bodyFixture:      "issue_reopened",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: moveTo("rejected")},
+			},
+		},
+		{
+			name:             "reopening the issue of a story which isn't accepted doesn't change it",
+			configuration:    syncing("", "started"),
+			stories:          storyIn("delivered"),
+			event:            "issues",
+			bodyFixture:      "issue_reopened",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "reopening the issue comments on the story",
+			configuration:    syncing("", "comment"),
+			stories:          storyIn("accepted"),
+			event:            "issues",
+			bodyFixture:      "issue_reopened",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantComments:     []string{"#176651069: GitHub issue [#348](https://github.com/vmware-tanzu/Pinniped/issues/348) was reopened by @ryan."},
+		},
+		{
+			name: "the app's own changes to the issue are ignored when configured",
+			configuration: &config.Config{Bindings: binding, UserIDMapping: mapping, GitHubSync: config.GitHubSync{OnClose: "accepted"},
+				LoopGuard: config.LoopGuard{SuppressOwnGitHubUser: true}},
+			stories:     storyIn("delivered"),
+			event:       "issues",
+			bodyFixture: "issue_closed_by_the_app",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:             "the changes of the app's own GitHub user are synced by default",
+			configuration:    syncing("accepted", ""),
+			stories:          storyIn("delivered"),
+			event:            "issues",
+			bodyFixture:      "issue_closed_by_the_app",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: moveTo("accepted")},
+			},
+		},
+		{
+			name:          "events which match the app's recent updates to the issue are suppressed",
+			configuration: syncing("finished", ""),
+			recentWrites:  []string{loopguard.IssueFingerprint(348, "state=closed")},
+			event:         "issues",
+			bodyFixture:   "issue_closed",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:             "events which match another recent update to the issue are synced",
+			configuration:    syncing("finished", ""),
+			stories:          storyIn("started"),
+			recentWrites:     []string{loopguard.IssueFingerprint(348, "state=open")},
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: moveTo("finished")},
+			},
+		},
+		{
+			name:             "when the app's GitHub user can't be found, events are still synced",
+			configuration:    syncing("accepted", ""),
+			stories:          storyIn("delivered"),
+			loginError:       errors.New("GitHub is down"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: moveTo("accepted")},
+			},
+		},
+		{
+			name: "dry run reports the planned comment instead of adding it",
+			configuration: &config.Config{Bindings: binding, DryRun: true,
+				GitHubSync: config.GitHubSync{OnClose: "comment"}},
+			stories:          storyIn("started"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusOK,
+			wantBody:         "dry run: planned comment on story #176651069: GitHub issue [#348](https://github.com/vmware-tanzu/Pinniped/issues/348) was closed by `@cfryanr`.\n",
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "error commenting on the story",
+			configuration:    syncing("comment", ""),
+			stories:          storyIn("started"),
+			commentError:     errors.New("Tracker is down"),
+			event:            "issues",
+			bodyFixture:      "issue_closed",
+			wantStatus:       http.StatusBadGateway,
+			wantBody:         "can't comment on Tracker story via Tracker API\n",
+			wantFindProjects: []int64{2453999},
+			wantComments:     []string{"#176651069: GitHub issue [#348](https://github.com/vmware-tanzu/Pinniped/issues/348) was closed by @ryan."},
+		},
+		{
+			name:             "without a user ID mapping, the user resolver finds the owners and assignees",
+			configuration:    &config.Config{Bindings: binding, UserResolver: config.UserResolver{Enabled: true}},
+			users:            &fakeUserResolver{usernames: map[int64]string{3344177: "cfryanr", 9999999: "former-owner"}},
+			stories:          story(9999999, 5555555),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: owners(5555555, 3344177)},
+			},
+		},
+		{
+			name:             "the user resolver adds to the user ID mapping",
+			configuration:    &config.Config{Bindings: binding, UserIDMapping: map[int64]string{1234567: "enj"}, UserResolver: config.UserResolver{Enabled: true}},
+			users:            &fakeUserResolver{usernames: map[int64]string{3344177: "cfryanr", 1111111: "enj"}},
+			stories:          story(),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: owners(1234567, 3344177)},
+			},
+		},
+		{
+			name:             "owners whose users can't be resolved are kept",
+			configuration:    &config.Config{Bindings: binding, UserResolver: config.UserResolver{Enabled: true}},
+			users:            &fakeUserResolver{usernames: map[int64]string{3344177: "cfryanr"}, err: errors.New("GitHub is down")},
+			stories:          story(9999999),
+			event:            "issues",
+			bodyFixture:      "issue_unassigned",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:          "without a user ID mapping the event is ignored",
+			configuration: &config.Config{Bindings: binding},
+			event:         "issues",
+			bodyFixture:   "issue_assigned",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "without bindings the event is ignored",
+			configuration: &config.Config{UserIDMapping: mapping},
+			event:         "issues",
+			bodyFixture:   "issue_assigned",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:             "labeling the issue with a story type label changes the story type",
+			stories:          storyOfType("bug", nil),
+			event:            "issues",
+			bodyFixture:      "issue_labeled",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates:      []updateStoryCall{{ProjectID: 2453999, StoryID: 176651069, Update: changeType("feature")}},
+		},
+		{
+			name:             "story type which already matches the issue's labels is not updated",
+			stories:          storyOfType("feature", nil),
+			event:            "issues",
+			bodyFixture:      "issue_labeled",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "unlabeling the story type's label changes the story type to match the remaining labels",
+			stories:          storyOfType("feature", nil),
+			event:            "issues",
+			bodyFixture:      "issue_unlabeled",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates:      []updateStoryCall{{ProjectID: 2453999, StoryID: 176651069, Update: changeType("bug")}},
+		},
+		{
+			name:             "estimate label which maps to several estimates uses the one in a powers of 2 point scale",
+			stories:          storyOfType("bug", nil),
+			pointScale:       "0,1,2,4,8",
+			event:            "issues",
+			bodyFixture:      "issue_labeled_estimate",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: trackerapi.StoryUpdate{Estimate: points(4)}},
+			},
+		},
+		{
+			name:             "estimate label which maps to several estimates uses the one in a fibonacci point scale",
+			stories:          storyOfType("bug", points(1)),
+			pointScale:       "0,1,2,3,5,8",
+			event:            "issues",
+			bodyFixture:      "issue_labeled_estimate",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: trackerapi.StoryUpdate{Estimate: points(3)}},
+			},
+		},
+		{
+			name:             "estimate label which maps to several estimates in the point scale leaves the estimate unchanged",
+			stories:          storyOfType("bug", points(1)),
+			pointScale:       "0,1,2,3,4,5,6,7,8",
+			event:            "issues",
+			bodyFixture:      "issue_labeled_estimate",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "error getting the project's point scale",
+			stories:          storyOfType("bug", nil),
+			projectError:     errors.New("oops"),
+			event:            "issues",
+			bodyFixture:      "issue_labeled_estimate",
+			wantStatus:       http.StatusBadGateway,
+			wantBody:         "can't get the Tracker project's point scale\n",
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "unlabeling the story's estimate label removes the estimate",
+			stories:          storyOfType("bug", points(2)),
+			event:            "issues",
+			bodyFixture:      "issue_unlabeled_estimate",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: trackerapi.StoryUpdate{Unestimate: true}},
+			},
+		},
+		{
+			name:             "unlabeling an estimate label which isn't the story's estimate doesn't change it",
+			stories:          storyOfType("bug", points(3)),
+			event:            "issues",
+			bodyFixture:      "issue_unlabeled_estimate",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:        "labels which aren't mapped to a story type or estimate are ignored",
+			event:       "issues",
+			bodyFixture: "issue_labeled_unmapped",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:             "editing the issue's task list changes the story's tasks and marks the new items with their tasks",
+			configuration:    syncingTasks,
+			stories:          story(),
+			tasks:            tasks,
+			event:            "issues",
+			bodyFixture:      "issue_edited",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantTaskChanges: []string{
+				"#176651069: delete 71234567",
+				`#176651069: update 71234566 {"complete":true}`,
+				`#176651069: create {"description":"Document it","complete":false,"position":2}`,
+			},
+			wantIssueUpdates: []string{"#348: " + markedBody},
+			wantRecentWrites: []string{loopguard.IssueFingerprint(348, "body="+loopguard.Digest(markedBody))},
+		},
+		{
+			name:             "the new items are not marked with their tasks when the issue's body was edited again since the event",
+			configuration:    syncingTasks,
+			stories:          story(),
+			tasks:            tasks,
+			issueBody:        "Steps:\r\n- [x] Enable audit logging <!-- issues2stories: task 71234566 -->\r\n- [ ] Document it\r\n- [ ] Ship it\r\n",
+			event:            "issues",
+			bodyFixture:      "issue_edited",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantTaskChanges: []string{
+				"#176651069: delete 71234567",
+				`#176651069: update 71234566 {"complete":true}`,
+				`#176651069: create {"description":"Document it","complete":false,"position":2}`,
+			},
+		},
+		{
+			name:          "the mentions in the issue's task list are translated for Tracker",
+			configuration: &config.Config{UserIDMapping: mapping, Bindings: binding, TaskSync: config.TaskSync{Enabled: true}},
+			stories:       story(),
+			tasks: []trackerapi.Task{
+				{ID: 71234566, StoryID: 176651069, Description: "Enable audit logging with @ryan", Position: 1},
+				{ID: 71234567, StoryID: 176651069, Description: "Check the logs", Position: 2},
+			},
+			event:            "issues",
+			bodyFixture:      "issue_edited_with_mentions",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantTaskChanges: []string{
+				"#176651069: delete 71234567",
+				`#176651069: update 71234566 {"complete":true}`,
+				`#176651069: create {"description":"Document it, @ryan","complete":false,"position":2}`,
+			},
+			wantIssueUpdates: []string{"#348: Steps:\r\n- [x] Enable audit logging with @cfryanr <!-- issues2stories: task 71234566 -->\r\n" +
+				"- [ ] Document it, @cfryanr <!-- issues2stories: task 3003 -->\r\n"},
+		},
+		{
+			name:             "dry run reports the planned task changes instead of making them",
+			configuration:    &config.Config{Bindings: binding, TaskSync: config.TaskSync{Enabled: true}, DryRun: true},
+			stories:          story(),
+			tasks:            tasks,
+			event:            "issues",
+			bodyFixture:      "issue_edited",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+			wantBody: "dry run: planned deletion of task 71234567 of story #176651069\n" +
+				"dry run: planned update for task 71234566 of story #176651069: {\"complete\":true}\n" +
+				"dry run: planned new task for story #176651069: {\"description\":\"Document it\",\"complete\":false,\"position\":2}\n",
+		},
+		{
+			name:          "editing the issue's task list is ignored unless task sync is enabled",
+			configuration: &config.Config{Bindings: binding},
+			event:         "issues",
+			bodyFixture:   "issue_edited",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "editing the issue's title is ignored",
+			configuration: syncingTasks,
+			event:         "issues",
+			bodyFixture:   "issue_title_edited",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "the app's own edits to the issue's task list are suppressed",
+			configuration: syncingTasks,
+			recentWrites: []string{loopguard.IssueFingerprint(348, "body="+loopguard.Digest(
+				"Steps:\r\n- [x] Enable audit logging <!-- issues2stories: task 71234566 -->\r\n- [ ] Document it\r\n"))},
+			event:       "issues",
+			bodyFixture: "issue_edited",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:          "the task list of an issue which is linked to more than one story is not synced",
+			configuration: syncingTasks,
+			stories: map[int64][]trackerapi.Story{2453999: {
+				{ID: 176651069, ExternalID: "348"},
+				{ID: 176651070, ExternalID: "348"},
+			}},
+			tasks:            tasks,
+			event:            "issues",
+			bodyFixture:      "issue_edited",
+			wantStatus:       http.StatusOK,
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "error listing the story's tasks",
+			configuration:    syncingTasks,
+			stories:          story(),
+			tasksError:       errors.New("Tracker is down"),
+			event:            "issues",
+			bodyFixture:      "issue_edited",
+			wantStatus:       http.StatusBadGateway,
+			wantBody:         "can't list the story's tasks via Tracker API\n",
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "error marking the issue's task list with its tasks",
+			configuration:    syncingTasks,
+			stories:          story(),
+			tasks:            tasks,
+			issueError:       errors.New("GitHub is down"),
+			event:            "issues",
+			bodyFixture:      "issue_edited",
+			wantStatus:       http.StatusBadGateway,
+			wantBody:         "can't update GitHub issue via GitHub API\n",
+			wantFindProjects: []int64{2453999},
+			wantTaskChanges: []string{
+				"#176651069: delete 71234567",
+				`#176651069: update 71234566 {"complete":true}`,
+				`#176651069: create {"description":"Document it","complete":false,"position":2}`,
+			},
+			wantIssueUpdates:    []string{"#348: " + markedBody},
+			wantNotRecentWrites: []string{loopguard.IssueFingerprint(348, "body="+loopguard.Digest(markedBody))},
+		},
+		{
+			name:        "other issue actions are ignored",
+			event:       "issues",
+			bodyFixture: "issue_milestoned",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "the ping event is ignored",
+			event:       "ping",
+			bodyFixture: "ping",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "events from another repository are ignored",
+			event:       "issues",
+			bodyFixture: "issue_assigned_in_another_repository",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:             "error finding the linked stories",
+			findError:        errors.New("Tracker is down"),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusBadGateway,
+			wantBody:         "can't find the Tracker stories linked to the GitHub issue\n",
+			wantFindProjects: []int64{2453999},
+		},
+		{
+			name:             "error updating the story",
+			stories:          story(),
+			updateError:      errors.New("Tracker is down"),
+			event:            "issues",
+			bodyFixture:      "issue_assigned",
+			wantStatus:       http.StatusBadGateway,
+			wantBody:         "can't update Tracker story via Tracker API\n",
+			wantFindProjects: []int64{2453999},
+			wantUpdates: []updateStoryCall{
+				{ProjectID: 2453999, StoryID: 176651069, Update: owners(1234567, 3344177)},
+			},
+			wantNotRecentWrites: []string{loopguard.StoryFingerprint(176651069, "owner_ids", []int64{1234567, 3344177})},
+		},
+		{
+			name:        "bad signature",
+			event:       "issues",
+			bodyFixture: "issue_assigned",
+			signature:   "sha256=0000000000000000000000000000000000000000000000000000000000000000",
+			wantStatus:  http.StatusUnauthorized,
+			wantBody:    "Unauthorized\n",
+		},
+		{
+			name:        "missing signature",
+			event:       "issues",
+			bodyFixture: "issue_assigned",
+			signature:   "none",
+			wantStatus:  http.StatusUnauthorized,
+			wantBody:    "Unauthorized\n",
+		},
+		{
+			name:       "body too large",
+			event:      "issues",
+			bodyReader: readerWhichIsTooLarge(0),
+			signature:  "sha256=0000000000000000000000000000000000000000000000000000000000000000",
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantBody:   "request body is too large\n",
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Request method is not supported: GET\n",
+		},
+		{
+			name:        "wrong content type",
+			event:       "issues",
+			contentType: "application/x-www-form-urlencoded",
+			bodyFixture: "issue_assigned",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantBody:    "Request had wrong Content-Type: application/x-www-form-urlencoded\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trackerAPI := &fakeTrackerAPI{stories: test.stories, findError: test.findError, updateError: test.updateError,
+				commentError: test.commentError, pointScale: test.pointScale, projectError: test.projectError,
+				members: members, membersError: test.membersError, tasks: test.tasks, tasksError: test.tasksError}
+			if test.configuration == nil {
+				test.configuration = &config.Config{UserIDMapping: mapping, Bindings: binding}
+			}
+			if test.method == "" {
+				test.method = http.MethodPost
+			}
+			if test.contentType == "" {
+				test.contentType = "application/json"
+			}
+
+			recentWrites := loopguard.New(loopguard.DefaultTTL)
+			recentWrites.Remember(test.recentWrites...)
+
+			gitHubAPI := &fakeGitHubAPI{loginError: test.loginError, updateError: test.issueError}
+			var users UserResolver
+			if test.users != nil {
+				users = test.users
+			}
+			subject := NewHandler(trackerAPI, gitHubAPI, "vmware-tanzu", "Pinniped",
+				test.configuration, NewSignatureAuthenticator(secret), users, recentWrites)
+
+			body := ""
+			switch test.bodyFixture {
+			case "issue_assigned_in_another_repository":
+				body = strings.Replace(readFixture(t, "issue_assigned"), `"full_name": "vmware-tanzu/pinniped"`, `"full_name": "vmware-tanzu/other"`, 1)
+			case "issue_labeled_unmapped":
+				body = strings.Replace(readFixture(t, "issue_labeled"), `"label": {"id": 1234, "name": "enhancement"}`, `"label": {"id": 1240, "name": "priority/high"}`, 1)
+			case "issue_closed_by_the_app":
+				body = strings.Replace(readFixture(t, "issue_closed"), `"sender": {
+    "login": "cfryanr"`, `"sender": {
+    "login": "Issues2Stories-Bot"`, 1)
+			case "issue_edited_with_mentions":
+				body = strings.ReplaceAll(readFixture(t, "issue_edited"), "Enable audit logging", "Enable audit logging with @cfryanr")
+				body = strings.Replace(body, "Document it", "Document it, @cfryanr", 1)
+			case "issue_title_edited":
+				body = strings.Replace(readFixture(t, "issue_edited"), `"body": {
+      "from"`, `"title": {
+      "from"`, 1)
+			case "":
+			default:
+				body = readFixture(t, test.bodyFixture)
+			}
+			if test.issueBody != "" {
+				gitHubAPI.issueBody = test.issueBody
+			} else {
+				// The issue's body is the event's, unless the issue was edited again since.
+				var payload IssuesEvent
+				_ = json.Unmarshal([]byte(body), &payload)
+				gitHubAPI.issueBody = payload.Issue.Body
+			}
+			var requestBodyReader io.Reader = strings.NewReader(body)
+			if test.bodyReader != nil {
+				requestBodyReader = test.bodyReader
+			}
+			req := httptest.NewRequest(test.method, "/github_webhook", requestBodyReader)
+			req.Header.Set("Content-Type", test.contentType)
+			req.Header.Set("X-GitHub-Event", test.event)
+			switch test.signature {
+			case "":
+				req.Header.Set(SignatureHeader, Sign([]byte(secret), []byte(body)))
+			case "none":
+			default:
+				req.Header.Set(SignatureHeader, test.signature)
+			}
+			rsp := httptest.NewRecorder()
+
+			subject.ServeHTTP(rsp, req)
+
+			require.Equal(t, test.wantStatus, rsp.Code, "wrong response status")
+			require.Equal(t, test.wantBody, rsp.Body.String(), "wrong response body")
+			require.Equal(t, test.wantFindProjects, trackerAPI.findProjectIDs)
+			for _, issueID := range trackerAPI.findIssueIDs {
+				require.Equal(t, 348, issueID)
+			}
+			require.Equal(t, test.wantUpdates, trackerAPI.updates)
+			require.Equal(t, test.wantComments, trackerAPI.comments)
+			require.Equal(t, test.wantTaskChanges, trackerAPI.taskChanges)
+			require.Equal(t, test.wantIssueUpdates, gitHubAPI.issueUpdates)
+			if test.wantRecentWrites != nil {
+				require.True(t, recentWrites.Consume(test.wantRecentWrites...), "the update should be remembered")
+			}
+			if test.wantNotRecentWrites != nil {
+				require.False(t, recentWrites.Consume(test.wantNotRecentWrites...), "the failed update should be forgotten")
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// The example from GitHub's documentation.
+	require.Equal(t, "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		Sign([]byte("It's a Secret to Everybody"), []byte("Hello, World!")))
+}
@@ -0,0 +1,180 @@
+package githubwebhook
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/trackerapi"
+)
+
+// How far along its workflow a story in each state is, so that closing an issue only ever moves its story forward.
+var storyStateProgress = map[string]int{
+	"unscheduled": 0,
+	"unstarted":   0,
+	"planned":     0,
+	"started":     1,
+	"rejected":    1,
+	"finished":    2,
+	"delivered":   3,
+	"accepted":    4,
+}
+
+// Returns the story owners which match the issue's assignees, using the user ID mapping in reverse. The current
+// owners who have no GitHub username in the mapping are kept, because the issue's assignees can't show whether
+// they should still own the story. Also returns the assignees who have no Tracker user ID in the mapping.
+func ownersForAssignees(currentOwners []int64, assignees []string, userIDMapping map[int64]string) (owners []int64, unmapped []string) {
+	// GitHub usernames are case-insensitive.
+	assigned := map[string]bool{}
+	for _, assignee := range assignees {
+		assigned[strings.ToLower(assignee)] = true
+	}
+	trackerIDs := map[string]int64{}
+	for trackerID, username := range userIDMapping {
+		trackerIDs[strings.ToLower(username)] = trackerID
+	}
+
+	owners = []int64{}
+	isOwner := map[int64]bool{}
+	for _, ownerID := range currentOwners {
+		username, mapped := userIDMapping[ownerID]
+		if !mapped || assigned[strings.ToLower(username)] {
+			owners = append(owners, ownerID)
+			isOwner[ownerID] = true
+		}
+	}
+	for _, assignee := range assignees {
+		trackerID, mapped := trackerIDs[strings.ToLower(assignee)]
+		if !mapped {
+			unmapped = append(unmapped, assignee)
+			continue
+		}
+		if !isOwner[trackerID] {
+			owners = append(owners, trackerID)
+			isOwner[trackerID] = true
+		}
+	}
+	return owners, unmapped
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the keys of the label map, e.g. story types, whose labels are all on the issue. Keys without labels are
+// never returned, and only the keys with the most labels are returned, since a key with two labels on the issue
+// matches it better than a key with only one of them. When label is not empty, only the keys whose labels include
+// it are considered. GitHub label names are case-insensitive.
+func keysForLabels(labelMap map[string][]string, issueLabels []string, label string) []string {
+	var keys []string
+	mostLabels := 0
+	for key, labels := range labelMap {
+		if len(labels) == 0 || (label != "" && !containsLabel(labels, label)) {
+			continue
+		}
+		allOnIssue := true
+		for _, l := range labels {
+			allOnIssue = allOnIssue && containsLabel(issueLabels, l)
+		}
+		switch {
+		case !allOnIssue || len(labels) < mostLabels:
+		case len(labels) > mostLabels:
+			keys, mostLabels = []string{key}, len(labels)
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the estimates which are in the project's point scale, e.g. "0,1,2,3,5,8".
+func estimatesInPointScale(estimates []string, pointScale string) []string {
+	var inScale []string
+	for _, estimate := range estimates {
+		value, err := strconv.ParseFloat(estimate, 64)
+		if err != nil {
+			continue
+		}
+		for _, point := range strings.Split(pointScale, ",") {
+			if scaleValue, err := strconv.ParseFloat(strings.TrimSpace(point), 64); err == nil && scaleValue == value {
+				inScale = append(inScale, estimate)
+				break
+			}
+		}
+	}
+	return inScale
+}
+
+// Returns true when the label map has the label as one of its values.
+func isMappedLabel(labelMap map[string][]string, label string) bool {
+	for _, labels := range labelMap {
+		if containsLabel(labels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the fingerprint of the change which the issue event reports, matching those of the app's own updates to
+// the issue, or an empty string for actions which the app never causes.
+func issuesEventFingerprint(issuesEvent *IssuesEvent) string {
+	issueNumber := issuesEvent.Issue.Number
+	switch {
+	case issuesEvent.Action == "labeled" && issuesEvent.Label != nil:
+		return loopguard.IssueFingerprint(issueNumber, "label+"+issuesEvent.Label.Name)
+	case issuesEvent.Action == "unlabeled" && issuesEvent.Label != nil:
+		return loopguard.IssueFingerprint(issueNumber, "label-"+issuesEvent.Label.Name)
+	case issuesEvent.Action == "assigned" && issuesEvent.Assignee != nil:
+		return loopguard.IssueFingerprint(issueNumber, "assignee+"+issuesEvent.Assignee.Login)
+	case issuesEvent.Action == "unassigned" && issuesEvent.Assignee != nil:
+		return loopguard.IssueFingerprint(issueNumber, "assignee-"+issuesEvent.Assignee.Login)
+	case issuesEvent.Action == "closed":
+		return loopguard.IssueFingerprint(issueNumber, "state=closed")
+	case issuesEvent.Action == "reopened":
+		return loopguard.IssueFingerprint(issueNumber, "state=open")
+	case issuesEvent.Action == "edited":
+		return loopguard.IssueFingerprint(issueNumber, "body="+loopguard.Digest(issuesEvent.Issue.Body))
+	}
+	return ""
+}
+
+// Returns the fingerprints of the fields which the update changes, matching those of the story change in the
+// Tracker activity event which the update will cause.
+func storyUpdateFingerprints(storyID int64, update *trackerapi.StoryUpdate) []string {
+	var fingerprints []string
+	if update.CurrentState != nil {
+		fingerprints = append(fingerprints, loopguard.StoryFingerprint(storyID, "current_state", *update.CurrentState))
+	}
+	if update.StoryType != nil {
+		fingerprints = append(fingerprints, loopguard.StoryFingerprint(storyID, "story_type", *update.StoryType))
+	}
+	if update.Estimate != nil {
+		fingerprints = append(fingerprints, loopguard.StoryFingerprint(storyID, "estimate", *update.Estimate))
+	}
+	if update.Unestimate {
+		fingerprints = append(fingerprints, loopguard.StoryFingerprint(storyID, "estimate", nil))
+	}
+	if update.OwnerIDs != nil {
+		fingerprints = append(fingerprints, loopguard.StoryFingerprint(storyID, "owner_ids", *update.OwnerIDs))
+	}
+	return fingerprints
+}
@@ -0,0 +1,157 @@
+package githubwebhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/trackerapi"
+)
+
+func TestOwnersForAssignees(t *testing.T) {
+	mapping := map[int64]string{1: "alice", 2: "Bob", 3: "carol"}
+	tests := []struct {
+		name          string
+		currentOwners []int64
+		assignees     []string
+
+		wantOwners   []int64
+		wantUnmapped []string
+	}{
+		{
+			name:       "no owners and no assignees",
+			wantOwners: []int64{},
+		},
+		{
+			name:          "assignees are added after the current owners, ignoring case",
+			currentOwners: []int64{1},
+			assignees:     []string{"bob", "ALICE"},
+			wantOwners:    []int64{1, 2},
+		},
+		{
+			name:          "mapped owners who are not assigned are removed, and owners who aren't mapped are kept",
+			currentOwners: []int64{99, 1, 3},
+			assignees:     []string{"carol"},
+			wantOwners:    []int64{99, 3},
+		},
+		{
+			name:          "assignees who aren't mapped are reported",
+			currentOwners: []int64{},
+			assignees:     []string{"dave", "alice", "erin"},
+			wantOwners:    []int64{1},
+			wantUnmapped:  []string{"dave", "erin"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			owners, unmapped := ownersForAssignees(test.currentOwners, test.assignees, mapping)
+			require.Equal(t, test.wantOwners, owners)
+			require.Equal(t, test.wantUnmapped, unmapped)
+		})
+	}
+}
+
+func TestKeysForLabels(t *testing.T) {
+	labelMap := map[string][]string{
+		"feature": {"enhancement"},
+		"bug":     {"bug"},
+		"chore":   {"chore"},
+		"release": {},
+		"3":       {"estimate/L"},
+		"4":       {"estimate/L"},
+		"spike":   {"chore", "research"},
+	}
+	tests := []struct {
+		name        string
+		issueLabels []string
+		label       string
+
+		wantKeys []string
+	}{
+		{
+			name: "no labels",
+		},
+		{
+			name:        "keys whose labels are on the issue, ignoring case",
+			issueLabels: []string{"Enhancement", "priority/high"},
+			wantKeys:    []string{"feature"},
+		},
+		{
+			name:        "every key which has the labels",
+			issueLabels: []string{"estimate/L"},
+			wantKeys:    []string{"3", "4"},
+		},
+		{
+			name:        "only the keys with the most labels on the issue",
+			issueLabels: []string{"research", "chore"},
+			wantKeys:    []string{"spike"},
+		},
+		{
+			name:        "only the keys which have the label",
+			issueLabels: []string{"bug", "enhancement"},
+			label:       "bug",
+			wantKeys:    []string{"bug"},
+		},
+		{
+			name:        "all of a key's labels must be on the issue",
+			issueLabels: []string{"research"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.wantKeys, keysForLabels(labelMap, test.issueLabels, test.label))
+		})
+	}
+}
+
+func TestEstimatesInPointScale(t *testing.T) {
+	tests := []struct {
+		name       string
+		estimates  []string
+		pointScale string
+
+		wantEstimates []string
+	}{
+		{
+			name:          "fibonacci",
+			estimates:     []string{"3", "4"},
+			pointScale:    "0,1,2,3,5,8",
+			wantEstimates: []string{"3"},
+		},
+		{
+			name:          "powers of 2",
+			estimates:     []string{"3", "4"},
+			pointScale:    "0,1,2,4,8",
+			wantEstimates: []string{"4"},
+		},
+		{
+			name:          "custom point scale with spaces and fractions",
+			estimates:     []string{"0.5", "1", "3"},
+			pointScale:    "0, 0.50, 1",
+			wantEstimates: []string{"0.5", "1"},
+		},
+		{
+			name:       "estimates which are not in the point scale",
+			estimates:  []string{"3", "4"},
+			pointScale: "0,1,2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.wantEstimates, estimatesInPointScale(test.estimates, test.pointScale))
+		})
+	}
+}
+
+func TestStoryUpdateFingerprints(t *testing.T) {
+	started, bug, estimate := "started", "bug", 3.0
+	require.Equal(t, []string{
+		"tracker/story/101/current_state=started",
+		"tracker/story/101/story_type=bug",
+		"tracker/story/101/estimate=3",
+		"tracker/story/101/owner_ids=[1 2]",
+	}, storyUpdateFingerprints(101, &trackerapi.StoryUpdate{
+		CurrentState: &started, StoryType: &bug, Estimate: &estimate, OwnerIDs: &[]int64{2, 1},
+	}))
+	require.Equal(t, []string{"tracker/story/101/estimate=none"},
+		storyUpdateFingerprints(101, &trackerapi.StoryUpdate{Unestimate: true}))
+}
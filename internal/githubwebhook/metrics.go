@@ -0,0 +1,11 @@
+package githubwebhook
+
+import "issues2stories/internal/metrics"
+
+var webhookEvents = metrics.NewCounterVec(
+	"issues2stories_github_webhook_events_total",
+	"GitHub webhook events received, by event, action and outcome.",
+	"event", "action", "outcome")
+
+// The event used for requests which were rejected before their event type was known.
+const unknownEvent = "unknown"
@@ -0,0 +1,53 @@
+package githubwebhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"issues2stories/internal/config"
+)
+
+// GitHub sends the HMAC-SHA256 of the request body, keyed with the webhook's secret, in this header.
+// See https://docs.github.com/en/developers/webhooks-and-events/securing-your-webhooks
+const SignatureHeader = "X-Hub-Signature-256"
+
+// The environment variable which holds the webhook's secret.
+const SecretEnvVar = "GITHUB_WEBHOOK_SECRET"
+
+// SignatureAuthenticator accepts requests whose body was signed with the webhook's secret.
+type SignatureAuthenticator struct {
+	secret []byte
+}
+
+func NewSignatureAuthenticator(secret string) *SignatureAuthenticator {
+	return &SignatureAuthenticator{secret: []byte(secret)}
+}
+
+// Reads the request body to check its signature, and then replaces the body so that it can be read again.
+// Returns the error from reading the body when it can't be read, e.g. because it is too large.
+func (s *SignatureAuthenticator) Authenticate(request *http.Request) (string, error) {
+	signature := request.Header.Get(SignatureHeader)
+	if signature == "" {
+		return "", config.ErrMissingCredentials
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return "", err
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if !hmac.Equal([]byte(signature), []byte(Sign(s.secret, body))) {
+		return "", config.ErrBadCredentials
+	}
+	return "github_webhook_secret", nil
+}
+
+// Returns the value of the SignatureHeader for the body, e.g. "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17".
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
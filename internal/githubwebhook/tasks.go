@@ -0,0 +1,113 @@
+package githubwebhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v33/github"
+	"issues2stories/internal/config"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/tasklist"
+	"issues2stories/internal/tracing"
+	"issues2stories/internal/translate"
+)
+
+// Update the story's tasks to match the edited task list in the issue's body, and mark the task list's new items with
+// their tasks. Returns false when the tasks could not be updated, in which case an error has already been written to
+// the response.
+func (h *handler) syncTasks(ctx context.Context, logger *logging.Logger, responseWriter http.ResponseWriter,
+	configuration *config.Config, projectID int64, issuesEvent *IssuesEvent, storyID int64) bool {
+	ctx, span := tracing.Start(ctx, "process task list edit", tracing.SpanKindInternal,
+		"tracker.project", projectID,
+		"tracker.story", storyID,
+		"github.issue", issuesEvent.Issue.Number)
+	defer span.End()
+
+	tasks, err := h.trackerAPI.ListTasks(ctx, projectID, storyID)
+	if err != nil {
+		logger.Error("Error calling Tracker API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't list the story's tasks via Tracker API", http.StatusBadGateway)
+		return false
+	}
+	body := issuesEvent.Issue.Body
+
+	// Task text is copied between the systems, so the tasks are compared with the task list as they would be written
+	// in GitHub, and the changed items are translated for Tracker.
+	texts := []string{body}
+	for _, task := range tasks {
+		texts = append(texts, task.Description)
+	}
+	translator, err := translate.ForProjects(ctx, h.trackerAPI, configuration.UserIDMapping,
+		"https://github.com/"+h.repository, []int64{projectID}, texts...)
+	if err != nil {
+		logger.Warn("Could not list the Tracker project's members, so mentions in tasks won't be translated", "error", err)
+	}
+	items, changes := tasklist.TaskChanges(issuesEvent.Changes.Body.From, body, tasklist.TranslateTasks(tasks, translator.ToGitHub))
+	changes = tasklist.TranslateChanges(changes, tasks, translator.ToTracker)
+	if len(changes) == 0 {
+		logger.Info("The story's tasks already match the issue's task list")
+	}
+
+	if configuration.IsDryRun(projectID) {
+		for _, change := range changes {
+			var planned bool
+			switch {
+			case change.Delete:
+				planned = writeDryRunPlan(logger, span, responseWriter, "Tracker API call to delete task",
+					fmt.Sprintf("deletion of task %d of story #%d", change.TaskID, storyID), nil)
+			case change.TaskID == 0:
+				planned = writeDryRunPlan(logger, span, responseWriter, "Tracker API call to create task",
+					fmt.Sprintf("new task for story #%d", storyID), change.Update)
+			default:
+				planned = writeDryRunPlan(logger, span, responseWriter, "Tracker API call to update task",
+					fmt.Sprintf("update for task %d of story #%d", change.TaskID, storyID), change.Update)
+			}
+			if !planned {
+				return false
+			}
+		}
+		return true
+	}
+	if len(changes) > 0 {
+		logger.Info("Calling Tracker API to change the story's tasks", "changes", len(changes))
+		items, err = tasklist.Apply(ctx, h.trackerAPI, projectID, storyID, items, changes)
+		if err != nil {
+			logger.Error("Error calling Tracker API", "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't update the story's tasks via Tracker API", http.StatusBadGateway)
+			return false
+		}
+	}
+
+	newBody := tasklist.Rewrite(body, items)
+	if newBody == body {
+		return true
+	}
+	// The event's body is stale when the issue was edited again since, and rewriting it would undo that edit. The
+	// later edit's event syncs the task list again, and its items still match their tasks by their text.
+	issue, err := h.gitHubClient.GetIssue(ctx, issuesEvent.Issue.Number)
+	if err != nil {
+		logger.Error("Could not get issue from GitHub", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't get GitHub issue details from GitHub", http.StatusBadGateway)
+		return false
+	}
+	if issue.Body != body {
+		logger.Info("Not marking the issue's task list with its tasks: the issue's body was edited again since the event")
+		return true
+	}
+	logger.Info("Calling GitHub API to mark the issue's task list with its tasks")
+	err = h.recentWrites.Write(func() error {
+		return h.gitHubClient.UpdateIssue(ctx, issuesEvent.Issue.Number, &github.IssueRequest{Body: &newBody})
+	}, loopguard.IssueFingerprint(issuesEvent.Issue.Number, "body="+loopguard.Digest(newBody)))
+	if err != nil {
+		logger.Error("Error calling GitHub API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't update GitHub issue via GitHub API", http.StatusBadGateway)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package githubwebhook
+
+// The parts of GitHub's "issues" webhook event which are used.
+// See https://docs.github.com/en/developers/webhooks-and-events/webhook-events-and-payloads#issues
+type IssuesEvent struct {
+	Action     string     `json:"action"`
+	Issue      Issue      `json:"issue"`
+	Assignee   *User      `json:"assignee"`
+	Label      *Label     `json:"label"`
+	Changes    *Changes   `json:"changes"`
+	Repository Repository `json:"repository"`
+	Sender     User       `json:"sender"`
+}
+
+type Issue struct {
+	Number    int     `json:"number"`
+	Assignees []User  `json:"assignees"`
+	Labels    []Label `json:"labels"`
+	Body      string  `json:"body"`
+}
+
+// The previous values of the fields which an "edited" action changed. Fields which did not change are nil.
+type Changes struct {
+	Body *ChangedValue `json:"body"`
+}
+
+type ChangedValue struct {
+	From string `json:"from"`
+}
+
+type User struct {
+	Login string `json:"login"`
+}
+
+type Repository struct {
+	// e.g. "vmware-tanzu/pinniped"
+	FullName string `json:"full_name"`
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
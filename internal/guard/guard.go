@@ -0,0 +1,333 @@
+// Package guard protects the endpoints from unwanted clients. It locks out client IP addresses after repeated
+// failed authentication, only accepts clients from each endpoint's allowed CIDRs, and limits request body sizes.
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"issues2stories/internal/config"
+	"issues2stories/internal/logging"
+)
+
+// The names of the endpoints which can be configured in config.Inbound.Endpoints.
+const (
+	EndpointTrackerActivity = "tracker_activity"
+	EndpointTrackerImport   = "tracker_import"
+	EndpointMetrics         = "metrics"
+	EndpointGitHubWebhook   = "github_webhook"
+)
+
+// Reading the body of a request returns this error once the body is larger than the endpoint allows.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+// At most this many clients are tracked, so that a flood of failures from many addresses can't use unbounded memory.
+// Once there are this many, the clients whose failures have expired are forgotten, and then the clients whose last
+// failure was longest ago.
+const maxTrackedClients = 10000
+
+type Guard struct {
+	trustedProxies []*net.IPNet
+	maxFailedAuth  int
+	window         time.Duration
+	lockout        time.Duration
+	endpoints      map[string]endpoint
+
+	// Allows tests to control the time and the number of tracked clients.
+	now        func() time.Time
+	maxClients int
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+type endpoint struct {
+	allowed      []*net.IPNet
+	maxBodyBytes int64
+}
+
+type client struct {
+	failures    int
+	windowStart time.Time
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Returns a Guard for the settings, or an error when they are invalid.
+func New(settings config.Inbound) (*Guard, error) {
+	settings = settings.WithDefaults()
+	trustedProxies, err := parseCIDRs(settings.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted_proxies: %w", err)
+	}
+	g := &Guard{
+		trustedProxies: trustedProxies,
+		maxFailedAuth:  settings.MaxFailedAuth,
+		window:         settings.FailedAuthWindow,
+		lockout:        settings.LockoutDuration,
+		endpoints:      map[string]endpoint{},
+		now:            time.Now,
+		maxClients:     maxTrackedClients,
+		clients:        map[string]*client{},
+	}
+	for _, name := range []string{EndpointTrackerActivity, EndpointTrackerImport, EndpointMetrics, EndpointGitHubWebhook} {
+		endpointSettings := settings.Endpoints[name].WithDefaults()
+		allowed, err := parseCIDRs(endpointSettings.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_cidrs for endpoint %s: %w", name, err)
+		}
+		g.endpoints[name] = endpoint{allowed: allowed, maxBodyBytes: endpointSettings.MaxBodyBytes}
+	}
+	for name := range settings.Endpoints {
+		if _, ok := g.endpoints[name]; !ok {
+			return nil, fmt.Errorf("unknown endpoint: %s", name)
+		}
+	}
+	return g, nil
+}
+
+// Protect wraps the handler of the named endpoint. Requests from disallowed or locked out clients, and requests
+// with too large bodies, are rejected before they reach the handler. Responses with status 401 count as failed
+// authentication attempts by the client.
+func (g *Guard) Protect(endpointName string, next http.Handler) http.Handler {
+	settings, ok := g.endpoints[endpointName]
+	if !ok {
+		panic("unknown endpoint: " + endpointName)
+	}
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		clientIP := g.ClientIP(request)
+		logger := logging.FromContext(request.Context()).With("client_ip", clientIP.String())
+
+		if !settings.allows(clientIP) {
+			logger.Warn("Rejecting request from a client which is not in the endpoint's allowed CIDRs.")
+			rejections.WithLabelValues(endpointName, "source_not_allowed").Inc()
+			http.Error(responseWriter, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if retryAfter := g.lockedOut(clientIP); retryAfter > 0 {
+			logger.Warn("Rejecting request from a client which is locked out after failed authentication attempts.",
+				"retry_after_seconds", retryAfter)
+			rejections.WithLabelValues(endpointName, "locked_out").Inc()
+			responseWriter.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(responseWriter, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if request.ContentLength > settings.maxBodyBytes {
+			logger.Warn("Rejecting request with a body which is too large.",
+				"content_length", request.ContentLength, "max_body_bytes", settings.maxBodyBytes)
+			rejections.WithLabelValues(endpointName, "body_too_large").Inc()
+			http.Error(responseWriter, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body := &limitedBody{ReadCloser: request.Body, remaining: settings.maxBodyBytes}
+		request.Body = body
+
+		recorder := &statusRecorder{ResponseWriter: responseWriter}
+		next.ServeHTTP(recorder, request)
+
+		if body.exceeded {
+			logger.Warn("Rejected request with a body which is too large.", "max_body_bytes", settings.maxBodyBytes)
+			rejections.WithLabelValues(endpointName, "body_too_large").Inc()
+		}
+		if recorder.status == http.StatusUnauthorized {
+			rejections.WithLabelValues(endpointName, "unauthorized").Inc()
+			if g.recordFailedAuth(clientIP) {
+				logger.Warn("Locking out client after repeated failed authentication attempts.",
+					"lockout_seconds", int(g.lockout.Seconds()))
+				lockouts.WithLabelValues(endpointName).Inc()
+			}
+		}
+	})
+}
+
+// Returns the IP address of the client. When the peer of the connection is a trusted proxy, the client is the
+// last address in the X-Forwarded-For header which is not also a trusted proxy.
+func (g *Guard) ClientIP(request *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	clientIP := net.ParseIP(host)
+	if clientIP == nil || !contains(g.trustedProxies, clientIP) {
+		return clientIP
+	}
+	forwardedFor := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		forwardedIP := net.ParseIP(strings.TrimSpace(forwardedFor[i]))
+		if forwardedIP == nil {
+			// Anything to the left of a malformed entry can't be trusted.
+			break
+		}
+		clientIP = forwardedIP
+		if !contains(g.trustedProxies, clientIP) {
+			break
+		}
+	}
+	return clientIP
+}
+
+// Returns the number of seconds until the client's lockout ends, or 0 when the client is not locked out.
+func (g *Guard) lockedOut(clientIP net.IP) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c, ok := g.clients[clientKey(clientIP)]
+	if !ok {
+		return 0
+	}
+	remaining := c.lockedUntil.Sub(g.now())
+	if remaining <= 0 {
+		return 0
+	}
+	return int((remaining + time.Second - 1) / time.Second)
+}
+
+// Counts a failed authentication attempt. Returns true when the client has just been locked out.
+func (g *Guard) recordFailedAuth(clientIP net.IP) bool {
+	if g.maxFailedAuth < 0 {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	key := clientKey(clientIP)
+	c, ok := g.clients[key]
+	if !ok {
+		if len(g.clients) >= g.maxClients {
+			g.forgetExpiredClients(now)
+		}
+		for len(g.clients) >= g.maxClients {
+			g.forgetOldestClient()
+		}
+		c = &client{}
+		g.clients[key] = c
+	}
+	if now.Sub(c.windowStart) > g.window {
+		c.failures = 0
+		c.windowStart = now
+	}
+	c.failures++
+	c.lastFailure = now
+	if c.failures < g.maxFailedAuth {
+		return false
+	}
+	c.failures = 0
+	c.lockedUntil = now.Add(g.lockout)
+	return true
+}
+
+func (g *Guard) forgetExpiredClients(now time.Time) {
+	for key, c := range g.clients {
+		if now.Sub(c.windowStart) > g.window && !now.Before(c.lockedUntil) {
+			delete(g.clients, key)
+		}
+	}
+}
+
+func (g *Guard) forgetOldestClient() {
+	var oldestKey string
+	var oldest *client
+	for key, c := range g.clients {
+		if oldest == nil || c.lastFailure.Before(oldest.lastFailure) {
+			oldestKey, oldest = key, c
+		}
+	}
+	delete(g.clients, oldestKey)
+}
+
+// IPv6 clients can usually use any address in their /64, so they are tracked by /64 instead of by address.
+func clientKey(clientIP net.IP) string {
+	if clientIP.To4() == nil && len(clientIP) == net.IPv6len {
+		return clientIP.Mask(net.CIDRMask(64, 128)).String()
+	}
+	return clientIP.String()
+}
+
+func (e endpoint) allows(clientIP net.IP) bool {
+	return len(e.allowed) == 0 || (clientIP != nil && contains(e.allowed, clientIP))
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses CIDRs, and also single IP addresses.
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("not a CIDR or IP address: %q", value)
+			}
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("not a CIDR or IP address: %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Like http.MaxBytesReader, but with an error which handlers can recognize.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrRequestBodyTooLarge
+	}
+	// Read one byte more than allowed, to find out whether the body is too large.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.remaining {
+		l.exceeded = true
+		return int(l.remaining), ErrRequestBodyTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
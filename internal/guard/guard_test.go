@@ -0,0 +1,308 @@
+package guard
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.Inbound
+		wantErr  string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "valid CIDRs and addresses",
+			settings: config.Inbound{
+				TrustedProxies: []string{"130.211.0.0/22", "35.191.0.0/16", "::1"},
+				Endpoints: map[string]config.InboundEndpoint{
+					EndpointTrackerActivity: {AllowedCIDRs: []string{"10.0.0.1", "2001:db8::/32"}},
+				},
+			},
+		},
+		{
+			name:     "invalid trusted proxy",
+			settings: config.Inbound{TrustedProxies: []string{"10.0.0.0/33"}},
+			wantErr:  `invalid trusted_proxies: not a CIDR or IP address: "10.0.0.0/33"`,
+		},
+		{
+			name: "invalid allowed CIDR",
+			settings: config.Inbound{Endpoints: map[string]config.InboundEndpoint{
+				EndpointMetrics: {AllowedCIDRs: []string{"localhost"}},
+			}},
+			wantErr: `invalid allowed_cidrs for endpoint metrics: not a CIDR or IP address: "localhost"`,
+		},
+		{
+			name: "unknown endpoint",
+			settings: config.Inbound{Endpoints: map[string]config.InboundEndpoint{
+				"tracker_activty": {AllowedCIDRs: []string{"10.0.0.0/8"}},
+			}},
+			wantErr: "unknown endpoint: tracker_activty",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.settings)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	subject, err := New(config.Inbound{TrustedProxies: []string{"130.211.0.0/22", "10.0.0.0/8"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantClientIP string
+	}{
+		{
+			name:         "direct client",
+			remoteAddr:   "203.0.113.7:51234",
+			wantClientIP: "203.0.113.7",
+		},
+		{
+			name:         "direct client cannot spoof its address",
+			remoteAddr:   "203.0.113.7:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			wantClientIP: "203.0.113.7",
+		},
+		{
+			name:         "via a trusted proxy",
+			remoteAddr:   "130.211.0.5:443",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.7, 130.211.1.1"},
+			wantClientIP: "203.0.113.7",
+		},
+		{
+			name:         "via several trusted proxies, using several headers",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"203.0.113.7", "130.211.1.1"},
+			wantClientIP: "203.0.113.7",
+		},
+		{
+			name:         "via a trusted proxy which did not set the header",
+			remoteAddr:   "10.1.2.3:443",
+			wantClientIP: "10.1.2.3",
+		},
+		{
+			name:         "stops at a malformed entry",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"203.0.113.7, unknown, 130.211.1.1"},
+			wantClientIP: "130.211.1.1",
+		},
+		{
+			name:         "IPv6",
+			remoteAddr:   "[2001:db8::1]:443",
+			wantClientIP: "2001:db8::1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = test.remoteAddr
+			for _, value := range test.forwardedFor {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			require.Equal(t, test.wantClientIP, subject.ClientIP(request).String())
+		})
+	}
+}
+
+// Responds 401 unless the request has the right password, and otherwise echoes the request body.
+var echoHandler = http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.URL.Query().Get("password") != "right" {
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	_, _ = responseWriter.Write(body)
+})
+
+func TestProtect(t *testing.T) {
+	type step struct {
+		remoteAddr   string
+		forwardedFor string
+		password     string
+		body         string
+		chunked      bool
+		advance      time.Duration
+
+		wantStatus     int
+		wantBody       string
+		wantRetryAfter string
+	}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		settings config.Inbound
+		steps    []step
+	}{
+		{
+			name:     "locks out a client after repeated failed authentication, until the lockout ends",
+			endpoint: EndpointTrackerImport,
+			settings: config.Inbound{MaxFailedAuth: 3, FailedAuthWindow: time.Minute, LockoutDuration: 10 * time.Minute},
+			steps: []step{
+				{remoteAddr: "203.0.113.7:1", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "203.0.113.7:2", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "203.0.113.7:3", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "203.0.113.7:4", password: "right", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "600"},
+				{remoteAddr: "198.51.100.1:1", password: "right", body: "other client", wantStatus: http.StatusOK, wantBody: "other client"},
+				{advance: 9 * time.Minute, remoteAddr: "203.0.113.7:5", password: "right", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "60"},
+				{advance: time.Minute, remoteAddr: "203.0.113.7:6", password: "right", body: "ok", wantStatus: http.StatusOK, wantBody: "ok"},
+			},
+		},
+		{
+			name:     "failures outside of the window are forgotten",
+			endpoint: EndpointTrackerImport,
+			settings: config.Inbound{MaxFailedAuth: 2, FailedAuthWindow: time.Minute},
+			steps: []step{
+				{remoteAddr: "203.0.113.7:1", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{advance: 2 * time.Minute, remoteAddr: "203.0.113.7:2", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "203.0.113.7:3", password: "right", body: "ok", wantStatus: http.StatusOK, wantBody: "ok"},
+			},
+		},
+		{
+			name:     "IPv6 clients are tracked by /64",
+			endpoint: EndpointTrackerImport,
+			settings: config.Inbound{MaxFailedAuth: 2},
+			steps: []step{
+				{remoteAddr: "[2001:db8:0:1::1]:1", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "[2001:db8:0:1::2]:1", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "[2001:db8:0:1::3]:1", password: "right", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "900"},
+				{remoteAddr: "[2001:db8:0:2::1]:1", password: "right", body: "ok", wantStatus: http.StatusOK, wantBody: "ok"},
+			},
+		},
+		{
+			name:     "lockout can be disabled",
+			endpoint: EndpointTrackerImport,
+			settings: config.Inbound{MaxFailedAuth: -1},
+			steps: []step{
+				{remoteAddr: "203.0.113.7:1", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "203.0.113.7:2", password: "wrong", wantStatus: http.StatusUnauthorized},
+				{remoteAddr: "203.0.113.7:3", password: "right", body: "ok", wantStatus: http.StatusOK, wantBody: "ok"},
+			},
+		},
+		{
+			name:     "only accepts clients from the allowed CIDRs, behind a trusted proxy",
+			endpoint: EndpointTrackerActivity,
+			settings: config.Inbound{
+				TrustedProxies: []string{"10.0.0.0/8"},
+				Endpoints: map[string]config.InboundEndpoint{
+					EndpointTrackerActivity: {AllowedCIDRs: []string{"35.184.0.0/13"}},
+				},
+			},
+			steps: []step{
+				{remoteAddr: "203.0.113.7:1", password: "right", wantStatus: http.StatusForbidden, wantBody: "Forbidden\n"},
+				{remoteAddr: "10.0.0.1:1", forwardedFor: "203.0.113.7", password: "right", wantStatus: http.StatusForbidden, wantBody: "Forbidden\n"},
+				{remoteAddr: "10.0.0.1:1", forwardedFor: "35.184.0.2", password: "right", body: "proxied", wantStatus: http.StatusOK, wantBody: "proxied"},
+				{remoteAddr: "35.184.0.1:1", password: "right", body: "direct", wantStatus: http.StatusOK, wantBody: "direct"},
+			},
+		},
+		{
+			name:     "limits the body size",
+			endpoint: EndpointTrackerActivity,
+			settings: config.Inbound{Endpoints: map[string]config.InboundEndpoint{
+				EndpointTrackerActivity: {MaxBodyBytes: 5},
+			}},
+			steps: []step{
+				{remoteAddr: "203.0.113.7:1", password: "right", body: "12345", wantStatus: http.StatusOK, wantBody: "12345"},
+				{remoteAddr: "203.0.113.7:1", password: "right", body: "123456", wantStatus: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+				{remoteAddr: "203.0.113.7:1", password: "right", body: "123456", chunked: true, wantStatus: http.StatusRequestEntityTooLarge, wantBody: "request body too large\n"},
+				{remoteAddr: "203.0.113.7:1", password: "right", body: "12345", chunked: true, wantStatus: http.StatusOK, wantBody: "12345"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject, err := New(test.settings)
+			require.NoError(t, err)
+			currentTime := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+			subject.now = func() time.Time { return currentTime }
+			handler := subject.Protect(test.endpoint, echoHandler)
+
+			for i, step := range test.steps {
+				currentTime = currentTime.Add(step.advance)
+				request := httptest.NewRequest(http.MethodPost, "/endpoint?password="+step.password, strings.NewReader(step.body))
+				request.RemoteAddr = step.remoteAddr
+				if step.forwardedFor != "" {
+					request.Header.Set("X-Forwarded-For", step.forwardedFor)
+				}
+				if step.chunked {
+					request.ContentLength = -1
+				}
+				rsp := httptest.NewRecorder()
+				handler.ServeHTTP(rsp, request)
+
+				require.Equal(t, step.wantStatus, rsp.Code, "step %d: wrong status", i)
+				if step.wantBody != "" {
+					require.Equal(t, step.wantBody, rsp.Body.String(), "step %d: wrong body", i)
+				}
+				require.Equal(t, step.wantRetryAfter, rsp.Header().Get("Retry-After"), "step %d: wrong Retry-After", i)
+			}
+		})
+	}
+}
+
+func TestTrackedClientsAreLimited(t *testing.T) {
+	subject, err := New(config.Inbound{MaxFailedAuth: 1, FailedAuthWindow: time.Minute, LockoutDuration: time.Hour})
+	require.NoError(t, err)
+	currentTime := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	subject.now = func() time.Time { return currentTime }
+	subject.maxClients = 2
+
+	for _, address := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		currentTime = currentTime.Add(time.Second)
+		require.True(t, subject.recordFailedAuth(net.ParseIP(address)))
+	}
+
+	// Every client is still locked out, so the one whose last failure was longest ago is forgotten.
+	require.Len(t, subject.clients, 2)
+	require.Zero(t, subject.lockedOut(net.ParseIP("203.0.113.1")))
+	require.NotZero(t, subject.lockedOut(net.ParseIP("203.0.113.2")))
+	require.NotZero(t, subject.lockedOut(net.ParseIP("203.0.113.3")))
+
+	// Clients whose failures and lockouts have expired are forgotten first.
+	currentTime = currentTime.Add(2 * time.Hour)
+	require.True(t, subject.recordFailedAuth(net.ParseIP("203.0.113.4")))
+	require.Len(t, subject.clients, 1)
+}
+
+func TestProtectMetrics(t *testing.T) {
+	unauthorizedBefore := rejections.Value(EndpointMetrics, "unauthorized")
+	lockedOutBefore := rejections.Value(EndpointMetrics, "locked_out")
+	lockoutsBefore := lockouts.Value(EndpointMetrics)
+
+	subject, err := New(config.Inbound{MaxFailedAuth: 2})
+	require.NoError(t, err)
+	handler := subject.Protect(EndpointMetrics, echoHandler)
+	for i := 0; i < 3; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/metrics?password=wrong", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	require.Equal(t, 2.0, rejections.Value(EndpointMetrics, "unauthorized")-unauthorizedBefore)
+	require.Equal(t, 1.0, rejections.Value(EndpointMetrics, "locked_out")-lockedOutBefore)
+	require.Equal(t, 1.0, lockouts.Value(EndpointMetrics)-lockoutsBefore)
+}
@@ -0,0 +1,15 @@
+package guard
+
+import "issues2stories/internal/metrics"
+
+var (
+	rejections = metrics.NewCounterVec(
+		"issues2stories_inbound_rejections_total",
+		"Requests rejected because of failed authentication, lockouts, allowed CIDRs or body sizes, by endpoint and reason.",
+		"endpoint", "reason")
+
+	lockouts = metrics.NewCounterVec(
+		"issues2stories_client_lockouts_total",
+		"Client IP addresses locked out after repeated failed authentication attempts, by endpoint.",
+		"endpoint")
+)
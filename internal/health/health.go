@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"issues2stories/internal/logging"
+)
+
+// A Check verifies one upstream dependency, e.g. that an API token is still valid.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// The result of a check, as reported by the unauthenticated readiness endpoint. Why a check failed is only logged,
+// because the API errors can mention the repository, the project and the APIs' rate limits.
+type CheckResult struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+}
+
+type Report struct {
+	Ready     bool          `json:"ready"`
+	Reason    string        `json:"reason,omitempty"`
+	CheckedAt *time.Time    `json:"checked_at,omitempty"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+// A Checker runs its checks periodically in the background and caches the results,
+// so readiness probes are cheap and do not spend the upstream APIs' rate limits.
+type Checker struct {
+	interval time.Duration
+	timeout  time.Duration
+	now      func() time.Time
+
+	mu           sync.RWMutex
+	checks       []Check
+	results      []CheckResult
+	checkedAt    time.Time
+	shuttingDown bool
+}
+
+func NewChecker(checks []Check, interval, timeout time.Duration) *Checker {
+	return &Checker{checks: checks, interval: interval, timeout: timeout, now: time.Now}
+}
+
+// Run the checks every interval until the context is done. The first run starts immediately.
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			c.RunChecks(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Run all checks concurrently and cache their results.
+func (c *Checker) RunChecks(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = CheckResult{Name: check.Name, OK: true}
+			if err := check.Run(ctx); err != nil {
+				results[i] = CheckResult{Name: check.Name, OK: false}
+				logging.FromContext(ctx).Warn("Readiness check failed", "check", check.Name, "error", err)
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = results
+	c.checkedAt = c.now()
+}
+
+// Replace the checks, e.g. after the configuration was reloaded. The new checks are used from the next run.
+func (c *Checker) SetChecks(checks []Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = checks
+}
+
+// Make the app report that it is not ready, e.g. while it is draining requests during shutdown.
+func (c *Checker) SetShuttingDown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shuttingDown = true
+}
+
+func (c *Checker) Report() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := Report{Ready: true, Checks: append([]CheckResult{}, c.results...)}
+	switch {
+	case c.shuttingDown:
+		report.Ready = false
+		report.Reason = "shutting down"
+	case c.checkedAt.IsZero():
+		report.Ready = false
+		report.Reason = "checks have not finished running yet"
+		report.Checks = []CheckResult{}
+	default:
+		for _, result := range c.results {
+			if !result.OK {
+				report.Ready = false
+				report.Reason = "some checks failed"
+			}
+		}
+	}
+	if !c.checkedAt.IsZero() {
+		checkedAt := c.checkedAt
+		report.CheckedAt = &checkedAt
+	}
+	return report
+}
+
+// Serves the cached readiness report as JSON, with status 200 when ready and 503 otherwise.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.Method != "GET" {
+			http.Error(responseWriter, "Method is not supported", http.StatusMethodNotAllowed)
+			return
+		}
+		report := c.Report()
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		body, _ := json.Marshal(report)
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(status)
+		responseWriter.Write(append(body, '\n'))
+	})
+}
+
+// Serves liveness probes. The app is alive whenever it can respond at all, regardless of its upstream dependencies.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.Method != "GET" {
+			http.Error(responseWriter, "Method is not supported", http.StatusMethodNotAllowed)
+			return
+		}
+		responseWriter.Write([]byte("ok"))
+	})
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/logging"
+)
+
+func TestReadyHandler(t *testing.T) {
+	passing := Check{Name: "github_repo_access", Run: func(_ context.Context) error { return nil }}
+	failing := Check{Name: "tracker_token", Run: func(_ context.Context) error { return errors.New("Tracker API returned status 403") }}
+	checkedAt := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		checks       []Check
+		runChecks    bool
+		shuttingDown bool
+		method       string
+
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "not ready before the first checks have finished",
+			checks:     []Check{passing},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"ready":false,"reason":"checks have not finished running yet","checks":[]}` + "\n",
+		},
+		{
+			name:       "ready when all checks pass",
+			checks:     []Check{passing},
+			runChecks:  true,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"ready":true,"checked_at":"2021-02-03T04:05:06Z","checks":[{"name":"github_repo_access","ok":true}]}` + "\n",
+		},
+		{
+			name:       "not ready and reports what failed when any check fails",
+			checks:     []Check{passing, failing},
+			runChecks:  true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody: `{"ready":false,"reason":"some checks failed","checked_at":"2021-02-03T04:05:06Z","checks":[` +
+				`{"name":"github_repo_access","ok":true},{"name":"tracker_token","ok":false}]}` + "\n",
+		},
+		{
+			name:         "not ready while shutting down",
+			checks:       []Check{passing},
+			runChecks:    true,
+			shuttingDown: true,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     `{"ready":false,"reason":"shutting down","checked_at":"2021-02-03T04:05:06Z","checks":[{"name":"github_repo_access","ok":true}]}` + "\n",
+		},
+		{
+			name:       "wrong method is an error",
+			checks:     []Check{passing},
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Method is not supported\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject := NewChecker(test.checks, time.Minute, time.Second)
+			subject.now = func() time.Time { return checkedAt }
+			if test.runChecks {
+				subject.RunChecks(context.Background())
+			}
+			if test.shuttingDown {
+				subject.SetShuttingDown()
+			}
+			if test.method == "" {
+				test.method = http.MethodGet
+			}
+
+			rsp := httptest.NewRecorder()
+			subject.ReadyHandler().ServeHTTP(rsp, httptest.NewRequest(test.method, "/readyz", nil))
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			require.Equal(t, test.wantBody, rsp.Body.String())
+		})
+	}
+}
+
+func TestCheckerCachesResultsBetweenIntervals(t *testing.T) {
+	var runs int32
+	check := Check{Name: "counting", Run: func(_ context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}}
+	subject := NewChecker([]Check{check}, time.Hour, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subject.Start(ctx)
+
+	require.Eventually(t, func() bool { return subject.Report().Ready }, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		subject.ReadyHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
+
+func TestCheckTimeout(t *testing.T) {
+	slow := Check{Name: "slow", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	subject := NewChecker([]Check{slow}, time.Minute, 10*time.Millisecond)
+	subject.RunChecks(context.Background())
+	report := subject.Report()
+	require.False(t, report.Ready)
+	require.Equal(t, []CheckResult{{Name: "slow", OK: false}}, report.Checks)
+}
+
+func TestSetChecks(t *testing.T) {
+	failing := Check{Name: "github", Run: func(_ context.Context) error { return errors.New("bad token") }}
+	subject := NewChecker([]Check{failing}, time.Minute, time.Second)
+	var logs bytes.Buffer
+	subject.RunChecks(logging.NewContext(context.Background(), logging.New(&logs, logging.LevelInfo)))
+	require.False(t, subject.Report().Ready)
+	require.Contains(t, logs.String(), `"msg":"Readiness check failed"`)
+	require.Contains(t, logs.String(), `"error":"bad token"`, "the reason should only be logged")
+
+	subject.SetChecks([]Check{{Name: "github", Run: func(_ context.Context) error { return nil }}})
+	subject.RunChecks(context.Background())
+	report := subject.Report()
+	require.True(t, report.Ready)
+	require.Equal(t, []CheckResult{{Name: "github", OK: true}}, report.Checks)
+}
+
+func TestLiveHandler(t *testing.T) {
+	rsp := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	require.Equal(t, http.StatusOK, rsp.Code)
+	require.Equal(t, "ok", rsp.Body.String())
+}
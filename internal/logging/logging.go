@@ -0,0 +1,326 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Parse a level name such as "debug", "info", "warn", or "error".
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+	}
+}
+
+const redacted = "[REDACTED]"
+
+// Any field whose key ends with one of these words has its value redacted, e.g. "github_api_token" and
+// "X-TrackerToken". Keys which only mention them, e.g. "revoked_token_ids" and "changed_secrets", name values
+// which are not secret, so they are logged as they are.
+var sensitiveKeySuffixes = []string{"password", "passwd", "secret", "token", "authorization", "credential", "api_key", "apikey"}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// A Logger writes one JSON object per line. It is safe for concurrent use.
+// Loggers are immutable, so use With() to derive a Logger which adds fields to every line.
+type Logger struct {
+	out     io.Writer
+	mu      *sync.Mutex
+	level   Level
+	fields  []field
+	secrets *secretSet
+	now     func() time.Time
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{out: out, mu: &sync.Mutex{}, level: level, secrets: &secretSet{}, now: time.Now}
+}
+
+// Returns a new Logger which includes the given key/value pairs on every line, in addition to this Logger's fields.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	derived := *l
+	derived.fields = append(append([]field{}, l.fields...), toFields(keysAndValues)...)
+	return &derived
+}
+
+// Registers secret values, such as API tokens, which should never be logged.
+// Every occurrence of these values is redacted from all messages and string fields
+// of this Logger and of every Logger derived from it.
+func (l *Logger) RegisterSecrets(secrets ...string) {
+	l.secrets.add(secrets...)
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(LevelDebug, msg, keysAndValues)
+}
+
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(LevelInfo, msg, keysAndValues)
+}
+
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(LevelWarn, msg, keysAndValues)
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(LevelError, msg, keysAndValues)
+}
+
+func (l *Logger) log(level Level, msg string, keysAndValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeJSON(&line, l.now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeJSON(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeJSON(&line, l.secrets.redact(msg))
+	for _, f := range append(append([]field{}, l.fields...), toFields(keysAndValues)...) {
+		line.WriteByte(',')
+		writeJSON(&line, f.key)
+		line.WriteByte(':')
+		writeJSON(&line, l.redactValue(f.key, f.value))
+	}
+	line.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(line.Bytes())
+}
+
+func (l *Logger) redactValue(key string, value interface{}) interface{} {
+	if isSensitiveKey(key) {
+		return redacted
+	}
+	switch v := value.(type) {
+	case *url.URL:
+		return l.secrets.redact(RedactURL(v))
+	case http.Header:
+		return RedactHeader(v)
+	case error:
+		return l.secrets.redact(v.Error())
+	case fmt.Stringer:
+		return l.secrets.redact(v.String())
+	case string:
+		return l.secrets.redact(v)
+	default:
+		return v
+	}
+}
+
+func toFields(keysAndValues []interface{}) []field {
+	fields := make([]field, 0, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		if i+1 >= len(keysAndValues) {
+			fields = append(fields, field{key: "!BADKEY", value: key})
+			break
+		}
+		fields = append(fields, field{key: key, value: keysAndValues[i+1]})
+	}
+	return fields
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false) // keep URLs readable
+	if err := encoder.Encode(value); err != nil {
+		encoded.Reset()
+		_ = encoder.Encode(fmt.Sprintf("%+v", value))
+	}
+	buf.Write(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+}
+
+func isSensitiveKey(key string) bool {
+	lowerKey := strings.ToLower(key)
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(lowerKey, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var secretPathSegmentPrefixes = struct {
+	sync.RWMutex
+	prefixes []string
+}{}
+
+// Registers a prefix of URL path segments which are secrets, such as signed tokens which are embedded in
+// webhook URLs. Such segments are redacted from every URL which is logged by any Logger.
+func RegisterSecretPathSegmentPrefix(prefix string) {
+	secretPathSegmentPrefixes.Lock()
+	defer secretPathSegmentPrefixes.Unlock()
+	secretPathSegmentPrefixes.prefixes = append(secretPathSegmentPrefixes.prefixes, prefix)
+}
+
+// Returns the URL path with any secret segments redacted. See RegisterSecretPathSegmentPrefix.
+func RedactPath(path string) string {
+	secretPathSegmentPrefixes.RLock()
+	defer secretPathSegmentPrefixes.RUnlock()
+	if len(secretPathSegmentPrefixes.prefixes) == 0 {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		for _, prefix := range secretPathSegmentPrefixes.prefixes {
+			if strings.HasPrefix(segment, prefix) {
+				segments[i] = prefix + "REDACTED"
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Returns the URL as a string with the values of any sensitive query parameters, any userinfo password,
+// and any secret path segments redacted.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redactedURL := *u
+	if redactedPath := RedactPath(redactedURL.Path); redactedPath != redactedURL.Path {
+		redactedURL.Path = redactedPath
+		redactedURL.RawPath = ""
+	}
+	if redactedURL.User != nil {
+		if _, hasPassword := redactedURL.User.Password(); hasPassword {
+			redactedURL.User = url.UserPassword(redactedURL.User.Username(), redacted)
+		}
+	}
+	query := redactedURL.Query()
+	changed := false
+	for key := range query {
+		if isSensitiveKey(key) || strings.EqualFold(key, "username") {
+			query[key] = []string{redacted}
+			changed = true
+		}
+	}
+	if changed {
+		redactedURL.RawQuery = query.Encode()
+	}
+	return redactedURL.String()
+}
+
+// Returns a copy of the headers with the values of any sensitive headers redacted.
+func RedactHeader(header http.Header) http.Header {
+	result := http.Header{}
+	for key, values := range header {
+		if isSensitiveKey(key) || strings.EqualFold(key, "Cookie") || strings.HasPrefix(strings.ToLower(key), "x-hub-signature") {
+			result[key] = []string{redacted}
+		} else {
+			result[key] = values
+		}
+	}
+	return result
+}
+
+type secretSet struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func (s *secretSet) add(secrets ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" && !s.contains(secret) {
+			s.secrets = append(s.secrets, secret)
+		}
+	}
+}
+
+// The same secrets are registered again each time the configuration is reloaded, so they are only kept once.
+func (s *secretSet) contains(secret string) bool {
+	for _, existing := range s.secrets {
+		if existing == secret {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *secretSet) redact(text string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, secret := range s.secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo)
+
+// The Logger used when no Logger was added to a context.
+func Default() *Logger {
+	return defaultLogger
+}
+
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// Returns the Logger from the context, or the default Logger if the context does not have one.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
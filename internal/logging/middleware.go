@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// Incoming request IDs are only trusted when they are reasonably short and boring.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Middleware assigns a request ID to each request, adds a Logger which includes that ID to the
+// request's context, and logs the start and end of each request without logging any credentials.
+func Middleware(logger *Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		responseWriter.Header().Set(RequestIDHeader, requestID)
+
+		requestLogger := logger.With("request_id", requestID)
+		requestLogger.Info("request started",
+			"method", request.Method,
+			"url", request.URL,
+			"remote_addr", request.RemoteAddr,
+			"user_agent", request.UserAgent())
+		requestLogger.Debug("request headers", "headers", request.Header)
+
+		recorder := &statusRecorder{ResponseWriter: responseWriter}
+		start := time.Now()
+		next.ServeHTTP(recorder, request.WithContext(NewContext(request.Context(), requestLogger)))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestLogger.Info("request finished",
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds())
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
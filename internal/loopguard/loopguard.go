@@ -0,0 +1,138 @@
+package loopguard
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a write is remembered. The webhook event caused by a write usually arrives within seconds.
+const DefaultTTL = 2 * time.Minute
+
+// The sources of webhook events, used in log messages and metrics.
+const (
+	SourceGitHub  = "github"
+	SourceTracker = "tracker"
+)
+
+// The reasons why an event is suppressed.
+const (
+	// The event was performed by the app's own GitHub or Tracker user.
+	ReasonOwnUser = "own_user"
+
+	// The event matches a recent write made by the app.
+	ReasonRecentWrite = "recent_write"
+)
+
+// A RecentWrites cache remembers fingerprints of the app's recent writes to GitHub and Tracker, so that the webhook
+// events caused by those writes can be recognized and not synced back to where they came from. Otherwise, each
+// change could bounce between Tracker and GitHub. A nil cache remembers nothing.
+type RecentWrites struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	written map[string]time.Time
+}
+
+func New(ttl time.Duration) *RecentWrites {
+	return &RecentWrites{ttl: ttl, now: time.Now, written: map[string]time.Time{}}
+}
+
+// Remember the fingerprints of a write which is about to be made.
+func (r *RecentWrites) Remember(fingerprints ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for fingerprint, writtenAt := range r.written {
+		if now.Sub(writtenAt) >= r.ttl {
+			delete(r.written, fingerprint)
+		}
+	}
+	for _, fingerprint := range fingerprints {
+		r.written[fingerprint] = now
+	}
+}
+
+// Forget the fingerprints of a write which failed.
+func (r *RecentWrites) Forget(fingerprints ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fingerprint := range fingerprints {
+		delete(r.written, fingerprint)
+	}
+}
+
+// Make a write, remembering its fingerprints before making it, because the webhook events which it causes can arrive
+// before the API call returns. The fingerprints are forgotten when the write fails.
+func (r *RecentWrites) Write(write func() error, fingerprints ...string) error {
+	r.Remember(fingerprints...)
+	if err := write(); err != nil {
+		r.Forget(fingerprints...)
+		return err
+	}
+	return nil
+}
+
+// Returns true when every one of the event's fingerprints matches a recent write, and then forgets them, so that
+// a later event which makes the same change again, e.g. a person undoing and redoing it, is not suppressed.
+// Returns false when there are no fingerprints.
+func (r *RecentWrites) Consume(fingerprints ...string) bool {
+	if r == nil || len(fingerprints) == 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for _, fingerprint := range fingerprints {
+		writtenAt, ok := r.written[fingerprint]
+		if !ok || now.Sub(writtenAt) >= r.ttl {
+			return false
+		}
+	}
+	for _, fingerprint := range fingerprints {
+		delete(r.written, fingerprint)
+	}
+	return true
+}
+
+// Returns the fingerprint of a change to one field of a GitHub issue, e.g. "github/issue/348/label+bug". GitHub
+// usernames and label names are case-insensitive, so the value is lowercased.
+func IssueFingerprint(issueNumber int, change string) string {
+	return "github/issue/" + strconv.Itoa(issueNumber) + "/" + strings.ToLower(change)
+}
+
+// Returns the fingerprint of a change to one field of a Tracker story, e.g. "tracker/story/101/current_state=started".
+// A nil value, e.g. for a story which was unestimated, is written as "none", and owner IDs are sorted, since their
+// order doesn't matter.
+func StoryFingerprint(storyID int64, field string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		value = "none"
+	case []int64:
+		sorted := append([]int64{}, v...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		value = sorted
+	}
+	return fmt.Sprintf("tracker/story/%d/%s=%v", storyID, field, value)
+}
+
+// Returns a short digest of a long value, e.g. an issue's body, for use in a fingerprint.
+func Digest(text string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(text)))[:16]
+}
+
+// Count the suppressed event.
+func Suppressed(source, reason string) {
+	suppressedEvents.WithLabelValues(source, reason).Inc()
+}
@@ -0,0 +1,113 @@
+package loopguard
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentWrites(t *testing.T) {
+	tests := []struct {
+		name       string
+		remembered []string
+		forgotten  []string
+		elapsed    time.Duration
+		consumed   []string
+
+		wantConsumed bool
+	}{
+		{
+			name:         "every fingerprint was written recently",
+			remembered:   []string{"a", "b", "c"},
+			consumed:     []string{"a", "b"},
+			wantConsumed: true,
+		},
+		{
+			name:       "one of the fingerprints was not written",
+			remembered: []string{"a"},
+			consumed:   []string{"a", "b"},
+		},
+		{
+			name:       "the write is too old",
+			remembered: []string{"a"},
+			elapsed:    DefaultTTL,
+			consumed:   []string{"a"},
+		},
+		{
+			name:         "the write is almost too old",
+			remembered:   []string{"a"},
+			elapsed:      DefaultTTL - time.Second,
+			consumed:     []string{"a"},
+			wantConsumed: true,
+		},
+		{
+			name:       "the write failed",
+			remembered: []string{"a", "b"},
+			forgotten:  []string{"a", "b"},
+			consumed:   []string{"a"},
+		},
+		{
+			name:       "no fingerprints",
+			remembered: []string{"a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject := New(DefaultTTL)
+			currentTime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+			subject.now = func() time.Time { return currentTime }
+
+			subject.Remember(test.remembered...)
+			subject.Forget(test.forgotten...)
+			currentTime = currentTime.Add(test.elapsed)
+
+			require.Equal(t, test.wantConsumed, subject.Consume(test.consumed...))
+			if test.wantConsumed {
+				require.False(t, subject.Consume(test.consumed...), "fingerprints should only be consumed once")
+			}
+		})
+	}
+}
+
+func TestExpiredWritesAreRemoved(t *testing.T) {
+	subject := New(DefaultTTL)
+	currentTime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	subject.now = func() time.Time { return currentTime }
+
+	subject.Remember("a", "b")
+	currentTime = currentTime.Add(DefaultTTL)
+	subject.Remember("c")
+	require.Equal(t, map[string]time.Time{"c": currentTime}, subject.written)
+}
+
+func TestWrite(t *testing.T) {
+	subject := New(DefaultTTL)
+
+	err := subject.Write(func() error {
+		require.True(t, subject.Consume("a"), "the write's event can arrive before the write returns")
+		return nil
+	}, "a")
+	require.NoError(t, err)
+
+	writeErr := errors.New("write failed")
+	require.Equal(t, writeErr, subject.Write(func() error { return writeErr }, "b"))
+	require.False(t, subject.Consume("b"), "a failed write should be forgotten")
+}
+
+func TestNilRecentWrites(t *testing.T) {
+	var subject *RecentWrites
+	subject.Remember("a")
+	subject.Forget("a")
+	require.False(t, subject.Consume("a"))
+}
+
+func TestFingerprints(t *testing.T) {
+	require.Equal(t, "github/issue/348/label+enhancement", IssueFingerprint(348, "label+Enhancement"))
+	require.Equal(t, "tracker/story/176651069/current_state=started", StoryFingerprint(176651069, "current_state", "started"))
+	require.Equal(t, "tracker/story/176651069/estimate=3", StoryFingerprint(176651069, "estimate", 3.0))
+	require.Equal(t, "tracker/story/176651069/estimate=3", StoryFingerprint(176651069, "estimate", int64(3)))
+	require.Equal(t, "tracker/story/176651069/estimate=none", StoryFingerprint(176651069, "estimate", nil))
+	require.Equal(t, "tracker/story/176651069/owner_ids=[1 2 3]", StoryFingerprint(176651069, "owner_ids", []int64{3, 1, 2}))
+}
@@ -0,0 +1,8 @@
+package loopguard
+
+import "issues2stories/internal/metrics"
+
+var suppressedEvents = metrics.NewCounterVec(
+	"issues2stories_loop_suppressed_events_total",
+	"Webhook events which were not synced because the app caused them, by source (github or tracker) and reason (own_user or recent_write).",
+	"source", "reason")
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"issues2stories/internal/config"
+	"issues2stories/internal/logging"
+)
+
+type handler struct {
+	metrics     http.Handler
+	credentials config.Authenticator
+}
+
+// NewHandler serves the metrics of the registry. The credentials should be different
+// from the ones used by Tracker, since the metrics are only meant for the operators of the app.
+func NewHandler(registry *Registry, credentials config.Authenticator) http.Handler {
+	return &handler{
+		metrics:     promhttp.HandlerFor(registry.registry, promhttp.HandlerOpts{ErrorLog: errorLogger{}}),
+		credentials: credentials,
+	}
+}
+
+func (h *handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := logging.FromContext(request.Context())
+
+	if request.Method != "GET" {
+		http.Error(responseWriter, "Method is not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := h.credentials.Authenticate(request); err != nil {
+		logger.Warn("Rejecting metrics request due to bad credentials.", "error", err)
+		responseWriter.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.metrics.ServeHTTP(responseWriter, request)
+}
+
+// Logs the errors of the Prometheus client library's handler, e.g. failures to write the metrics.
+type errorLogger struct{}
+
+func (errorLogger) Println(v ...interface{}) {
+	logging.Default().Error("Error serving metrics", "error", fmt.Sprint(v...))
+}
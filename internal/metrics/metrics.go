@@ -0,0 +1,95 @@
+// Package metrics creates the app's Prometheus metrics with the official client library, and keeps them in a
+// registry of the app's own, which is served in the Prometheus exposition formats.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The defaults of the Prometheus client library. Suitable for request latencies in seconds.
+var DefaultBuckets = prometheus.DefBuckets
+
+type Registry struct {
+	registry *prometheus.Registry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{registry: prometheus.NewRegistry()}
+}
+
+// All metrics created by the package-level New* functions are registered here.
+var DefaultRegistry = NewRegistry()
+
+type CounterVec struct {
+	*prometheus.CounterVec
+}
+
+// Create a counter and register it in the DefaultRegistry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labelNames)
+	r.registry.MustRegister(c)
+	return &CounterVec{c}
+}
+
+// Returns the current value of the counter with the given label values. Useful in tests.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	return read(c.WithLabelValues(labelValues...)).GetCounter().GetValue()
+}
+
+type GaugeVec struct {
+	*prometheus.GaugeVec
+}
+
+// Create a gauge and register it in the DefaultRegistry.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labelNames)
+	r.registry.MustRegister(g)
+	return &GaugeVec{g}
+}
+
+// Returns the current value of the gauge with the given label values. Useful in tests.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	return read(g.WithLabelValues(labelValues...)).GetGauge().GetValue()
+}
+
+type HistogramVec struct {
+	*prometheus.HistogramVec
+}
+
+// Create a histogram and register it in the DefaultRegistry.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	// The library needs the buckets in increasing order.
+	sortedBuckets := append([]float64{}, buckets...)
+	sort.Float64s(sortedBuckets)
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: sortedBuckets}, labelNames)
+	r.registry.MustRegister(h)
+	return &HistogramVec{h}
+}
+
+// Returns the number of observations of the histogram with the given label values. Useful in tests.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	return read(h.WithLabelValues(labelValues...).(prometheus.Metric)).GetHistogram().GetSampleCount()
+}
+
+func read(metric prometheus.Metric) *dto.Metric {
+	var m dto.Metric
+	// Writing the library's own metrics doesn't fail.
+	_ = metric.Write(&m)
+	return &m
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/config"
+)
+
+var credentials = &config.BasicAuthCredentials{Username: "metrics-user", Password: "metrics-password"}
+
+// Returns the registry's metrics as a scraper sees them.
+func scrape(t *testing.T, registry *Registry) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth(credentials.Username, credentials.Password)
+	rsp := httptest.NewRecorder()
+	NewHandler(registry, credentials).ServeHTTP(rsp, req)
+	require.Equal(t, http.StatusOK, rsp.Code)
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rsp.Header().Get("Content-Type"))
+	return rsp.Body.String()
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("test_requests_total", "Requests, by operation and status.", "operation", "status")
+	remaining := registry.NewGaugeVec("test_remaining", "Remaining things.\nWith a second line.")
+	latency := registry.NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.1}, "operation")
+
+	requests.WithLabelValues("get", "200").Inc()
+	requests.WithLabelValues("get", "200").Add(2)
+	requests.WithLabelValues("update", `weird "value"`).Inc()
+	remaining.WithLabelValues().Set(4999)
+	latency.WithLabelValues("get").Observe(0.05)
+	latency.WithLabelValues("get").Observe(0.1)
+	latency.WithLabelValues("get").Observe(0.5)
+	latency.WithLabelValues("get").Observe(30)
+
+	require.Equal(t, `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{operation="get",le="0.1"} 2
+test_latency_seconds_bucket{operation="get",le="1"} 3
+test_latency_seconds_bucket{operation="get",le="+Inf"} 4
+test_latency_seconds_sum{operation="get"} 30.65
+test_latency_seconds_count{operation="get"} 4
+# HELP test_remaining Remaining things.\nWith a second line.
+# TYPE test_remaining gauge
+test_remaining 4999
+# HELP test_requests_total Requests, by operation and status.
+# TYPE test_requests_total counter
+test_requests_total{operation="get",status="200"} 3
+test_requests_total{operation="update",status="weird \"value\""} 1
+`, scrape(t, registry))
+
+	require.Equal(t, float64(3), requests.Value("get", "200"))
+	require.Equal(t, float64(4999), remaining.Value())
+	require.Equal(t, uint64(4), latency.Count("get"))
+}
+
+func TestRegistryPanics(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("test_total", "Test.", "label")
+	require.Panics(t, func() { registry.NewGaugeVec("test_total", "Test.") }, "a metric can't be registered twice")
+	require.Panics(t, func() { counter.WithLabelValues("a", "b") }, "the label values must match the label names")
+	require.Panics(t, func() { counter.WithLabelValues("a").Add(-1) }, "counters can't decrease")
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounterVec("test_total", "Test.").WithLabelValues().Inc()
+	subject := NewHandler(registry, credentials)
+
+	tests := []struct {
+		name       string
+		method     string
+		username   string
+		password   string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "serves the metrics",
+			method:     http.MethodGet,
+			username:   "metrics-user",
+			password:   "metrics-password",
+			wantStatus: http.StatusOK,
+			wantBody:   "# HELP test_total Test.\n# TYPE test_total counter\ntest_total 1\n",
+		},
+		{
+			name:       "wrong password is an error",
+			method:     http.MethodGet,
+			username:   "metrics-user",
+			password:   "wrong",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Unauthorized\n",
+		},
+		{
+			name:       "missing credentials is an error",
+			method:     http.MethodGet,
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Unauthorized\n",
+		},
+		{
+			name:       "wrong method is an error",
+			method:     http.MethodPost,
+			username:   "metrics-user",
+			password:   "metrics-password",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Method is not supported\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/metrics", nil)
+			if test.username != "" {
+				req.SetBasicAuth(test.username, test.password)
+			}
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			require.Equal(t, test.wantStatus, rsp.Code)
+			require.Equal(t, test.wantBody, rsp.Body.String())
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+
+	// The cost of new bcrypt hashes. Each request to a protected endpoint verifies a hash,
+	// so this is a trade-off between request latency and resistance to brute force.
+	bcryptCost = 11
+
+	// The parameters of new argon2id hashes, from the recommendations in RFC 9106.
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Returns a new hash of the password using the given algorithm, either Bcrypt or Argon2id.
+// Argon2id hashes are encoded in the PHC string format, e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>".
+func Hash(password, algorithm string) (string, error) {
+	switch algorithm {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case Argon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		params := argon2Params{time: argon2Time, memory: argon2Memory, threads: argon2Threads, salt: salt}
+		params.key = argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, argon2KeyLen)
+		return params.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm %q, must be %s or %s", algorithm, Bcrypt, Argon2id)
+	}
+}
+
+// Returns an error when the hash is not a bcrypt hash or an argon2id hash in the PHC string format.
+func Validate(hash string) error {
+	if isArgon2id(hash) {
+		_, err := parseArgon2id(hash)
+		return err
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return errors.New("password hash must be a bcrypt hash or an argon2id hash in PHC string format")
+	}
+	return nil
+}
+
+// Returns true when the password matches the hash. The comparison takes constant time.
+func Verify(hash, password string) (bool, error) {
+	if isArgon2id(hash) {
+		params, err := parseArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.New("password hash must be a bcrypt hash or an argon2id hash in PHC string format")
+	}
+	return true, nil
+}
+
+type argon2Params struct {
+	time, memory uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+func (p argon2Params) String() string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(p.salt), base64.RawStdEncoding.EncodeToString(p.key))
+}
+
+func isArgon2id(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func parseArgon2id(hash string) (*argon2Params, error) {
+	invalid := errors.New("argon2id password hash must be in PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>")
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, invalid
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, invalid
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, invalid
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, invalid
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, invalid
+	}
+	if params.time == 0 || params.threads == 0 {
+		return nil, invalid
+	}
+	return params, nil
+}
@@ -0,0 +1,89 @@
+package passwordhash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{Bcrypt, Argon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			hash, err := Hash("correct-password", algorithm)
+			require.NoError(t, err)
+			require.NoError(t, Validate(hash))
+
+			ok, err := Verify(hash, "correct-password")
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			ok, err = Verify(hash, "wrong")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			otherHash, err := Hash("correct-password", algorithm)
+			require.NoError(t, err)
+			require.NotEqual(t, hash, otherHash, "hashes should be salted")
+		})
+	}
+
+	_, err := Hash("correct-password", "md5")
+	require.EqualError(t, err, `unsupported password hash algorithm "md5", must be bcrypt or argon2id`)
+}
+
+func TestVerifyKnownHashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		wantOK   bool
+		wantErr  string
+	}{
+		{
+			name:     "bcrypt",
+			hash:     "$2a$04$vXcomGQDPgt89.SPoxmcyetqKvs47htptskXczuzoozNqfzevm/B6",
+			password: "correct-password",
+			wantOK:   true,
+		},
+		{
+			name:     "argon2id",
+			hash:     "$argon2id$v=19$m=16,t=2,p=1$c29tZXNhbHQ$97FcQ2XrXRGBu161IDNkhQ",
+			password: "password",
+			wantOK:   true,
+		},
+		{
+			name:     "argon2id wrong password",
+			hash:     "$argon2id$v=19$m=16,t=2,p=1$c29tZXNhbHQ$97FcQ2XrXRGBu161IDNkhQ",
+			password: "wrong",
+			wantOK:   false,
+		},
+		{
+			name:    "plaintext is not a hash",
+			hash:    "correct-password",
+			wantErr: "password hash must be a bcrypt hash or an argon2id hash in PHC string format",
+		},
+		{
+			name:    "malformed argon2id",
+			hash:    "$argon2id$v=19$m=16,t=2$c29tZXNhbHQ$97FcQ2XrXRGBu161IDNkhQ",
+			wantErr: "argon2id password hash must be in PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>",
+		},
+		{
+			name:    "unsupported argon2id version",
+			hash:    "$argon2id$v=16$m=16,t=2,p=1$c29tZXNhbHQ$97FcQ2XrXRGBu161IDNkhQ",
+			wantErr: "unsupported argon2id version 16",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, err := Verify(test.hash, test.password)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				require.EqualError(t, Validate(test.hash), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, Validate(test.hash))
+			require.Equal(t, test.wantOK, ok)
+		})
+	}
+}
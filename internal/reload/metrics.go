@@ -0,0 +1,8 @@
+package reload
+
+import "issues2stories/internal/metrics"
+
+var reloads = metrics.NewCounterVec(
+	"issues2stories_config_reloads_total",
+	"Attempts to reload the configuration and secrets, by outcome: ok or error.",
+	"outcome")
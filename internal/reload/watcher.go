@@ -0,0 +1,163 @@
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"issues2stories/internal/logging"
+)
+
+// A Watcher calls its reload function when any of its files change, e.g. when Kubernetes updates a mounted
+// ConfigMap or Secret, or when it is triggered, e.g. by SIGHUP. Files are compared by their content, because
+// Kubernetes replaces mounted files by swapping symlinks, which doesn't always change their modification times.
+type Watcher struct {
+	paths   []string
+	reload  func(ctx context.Context, files Files) error
+	trigger chan struct{}
+
+	mu sync.Mutex
+	// The hashes of the files' content when they were last loaded.
+	loaded map[string]string
+	// The hashes of the changed files' content when they were last checked, or nil when they hadn't changed.
+	pending map[string]string
+}
+
+// The content of the watched files by path, as read by the Watcher. A file which couldn't be read is missing.
+// The reload function uses this content, rather than reading the files again, so that it loads exactly the
+// content which the Watcher saw.
+type Files map[string][]byte
+
+// Returns the content of the file from Files, or reads it when it is not a watched file.
+func (f Files) ReadFile(path string) ([]byte, error) {
+	if content, ok := f[path]; ok {
+		return content, nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Returns a Watcher which treats the current content of the files as already loaded.
+func NewWatcher(paths []string, reload func(ctx context.Context, files Files) error) *Watcher {
+	w := &Watcher{paths: paths, reload: reload, trigger: make(chan struct{}, 1)}
+	_, w.loaded = readFiles(paths)
+	return w
+}
+
+// Returns the files whose content changed since it was last loaded, in the order they were given to NewWatcher,
+// and the content of all of the files. Changes are only returned once two consecutive calls have read the same
+// content, so that a file which is still being written, e.g. by an editor, isn't loaded half-written. The returned
+// content is then treated as loaded. A file which can't be read counts as changed, so that the reload function
+// reports the error.
+func (w *Watcher) Changed() ([]string, Files) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	files, hashes := readFiles(w.paths)
+	var changed []string
+	for _, path := range w.paths {
+		if hashes[path] != w.loaded[path] {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		w.pending = nil
+		return nil, nil
+	}
+	if !equal(hashes, w.pending) {
+		w.pending = hashes
+		return nil, nil
+	}
+	w.loaded, w.pending = hashes, nil
+	return changed, files
+}
+
+// Returns the content of all of the files, and treats it as loaded.
+func (w *Watcher) readAll() Files {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	files, hashes := readFiles(w.paths)
+	w.loaded, w.pending = hashes, nil
+	return files
+}
+
+// Reload as soon as possible, whether or not any files changed. Does not block. Triggers which arrive while a
+// reload is pending are combined.
+func (w *Watcher) Trigger() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Check for changed files every interval, and wait for triggers, until the context is done. When the interval
+// is not positive, only triggers cause reloads.
+func (w *Watcher) Start(ctx context.Context, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		ticks = ticker.C
+		go func() {
+			<-ctx.Done()
+			ticker.Stop()
+		}()
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticks:
+				if changed, files := w.Changed(); len(changed) > 0 {
+					logger.Info("Reloading configuration because files changed", "files", changed)
+					w.run(ctx, files)
+				}
+			case <-w.trigger:
+				// Any changes are loaded by this reload, so they don't cause another one.
+				files := w.readAll()
+				logger.Info("Reloading configuration because it was requested")
+				w.run(ctx, files)
+			}
+		}
+	}()
+}
+
+func (w *Watcher) run(ctx context.Context, files Files) {
+	if err := w.reload(ctx, files); err != nil {
+		reloads.WithLabelValues("error").Inc()
+		return
+	}
+	reloads.WithLabelValues("ok").Inc()
+}
+
+// Returns the content of each file which could be read, and the hash of each file's content, which is empty when
+// the file couldn't be read.
+func readFiles(paths []string) (Files, map[string]string) {
+	files := Files{}
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			hashes[path] = ""
+			continue
+		}
+		files[path] = content
+		sum := sha256.Sum256(content)
+		hashes[path] = hex.EncodeToString(sum[:])
+	}
+	return files, hashes
+}
+
+func equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, hash := range a {
+		if other, ok := b[path]; !ok || other != hash {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile, secretFile := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: false\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("secret\n"), 0600))
+
+	subject := NewWatcher([]string{configFile, secretFile}, nil)
+	requireUnchanged := func() {
+		t.Helper()
+		changed, files := subject.Changed()
+		require.Empty(t, changed)
+		require.Nil(t, files)
+	}
+	requireUnchanged()
+
+	// Rewriting the same content is not a change.
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: false\n"), 0600))
+	requireUnchanged()
+
+	// A change is only returned once the next call reads the same content, with the content which was read.
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("rotated\n"), 0600))
+	requireUnchanged()
+	changed, files := subject.Changed()
+	require.Equal(t, []string{secretFile}, changed)
+	require.Equal(t, Files{configFile: []byte("dry_run: false\n"), secretFile: []byte("rotated\n")}, files)
+	requireUnchanged()
+
+	// A file which is still being written is not returned until it stops changing.
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: tr"), 0600))
+	requireUnchanged()
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: true\n"), 0600))
+	requireUnchanged()
+	changed, files = subject.Changed()
+	require.Equal(t, []string{configFile}, changed)
+	require.Equal(t, []byte("dry_run: true\n"), files[configFile])
+
+	// A change which is reverted before it is returned is not a change.
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: maybe\n"), 0600))
+	requireUnchanged()
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: true\n"), 0600))
+	requireUnchanged()
+	requireUnchanged()
+
+	require.NoError(t, os.Remove(configFile))
+	requireUnchanged()
+	changed, files = subject.Changed()
+	require.Equal(t, []string{configFile}, changed)
+	require.Equal(t, Files{secretFile: []byte("rotated\n")}, files)
+	_, err = files.ReadFile(configFile)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("dry_run: false\n"), 0600))
+
+	// Each reload sends the files which it was given, and then returns the next result which the test sends.
+	reloadedFiles := make(chan Files)
+	results := make(chan error)
+	subject := NewWatcher([]string{configFile}, func(_ context.Context, files Files) error {
+		reloadedFiles <- files
+		return <-results
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	okBefore, errorBefore := reloads.Value("ok"), reloads.Value("error")
+	subject.Start(ctx, 10*time.Millisecond)
+
+	requireReloaded := func(wantContent string, result error) {
+		t.Helper()
+		select {
+		case files := <-reloadedFiles:
+			require.Equal(t, wantContent, string(files[configFile]))
+			results <- result
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "expected a reload")
+		}
+	}
+	requireNotReloaded := func() {
+		t.Helper()
+		select {
+		case <-reloadedFiles:
+			require.FailNow(t, "expected no reload")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	requireNotReloaded()
+
+	writeAtomically(t, configFile, "dry_run: true\n")
+	requireReloaded("dry_run: true\n", nil)
+	requireNotReloaded()
+
+	subject.Trigger()
+	requireReloaded("dry_run: true\n", nil)
+
+	writeAtomically(t, configFile, "dry_run: maybe\n")
+	requireReloaded("dry_run: maybe\n", errors.New("invalid config"))
+	// A failed reload is not retried until the files change again.
+	requireNotReloaded()
+
+	cancel()
+	require.Eventually(t, func() bool {
+		return reloads.Value("ok") == okBefore+2 && reloads.Value("error") == errorBefore+1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStartWithoutInterval(t *testing.T) {
+	reloaded := make(chan struct{}, 1)
+	subject := NewWatcher(nil, func(_ context.Context, _ Files) error {
+		reloaded <- struct{}{}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subject.Start(ctx, -1)
+
+	subject.Trigger()
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "expected a reload")
+	}
+}
+
+// Replaces the file in one step, like Kubernetes does with mounted ConfigMaps, so that the watcher never sees it
+// half-written and reloads twice.
+func writeAtomically(t *testing.T, path, content string) {
+	t.Helper()
+	temporary := path + ".tmp"
+	require.NoError(t, ioutil.WriteFile(temporary, []byte(content), 0600))
+	require.NoError(t, os.Rename(temporary, path))
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"issues2stories/internal/logging"
+)
+
+// Options for Run. Zero values mean no delay, no hooks, and no shutdown timeout.
+type Options struct {
+	// How long to keep serving after shutdown begins, while the app reports that it is not ready,
+	// so load balancers can stop sending new requests before the listener closes. Optional.
+	ShutdownDelay time.Duration
+
+	// How long to wait for in-flight requests to finish, and then separately for the OnShutdown hooks to run.
+	ShutdownTimeout time.Duration
+
+	// Called as soon as shutdown begins, e.g. to start failing readiness checks. Optional.
+	BeforeShutdown func()
+
+	// Called after the in-flight requests have drained, e.g. to flush buffered trace spans. Optional.
+	OnShutdown []func(ctx context.Context) error
+}
+
+// Serve requests on the listener until the context is done (e.g. due to SIGTERM), then shut down gracefully:
+// stop accepting new connections, wait for in-flight requests to finish, and flush anything still buffered.
+// Returns nil after a graceful shutdown, or the error which caused the server to stop.
+func Run(ctx context.Context, srv *http.Server, listener net.Listener, opts Options) error {
+	logger := logging.FromContext(ctx)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down gracefully", "shutdown_delay", opts.ShutdownDelay.String(), "shutdown_timeout", opts.ShutdownTimeout.String())
+	if opts.BeforeShutdown != nil {
+		opts.BeforeShutdown()
+	}
+	if opts.ShutdownDelay > 0 {
+		time.Sleep(opts.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+
+	var result error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// Some requests did not finish in time. Cut them off.
+		logger.Error("In-flight requests did not finish before the shutdown timeout", "error", err)
+		_ = srv.Close()
+		result = err
+	} else {
+		logger.Info("All in-flight requests finished")
+	}
+
+	// The hooks get their own deadline, so that they can still flush even when the requests took too long.
+	hooksCtx, cancelHooks := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancelHooks()
+	for _, hook := range opts.OnShutdown {
+		if err := hook(hooksCtx); err != nil {
+			logger.Error("Error while shutting down", "error", err)
+			if result == nil {
+				result = err
+			}
+		}
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) && result == nil {
+		result = err
+	}
+	return result
+}
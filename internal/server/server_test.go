@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name            string
+		requestDuration time.Duration
+		shutdownTimeout time.Duration
+		hookErr         error
+
+		wantRequestFinished bool
+		wantErr             string
+	}{
+		{
+			name:                "in-flight requests finish before the server stops",
+			requestDuration:     200 * time.Millisecond,
+			shutdownTimeout:     5 * time.Second,
+			wantRequestFinished: true,
+		},
+		{
+			name:            "in-flight requests are cut off after the shutdown timeout",
+			requestDuration: 5 * time.Second,
+			shutdownTimeout: 100 * time.Millisecond,
+			wantErr:         "context deadline exceeded",
+		},
+		{
+			name:                "shutdown hook errors are returned",
+			requestDuration:     10 * time.Millisecond,
+			shutdownTimeout:     5 * time.Second,
+			hookErr:             errors.New("could not flush spans"),
+			wantRequestFinished: true,
+			wantErr:             "could not flush spans",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestDuration := test.requestDuration
+			requestStarted := make(chan struct{})
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(requestStarted)
+				time.Sleep(requestDuration)
+				_, _ = w.Write([]byte("done"))
+			})}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			beforeShutdownCalled := false
+			hookCalled := false
+			runErr := make(chan error, 1)
+			go func() {
+				runErr <- Run(ctx, srv, listener, Options{
+					ShutdownTimeout: test.shutdownTimeout,
+					BeforeShutdown:  func() { beforeShutdownCalled = true },
+					OnShutdown: []func(ctx context.Context) error{func(ctx context.Context) error {
+						hookCalled = true
+						return test.hookErr
+					}},
+				})
+			}()
+
+			responseBody := make(chan string, 1)
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if err != nil {
+					responseBody <- ""
+					return
+				}
+				defer resp.Body.Close()
+				body, _ := ioutil.ReadAll(resp.Body)
+				responseBody <- string(body)
+			}()
+
+			<-requestStarted
+			cancel()
+
+			select {
+			case err := <-runErr:
+				if test.wantErr != "" {
+					require.EqualError(t, err, test.wantErr)
+				} else {
+					require.NoError(t, err)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("Run did not return after the context was cancelled")
+			}
+
+			require.True(t, beforeShutdownCalled)
+			require.True(t, hookCalled)
+			if test.wantRequestFinished {
+				require.Equal(t, "done", <-responseBody)
+			} else {
+				require.Equal(t, "", <-responseBody)
+			}
+
+			// The listener is closed, so no new requests are accepted.
+			_, err = net.Dial("tcp", listener.Addr().String())
+			require.Error(t, err)
+		})
+	}
+}
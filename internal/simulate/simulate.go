@@ -0,0 +1,345 @@
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/importtypes"
+	"issues2stories/internal/trackeractivity"
+	"issues2stories/internal/trackerapi"
+)
+
+// The credentials used internally to call the webhook handler. They never leave this process.
+var simulatorCredentials = &config.BasicAuthCredentials{Username: "simulator", Password: "simulator"}
+
+type Options struct {
+	// Path to a Tracker activity webhook JSON payload, like those in internal/trackeractivity/testdata.
+	EventFile string
+
+	// The GitHub issue number which every story in the event is assumed to be linked to.
+	IssueNumber int
+
+	// Path to a JSON file describing the current state of the issue, e.g. {"labels": ["bug"]}.
+	// Ignored when LiveGitHubClient is not nil.
+	IssueFixtureFile string
+
+	// When not nil, the current state of the issue is read from GitHub using this client.
+	// The simulator never calls any of this client's methods which would modify GitHub.
+	LiveGitHubClient githubapi.GitHubAPI
+
+	// When true, print the planned changes as a diff against the current state of the issue.
+	Diff bool
+
+	Configuration *config.Config
+}
+
+// A plannedUpdate is what the webhook handler would have sent to GitHub.
+type plannedUpdate struct {
+	issueNumber int
+	before      *githubapi.Issue
+	request     *github.IssueRequest
+}
+
+// A plannedComment is a comment which the webhook handler would have added to an issue.
+type plannedComment struct {
+	issueNumber int
+	body        string
+}
+
+// Wraps a source of issue details and records the updates instead of applying them.
+type recordingGitHubAPI struct {
+	getIssue func(ctx context.Context, issueNumber int) (*githubapi.Issue, error)
+	fetched  map[int]*githubapi.Issue
+	planned  []plannedUpdate
+	comments []plannedComment
+}
+
+func (r *recordingGitHubAPI) GetIssue(ctx context.Context, issueNumber int) (*githubapi.Issue, error) {
+	issue, err := r.getIssue(ctx, issueNumber)
+	if err != nil {
+		return nil, err
+	}
+	r.fetched[issueNumber] = issue
+	return issue, nil
+}
+
+func (r *recordingGitHubAPI) UpdateIssue(_ context.Context, issueNumber int, updates *github.IssueRequest) error {
+	r.planned = append(r.planned, plannedUpdate{issueNumber: issueNumber, before: r.fetched[issueNumber], request: updates})
+	return nil
+}
+
+func (r *recordingGitHubAPI) ListAllOpenIssuesForRepoInImportFormat(_ context.Context) ([]importtypes.Issue, error) {
+	return nil, fmt.Errorf("listing issues is not supported by the simulator")
+}
+
+func (r *recordingGitHubAPI) CheckRepoAccess(_ context.Context) error {
+	return nil
+}
+
+func (r *recordingGitHubAPI) FindUsersByEmail(_ context.Context, _ string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *recordingGitHubAPI) ListCommitAuthors(_ context.Context, _ int) ([]githubapi.CommitAuthor, error) {
+	return nil, nil
+}
+
+func (r *recordingGitHubAPI) GetAuthenticatedUser(_ context.Context) (string, error) {
+	return "", nil
+}
+
+func (r *recordingGitHubAPI) CreateComment(_ context.Context, issueNumber int, body string) (int64, error) {
+	r.comments = append(r.comments, plannedComment{issueNumber: issueNumber, body: body})
+	return int64(len(r.comments)), nil
+}
+
+func (r *recordingGitHubAPI) DownloadAttachment(_ context.Context, _ string, _ int64) (*githubapi.Attachment, error) {
+	return nil, fmt.Errorf("downloading files is not supported by the simulator")
+}
+
+// The simulator handles only one event, so there are no earlier comments to edit.
+func (r *recordingGitHubAPI) EditComment(_ context.Context, _ int64, _ string) error {
+	return fmt.Errorf("editing comments is not supported by the simulator")
+}
+
+// Pretends that every story is linked to the same GitHub issue.
+type fixedTrackerAPI struct {
+	issueNumber int
+}
+
+func (f *fixedTrackerAPI) GetGithubIssueIDLinkedToStory(_ context.Context, _, _ int64) (int, error) {
+	return f.issueNumber, nil
+}
+
+func (f *fixedTrackerAPI) CheckToken(_ context.Context) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) CheckProjectAccess(_ context.Context, _ int64) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) ListProjectMembers(_ context.Context, _ int64) ([]trackerapi.Person, error) {
+	return nil, nil
+}
+
+func (f *fixedTrackerAPI) FindStoriesLinkedToGitHubIssue(_ context.Context, _ int64, _ int) ([]trackerapi.Story, error) {
+	return nil, nil
+}
+
+func (f *fixedTrackerAPI) UpdateStory(_ context.Context, _, _ int64, _ *trackerapi.StoryUpdate) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) AddComment(_ context.Context, _, _ int64, _ string) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) UploadFile(_ context.Context, _ int64, _, _ string, _ []byte) (*trackerapi.FileAttachment, error) {
+	return nil, fmt.Errorf("uploading files is not supported by the simulator")
+}
+
+func (f *fixedTrackerAPI) AddCommentWithAttachments(_ context.Context, _, _ int64, _ string, _ []trackerapi.FileAttachment) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) ListTasks(_ context.Context, _, _ int64) ([]trackerapi.Task, error) {
+	return nil, fmt.Errorf("listing tasks is not supported by the simulator")
+}
+
+func (f *fixedTrackerAPI) CreateTask(_ context.Context, _, _ int64, _ *trackerapi.TaskUpdate) (*trackerapi.Task, error) {
+	return nil, fmt.Errorf("creating tasks is not supported by the simulator")
+}
+
+func (f *fixedTrackerAPI) UpdateTask(_ context.Context, _, _, _ int64, _ *trackerapi.TaskUpdate) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) DeleteTask(_ context.Context, _, _, _ int64) error {
+	return nil
+}
+
+func (f *fixedTrackerAPI) GetProject(_ context.Context, _ int64) (*trackerapi.Project, error) {
+	return nil, nil
+}
+
+// The simulated app has no Tracker user, so no event is mistaken for one of the app's own changes.
+func (f *fixedTrackerAPI) GetAuthenticatedPerson(_ context.Context) (*trackerapi.Person, error) {
+	return &trackerapi.Person{}, nil
+}
+
+// The simulated project has no iterations, so comments don't mention one.
+func (f *fixedTrackerAPI) GetCurrentIteration(_ context.Context, _ int64) (*trackerapi.Iteration, error) {
+	return &trackerapi.Iteration{}, nil
+}
+
+// Run the Tracker activity event through the same webhook handler that the server uses,
+// and print the GitHub issue updates that the handler would have made.
+func Run(ctx context.Context, opts *Options, out io.Writer) error {
+	event, err := ioutil.ReadFile(opts.EventFile)
+	if err != nil {
+		return fmt.Errorf("could not read event file: %v", err)
+	}
+
+	getIssue, err := issueSource(opts)
+	if err != nil {
+		return err
+	}
+	recorder := &recordingGitHubAPI{getIssue: getIssue, fetched: map[int]*githubapi.Issue{}}
+
+	configuration := opts.Configuration
+	if configuration == nil {
+		configuration = &config.Config{}
+	}
+	// The recorder already prevents any updates, so the handler should behave as if it was for real.
+	simulatedConfiguration := *configuration
+	simulatedConfiguration.DryRun = false
+	simulatedConfiguration.Bindings = nil
+	// Copying attachments only changes the story, and the simulator only shows the changes to the issue.
+	simulatedConfiguration.AttachmentCopy.Enabled = false
+	// Syncing tasks needs the story's tasks, which the simulator doesn't have.
+	simulatedConfiguration.TaskSync.Enabled = false
+
+	handler := trackeractivity.NewHandler(
+		&fixedTrackerAPI{issueNumber: opts.IssueNumber}, recorder, &simulatedConfiguration, simulatorCredentials, nil, nil, nil)
+
+	query := url.Values{"username": {simulatorCredentials.Username}, "password": {simulatorCredentials.Password}}
+	request := httptest.NewRequest(http.MethodPost, "/tracker_activity?"+query.Encode(), strings.NewReader(string(event)))
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		return fmt.Errorf("webhook handler returned status %d: %s", response.Code, strings.TrimSpace(response.Body.String()))
+	}
+
+	if len(recorder.planned) == 0 && len(recorder.comments) == 0 {
+		fmt.Fprintln(out, "No GitHub issue updates planned.")
+		return nil
+	}
+	for _, update := range recorder.planned {
+		if opts.Diff {
+			printDiff(out, update)
+		} else if err := printJSON(out, update); err != nil {
+			return err
+		}
+	}
+	for _, comment := range recorder.comments {
+		fmt.Fprintf(out, "Planned comment on issue #%d:\n%s\n", comment.issueNumber, comment.body)
+	}
+	return nil
+}
+
+func issueSource(opts *Options) (func(ctx context.Context, issueNumber int) (*githubapi.Issue, error), error) {
+	if opts.LiveGitHubClient != nil {
+		return opts.LiveGitHubClient.GetIssue, nil
+	}
+
+	issue := &githubapi.Issue{Labels: []string{}}
+	if opts.IssueFixtureFile != "" {
+		content, err := ioutil.ReadFile(opts.IssueFixtureFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read issue fixture file: %v", err)
+		}
+		if err := json.Unmarshal(content, issue); err != nil {
+			return nil, fmt.Errorf("could not parse issue fixture file as JSON: %v", err)
+		}
+		if issue.Labels == nil {
+			issue.Labels = []string{}
+		}
+	}
+	return func(_ context.Context, _ int) (*githubapi.Issue, error) {
+		// Return a copy so the handler can't change the fixture between calls.
+		return &githubapi.Issue{Labels: append([]string{}, issue.Labels...), Assignees: append([]string{}, issue.Assignees...), Body: issue.Body}, nil
+	}, nil
+}
+
+func printJSON(out io.Writer, update plannedUpdate) error {
+	body, err := json.MarshalIndent(update.request, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not serialize planned update for issue #%d: %v", update.issueNumber, err)
+	}
+	fmt.Fprintf(out, "Planned update for issue #%d:\n%s\n", update.issueNumber, body)
+	return nil
+}
+
+func printDiff(out io.Writer, update plannedUpdate) {
+	fmt.Fprintf(out, "--- issue #%d (current)\n+++ issue #%d (planned)\n", update.issueNumber, update.issueNumber)
+
+	request := update.request
+	if request.Title != nil {
+		fmt.Fprintf(out, "+ title: %q\n", *request.Title)
+	}
+	if request.Body != nil {
+		fmt.Fprintln(out, "+ body:")
+		for _, line := range strings.Split(strings.TrimSuffix(*request.Body, "\n"), "\n") {
+			fmt.Fprintf(out, "+   %s\n", line)
+		}
+	}
+	if request.State != nil {
+		fmt.Fprintf(out, "+ state: %s\n", *request.State)
+	}
+	if request.Labels != nil {
+		before := []string{}
+		if update.before != nil {
+			before = update.before.Labels
+		}
+		fmt.Fprintln(out, "  labels:")
+		for _, line := range diffLines(before, *request.Labels) {
+			fmt.Fprintf(out, "%s\n", line)
+		}
+	}
+	if request.Assignees != nil {
+		fmt.Fprintf(out, "+ assignees: [%s]\n", strings.Join(*request.Assignees, ", "))
+	}
+}
+
+// Compare two sets of strings, ignoring order, and return one sorted line per value
+// prefixed with "-" when removed, "+" when added, or " " when unchanged.
+func diffLines(before, after []string) []string {
+	inBefore := map[string]bool{}
+	for _, value := range before {
+		inBefore[value] = true
+	}
+	inAfter := map[string]bool{}
+	for _, value := range after {
+		inAfter[value] = true
+	}
+
+	all := []string{}
+	for value := range inBefore {
+		all = append(all, value)
+	}
+	for value := range inAfter {
+		if !inBefore[value] {
+			all = append(all, value)
+		}
+	}
+	sort.Strings(all)
+
+	lines := []string{}
+	for _, value := range all {
+		switch {
+		case inBefore[value] && !inAfter[value]:
+			lines = append(lines, "-   "+value)
+		case !inBefore[value] && inAfter[value]:
+			lines = append(lines, "+   "+value)
+		default:
+			lines = append(lines, "    "+value)
+		}
+	}
+	return lines
+}
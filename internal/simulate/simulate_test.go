@@ -0,0 +1,162 @@
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/githubapi"
+)
+
+// The simulator reads the same fixtures that the webhook handler's own tests use.
+const activityFixtures = "../trackeractivity/testdata/"
+
+type fakeLiveGitHubAPI struct {
+	githubapi.GitHubAPI // not implemented, so calling any other method will panic
+	issue               *githubapi.Issue
+	err                 error
+}
+
+func (f *fakeLiveGitHubAPI) GetIssue(_ context.Context, _ int) (*githubapi.Issue, error) {
+	return f.issue, f.err
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+
+		wantOutput string
+		wantError  string
+	}{
+		{
+			name: "prints the planned update as JSON",
+			opts: &Options{
+				EventFile:        activityFixtures + "edit_accept_story.json",
+				IssueNumber:      42,
+				IssueFixtureFile: "testdata/issue_in_backlog.json",
+			},
+			wantOutput: `Planned update for issue #42:
+{
+  "labels": [
+    "initial-unrelated-label",
+    "enhancement",
+    "estimate/XXL",
+    "state/accepted"
+  ],
+  "state": "closed"
+}
+`,
+		},
+		{
+			name: "prints the planned update as a diff",
+			opts: &Options{
+				EventFile:        activityFixtures + "edit_accept_story.json",
+				IssueNumber:      42,
+				IssueFixtureFile: "testdata/issue_in_backlog.json",
+				Diff:             true,
+			},
+			wantOutput: `--- issue #42 (current)
++++ issue #42 (planned)
++ state: closed
+  labels:
+    enhancement
+    estimate/XXL
+    initial-unrelated-label
+-   priority/backlog
++   state/accepted
+-   state/delivered
+`,
+		},
+		{
+			name: "prints title and body changes in the diff",
+			opts: &Options{
+				EventFile:   activityFixtures + "edit_story_change_description.json",
+				IssueNumber: 7,
+				Diff:        true,
+			},
+			wantOutput: `--- issue #7 (current)
++++ issue #7 (planned)
++ body:
++   This is the UPDATED description.
+`,
+		},
+		{
+			name: "reads the current issue from GitHub when live",
+			opts: &Options{
+				EventFile:        activityFixtures + "move_story_from_icebox_to_backlog.json",
+				IssueNumber:      42,
+				LiveGitHubClient: &fakeLiveGitHubAPI{issue: &githubapi.Issue{Labels: []string{"priority/undecided", "bug"}}},
+				Diff:             true,
+			},
+			wantOutput: `--- issue #42 (current)
++++ issue #42 (planned)
+  labels:
+    bug
++   priority/backlog
+-   priority/undecided
+`,
+		},
+		{
+			name: "reports when there is nothing to update",
+			opts: &Options{
+				EventFile:   activityFixtures + "delete_story.json",
+				IssueNumber: 42,
+			},
+			wantOutput: "No GitHub issue updates planned.\n",
+		},
+		{
+			name: "error reading the event file",
+			opts: &Options{
+				EventFile: "testdata/does_not_exist.json",
+			},
+			wantError: "could not read event file: open testdata/does_not_exist.json: no such file or directory",
+		},
+		{
+			name: "error reading the issue fixture file",
+			opts: &Options{
+				EventFile:        activityFixtures + "edit_accept_story.json",
+				IssueFixtureFile: "testdata/does_not_exist.json",
+			},
+			wantError: "could not read issue fixture file: open testdata/does_not_exist.json: no such file or directory",
+		},
+		{
+			name: "error parsing the issue fixture file",
+			opts: &Options{
+				EventFile:        activityFixtures + "edit_accept_story.json",
+				IssueFixtureFile: "testdata/not_json.json",
+			},
+			wantError: "could not parse issue fixture file as JSON: invalid character 'h' in literal true (expecting 'r')",
+		},
+		{
+			name: "error from the webhook handler",
+			opts: &Options{
+				EventFile: "testdata/not_json.json",
+			},
+			wantError: "webhook handler returned status 400: can't parse json body",
+		},
+		{
+			name: "error reading the issue from GitHub when live",
+			opts: &Options{
+				EventFile:        activityFixtures + "edit_accept_story.json",
+				IssueNumber:      42,
+				LiveGitHubClient: &fakeLiveGitHubAPI{err: errors.New("fake GitHub error")},
+			},
+			wantError: "webhook handler returned status 502: can't get GitHub issue details from GitHub",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Run(context.Background(), test.opts, &out)
+			if test.wantError != "" {
+				require.EqualError(t, err, test.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantOutput, out.String())
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package tasklist
+
+import "issues2stories/internal/metrics"
+
+var taskChanges = metrics.NewCounterVec(
+	"issues2stories_tracker_task_changes_total",
+	"Changes to Tracker story tasks which were made to match the task lists of their GitHub issues, by change.",
+	"change")
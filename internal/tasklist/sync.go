@@ -0,0 +1,253 @@
+package tasklist
+
+import (
+	"context"
+	"sort"
+
+	"issues2stories/internal/trackerapi"
+)
+
+// A change to one of a story's tasks, which makes the tasks match the issue's task list.
+type Change struct {
+	// The task to change, or zero for a task to create.
+	TaskID int64
+
+	// Delete the task instead of updating it.
+	Delete bool
+
+	Update trackerapi.TaskUpdate
+
+	// The index of the item which the task is synced with, or -1 for a task to delete.
+	Item int
+}
+
+// Returns the task which each item is synced with, or zero. An item is synced with the task in its marker, or else
+// with a task with the same text, so that items which were written by hand before they were synced still match.
+// Each task is synced with at most one item, e.g. when an item was copied with its marker.
+func match(items []Item, tasks []trackerapi.Task) []int64 {
+	exists := map[int64]bool{}
+	for _, task := range tasks {
+		exists[task.ID] = true
+	}
+	matches := make([]int64, len(items))
+	claimed := map[int64]bool{}
+	for i, item := range items {
+		if exists[item.TaskID] && !claimed[item.TaskID] {
+			matches[i] = item.TaskID
+			claimed[item.TaskID] = true
+		}
+	}
+	for i, item := range items {
+		if matches[i] != 0 || orphaned(item, exists) {
+			continue
+		}
+		for _, task := range tasks {
+			if !claimed[task.ID] && normalize(task.Description) == normalize(item.Text) {
+				matches[i] = task.ID
+				claimed[task.ID] = true
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// An item is orphaned when its task no longer exists, i.e. it was deleted in Tracker.
+func orphaned(item Item, exists map[int64]bool) bool {
+	return item.TaskID != 0 && !exists[item.TaskID]
+}
+
+func byPosition(tasks []trackerapi.Task) []trackerapi.Task {
+	sorted := append([]trackerapi.Task{}, tasks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Position < sorted[j].Position })
+	return sorted
+}
+
+// Returns the issue's task list items after the story's tasks changed in Tracker. The synced items become the
+// story's tasks, in Tracker's order, and the tasks which are not in the task list yet are added after the last of
+// them. The items of tasks which were deleted are removed. Items which were only added in GitHub are left alone.
+func ItemsForTasks(body string, tasks []trackerapi.Task) []Item {
+	tasks = byPosition(tasks)
+	exists := map[int64]bool{}
+	for _, task := range tasks {
+		exists[task.ID] = true
+	}
+	items := Parse(body)
+	matches := match(items, tasks)
+
+	var result []Item
+	var synced []int
+	for i, item := range items {
+		switch {
+		case matches[i] != 0:
+			synced = append(synced, len(result))
+			result = append(result, item)
+		case orphaned(item, exists):
+		default:
+			// A copied marker is removed.
+			item.TaskID = 0
+			result = append(result, item)
+		}
+	}
+
+	added := len(result)
+	if len(synced) > 0 {
+		added = synced[len(synced)-1] + 1
+	}
+	for i, task := range tasks {
+		item := Item{Text: task.Description, Complete: task.Complete, TaskID: task.ID}
+		if i < len(synced) {
+			result[synced[i]] = item
+			continue
+		}
+		result = append(result[:added], append([]Item{item}, result[added:]...)...)
+		added++
+	}
+	return result
+}
+
+// Returns the tasks with their descriptions rewritten, e.g. translated for GitHub, so that they can be compared with
+// the issue's task list.
+func TranslateTasks(tasks []trackerapi.Task, translate func(string) string) []trackerapi.Task {
+	translated := append([]trackerapi.Task{}, tasks...)
+	for i := range translated {
+		translated[i].Description = translate(translated[i].Description)
+	}
+	return translated
+}
+
+// Returns the changes with the tasks' new descriptions rewritten, e.g. translated for Tracker. A task whose
+// description would then be the same as before is not changed, and neither is its description.
+func TranslateChanges(changes []Change, tasks []trackerapi.Task, translate func(string) string) []Change {
+	descriptions := map[int64]string{}
+	for _, task := range tasks {
+		descriptions[task.ID] = normalize(task.Description)
+	}
+	var translated []Change
+	for _, change := range changes {
+		if change.Update.Description != nil {
+			text := normalize(translate(*change.Update.Description))
+			if description, ok := descriptions[change.TaskID]; ok && text == description {
+				change.Update.Description = nil
+				if change.Update == (trackerapi.TaskUpdate{}) {
+					continue
+				}
+			} else {
+				change.Update.Description = &text
+			}
+		}
+		translated = append(translated, change)
+	}
+	return translated
+}
+
+// Returns the changes to make to the story's tasks after the issue's task list was edited in GitHub, and the body's
+// items marked with the tasks which they are synced with. Items which are not synced with a task become new tasks,
+// and the tasks of items which were removed from the previous body are deleted. Tasks which were never in the issue's
+// task list are left alone, after the synced ones. Items whose task was deleted in Tracker are not synced again.
+// The positions of the changes are correct when the changes are made in order.
+func TaskChanges(previousBody, body string, tasks []trackerapi.Task) ([]Item, []Change) {
+	tasks = byPosition(tasks)
+	byID := map[int64]trackerapi.Task{}
+	exists := map[int64]bool{}
+	for _, task := range tasks {
+		byID[task.ID] = task
+		exists[task.ID] = true
+	}
+	items := Parse(body)
+	matches := match(items, tasks)
+
+	var changes []Change
+	onIssue := map[int64]bool{}
+	for _, taskID := range matches {
+		onIssue[taskID] = true
+	}
+	deleted := map[int64]bool{}
+	for _, item := range Parse(previousBody) {
+		if exists[item.TaskID] && !onIssue[item.TaskID] && !deleted[item.TaskID] {
+			changes = append(changes, Change{TaskID: item.TaskID, Delete: true, Item: -1})
+			deleted[item.TaskID] = true
+		}
+	}
+
+	// The tasks' order, as the changes are made. Zero stands for a created task.
+	var order []int64
+	for _, task := range tasks {
+		if !deleted[task.ID] {
+			order = append(order, task.ID)
+		}
+	}
+	position := 0
+	for i, item := range items {
+		if orphaned(item, exists) {
+			continue
+		}
+		position++
+		p := position
+		items[i].TaskID = matches[i]
+		if matches[i] == 0 {
+			text, complete := normalize(item.Text), item.Complete
+			changes = append(changes, Change{Item: i, Update: trackerapi.TaskUpdate{Description: &text, Complete: &complete, Position: &p}})
+			order = moveTo(order, 0, position-1)
+			continue
+		}
+		task := byID[matches[i]]
+		var update trackerapi.TaskUpdate
+		if normalize(task.Description) != normalize(item.Text) {
+			text := normalize(item.Text)
+			update.Description = &text
+		}
+		if task.Complete != item.Complete {
+			complete := item.Complete
+			update.Complete = &complete
+		}
+		if order[position-1] != task.ID {
+			update.Position = &p
+			order = moveTo(order, task.ID, position-1)
+		}
+		if update != (trackerapi.TaskUpdate{}) {
+			changes = append(changes, Change{TaskID: task.ID, Item: i, Update: update})
+		}
+	}
+	return items, changes
+}
+
+// Returns the order with the task moved to the index, or inserted there when it is zero.
+func moveTo(order []int64, taskID int64, index int) []int64 {
+	moved := make([]int64, 0, len(order)+1)
+	for _, id := range order {
+		if id != taskID || taskID == 0 {
+			moved = append(moved, id)
+		}
+	}
+	return append(moved[:index], append([]int64{taskID}, moved[index:]...)...)
+}
+
+// Makes the changes to the story's tasks in order, and returns the items with the IDs of the created tasks, ready to
+// be written back to the issue's body. Stops at the first change which fails.
+func Apply(ctx context.Context, tracker trackerapi.TrackerAPI, trackerProjectID, trackerStoryID int64, items []Item, changes []Change) ([]Item, error) {
+	items = append([]Item{}, items...)
+	for _, change := range changes {
+		update := change.Update
+		switch {
+		case change.Delete:
+			if err := tracker.DeleteTask(ctx, trackerProjectID, trackerStoryID, change.TaskID); err != nil {
+				return nil, err
+			}
+			taskChanges.WithLabelValues("deleted").Inc()
+		case change.TaskID == 0:
+			created, err := tracker.CreateTask(ctx, trackerProjectID, trackerStoryID, &update)
+			if err != nil {
+				return nil, err
+			}
+			items[change.Item].TaskID = created.ID
+			taskChanges.WithLabelValues("created").Inc()
+		default:
+			if err := tracker.UpdateTask(ctx, trackerProjectID, trackerStoryID, change.TaskID, &update); err != nil {
+				return nil, err
+			}
+			taskChanges.WithLabelValues("updated").Inc()
+		}
+	}
+	return items, nil
+}
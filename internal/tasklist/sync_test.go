@@ -0,0 +1,228 @@
+package tasklist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/trackerapi"
+)
+
+func TestItemsForTasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		tasks []trackerapi.Task
+		want  []Item
+	}{
+		{
+			name: "synced items become the tasks in Tracker's order, and new tasks are added after them",
+			body: "- [ ] One <!-- issues2stories: task 1 -->\n- [ ] GitHub only\n- [ ] Two <!-- issues2stories: task 2 -->\n- [ ] Later",
+			tasks: []trackerapi.Task{
+				{ID: 1, Description: "One", Complete: true, Position: 2},
+				{ID: 2, Description: "Two, edited", Position: 1},
+				{ID: 3, Description: "Three", Position: 3},
+			},
+			want: []Item{
+				{Text: "Two, edited", TaskID: 2},
+				{Text: "GitHub only"},
+				{Text: "One", Complete: true, TaskID: 1},
+				{Text: "Three", TaskID: 3},
+				{Text: "Later"},
+			},
+		},
+		{
+			name:  "items without markers are synced with tasks with the same text",
+			body:  "- [ ] One\n- [ ] One",
+			tasks: []trackerapi.Task{{ID: 1, Description: "One", Position: 1}},
+			want:  []Item{{Text: "One", TaskID: 1}, {Text: "One"}},
+		},
+		{
+			name:  "items of deleted tasks are removed, and copied markers are dropped",
+			body:  "- [ ] Gone <!-- issues2stories: task 9 -->\n- [ ] One <!-- issues2stories: task 1 -->\n- [ ] Copy <!-- issues2stories: task 1 -->",
+			tasks: []trackerapi.Task{{ID: 1, Description: "One", Position: 1}},
+			want:  []Item{{Text: "One", TaskID: 1}, {Text: "Copy"}},
+		},
+		{
+			name:  "a body without a task list gets all of the tasks",
+			body:  "Text",
+			tasks: []trackerapi.Task{{ID: 1, Description: "One", Position: 1}},
+			want:  []Item{{Text: "One", TaskID: 1}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, ItemsForTasks(test.body, test.tasks))
+		})
+	}
+}
+
+// Describes the change, e.g. `update 2 for item 0: {"position":1}`.
+func describe(change Change) string {
+	update, _ := json.Marshal(change.Update)
+	switch {
+	case change.Delete:
+		return fmt.Sprintf("delete %d", change.TaskID)
+	case change.TaskID == 0:
+		return fmt.Sprintf("create item %d: %s", change.Item, update)
+	default:
+		return fmt.Sprintf("update %d for item %d: %s", change.TaskID, change.Item, update)
+	}
+}
+
+func TestTaskChanges(t *testing.T) {
+	tasks := []trackerapi.Task{
+		{ID: 1, Description: "One", Position: 1},
+		{ID: 2, Description: "Two", Position: 2},
+		{ID: 3, Description: "Tracker only", Position: 3},
+	}
+	synced := "- [ ] One <!-- issues2stories: task 1 -->\n- [ ] Two <!-- issues2stories: task 2 -->\n"
+
+	tests := []struct {
+		name         string
+		previousBody string
+		body         string
+		wantItems    []Item
+		wantChanges  []string
+	}{
+		{
+			name:         "unchanged items need no changes",
+			previousBody: synced,
+			body:         synced + "More text",
+			wantItems:    []Item{{Text: "One", TaskID: 1}, {Text: "Two", TaskID: 2}},
+		},
+		{
+			name:         "new items become tasks in their places",
+			previousBody: synced,
+			body:         "- [ ] New\n" + synced + "- [x] Last",
+			wantItems:    []Item{{Text: "New"}, {Text: "One", TaskID: 1}, {Text: "Two", TaskID: 2}, {Text: "Last", Complete: true}},
+			wantChanges: []string{
+				`create item 0: {"description":"New","complete":false,"position":1}`,
+				`create item 3: {"description":"Last","complete":true,"position":4}`,
+			},
+		},
+		{
+			name:         "checked, edited and reordered items update their tasks",
+			previousBody: synced,
+			body:         "- [x] Two <!-- issues2stories: task 2 -->\n- [ ] One, edited <!-- issues2stories: task 1 -->\n",
+			wantItems:    []Item{{Text: "Two", Complete: true, TaskID: 2}, {Text: "One, edited", TaskID: 1}},
+			wantChanges: []string{
+				`update 2 for item 0: {"complete":true,"position":1}`,
+				`update 1 for item 1: {"description":"One, edited"}`,
+			},
+		},
+		{
+			name:         "removed items delete their tasks",
+			previousBody: synced,
+			body:         "- [ ] Two <!-- issues2stories: task 2 -->\n",
+			wantItems:    []Item{{Text: "Two", TaskID: 2}},
+			wantChanges:  []string{"delete 1"},
+		},
+		{
+			name:      "items without markers are synced with tasks with the same text",
+			body:      "- [ ] Tracker only\n- [ ] One\n",
+			wantItems: []Item{{Text: "Tracker only", TaskID: 3}, {Text: "One", TaskID: 1}},
+			// Moving the first task also moves the second into place.
+			wantChanges: []string{`update 3 for item 0: {"position":1}`},
+		},
+		{
+			name:         "items whose tasks were deleted in Tracker are not synced again",
+			previousBody: synced,
+			body:         "- [ ] Gone <!-- issues2stories: task 9 -->\n" + synced,
+			wantItems:    []Item{{Text: "Gone", TaskID: 9}, {Text: "One", TaskID: 1}, {Text: "Two", TaskID: 2}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items, changes := TaskChanges(test.previousBody, test.body, tasks)
+			var described []string
+			for _, change := range changes {
+				described = append(described, describe(change))
+			}
+			require.Equal(t, test.wantItems, items)
+			require.Equal(t, test.wantChanges, described)
+		})
+	}
+}
+
+type fakeTrackerAPI struct {
+	trackerapi.TrackerAPI
+
+	err   error
+	calls []string
+}
+
+func (f *fakeTrackerAPI) CreateTask(_ context.Context, _, trackerStoryID int64, task *trackerapi.TaskUpdate) (*trackerapi.Task, error) {
+	f.calls = append(f.calls, fmt.Sprintf("create task for story %d: %s", trackerStoryID, *task.Description))
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &trackerapi.Task{ID: int64(100 + len(f.calls))}, nil
+}
+
+func (f *fakeTrackerAPI) UpdateTask(_ context.Context, _, trackerStoryID, trackerTaskID int64, _ *trackerapi.TaskUpdate) error {
+	f.calls = append(f.calls, fmt.Sprintf("update task %d of story %d", trackerTaskID, trackerStoryID))
+	return f.err
+}
+
+func (f *fakeTrackerAPI) DeleteTask(_ context.Context, _, trackerStoryID, trackerTaskID int64) error {
+	f.calls = append(f.calls, fmt.Sprintf("delete task %d of story %d", trackerTaskID, trackerStoryID))
+	return f.err
+}
+
+func TestTranslateTasks(t *testing.T) {
+	tasks := []trackerapi.Task{{ID: 1, Description: "Ask @ryan"}, {ID: 2, Description: "Test it"}}
+	translated := TranslateTasks(tasks, func(text string) string { return strings.ReplaceAll(text, "@ryan", "@cfryanr") })
+	require.Equal(t, []trackerapi.Task{{ID: 1, Description: "Ask @cfryanr"}, {ID: 2, Description: "Test it"}}, translated)
+	require.Equal(t, "Ask @ryan", tasks[0].Description, "the tasks should not be changed")
+}
+
+func TestTranslateChanges(t *testing.T) {
+	text := func(s string) *string { return &s }
+	complete := true
+	tasks := []trackerapi.Task{
+		{ID: 1, Description: "Ask @ryan"},
+		{ID: 2, Description: "Ask @mo"},
+		{ID: 3, Description: "Test it"},
+	}
+	changes := []Change{
+		{TaskID: 1, Update: trackerapi.TaskUpdate{Description: text("Ask @cfryanr")}, Item: 0},
+		{TaskID: 2, Update: trackerapi.TaskUpdate{Description: text("Ask @cfryanr")}, Item: 1},
+		{TaskID: 3, Update: trackerapi.TaskUpdate{Description: text("Test it"), Complete: &complete}, Item: 2},
+		{Update: trackerapi.TaskUpdate{Description: text("Ask  @cfryanr")}, Item: 3},
+		{TaskID: 4, Delete: true, Item: -1},
+	}
+	translated := TranslateChanges(changes, tasks, func(text string) string { return strings.ReplaceAll(text, "@cfryanr", "@ryan") })
+	require.Equal(t, []Change{
+		{TaskID: 2, Update: trackerapi.TaskUpdate{Description: text("Ask @ryan")}, Item: 1},
+		{TaskID: 3, Update: trackerapi.TaskUpdate{Complete: &complete}, Item: 2},
+		{Update: trackerapi.TaskUpdate{Description: text("Ask @ryan")}, Item: 3},
+		{TaskID: 4, Delete: true, Item: -1},
+	}, translated)
+}
+
+func TestApply(t *testing.T) {
+	text := "New"
+	items := []Item{{Text: "One", TaskID: 1}, {Text: "New"}}
+	changes := []Change{
+		{TaskID: 2, Delete: true, Item: -1},
+		{TaskID: 1, Item: 0},
+		{Item: 1, Update: trackerapi.TaskUpdate{Description: &text}},
+	}
+
+	tracker := &fakeTrackerAPI{}
+	applied, err := Apply(context.Background(), tracker, 12345, 101, items, changes)
+	require.NoError(t, err)
+	require.Equal(t, []Item{{Text: "One", TaskID: 1}, {Text: "New", TaskID: 103}}, applied)
+	require.Equal(t, []Item{{Text: "One", TaskID: 1}, {Text: "New"}}, items, "the items should not be modified")
+	require.Equal(t, []string{"delete task 2 of story 101", "update task 1 of story 101", "create task for story 101: New"}, tracker.calls)
+
+	tracker = &fakeTrackerAPI{err: errors.New("Tracker is down")}
+	_, err = Apply(context.Background(), tracker, 12345, 101, items, changes)
+	require.EqualError(t, err, "Tracker is down")
+	require.Equal(t, []string{"delete task 2 of story 101"}, tracker.calls)
+}
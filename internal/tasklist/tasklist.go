@@ -0,0 +1,164 @@
+// Package tasklist reads and rewrites the task lists in GitHub issue bodies, e.g. "- [ ] Write the docs", and matches
+// their items with the tasks of Tracker stories.
+package tasklist
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An item of a task list.
+type Item struct {
+	Text     string
+	Complete bool
+
+	// The ID of the Tracker task which the item is synced with, from the item's hidden marker, or zero.
+	TaskID int64
+}
+
+// The marker at the end of a synced item. HTML comments are not shown when GitHub renders the body.
+const markerFormat = "<!-- issues2stories: task %d -->"
+
+var (
+	// An item is a list item which starts with a checkbox. Items can be nested, and can be in numbered lists.
+	itemPattern = regexp.MustCompile(`^([ \t]*(?:[-*+]|\d{1,9}[.)])[ \t]+)\[([ xX])\][ \t]+(.*?)` +
+		`(?:[ \t]*<!-- issues2stories: task (\d+) -->)?[ \t]*$`)
+
+	// A line which opens or closes a fenced code block.
+	fencePattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// A line of a body. The item is nil for lines which are not task list items.
+type line struct {
+	text   string
+	ending string
+
+	// The list marker and indentation before the item's checkbox, e.g. "  - ".
+	prefix string
+	item   *Item
+}
+
+func parseLines(body string) []line {
+	var lines []line
+	fence := ""
+	for _, raw := range strings.SplitAfter(body, "\n") {
+		if raw == "" {
+			continue
+		}
+		text := strings.TrimRight(raw, "\r\n")
+		l := line{text: text, ending: raw[len(text):]}
+		match := fencePattern.FindStringSubmatch(text)
+		switch {
+		case fence == "" && match != nil:
+			fence = match[1]
+		case fence != "":
+			// The closing fence is at least as long as the opening one, and is made of the same character.
+			if match != nil && strings.HasPrefix(match[1], fence) && strings.TrimSpace(text) == match[1] {
+				fence = ""
+			}
+		default:
+			// GitHub doesn't show a checkbox for an item without text.
+			if parts := itemPattern.FindStringSubmatch(text); parts != nil && parts[3] != "" {
+				taskID, _ := strconv.ParseInt(parts[4], 10, 64)
+				l.prefix = parts[1]
+				l.item = &Item{Text: parts[3], Complete: parts[2] != " ", TaskID: taskID}
+			}
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// Returns the items of the task lists in the Markdown body, in order. Items in code blocks are not items.
+func Parse(body string) []Item {
+	var items []Item
+	for _, l := range parseLines(body) {
+		if l.item != nil {
+			items = append(items, *l.item)
+		}
+	}
+	return items
+}
+
+// Returns the body with its task list items replaced by the items, in order, leaving the rest of the body unchanged.
+// When there are more items than the body has, the others are added after the body's last item, or in a new task
+// list at the end of the body. When there are fewer, the body's last items are removed.
+func Rewrite(body string, items []Item) string {
+	lines := parseLines(body)
+	last := -1
+	for i, l := range lines {
+		if l.item != nil {
+			last = i
+		}
+	}
+	newline := "\n"
+	if strings.Contains(body, "\r\n") {
+		newline = "\r\n"
+	}
+	if last < 0 {
+		if len(items) == 0 {
+			return body
+		}
+		var added []string
+		for _, item := range items {
+			added = append(added, format("- ", item))
+		}
+		list := strings.Join(added, newline)
+		if strings.TrimSpace(body) == "" {
+			return list
+		}
+		return strings.TrimRight(body, "\r\n") + newline + newline + list
+	}
+
+	var result strings.Builder
+	next := 0
+	for i, l := range lines {
+		if l.item == nil {
+			result.WriteString(l.text + l.ending)
+			continue
+		}
+		if next < len(items) {
+			// Unchanged items keep their original text, e.g. "[X]" instead of "[x]".
+			if items[next] == *l.item {
+				result.WriteString(l.text + l.ending)
+			} else {
+				result.WriteString(format(l.prefix, items[next]) + l.ending)
+			}
+			next++
+		}
+		if i == last && next < len(items) {
+			ending := l.ending
+			if ending == "" {
+				// The body ends with its last item.
+				result.WriteString(newline)
+			}
+			for ; next < len(items); next++ {
+				result.WriteString(format(l.prefix, items[next]))
+				if next < len(items)-1 || ending != "" {
+					result.WriteString(newline)
+				}
+			}
+		}
+	}
+	return result.String()
+}
+
+func format(prefix string, item Item) string {
+	checkbox := "[ ] "
+	if item.Complete {
+		checkbox = "[x] "
+	}
+	// An item is one line.
+	text := normalize(item.Text)
+	if item.TaskID == 0 {
+		return prefix + checkbox + text
+	}
+	return prefix + checkbox + text + " " + fmt.Sprintf(markerFormat, item.TaskID)
+}
+
+// Returns the text on one line, with runs of whitespace replaced by single spaces.
+func normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,99 @@
+package tasklist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Item
+	}{
+		{
+			name: "items with and without markers",
+			body: "Steps:\r\n- [ ] Write the docs\r\n- [x] Fix the bug <!-- issues2stories: task 12 -->\r\n* [X] Release it  \r\n",
+			want: []Item{
+				{Text: "Write the docs"},
+				{Text: "Fix the bug", Complete: true, TaskID: 12},
+				{Text: "Release it", Complete: true},
+			},
+		},
+		{
+			name: "nested and numbered items",
+			body: "1. [ ] First\n   - [ ] Nested\n2) [x] Second",
+			want: []Item{{Text: "First"}, {Text: "Nested"}, {Text: "Second", Complete: true}},
+		},
+		{
+			name: "lines which are not items",
+			body: "- [ ]\n- [] Not a checkbox\n[ ] Not a list\n- Just a list item\n- [ ]no space",
+		},
+		{
+			name: "items in code blocks are not items",
+			body: "```markdown\n- [ ] Example\n```\n- [ ] Real",
+			want: []Item{{Text: "Real"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, Parse(test.body))
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		items []Item
+		want  string
+	}{
+		{
+			name:  "items are replaced in place, leaving the rest of the body alone",
+			body:  "Intro\n\n- [ ] One\n* [X] Two\n\n```\n- [ ] Code\n```\nOutro\n",
+			items: []Item{{Text: "One", Complete: true, TaskID: 1}, {Text: "Two", Complete: true}},
+			want:  "Intro\n\n- [x] One <!-- issues2stories: task 1 -->\n* [X] Two\n\n```\n- [ ] Code\n```\nOutro\n",
+		},
+		{
+			name:  "more items are added after the last item",
+			body:  "- [ ] One\r\n  - [ ] Two\r\nOutro",
+			items: []Item{{Text: "One"}, {Text: "Two"}, {Text: "Three", TaskID: 3}},
+			want:  "- [ ] One\r\n  - [ ] Two\r\n  - [ ] Three <!-- issues2stories: task 3 -->\r\nOutro",
+		},
+		{
+			name:  "more items are added when the body ends with its last item",
+			body:  "- [ ] One",
+			items: []Item{{Text: "One"}, {Text: "Two"}},
+			want:  "- [ ] One\n- [ ] Two",
+		},
+		{
+			name:  "fewer items remove the last items",
+			body:  "- [ ] One\n- [ ] Two\n- [ ] Three\nOutro\n",
+			items: []Item{{Text: "Two"}},
+			want:  "- [ ] Two\nOutro\n",
+		},
+		{
+			name:  "a body without a task list gets one at the end",
+			body:  "Some text\n",
+			items: []Item{{Text: "One  with\nspaces", TaskID: 1}},
+			want:  "Some text\n\n- [ ] One with spaces <!-- issues2stories: task 1 -->",
+		},
+		{
+			name:  "an empty body gets only the task list",
+			items: []Item{{Text: "One"}},
+			want:  "- [ ] One",
+		},
+		{
+			name: "a body without a task list is unchanged by no items",
+			body: "Some text\n",
+			want: "Some text\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, Rewrite(test.body, test.items))
+		})
+	}
+}
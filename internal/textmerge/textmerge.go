@@ -0,0 +1,124 @@
+// Package textmerge merges two sets of changes to the same text, line by line, like diff3.
+package textmerge
+
+import "strings"
+
+// Merges the changes from base to ours and the changes from base to theirs. Returns false when both changed the
+// same lines differently, which is a conflict. Lines are separated by "\n".
+func Merge(base, ours, theirs string) (string, bool) {
+	baseLines, ourLines, theirLines := splitLines(base), splitLines(ours), splitLines(theirs)
+	ourMatches, theirMatches := matches(baseLines, ourLines), matches(baseLines, theirLines)
+
+	var merged strings.Builder
+	i, o, t := 0, 0, 0
+	for {
+		// Copy the lines which are unchanged in both.
+		stable := 0
+		for i+stable < len(baseLines) && ourMatches[i+stable] == o+stable && theirMatches[i+stable] == t+stable {
+			merged.WriteString(baseLines[i+stable])
+			stable++
+		}
+		i, o, t = i+stable, o+stable, t+stable
+
+		// The changed lines end at the next base line which is unchanged in both.
+		next := i
+		for next < len(baseLines) && (ourMatches[next] < 0 || theirMatches[next] < 0) {
+			next++
+		}
+		ourEnd, theirEnd := len(ourLines), len(theirLines)
+		if next < len(baseLines) {
+			ourEnd, theirEnd = ourMatches[next], theirMatches[next]
+		}
+		if next == len(baseLines) && i == next && ourEnd == o && theirEnd == t {
+			return merged.String(), true
+		}
+
+		baseChunk, ourChunk, theirChunk := baseLines[i:next], ourLines[o:ourEnd], theirLines[t:theirEnd]
+		switch {
+		case equal(ourChunk, baseChunk):
+			merged.WriteString(strings.Join(theirChunk, ""))
+		case equal(theirChunk, baseChunk), equal(ourChunk, theirChunk):
+			merged.WriteString(strings.Join(ourChunk, ""))
+		default:
+			return "", false
+		}
+		i, o, t = next, ourEnd, theirEnd
+	}
+}
+
+// Splits the text after each "\n", so that joining the lines gives back the text.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Returns, for each line of a, the index of the same line in b according to a longest common subsequence of the
+// lines, or -1 when the line is not in the subsequence.
+func matches(a, b []string) []int {
+	result := make([]int, len(a))
+	for i := range result {
+		result[i] = -1
+	}
+
+	// Lines which are the same at the start and end need no table, which keeps the table small for small changes.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		result[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		result[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+
+	// lengths[i][j] is the length of the longest common subsequence of the middle lines from a[i] and b[j] onwards.
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lengths := make([][]int, len(middleA)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(middleB)+1)
+	}
+	for i := len(middleA) - 1; i >= 0; i-- {
+		for j := len(middleB) - 1; j >= 0; j-- {
+			switch {
+			case middleA[i] == middleB[j]:
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	for i, j := 0, 0; i < len(middleA) && j < len(middleB); {
+		switch {
+		case middleA[i] == middleB[j]:
+			result[prefix+i] = prefix + j
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return result
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package textmerge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         string
+		ours         string
+		theirs       string
+		wantMerged   string
+		wantConflict bool
+	}{
+		{
+			name:       "nothing changed",
+			base:       "one\ntwo\n",
+			ours:       "one\ntwo\n",
+			theirs:     "one\ntwo\n",
+			wantMerged: "one\ntwo\n",
+		},
+		{
+			name:       "only ours changed",
+			base:       "one\ntwo\n",
+			ours:       "one\ntwo\nthree\n",
+			theirs:     "one\ntwo\n",
+			wantMerged: "one\ntwo\nthree\n",
+		},
+		{
+			name:       "only theirs changed",
+			base:       "one\ntwo\n",
+			ours:       "one\ntwo\n",
+			theirs:     "zero\none\n",
+			wantMerged: "zero\none\n",
+		},
+		{
+			name:       "changes to different lines are both kept",
+			base:       "title\n\nsteps\n1. open\n2. click\n\nexpected\nworks\n",
+			ours:       "title\n\nsteps\n1. open\n2. click\n3. scroll\n\nexpected\nworks\n",
+			theirs:     "new title\n\nsteps\n1. open\n2. click\n\nexpected\nworks fast\n",
+			wantMerged: "new title\n\nsteps\n1. open\n2. click\n3. scroll\n\nexpected\nworks fast\n",
+		},
+		{
+			name:       "the same change in both is kept once",
+			base:       "one\ntwo\nthree\n",
+			ours:       "one\n2\nthree\n",
+			theirs:     "one\n2\nthree\n",
+			wantMerged: "one\n2\nthree\n",
+		},
+		{
+			name:       "lines which were deleted in one and unchanged in the other are deleted",
+			base:       "one\ntwo\nthree\n",
+			ours:       "one\nthree\n",
+			theirs:     "one\ntwo\nthree\nfour\n",
+			wantMerged: "one\nthree\nfour\n",
+		},
+		{
+			name:       "everything is new",
+			base:       "",
+			ours:       "",
+			theirs:     "one\n",
+			wantMerged: "one\n",
+		},
+		{
+			name:         "different changes to the same line are a conflict",
+			base:         "one\ntwo\nthree\n",
+			ours:         "one\n2\nthree\n",
+			theirs:       "one\nTWO\nthree\n",
+			wantConflict: true,
+		},
+		{
+			name:         "different additions at the same place are a conflict",
+			base:         "one\n",
+			ours:         "one\ntwo\n",
+			theirs:       "one\nthree\n",
+			wantConflict: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			merged, ok := Merge(test.base, test.ours, test.theirs)
+			if test.wantConflict {
+				require.False(t, ok)
+				require.Empty(t, merged)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, test.wantMerged, merged)
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package tlscert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"issues2stories/internal/logging"
+)
+
+const (
+	LetsEncryptDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+	DefaultRenewBefore      = 30 * 24 * time.Hour
+
+	accountKeyFileName = "acme_account.key"
+	certFileName       = "cert.pem"
+	keyFileName        = "key.pem"
+)
+
+// ACMEOptions configures an ACMEManager.
+type ACMEOptions struct {
+	// The domain names for the certificate. The first one is also used as the certificate's common name.
+	Domains []string
+
+	// Defaults to LetsEncryptDirectoryURL.
+	DirectoryURL string
+
+	// The contact email address for the ACME account. Optional.
+	Email string
+
+	// Where to store the account key, certificate and certificate key. Optional. When empty, nothing is stored.
+	CacheDir string
+
+	// Proves control of the domains to the certificate authority.
+	Solver ChallengeSolver
+
+	// Defaults to DefaultRenewBefore.
+	RenewBefore time.Duration
+
+	// Used for calls to the ACME directory. Optional. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// An ACMEManager obtains a certificate from an ACME certificate authority, serves it, and renews it before it expires.
+type ACMEManager struct {
+	opts ACMEOptions
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewACMEManager(opts ACMEOptions) (*ACMEManager, error) {
+	if len(opts.Domains) == 0 {
+		return nil, errors.New("at least one domain is required")
+	}
+	if opts.Solver == nil {
+		return nil, errors.New("a challenge solver is required")
+	}
+	if opts.DirectoryURL == "" {
+		opts.DirectoryURL = LetsEncryptDirectoryURL
+	}
+	if opts.RenewBefore <= 0 {
+		opts.RenewBefore = DefaultRenewBefore
+	}
+	for i, domain := range opts.Domains {
+		opts.Domains[i] = strings.ToLower(domain)
+	}
+	return &ACMEManager{opts: opts}, nil
+}
+
+// Implements tls.Config's GetCertificate. The challenge handshakes of a "tls-alpn-01" solver are answered too.
+func (m *ACMEManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+		if solver, ok := m.opts.Solver.(TLSChallengeSolver); ok {
+			if cert, ok := solver.ChallengeCertificate(hello); ok {
+				return cert, nil
+			}
+		}
+		return nil, fmt.Errorf("no tls-alpn-01 challenge in progress for %q", hello.ServerName)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("no TLS certificate has been obtained from the ACME certificate authority yet")
+	}
+	return m.cert, nil
+}
+
+// Load the cached certificate, if any, and then obtain a new certificate whenever the current one is missing or
+// due for renewal, until the context is done. Failures are logged and retried.
+func (m *ACMEManager) Start(ctx context.Context) {
+	logger := logging.FromContext(ctx).With("domains", m.opts.Domains)
+	if err := m.loadCachedCertificate(); err != nil {
+		logger.Info("No usable cached ACME certificate", "error", err)
+	}
+	go func() {
+		for {
+			wait := time.Hour
+			if m.needsRenewal(time.Now()) {
+				logger.Info("Obtaining TLS certificate from ACME certificate authority", "directory_url", m.opts.DirectoryURL)
+				if err := m.Obtain(ctx); err != nil {
+					logger.Error("Could not obtain TLS certificate from ACME certificate authority", "error", err)
+					wait = time.Minute
+				} else {
+					logger.Info("Obtained TLS certificate from ACME certificate authority")
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+func (m *ACMEManager) needsRenewal(now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert == nil || now.Add(m.opts.RenewBefore).After(m.cert.Leaf.NotAfter)
+}
+
+// Obtain a new certificate for the domains, solving the challenges for any domains which are not already authorized.
+func (m *ACMEManager) Obtain(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	client, err := m.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(m.opts.Domains...))
+	if err != nil {
+		return fmt.Errorf("could not create order: %w", err)
+	}
+	// Only the response to creating the order has the order's URL.
+	orderURL := order.URI
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+	order, err = client.WaitOrder(ctx, orderURL)
+	if err != nil {
+		return fmt.Errorf("order was not ready: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.opts.Domains[0]},
+		DNSNames: m.opts.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		// The ACME client can't wait for an order which is still processing after it was finalized,
+		// because it looks for the order's URL in the wrong place. So wait for it here instead.
+		order, waitErr := client.WaitOrder(ctx, orderURL)
+		if waitErr != nil || order.Status != acme.StatusValid {
+			return fmt.Errorf("could not finalize order: %w", err)
+		}
+		der, err = client.FetchCert(ctx, order.CertURL, true)
+		if err != nil {
+			return fmt.Errorf("could not download certificate: %w", err)
+		}
+	}
+	cert, err := newCertificate(der, key)
+	if err != nil {
+		return err
+	}
+	if err := m.saveCertificate(cert); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = cert
+	return nil
+}
+
+func (m *ACMEManager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("could not get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	domain := authz.Identifier.Value
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.opts.Solver.Type() {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("the ACME certificate authority did not offer a %s challenge for %s", m.opts.Solver.Type(), domain)
+	}
+
+	if err := m.opts.Solver.Present(ctx, client, domain, challenge); err != nil {
+		return fmt.Errorf("could not present %s challenge for %s: %w", challenge.Type, domain, err)
+	}
+	defer m.opts.Solver.CleanUp(domain, challenge)
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("could not accept %s challenge for %s: %w", challenge.Type, domain, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s challenge for %s failed: %w", challenge.Type, domain, err)
+	}
+	return nil
+}
+
+// Returns a client for an ACME account, registering the account when it is new.
+func (m *ACMEManager) client(ctx context.Context) (*acme.Client, error) {
+	accountKey, err := m.accountKey()
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: m.opts.DirectoryURL,
+		HTTPClient:   m.opts.HTTPClient,
+		UserAgent:    "issues2stories",
+	}
+	account := &acme.Account{}
+	if m.opts.Email != "" {
+		account.Contact = []string{"mailto:" + m.opts.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("could not register ACME account: %w", err)
+	}
+	return client, nil
+}
+
+// Returns the cached account key, or generates (and caches) a new one.
+func (m *ACMEManager) accountKey() (crypto.Signer, error) {
+	if key, err := m.readCachedKey(accountKeyFileName); err == nil {
+		return key, nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.writeCachedKey(accountKeyFileName, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (m *ACMEManager) loadCachedCertificate() error {
+	if m.opts.CacheDir == "" {
+		return errors.New("no cache directory configured")
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(m.opts.CacheDir, certFileName), filepath.Join(m.opts.CacheDir, keyFileName))
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if err := cert.Leaf.VerifyHostname(m.opts.Domains[0]); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = &cert
+	return nil
+}
+
+func (m *ACMEManager) saveCertificate(cert *tls.Certificate) error {
+	if m.opts.CacheDir == "" {
+		return nil
+	}
+	var certPEM []byte
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	// Write the key first, so a crash in between leaves a mismatched pair which fails to load, rather than
+	// an old certificate which looks valid.
+	if err := m.writeCachedKey(keyFileName, cert.PrivateKey.(*ecdsa.PrivateKey)); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(m.opts.CacheDir, certFileName), certPEM)
+}
+
+func (m *ACMEManager) readCachedKey(name string) (*ecdsa.PrivateKey, error) {
+	if m.opts.CacheDir == "" {
+		return nil, errors.New("no cache directory configured")
+	}
+	keyPEM, err := ioutil.ReadFile(filepath.Join(m.opts.CacheDir, name))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", name)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func (m *ACMEManager) writeCachedKey(name string, key *ecdsa.PrivateKey) error {
+	if m.opts.CacheDir == "" {
+		return nil
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(m.opts.CacheDir, name), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+// Write the file atomically, so that readers never see a partially written file.
+func writeFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newCertificate(der [][]byte, key crypto.PrivateKey) (*tls.Certificate, error) {
+	if len(der) == 0 {
+		return nil, errors.New("the ACME certificate authority returned no certificates")
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse certificate from the ACME certificate authority: %w", err)
+	}
+	return &tls.Certificate{Certificate: der, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// Returns an HTTP client which trusts the system's root certificates plus those in the given PEM file,
+// e.g. for an ACME directory which is served with a test certificate. Returns nil when the path is empty,
+// which means http.DefaultClient.
+func HTTPClientTrustingRoots(caRootFile string) (*http.Client, error) {
+	if caRootFile == "" {
+		return nil, nil
+	}
+	caRootPEM, err := ioutil.ReadFile(caRootFile)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(caRootPEM) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", caRootFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,155 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+func TestHTTP01Solver(t *testing.T) {
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	client := &acme.Client{Key: accountKey}
+	wantResponse, err := client.HTTP01ChallengeResponse("token123")
+	require.NoError(t, err)
+
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com"+r.URL.Path, http.StatusMovedPermanently)
+	})
+	subject := NewHTTP01Solver(fallback)
+	challenge := &acme.Challenge{Type: "http-01", Token: "token123"}
+	require.NoError(t, subject.Present(context.Background(), client, "example.com", challenge))
+
+	tests := []struct {
+		name       string
+		path       string
+		cleanedUp  bool
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "responds to the challenge",
+			path:       "/.well-known/acme-challenge/token123",
+			wantStatus: http.StatusOK,
+			wantBody:   wantResponse,
+		},
+		{
+			name:       "unknown token",
+			path:       "/.well-known/acme-challenge/other",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "404 page not found\n",
+		},
+		{
+			name:       "other paths are handled by the fallback handler",
+			path:       "/tracker_activity",
+			wantStatus: http.StatusMovedPermanently,
+		},
+		{
+			name:       "no longer responds after cleaning up",
+			path:       "/.well-known/acme-challenge/token123",
+			cleanedUp:  true,
+			wantStatus: http.StatusNotFound,
+			wantBody:   "404 page not found\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.cleanedUp {
+				subject.CleanUp("example.com", challenge)
+			}
+			rr := httptest.NewRecorder()
+			subject.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, test.path, nil))
+			require.Equal(t, test.wantStatus, rr.Code)
+			if test.wantBody != "" {
+				require.Equal(t, test.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestACMEManagerGetCertificate(t *testing.T) {
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	client := &acme.Client{Key: accountKey}
+
+	solver := NewTLSALPN01Solver()
+	subject, err := NewACMEManager(ACMEOptions{Domains: []string{"Example.com"}, Solver: solver})
+	require.NoError(t, err)
+
+	challengeHello := &tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{acme.ALPNProto}}
+	_, err = subject.GetCertificate(challengeHello)
+	require.EqualError(t, err, `no tls-alpn-01 challenge in progress for "example.com"`)
+
+	require.NoError(t, solver.Present(context.Background(), client, "example.com", &acme.Challenge{Type: "tls-alpn-01", Token: "token123"}))
+	cert, err := subject.GetCertificate(challengeHello)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com"}, leaf.DNSNames)
+
+	_, err = subject.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{"h2", "http/1.1"}})
+	require.EqualError(t, err, "no TLS certificate has been obtained from the ACME certificate authority yet")
+}
+
+// Obtains a real certificate from Pebble, a small ACME server for testing (https://github.com/letsencrypt/pebble).
+// Skipped unless PEBBLE_DIRECTORY_URL is set. e.g. from a Pebble checkout, run
+//
+//	pebble -config test/config/pebble-config.json
+//
+// and then from this repo, run
+//
+//	PEBBLE_DIRECTORY_URL=https://localhost:14000/dir PEBBLE_CA_ROOT_FILE=<pebble checkout>/test/certs/pebble.minica.pem go test ./internal/tlscert
+func TestACMEManagerObtainFromPebble(t *testing.T) {
+	directoryURL := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if directoryURL == "" {
+		t.Skip("PEBBLE_DIRECTORY_URL is not set")
+	}
+	httpClient, err := HTTPClientTrustingRoots(os.Getenv("PEBBLE_CA_ROOT_FILE"))
+	require.NoError(t, err)
+
+	// Pebble validates http-01 challenges on port 5002 by default.
+	solver := NewHTTP01Solver(http.NotFoundHandler())
+	listener, err := net.Listen("tcp", "127.0.0.1:5002")
+	require.NoError(t, err)
+	challengeServer := &http.Server{Handler: solver}
+	go func() { _ = challengeServer.Serve(listener) }()
+	defer challengeServer.Close()
+
+	cacheDir, err := ioutil.TempDir("", "tlscert")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	subject, err := NewACMEManager(ACMEOptions{
+		Domains:      []string{"localhost"},
+		DirectoryURL: directoryURL,
+		CacheDir:     cacheDir,
+		Solver:       solver,
+		HTTPClient:   httpClient,
+	})
+	require.NoError(t, err)
+	require.NoError(t, subject.Obtain(context.Background()))
+
+	cert, err := subject.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost"}, cert.Leaf.DNSNames)
+
+	// The certificate is cached, so a restarted app serves it straight away.
+	restarted, err := NewACMEManager(ACMEOptions{Domains: []string{"localhost"}, CacheDir: cacheDir, Solver: solver})
+	require.NoError(t, err)
+	require.NoError(t, restarted.loadCachedCertificate())
+	cachedCert, err := restarted.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	require.NoError(t, err)
+	require.Equal(t, cert.Certificate, cachedCert.Certificate)
+}
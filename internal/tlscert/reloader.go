@@ -0,0 +1,104 @@
+package tlscert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"issues2stories/internal/logging"
+)
+
+// A Reloader serves a certificate and key which are read from files, and re-reads them when they change on disk,
+// e.g. when cert-manager renews a certificate in a mounted Kubernetes Secret.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// The contents of the files which cert was loaded from. Modification times aren't compared, because they don't
+	// always change, e.g. when files are restored from a backup or Kubernetes swaps the symlinks of a mounted Secret.
+	certPEM, keyPEM []byte
+}
+
+// Returns a Reloader which has already loaded the certificate, or an error when the files can't be loaded.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Re-read the files if either of them has changed since they were last loaded. Returns true when a new
+// certificate was loaded. When the new files can't be loaded, e.g. because only one of them has been
+// replaced so far, the previous certificate is kept and an error is returned.
+func (r *Reloader) Reload() (bool, error) {
+	certPEM, err := readFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := readFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("could not load TLS certificate from %s and %s: %w", r.certFile, r.keyFile, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.certPEM = certPEM
+	r.keyPEM = keyPEM
+	return true, nil
+}
+
+// Check for changed files every interval until the context is done.
+func (r *Reloader) Start(ctx context.Context, interval time.Duration) {
+	logger := logging.FromContext(ctx).With("cert_file", r.certFile, "key_file", r.keyFile)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reloaded, err := r.Reload()
+				if err != nil {
+					logger.Warn("Could not reload TLS certificate, so continuing to use the previous one", "error", err)
+				} else if reloaded {
+					logger.Info("Reloaded TLS certificate")
+				}
+			}
+		}
+	}()
+}
+
+// Implements tls.Config's GetCertificate.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func readFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read TLS file: %w", err)
+	}
+	return content, nil
+}
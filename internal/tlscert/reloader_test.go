@@ -0,0 +1,93 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlscert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	_, err = NewReloader(certFile, keyFile)
+	require.EqualError(t, err, "could not read TLS file: open "+certFile+": no such file or directory")
+
+	modTime := time.Now().Add(-time.Hour)
+	writeSelfSignedCert(t, certFile, keyFile, "first.example.com", modTime)
+	subject, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	requireServedCertName(t, subject, "first.example.com")
+
+	// Nothing changed on disk.
+	reloaded, err := subject.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// Files which were only touched are not reloaded.
+	require.NoError(t, os.Chtimes(certFile, time.Now(), time.Now()))
+	require.NoError(t, os.Chtimes(keyFile, time.Now(), time.Now()))
+	reloaded, err = subject.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// A renewed certificate is picked up, even when the files keep their modification times.
+	writeSelfSignedCert(t, certFile, keyFile, "second.example.com", modTime)
+	reloaded, err = subject.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	requireServedCertName(t, subject, "second.example.com")
+
+	// When only the certificate has been replaced so far, the previous pair continues to be served.
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	reloaded, err = subject.Reload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not load TLS certificate from "+certFile+" and "+keyFile)
+	require.False(t, reloaded)
+	requireServedCertName(t, subject, "second.example.com")
+}
+
+func requireServedCertName(t *testing.T, subject *Reloader, wantName string) {
+	t.Helper()
+	cert, err := subject.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, []string{wantName}, leaf.DNSNames)
+}
+
+// Write a self-signed certificate and its key, with the given modification time.
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, dnsName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
@@ -0,0 +1,122 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+)
+
+// A ChallengeSolver proves control of a domain to an ACME certificate authority using one type of challenge.
+type ChallengeSolver interface {
+	// The ACME challenge type, e.g. "http-01".
+	Type() string
+
+	// Start responding to the challenge, before the certificate authority is asked to validate it.
+	Present(ctx context.Context, client *acme.Client, domain string, challenge *acme.Challenge) error
+
+	// Stop responding to the challenge, after validation has finished.
+	CleanUp(domain string, challenge *acme.Challenge)
+}
+
+// A TLSChallengeSolver is a ChallengeSolver which answers validation handshakes which negotiate
+// the "acme-tls/1" protocol.
+type TLSChallengeSolver interface {
+	ChallengeSolver
+	ChallengeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool)
+}
+
+const httpChallengePathPrefix = "/.well-known/acme-challenge/"
+
+// HTTP01Solver solves "http-01" challenges. It must be served as an http.Handler on port 80 of each domain.
+// Requests for any other path are handled by the Fallback handler.
+type HTTP01Solver struct {
+	Fallback http.Handler
+
+	mu        sync.RWMutex
+	responses map[string]string
+}
+
+func NewHTTP01Solver(fallback http.Handler) *HTTP01Solver {
+	return &HTTP01Solver{Fallback: fallback, responses: map[string]string{}}
+}
+
+func (s *HTTP01Solver) Type() string {
+	return "http-01"
+}
+
+func (s *HTTP01Solver) Present(_ context.Context, client *acme.Client, _ string, challenge *acme.Challenge) error {
+	response, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[challenge.Token] = response
+	return nil
+}
+
+func (s *HTTP01Solver) CleanUp(_ string, challenge *acme.Challenge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, challenge.Token)
+}
+
+func (s *HTTP01Solver) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	if !strings.HasPrefix(request.URL.Path, httpChallengePathPrefix) {
+		s.Fallback.ServeHTTP(responseWriter, request)
+		return
+	}
+	s.mu.RLock()
+	response, ok := s.responses[strings.TrimPrefix(request.URL.Path, httpChallengePathPrefix)]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "text/plain")
+	_, _ = responseWriter.Write([]byte(response))
+}
+
+// TLSALPN01Solver solves "tls-alpn-01" challenges. It answers TLS handshakes on port 443 of each domain which
+// negotiate the "acme-tls/1" protocol, so the tls.Config must list acme.ALPNProto in NextProtos.
+type TLSALPN01Solver struct {
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+func NewTLSALPN01Solver() *TLSALPN01Solver {
+	return &TLSALPN01Solver{certs: map[string]*tls.Certificate{}}
+}
+
+func (s *TLSALPN01Solver) Type() string {
+	return "tls-alpn-01"
+}
+
+func (s *TLSALPN01Solver) Present(_ context.Context, client *acme.Client, domain string, challenge *acme.Challenge) error {
+	cert, err := client.TLSALPN01ChallengeCert(challenge.Token, domain)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs[domain] = &cert
+	return nil
+}
+
+func (s *TLSALPN01Solver) CleanUp(domain string, _ *acme.Challenge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.certs, domain)
+}
+
+// Returns the challenge certificate for the handshake's server name, or false when there is none.
+func (s *TLSALPN01Solver) ChallengeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cert, ok := s.certs[strings.ToLower(hello.ServerName)]
+	return cert, ok
+}
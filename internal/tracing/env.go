@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Create a provider configured by the standard OpenTelemetry environment variables:
+//
+// - OTEL_EXPORTER_OTLP_TRACES_ENDPOINT: the full URL of an OTLP/HTTP traces endpoint, or
+// - OTEL_EXPORTER_OTLP_ENDPOINT: the base URL of an OTLP/HTTP endpoint, to which "/v1/traces" is added
+// - OTEL_EXPORTER_OTLP_HEADERS: optional headers to send, e.g. "api-key=abc,other=def"
+// - OTEL_SERVICE_NAME: optional, defaults to "issues2stories"
+//
+// When neither endpoint is set, all spans are discarded. The returned bool is true when spans will be exported.
+// The SDK reports its errors, e.g. failed exports, to onError.
+func NewProviderFromEnv(lookupEnv func(string) (string, bool), onError func(error)) (*sdktrace.TracerProvider, bool, error) {
+	getenv := func(name string) string {
+		value, _ := lookupEnv(name)
+		return strings.TrimSpace(value)
+	}
+
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return sdktrace.NewTracerProvider(sdktrace.WithSyncer(discardExporter{})), false, nil
+	}
+	options, err := exporterOptions(endpoint, getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, false, err
+	}
+
+	serviceName := getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "issues2stories"
+	}
+	if onError != nil {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(onError))
+	}
+	// Creating the exporter doesn't connect to the collector, so it only fails for invalid options.
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create OTLP exporter: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	), true, nil
+}
+
+// Returns the OTLP/HTTP exporter's options for the traces endpoint URL and the headers setting.
+func exporterOptions(endpoint, headerSetting string) ([]otlptracehttp.Option, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid OTLP traces endpoint %q: must be an http or https URL", endpoint)
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(parsed.Host), otlptracehttp.WithURLPath(parsed.Path)}
+	if parsed.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	headers := map[string]string{}
+	for _, pair := range strings.Split(headerSetting, ",") {
+		keyAndValue := strings.SplitN(pair, "=", 2)
+		if len(keyAndValue) == 2 && strings.TrimSpace(keyAndValue[0]) != "" {
+			headers[strings.TrimSpace(keyAndValue[0])] = strings.TrimSpace(keyAndValue[1])
+		}
+	}
+	if len(headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(headers))
+	}
+	return options, nil
+}
+
+// Discards spans when no collector is configured. The provider still starts real spans, so that the trace context of
+// incoming requests is propagated to the APIs which the app calls.
+type discardExporter struct{}
+
+func (discardExporter) ExportSpans(_ context.Context, _ []sdktrace.ReadOnlySpan) error {
+	return nil
+}
+
+func (discardExporter) Shutdown(_ context.Context) error {
+	return nil
+}
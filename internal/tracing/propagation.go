@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"issues2stories/internal/logging"
+)
+
+// The W3C Trace Context propagator of the OpenTelemetry SDK, which reads and writes the traceparent header.
+// See https://www.w3.org/TR/trace-context/
+var propagator = propagation.TraceContext{}
+
+// Write the W3C traceparent header for the span in the context, if any.
+func InjectHeaders(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Returns a context which causes new root spans to continue the trace from the incoming
+// W3C traceparent header, if the header is present and valid.
+func ExtractHeaders(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Middleware starts a server span for each incoming request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		ctx := ExtractHeaders(request.Context(), request.Header)
+		// The path can contain secrets, e.g. a webhook token.
+		path := logging.RedactPath(request.URL.Path)
+		ctx, span := Start(ctx, request.Method+" "+path, SpanKindServer,
+			"http.method", request.Method,
+			"http.target", path)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: responseWriter}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes("http.status_code", status)
+		if status >= 500 {
+			span.RecordError(fmt.Errorf("responded with status %d", status))
+		}
+	})
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport wraps an http.RoundTripper to add the W3C traceparent header to outgoing requests.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if SpanFromContext(req.Context()) == nil {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the original request.
+	clone := req.Clone(req.Context())
+	InjectHeaders(req.Context(), clone.Header)
+	return t.base.RoundTrip(clone)
+}
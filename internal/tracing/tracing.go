@@ -0,0 +1,117 @@
+// Package tracing starts the app's spans with the OpenTelemetry SDK. Spans can be exported to any OpenTelemetry
+// collector using the SDK's OTLP/HTTP exporter, and trace context is propagated using W3C Trace Context headers,
+// so these traces interoperate with other OpenTelemetry-instrumented services.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type SpanKind = trace.SpanKind
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+)
+
+// The name of the app's tracer, which exporters report as the instrumentation scope of its spans.
+const instrumentationName = "issues2stories/internal/tracing"
+
+// A Span is one timed operation. Spans must always be ended. All methods are safe to call on a nil Span.
+type Span struct {
+	span trace.Span
+}
+
+// Add attributes to the span, as alternating keys and values.
+func (s *Span) SetAttributes(keysAndValues ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attributes(keysAndValues)...)
+}
+
+// Mark the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+func (s *Span) TraceID() trace.TraceID {
+	if s == nil {
+		return trace.TraceID{}
+	}
+	return s.span.SpanContext().TraceID()
+}
+
+func (s *Span) SpanID() trace.SpanID {
+	if s == nil {
+		return trace.SpanID{}
+	}
+	return s.span.SpanContext().SpanID()
+}
+
+// Set the provider used by Start(). By default all spans are discarded.
+func SetProvider(p trace.TracerProvider) {
+	otel.SetTracerProvider(p)
+}
+
+func GetProvider() trace.TracerProvider {
+	return otel.GetTracerProvider()
+}
+
+// Start a new span as a child of the span in the context, if any, or of the remote span which the context was
+// extracted from, and return a context which contains the new span.
+func Start(ctx context.Context, name string, kind SpanKind, keysAndValues ...interface{}) (context.Context, *Span) {
+	ctx, span := GetProvider().Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(kind), trace.WithAttributes(attributes(keysAndValues)...))
+	return ctx, &Span{span: span}
+}
+
+// Returns the current span, or nil when there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// Returns the alternating keys and values as attributes. A key without a value is dropped.
+func attributes(keysAndValues []interface{}) []attribute.KeyValue {
+	result := make([]attribute.KeyValue, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		switch v := keysAndValues[i+1].(type) {
+		case string:
+			result = append(result, attribute.String(key, v))
+		case bool:
+			result = append(result, attribute.Bool(key, v))
+		case int:
+			result = append(result, attribute.Int(key, v))
+		case int64:
+			result = append(result, attribute.Int64(key, v))
+		case float64:
+			result = append(result, attribute.Float64(key, v))
+		default:
+			result = append(result, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func useInMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	previous := GetProvider()
+	SetProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { SetProvider(previous) })
+	return exporter
+}
+
+func TestStartAndEnd(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+
+	ctx, parent := Start(context.Background(), "parent", SpanKindServer, "a", 1)
+	_, child := Start(ctx, "child", SpanKindClient)
+	child.SetAttributes("b", "two", "c", int64(3), "d", true, "e", 0.5, "f", []int{1}, "dangling")
+	child.RecordError(errors.New("some error"))
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("b", "two"),
+		attribute.Int64("c", 3),
+		attribute.Bool("d", true),
+		attribute.Float64("e", 0.5),
+		attribute.String("f", "[1]"),
+	}, spans[0].Attributes)
+	require.Equal(t, sdktrace.Status{Code: codes.Error, Description: "some error"}, spans[0].Status)
+	require.Len(t, spans[0].Events, 1, "the error should be recorded as an event")
+	require.Equal(t, "parent", spans[1].Name)
+	require.Equal(t, []attribute.KeyValue{attribute.Int("a", 1)}, spans[1].Attributes)
+	require.Equal(t, codes.Unset, spans[1].Status.Code)
+
+	require.Equal(t, spans[1].SpanContext.TraceID(), spans[0].SpanContext.TraceID())
+	require.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	require.False(t, spans[1].Parent.IsValid())
+	require.Equal(t, parent.SpanID(), SpanFromContext(ctx).SpanID())
+	require.Nil(t, SpanFromContext(context.Background()))
+}
+
+func TestNilSpanIsSafe(t *testing.T) {
+	var span *Span
+	span.SetAttributes("a", 1)
+	span.RecordError(errors.New("some error"))
+	span.End()
+	require.False(t, span.TraceID().IsValid())
+	require.False(t, span.SpanID().IsValid())
+}
+
+func TestPropagation(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	ctx := ExtractHeaders(context.Background(), incoming)
+	ctx, span := Start(ctx, "continued", SpanKindServer)
+
+	outgoing := http.Header{}
+	InjectHeaders(ctx, outgoing)
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].SpanContext.TraceID().String())
+	require.Equal(t, "b7ad6b7169203331", spans[0].Parent.SpanID().String())
+	require.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-"+spans[0].SpanContext.SpanID().String()+"-01", outgoing.Get("traceparent"))
+
+	for _, invalid := range []string{
+		"",
+		"garbage",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-zzzzzzzzzzzzzzzz-01",
+	} {
+		header := http.Header{}
+		header.Set("traceparent", invalid)
+		_, span := Start(ExtractHeaders(context.Background(), header), "root", SpanKindServer)
+		span.End()
+		require.NotEqual(t, "0af7651916cd43dd8448eb211c80319c", span.TraceID().String(), invalid)
+	}
+
+	noSpanHeader := http.Header{}
+	InjectHeaders(context.Background(), noSpanHeader)
+	require.Empty(t, noSpanHeader)
+}
+
+func TestMiddlewareAndTransport(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+
+	var traceparentSeenByServer string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparentSeenByServer = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	subject := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, downstream.URL, nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Empty(t, req.Header.Get("traceparent"), "the original request should not be modified")
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	subject.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/tracker_activity?password=secret", nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "POST /tracker_activity", spans[0].Name)
+	require.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+	require.Contains(t, spans[0].Attributes, attribute.Int("http.status_code", http.StatusBadGateway))
+	require.Contains(t, spans[0].Attributes, attribute.String("http.target", "/tracker_activity"))
+	require.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Equal(t, "00-"+spans[0].SpanContext.TraceID().String()+"-"+spans[0].SpanContext.SpanID().String()+"-01", traceparentSeenByServer)
+}
+
+func TestNewProviderFromEnv(t *testing.T) {
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			value, ok := vars[name]
+			return value, ok
+		}
+	}
+
+	provider, exporting, err := NewProviderFromEnv(env(map[string]string{}), nil)
+	require.NoError(t, err)
+	require.False(t, exporting)
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	_, _, err = NewProviderFromEnv(env(map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}), nil)
+	require.EqualError(t, err, `invalid OTLP traces endpoint "collector:4318/v1/traces": must be an http or https URL`)
+
+	// A collector which receives the spans, as the OTLP/HTTP exporter sends them.
+	type export struct {
+		path, contentType, apiKey string
+		size                      int
+	}
+	exports := make(chan export, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		exports <- export{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), apiKey: r.Header.Get("Api-Key"), size: len(body)}
+	}))
+	defer collector.Close()
+
+	for _, vars := range []map[string]string{
+		{"OTEL_EXPORTER_OTLP_ENDPOINT": collector.URL + "/"},
+		{
+			"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://ignored:4318",
+			"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": collector.URL + "/custom/path",
+			"OTEL_EXPORTER_OTLP_HEADERS":         "api-key = abc, other=d=e,,bad",
+			"OTEL_SERVICE_NAME":                  "my-issues2stories",
+		},
+	} {
+		provider, exporting, err := NewProviderFromEnv(env(vars), nil)
+		require.NoError(t, err)
+		require.True(t, exporting)
+		_, span := provider.Tracer(instrumentationName).Start(context.Background(), "exported")
+		span.End()
+		require.NoError(t, provider.Shutdown(context.Background()))
+
+		got := <-exports
+		require.Equal(t, "application/x-protobuf", got.contentType)
+		require.NotZero(t, got.size)
+		if vars["OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"] == "" {
+			require.Equal(t, "/v1/traces", got.path)
+			require.Empty(t, got.apiKey)
+		} else {
+			require.Equal(t, "/custom/path", got.path)
+			require.Equal(t, "abc", got.apiKey)
+		}
+	}
+}
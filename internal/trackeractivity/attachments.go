@@ -0,0 +1,142 @@
+package trackeractivity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/trackerapi"
+)
+
+// The URLs of files which were uploaded to GitHub, e.g. by pasting an image into an issue, as opposed to the other
+// links in an issue's body. A URL can't end with a dot, which usually ends a sentence.
+var attachmentURLPattern = regexp.MustCompile(`https://(?:user-images\.githubusercontent\.com/\d+/|` +
+	`github\.com/user-attachments/(?:assets|files)/|github\.com/[\w.-]+/[\w.-]+/(?:assets|files)/)[\w/.%~-]*[\w/%~-]`)
+
+// The outcomes of copying a file from GitHub into Tracker.
+const (
+	attachmentCopied   = "copied"
+	attachmentTooLarge = "too_large"
+	attachmentFailed   = "error"
+)
+
+const attachmentCommentText = "These files were copied from the GitHub issue, so that they can be seen without logging in to GitHub."
+
+// Copy the files which the new story's description links to on GitHub into Tracker, attached to a comment on the
+// story, and point the description's links at the copies. Files which can't be copied are left on GitHub, so that
+// the story is still usable, and the failures are only logged.
+func (h *handler) copyAttachments(ctx context.Context, logger *logging.Logger, responseWriter http.ResponseWriter,
+	configuration *config.Config, projectID int64, issueNumber int, change Change) {
+	settings := configuration.AttachmentCopy.WithDefaults()
+	description := change.NewValues.Description
+	fileURLs := attachmentURLs(description)
+	if len(fileURLs) == 0 {
+		return
+	}
+	if configuration.IsDryRun(projectID) {
+		logger.Info("Dry run: skipping copying files from issue into story", "urls", fileURLs)
+		fmt.Fprintf(responseWriter, "dry run: planned copy of %d files from issue #%d into story #%d\n", len(fileURLs), issueNumber, change.ID)
+		return
+	}
+
+	var attachments []trackerapi.FileAttachment
+	copies := map[string]string{}
+	var totalBytes int64
+	for _, fileURL := range fileURLs {
+		logger := logger.With("url", fileURL)
+		maxBytes := settings.MaxFileBytes
+		if remaining := settings.MaxTotalBytes - totalBytes; remaining < maxBytes {
+			maxBytes = remaining
+		}
+		var file *githubapi.Attachment
+		err := githubapi.ErrAttachmentTooLarge
+		if maxBytes > 0 {
+			logger.Info("Calling GitHub to download file linked from issue")
+			file, err = h.gitHubClient.DownloadAttachment(ctx, fileURL, maxBytes)
+		}
+		if errors.Is(err, githubapi.ErrAttachmentTooLarge) {
+			logger.Warn("Not copying file into story: it is larger than the attachment_copy limits allow",
+				"max_bytes", maxBytes)
+			attachmentCopies.WithLabelValues(attachmentTooLarge).Inc()
+			continue
+		}
+		if err != nil {
+			logger.Warn("Could not download file linked from issue, so leaving it on GitHub", "error", err)
+			attachmentCopies.WithLabelValues(attachmentFailed).Inc()
+			continue
+		}
+
+		logger.Info("Calling Tracker API to upload file")
+		uploaded, err := h.trackerAPI.UploadFile(ctx, projectID, attachmentFilename(fileURL), attachmentContentType(file), file.Content)
+		if err != nil {
+			logger.Warn("Could not upload file to Tracker, so leaving it on GitHub", "error", err)
+			attachmentCopies.WithLabelValues(attachmentFailed).Inc()
+			continue
+		}
+		totalBytes += int64(len(file.Content))
+		attachments = append(attachments, *uploaded)
+		copies[fileURL] = "https://www.pivotaltracker.com" + uploaded.DownloadURL
+	}
+	if len(attachments) == 0 {
+		return
+	}
+
+	// Uploaded files are only kept when they are attached to something.
+	logger.Info("Calling Tracker API to comment on story with the copied files", "files", len(attachments))
+	if err := h.trackerAPI.AddCommentWithAttachments(ctx, projectID, change.ID, attachmentCommentText, attachments); err != nil {
+		logger.Warn("Could not comment on story with the copied files, so leaving them on GitHub", "error", err)
+		attachmentCopies.WithLabelValues(attachmentFailed).Add(float64(len(attachments)))
+		return
+	}
+	attachmentCopies.WithLabelValues(attachmentCopied).Add(float64(len(attachments)))
+
+	newDescription := attachmentURLPattern.ReplaceAllStringFunc(description, func(fileURL string) string {
+		if trackerURL, ok := copies[fileURL]; ok {
+			return trackerURL
+		}
+		return fileURL
+	})
+	logger.Info("Calling Tracker API to update story description with the copied files' links")
+	err := h.recentWrites.Write(func() error {
+		return h.trackerAPI.UpdateStory(ctx, projectID, change.ID, &trackerapi.StoryUpdate{Description: &newDescription})
+	}, descriptionFingerprint(change.ID, newDescription))
+	if err != nil {
+		logger.Warn("Could not update story description with the copied files' links", "error", err)
+	}
+}
+
+// Returns the URLs of the files which were uploaded to GitHub, in the order in which they are first linked.
+func attachmentURLs(text string) []string {
+	var fileURLs []string
+	for _, fileURL := range attachmentURLPattern.FindAllString(text, -1) {
+		if !contains(fileURL, fileURLs) {
+			fileURLs = append(fileURLs, fileURL)
+		}
+	}
+	return fileURLs
+}
+
+// Returns the file's name from the end of its URL, e.g. "logs.zip", or the image's ID for images, which GitHub
+// links to without their names.
+func attachmentFilename(fileURL string) string {
+	name := path.Base(fileURL)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+func attachmentContentType(file *githubapi.Attachment) string {
+	if mediaType, _, err := mime.ParseMediaType(file.ContentType); err == nil {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,214 @@
+package trackeractivity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"issues2stories/internal/config"
+	"issues2stories/internal/logging"
+)
+
+// A transition which will be commented on, and its line of the audit comment.
+type auditLine struct {
+	transition string
+	text       string
+}
+
+// An audit comment which the app made on an issue.
+type auditComment struct {
+	id        int64
+	createdAt time.Time
+	lines     []auditLine
+}
+
+// The body of the comment, with one paragraph per transition.
+func (c *auditComment) body() string {
+	texts := make([]string, len(c.lines))
+	for i, line := range c.lines {
+		texts[i] = line.text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// RecentAuditComments remembers the audit comments which were recently made, by issue number, so that transitions
+// which follow soon after can be added to the same comment instead of making another one. One RecentAuditComments
+// should be shared by all of the handlers which can receive the same Tracker project's events.
+type RecentAuditComments struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	byIssue map[int]auditComment
+
+	// Held while commenting on an issue, so that concurrent events don't both make a new comment on it.
+	issueLocks map[int]*issueLock
+}
+
+type issueLock struct {
+	sync.Mutex
+	holders int
+}
+
+func NewRecentAuditComments() *RecentAuditComments {
+	return &RecentAuditComments{now: time.Now, byIssue: map[int]auditComment{}, issueLocks: map[int]*issueLock{}}
+}
+
+// Wait until no other event is commenting on the issue. The returned function must be called once done with it.
+func (r *RecentAuditComments) lockIssue(issueNumber int) (unlock func()) {
+	r.mu.Lock()
+	lock, ok := r.issueLocks[issueNumber]
+	if !ok {
+		lock = &issueLock{}
+		r.issueLocks[issueNumber] = lock
+	}
+	lock.holders++
+	r.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(r.issueLocks, issueNumber)
+		}
+	}
+}
+
+// Returns the audit comment which was made on the issue within the window, if any.
+func (r *RecentAuditComments) find(issueNumber int, window time.Duration) (auditComment, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	comment, ok := r.byIssue[issueNumber]
+	if !ok || window < 0 || r.now().Sub(comment.createdAt) >= window {
+		return auditComment{}, false
+	}
+	return comment, true
+}
+
+// Remember the audit comment, and forget the ones which were made too long ago to be added to.
+func (r *RecentAuditComments) remember(issueNumber int, comment auditComment, window time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for number, previous := range r.byIssue {
+		if r.now().Sub(previous.createdAt) >= window {
+			delete(r.byIssue, number)
+		}
+	}
+	r.byIssue[issueNumber] = comment
+}
+
+// Returns the lines of the audit comment for the story change, one for each of its transitions which the
+// configuration comments on. Returns nothing when no transitions are commented on.
+func (h *handler) auditLines(ctx context.Context, logger *logging.Logger, configuration *config.Config,
+	projectID int64, issueNumber int, performedBy Person, change Change) ([]auditLine, error) {
+	audit := configuration.AuditComments
+	if change.ChangeType != "update" {
+		return nil, nil
+	}
+
+	var transitions []string
+	if newState := change.NewValues.CurrentState; newState != "" && audit.Comments(newState) {
+		transitions = append(transitions, newState)
+	}
+	ownersChanged := change.NewValues.OwnerIDs.Present && change.NewValues.OwnerIDs.Value != nil
+	if ownersChanged && audit.Comments(config.AuditTransitionOwners) {
+		transitions = append(transitions, config.AuditTransitionOwners)
+	}
+	if len(transitions) == 0 {
+		return nil, nil
+	}
+
+	data := config.AuditCommentData{
+		IssueNumber: issueNumber,
+		ProjectID:   projectID,
+		StoryID:     change.ID,
+		StoryURL:    fmt.Sprintf("https://www.pivotaltracker.com/story/show/%d", change.ID),
+		PerformedBy: performedBy.Name,
+	}
+	if data.PerformedBy == "" {
+		data.PerformedBy = fmt.Sprintf("Tracker user %d", performedBy.ID)
+	}
+	// The webhook event doesn't say which iteration the story is in. Stories in the icebox, or scheduled in a later
+	// iteration, are in no iteration yet, so the iteration is only mentioned when the story is in the current one.
+	if iteration, err := h.trackerAPI.GetCurrentIteration(ctx, projectID); err != nil {
+		logger.Warn("Could not find the Tracker project's current iteration, so audit comments won't mention it", "error", err)
+	} else if iteration.Contains(change.ID) {
+		data.Iteration = iteration.Number
+	}
+
+	lines := make([]auditLine, 0, len(transitions))
+	for _, transition := range transitions {
+		lineData := data
+		lineData.Transition = transition
+		if transition == config.AuditTransitionOwners {
+			lineData.Owners = h.ownerNames(ctx, logger, configuration, projectID, *change.NewValues.OwnerIDs.Value)
+		} else {
+			lineData.PreviousState = change.OriginalValues.CurrentState
+			lineData.CurrentState = change.NewValues.CurrentState
+		}
+		text, err := audit.RenderComment(lineData)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, auditLine{transition: transition, text: text})
+	}
+	return lines, nil
+}
+
+// Returns the story owners' GitHub usernames where they are known, or else their Tracker user IDs, as a
+// comma-separated list. GitHub users are not @-mentioned, so that they are not notified of each comment.
+func (h *handler) ownerNames(ctx context.Context, logger *logging.Logger, configuration *config.Config, projectID int64, ownerIDs []int64) string {
+	if len(ownerIDs) == 0 {
+		return "nobody"
+	}
+	names := make([]string, len(ownerIDs))
+	for i, ownerID := range ownerIDs {
+		names[i] = h.gitHubUsernameOfOwner(ctx, logger, configuration, projectID, ownerID)
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("Tracker user %d", ownerID)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Comment on the issue with the lines. When the app already made an audit comment on the issue within the coalesce
+// window, the lines are added to that comment instead, so that a story which moves back and forth doesn't flood the
+// issue with comments.
+func (h *handler) postAuditComment(ctx context.Context, logger *logging.Logger, audit config.AuditComments, issueNumber int, lines []auditLine) error {
+	audit = audit.WithDefaults()
+	unlock := h.auditComments.lockIssue(issueNumber)
+	defer unlock()
+	if previous, ok := h.auditComments.find(issueNumber, audit.CoalesceWindow); ok {
+		coalesced := previous
+		coalesced.lines = append(append([]auditLine{}, previous.lines...), lines...)
+		logger.Info("Calling GitHub API to add to the previous audit comment on issue", "comment", previous.id)
+		err := h.gitHubClient.EditComment(ctx, previous.id, coalesced.body())
+		if err == nil {
+			h.auditComments.remember(issueNumber, coalesced, audit.CoalesceWindow)
+			countAuditLines(lines, "edited")
+			return nil
+		}
+		// E.g. someone deleted the previous comment.
+		logger.Warn("Could not add to the previous audit comment, so making another one", "comment", previous.id, "error", err)
+	}
+
+	comment := auditComment{createdAt: h.auditComments.now(), lines: lines}
+	logger.Info("Calling GitHub API to comment on issue about the story's transitions")
+	id, err := h.gitHubClient.CreateComment(ctx, issueNumber, comment.body())
+	if err != nil {
+		return err
+	}
+	comment.id = id
+	h.auditComments.remember(issueNumber, comment, audit.CoalesceWindow)
+	countAuditLines(lines, "created")
+	return nil
+}
+
+func countAuditLines(lines []auditLine, comment string) {
+	for _, line := range lines {
+		auditCommentTransitions.WithLabelValues(line.transition, comment).Inc()
+	}
+}
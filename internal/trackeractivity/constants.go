@@ -66,11 +66,11 @@ var issueLabelsToApplyPerStoryType = map[string][]string{
 // key's value.
 //
 // Tracker's estimation scales:
-// - Fibonacci scale:   0, 1, 2, 3, 5, 8 -> XS, S, M, L, XL, XXL
-// - Powers of 2 scale: 0, 1, 2, 4, 8    -> XS, S, M, L, XXL
-// - Linear scale:      0, 1, 2, 3       -> XS, S, M, L
-// - Custom scale: Not supported unless you edit the code below to match
-//   allowed values of your custom scale.
+//   - Fibonacci scale:   0, 1, 2, 3, 5, 8 -> XS, S, M, L, XL, XXL
+//   - Powers of 2 scale: 0, 1, 2, 4, 8    -> XS, S, M, L, XXL
+//   - Linear scale:      0, 1, 2, 3       -> XS, S, M, L
+//   - Custom scale: Not supported unless you edit the code below to match
+//     allowed values of your custom scale.
 var issueLabelsToApplyPerStoryEstimate = map[string][]string{
 	"0": {"estimate/XS"},
 	"1": {"estimate/S"},
@@ -0,0 +1,177 @@
+package trackeractivity
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+
+	"issues2stories/internal/config"
+	"issues2stories/internal/textmerge"
+)
+
+// The markers around the story's description in the issue body, in the "managed_section" description sync mode.
+// HTML comments are not shown when GitHub renders the body.
+const (
+	managedSectionStart = "<!-- issues2stories: Tracker story description. Edit it in Tracker, not here. -->"
+	managedSectionEnd   = "<!-- issues2stories: end of Tracker story description -->"
+)
+
+// In the "merge" description sync mode, the description which was last synced to the issue is kept at the end of the
+// issue body, base64 encoded between these, so that it can be the base of the next merge.
+const (
+	syncedDescriptionStart = "<!-- issues2stories: last synced description: "
+	syncedDescriptionEnd   = " -->"
+)
+
+// GitHub rejects issue bodies which are longer than this many characters.
+const maxIssueBodyLength = 65536
+
+// The outcomes of syncing a story's description to its issue's body.
+const (
+	descriptionUpdated   = "updated"
+	descriptionUnchanged = "unchanged"
+	descriptionConflict  = "conflict"
+)
+
+// Returns the issue's new body for the story's changed description, using the description sync mode, and the outcome.
+// The body should only be updated when the outcome is descriptionUpdated.
+func planIssueBody(mode string, issueBody string, change Change) (string, string) {
+	description := change.NewValues.Description
+	switch mode {
+	case config.DescriptionSyncManagedSection:
+		if _, _, ok := managedSection(issueBody); !ok {
+			// E.g. a story which was created from the import panel starts with the issue's body as its description.
+			// The issue already shows the description, and when it is edited the whole body is replaced, so that the
+			// body doesn't repeat the original description.
+			if sameText(issueBody, description) {
+				return "", descriptionUnchanged
+			}
+			if sameText(issueBody, change.OriginalValues.Description) {
+				return withManagedSection("", description), descriptionUpdated
+			}
+		}
+		newBody := withManagedSection(issueBody, description)
+		if newBody == issueBody {
+			return "", descriptionUnchanged
+		}
+		return newBody, descriptionUpdated
+
+	case config.DescriptionSyncMerge:
+		// The description which was last synced to the issue is the base of both the changes in Tracker and the
+		// changes which were only made in GitHub. Until it has been synced once, the story's previous description is.
+		body, base, ok := withoutSyncedDescription(issueBody)
+		if !ok {
+			base = change.OriginalValues.Description
+		}
+		ours := normalizeLines(body)
+		merged, ok := textmerge.Merge(normalizeLines(base), ours, normalizeLines(description))
+		if !ok {
+			return "", descriptionConflict
+		}
+		newBody := withSyncedDescription(withLineEndingsOf(merged, body), description)
+		if newBody == issueBody {
+			return "", descriptionUnchanged
+		}
+		return newBody, descriptionUpdated
+
+	default:
+		return description, descriptionUpdated
+	}
+}
+
+// Returns where the managed section starts in the body and where it ends, after its end marker, if it has one.
+func managedSection(body string) (int, int, bool) {
+	start := strings.Index(body, managedSectionStart)
+	if start < 0 {
+		return 0, 0, false
+	}
+	end := strings.Index(body[start:], managedSectionEnd)
+	if end < 0 {
+		return 0, 0, false
+	}
+	return start, start + end + len(managedSectionEnd), true
+}
+
+// Returns the body with the description between the managed section's markers, replacing the section when the body
+// already has one, or else adding the section at the end. Only the section's line endings are normalized.
+func withManagedSection(body, description string) string {
+	section := managedSectionStart + "\n" + normalizeLines(strings.TrimRight(description, "\r\n")) + managedSectionEnd
+	if start, end, ok := managedSection(body); ok {
+		return body[:start] + section + body[end:]
+	}
+	if strings.TrimSpace(body) == "" {
+		return section
+	}
+	return strings.TrimRight(body, "\r\n") + "\n\n" + section
+}
+
+// Returns the body without the last synced description, and the description, if the body has one.
+func withoutSyncedDescription(body string) (string, string, bool) {
+	start := strings.LastIndex(body, syncedDescriptionStart)
+	if start < 0 {
+		return body, "", false
+	}
+	end := strings.Index(body[start:], syncedDescriptionEnd)
+	if end < 0 {
+		return body, "", false
+	}
+	encoded := body[start+len(syncedDescriptionStart) : start+end]
+	description, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return body, "", false
+	}
+	before, after := body[:start], body[start+end+len(syncedDescriptionEnd):]
+	if strings.HasSuffix(before, "\r\n\r\n") {
+		before = strings.TrimSuffix(before, "\r\n\r\n")
+	} else {
+		before = strings.TrimSuffix(before, "\n\n")
+	}
+	return before + after, string(description), true
+}
+
+// Returns the body with the description kept at its end as the last synced description. The description is left out
+// when the body would be too long for GitHub with it, in which case the next merge falls back to the story's previous
+// description as its base.
+func withSyncedDescription(body, description string) string {
+	marker := syncedDescriptionStart + base64.StdEncoding.EncodeToString([]byte(description)) + syncedDescriptionEnd
+	var withMarker string
+	switch {
+	case body == "":
+		withMarker = marker
+	case strings.Contains(body, "\r\n"):
+		withMarker = body + "\r\n\r\n" + marker
+	default:
+		withMarker = body + "\n\n" + marker
+	}
+	if utf8.RuneCountInString(withMarker) > maxIssueBodyLength {
+		return body
+	}
+	return withMarker
+}
+
+// GitHub keeps the line endings from the browser, which are usually "\r\n", while Tracker uses "\n". The last line
+// gets a line ending too, so that only the text of the lines is compared when merging.
+func normalizeLines(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// Returns the normalized text with the line endings of the original text, so that merging doesn't change the line
+// endings of the lines which only GitHub changed, nor whether the last line has one.
+func withLineEndingsOf(text, original string) string {
+	if strings.Contains(original, "\r\n") {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	if !strings.HasSuffix(original, "\n") {
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+	}
+	return text
+}
+
+// Whether the texts only differ in their line endings and surrounding whitespace.
+func sameText(a, b string) bool {
+	return strings.TrimSpace(normalizeLines(a)) == strings.TrimSpace(normalizeLines(b))
+}
@@ -0,0 +1,142 @@
+package trackeractivity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithManagedSection(t *testing.T) {
+	section := managedSectionStart + "\nNew description\n" + managedSectionEnd
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "empty body",
+			body:     "",
+			wantBody: section,
+		},
+		{
+			name:     "body without a managed section",
+			body:     "Reported in GitHub\n\n",
+			wantBody: "Reported in GitHub\n\n" + section,
+		},
+		{
+			name:     "body with a managed section",
+			body:     "Before\n" + managedSectionStart + "\nOld description\n" + managedSectionEnd + "\nAfter",
+			wantBody: "Before\n" + section + "\nAfter",
+		},
+		{
+			name:     "body with only the start of a managed section",
+			body:     "Before\n" + managedSectionStart + "\nOld description",
+			wantBody: "Before\n" + managedSectionStart + "\nOld description\n\n" + section,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.wantBody, withManagedSection(test.body, "New description\n"))
+		})
+	}
+}
+
+func TestPlanIssueBody(t *testing.T) {
+	change := func(originalDescription, newDescription string) Change {
+		var c Change
+		c.OriginalValues.Description = originalDescription
+		c.NewValues.Description = newDescription
+		return c
+	}
+	tests := []struct {
+		name        string
+		mode        string
+		body        string
+		change      Change
+		wantBody    string
+		wantOutcome string
+	}{
+		{
+			name:        "managed section for an issue whose body is already the description",
+			mode:        "managed_section",
+			body:        "Reported in GitHub\r\n",
+			change:      change("Reported in GitHub", "Reported in GitHub\n"),
+			wantOutcome: descriptionUnchanged,
+		},
+		{
+			name:        "managed section for an issue whose body was the previous description",
+			mode:        "managed_section",
+			body:        "Reported in GitHub\r\n",
+			change:      change("Reported in GitHub\n", "Reported in GitHub, edited in Tracker\n"),
+			wantBody:    managedSectionStart + "\nReported in GitHub, edited in Tracker\n" + managedSectionEnd,
+			wantOutcome: descriptionUpdated,
+		},
+		{
+			name:        "managed section for an issue whose body is something else",
+			mode:        "managed_section",
+			body:        "Reported in GitHub\r\nwith details\r\n",
+			change:      change("Tracker story\n", "Tracker story, edited\r\nin two lines\n"),
+			wantBody:    "Reported in GitHub\r\nwith details\n\n" + managedSectionStart + "\nTracker story, edited\nin two lines\n" + managedSectionEnd,
+			wantOutcome: descriptionUpdated,
+		},
+		{
+			name:        "merge without a last synced description uses the previous description as the base",
+			mode:        "merge",
+			body:        "ONE\r\ntwo",
+			change:      change("one\ntwo\n", "one\ntwo\nthree\n"),
+			wantBody:    "ONE\r\ntwo\r\nthree\r\n\r\n" + withSyncedDescription("", "one\ntwo\nthree\n"),
+			wantOutcome: descriptionUpdated,
+		},
+		{
+			name:        "merge uses the last synced description as the base",
+			mode:        "merge",
+			body:        "ONE\ntwo\n\n" + withSyncedDescription("", "one\ntwo\n"),
+			change:      change("a previous description which was never synced\n", "one\ntwo\nthree\n"),
+			wantBody:    "ONE\ntwo\nthree\n\n" + withSyncedDescription("", "one\ntwo\nthree\n"),
+			wantOutcome: descriptionUpdated,
+		},
+		{
+			name:        "merge with the description already synced",
+			mode:        "merge",
+			body:        "ONE\ntwo\n\n" + withSyncedDescription("", "one\ntwo\n"),
+			change:      change("one\n", "one\ntwo\n"),
+			wantOutcome: descriptionUnchanged,
+		},
+		{
+			name:        "merge with conflicting changes",
+			mode:        "merge",
+			body:        "ONE\ntwo\n\n" + withSyncedDescription("", "one\ntwo\n"),
+			change:      change("one\ntwo\n", "1\ntwo\n"),
+			wantOutcome: descriptionConflict,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			body, outcome := planIssueBody(test.mode, test.body, test.change)
+			require.Equal(t, test.wantOutcome, outcome)
+			require.Equal(t, test.wantBody, body)
+		})
+	}
+}
+
+func TestSyncedDescription(t *testing.T) {
+	for _, body := range []string{"", "Reported in GitHub", "Reported in GitHub\n", "Reported\r\nin GitHub\r\n"} {
+		withDescription := withSyncedDescription(body, "A description\nwith a comment's end -->\n")
+		withoutDescription, description, ok := withoutSyncedDescription(withDescription)
+		require.True(t, ok)
+		require.Equal(t, body, withoutDescription)
+		require.Equal(t, "A description\nwith a comment's end -->\n", description)
+	}
+
+	_, _, ok := withoutSyncedDescription("Reported in GitHub\n\n" + syncedDescriptionStart + "not base64!" + syncedDescriptionEnd)
+	require.False(t, ok)
+
+	// The description is base64 encoded, which makes it longer, so a long body can't keep it.
+	long := strings.Repeat("é", 30000)
+	require.Equal(t, long, withSyncedDescription(long, long))
+	_, _, ok = withoutSyncedDescription(withSyncedDescription(long, long[:20000]))
+	require.True(t, ok)
+}
@@ -1,5 +1,13 @@
 package trackeractivity
 
+import (
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/loopguard"
+)
+
 func uniqueValuesFromMapOfSlices(theMap map[string][]string) []string {
 	allValues := []string{}
 	for _, values := range theMap {
@@ -56,3 +64,80 @@ func equalIgnoringOrder(a1, a2 []string) bool {
 func addressOf(s string) *string {
 	return &s
 }
+
+// Returns the story change without the fields which only echo a recent update which the app made to the story, so
+// that they are not synced back to the issue. The app changes the description when it copies the files which the
+// description links to into Tracker, and the owners when the issue's assignees change. The app's changes to the
+// story's state, type and estimate are still synced, so that the issue's labels match them, e.g. after closing the
+// issue moved the story to finished, but their fingerprints are forgotten too. Returns whether any field was echoed.
+func withoutEchoes(recentWrites *loopguard.RecentWrites, change Change) (Change, bool) {
+	echoed := false
+	if change.NewValues.Description != "" && recentWrites.Consume(descriptionFingerprint(change.ID, change.NewValues.Description)) {
+		change.NewValues.Description = ""
+		echoed = true
+	}
+	if change.NewValues.OwnerIDs.Present && change.NewValues.OwnerIDs.Value != nil &&
+		recentWrites.Consume(loopguard.StoryFingerprint(change.ID, "owner_ids", *change.NewValues.OwnerIDs.Value)) {
+		change.NewValues.OwnerIDs = OptionalInt64List{}
+		echoed = true
+	}
+	if change.NewValues.CurrentState != "" {
+		echoed = recentWrites.Consume(loopguard.StoryFingerprint(change.ID, "current_state", change.NewValues.CurrentState)) || echoed
+	}
+	if change.NewValues.StoryType != "" {
+		echoed = recentWrites.Consume(loopguard.StoryFingerprint(change.ID, "story_type", change.NewValues.StoryType)) || echoed
+	}
+	if change.NewValues.Estimate.Present {
+		var estimate interface{}
+		if change.NewValues.Estimate.Value != nil {
+			estimate = *change.NewValues.Estimate.Value
+		}
+		echoed = recentWrites.Consume(loopguard.StoryFingerprint(change.ID, "estimate", estimate)) || echoed
+	}
+	return change, echoed
+}
+
+// Returns the fingerprints of the GitHub webhook events which the issue update will cause: one for each label or
+// assignee which is added or removed, one for closing or reopening the issue, and one for editing its body.
+func issueUpdateFingerprints(issueNumber int, before *githubapi.Issue, update *github.IssueRequest) []string {
+	var fingerprints []string
+	addChanges := func(beforeValues []string, afterValues *[]string, kind string) {
+		if afterValues == nil {
+			return
+		}
+		for _, value := range *afterValues {
+			if !containsIgnoringCase(beforeValues, value) {
+				fingerprints = append(fingerprints, loopguard.IssueFingerprint(issueNumber, kind+"+"+value))
+			}
+		}
+		for _, value := range beforeValues {
+			if !containsIgnoringCase(*afterValues, value) {
+				fingerprints = append(fingerprints, loopguard.IssueFingerprint(issueNumber, kind+"-"+value))
+			}
+		}
+	}
+	addChanges(before.Labels, update.Labels, "label")
+	addChanges(before.Assignees, update.Assignees, "assignee")
+	if update.State != nil {
+		fingerprints = append(fingerprints, loopguard.IssueFingerprint(issueNumber, "state="+*update.State))
+	}
+	if update.Body != nil {
+		fingerprints = append(fingerprints, loopguard.IssueFingerprint(issueNumber, "body="+loopguard.Digest(*update.Body)))
+	}
+	return fingerprints
+}
+
+// GitHub label names and usernames are case-insensitive.
+func containsIgnoringCase(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Descriptions can be long, so their fingerprints use a digest of the description.
+func descriptionFingerprint(storyID int64, description string) string {
+	return loopguard.StoryFingerprint(storyID, "description", loopguard.Digest(description))
+}
@@ -3,10 +3,29 @@ package trackeractivity
 import (
 	"testing"
 
+	"github.com/google/go-github/v33/github"
 	"github.com/stretchr/testify/require"
+	"issues2stories/internal/githubapi"
 )
 
 func TestAddressOf(t *testing.T) {
 	require.Equal(t, "foo", *addressOf("foo"))
 	require.Equal(t, "bar", *addressOf("bar"))
 }
+
+func TestIssueUpdateFingerprints(t *testing.T) {
+	before := &githubapi.Issue{Labels: []string{"bug", "state/started"}, Assignees: []string{"cfryanr", "enj"}}
+	update := &github.IssueRequest{
+		Labels:    &[]string{"Bug", "state/accepted"},
+		Assignees: &[]string{"enj", "someone-else"},
+		State:     addressOf("closed"),
+	}
+	require.Equal(t, []string{
+		"github/issue/42/label+state/accepted",
+		"github/issue/42/label-state/started",
+		"github/issue/42/assignee+someone-else",
+		"github/issue/42/assignee-cfryanr",
+		"github/issue/42/state=closed",
+	}, issueUpdateFingerprints(42, before, update))
+	require.Nil(t, issueUpdateFingerprints(42, before, &github.IssueRequest{Title: addressOf("New title")}))
+}
@@ -0,0 +1,39 @@
+package trackeractivity
+
+import "issues2stories/internal/metrics"
+
+var (
+	webhookEvents = metrics.NewCounterVec(
+		"issues2stories_tracker_webhook_events_total",
+		"Tracker activity webhook events received, by event kind and outcome.",
+		"kind", "outcome")
+
+	storyChanges = metrics.NewCounterVec(
+		"issues2stories_tracker_story_changes_total",
+		"Story changes seen in Tracker activity webhook events, by change type.",
+		"change_type")
+
+	descriptionSyncs = metrics.NewCounterVec(
+		"issues2stories_tracker_description_syncs_total",
+		"Story description changes synced to GitHub issue bodies, by description sync mode and outcome.",
+		"mode", "outcome")
+
+	auditCommentTransitions = metrics.NewCounterVec(
+		"issues2stories_tracker_audit_comment_transitions_total",
+		"Story transitions which were commented on in GitHub issues, by transition and whether the comment was "+
+			"created or an earlier one was edited to add the transition.",
+		"transition", "comment")
+
+	attachmentCopies = metrics.NewCounterVec(
+		"issues2stories_tracker_attachment_copies_total",
+		"Files linked from GitHub issues which were copied into their new Tracker stories, by outcome.",
+		"outcome")
+
+	taskListSyncs = metrics.NewCounterVec(
+		"issues2stories_tracker_task_list_syncs_total",
+		"Story task changes synced to the task lists of GitHub issues, by outcome.",
+		"outcome")
+)
+
+// The event kind used for requests which were rejected before their body was parsed.
+const unknownEventKind = "unknown"
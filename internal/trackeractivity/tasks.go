@@ -0,0 +1,177 @@
+package trackeractivity
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v33/github"
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/tasklist"
+	"issues2stories/internal/tracing"
+	"issues2stories/internal/translate"
+)
+
+// The outcomes of syncing a story's tasks to its issue's task list.
+const (
+	taskListUpdated   = "updated"
+	taskListUnchanged = "unchanged"
+)
+
+// Returns the stories whose tasks the event changed. A task event's primary resource is the task's story.
+func storiesWithTaskChanges(activityEvent *TrackerEvent) []int64 {
+	changedTasks := false
+	for _, change := range activityEvent.Changes {
+		changedTasks = changedTasks || change.Kind == "task"
+	}
+	if !changedTasks {
+		return nil
+	}
+	var storyIDs []int64
+	for _, resource := range activityEvent.PrimaryResources {
+		if resource.Kind == "story" {
+			storyIDs = append(storyIDs, resource.ID)
+		}
+	}
+	return storyIDs
+}
+
+// Update the task list in the body of the GitHub issue linked to the story, if any, to match the story's tasks.
+// Returns false when the task list could not be updated, in which case an error has already been written to the
+// response.
+func (h *handler) syncTaskList(ctx context.Context, logger *logging.Logger, responseWriter http.ResponseWriter,
+	configuration *config.Config, projectID, storyID int64) bool {
+	ctx, span := tracing.Start(ctx, "process task changes", tracing.SpanKindInternal,
+		"tracker.project", projectID,
+		"tracker.story", storyID)
+	defer span.End()
+
+	logger = logger.With("story", storyID)
+	githubIssueID, err := h.trackerAPI.GetGithubIssueIDLinkedToStory(ctx, projectID, storyID)
+	if err != nil {
+		logger.Error("Error calling Tracker API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't get GitHub issue id from Tracker", http.StatusBadGateway)
+		return false
+	}
+	if githubIssueID == 0 {
+		logger.Info("Story is not linked to GitHub issue, so not syncing its tasks")
+		return true
+	}
+	logger = logger.With("issue", githubIssueID)
+	span.SetAttributes("github.issue", githubIssueID)
+
+	tasks, err := h.trackerAPI.ListTasks(ctx, projectID, storyID)
+	if err != nil {
+		logger.Error("Error calling Tracker API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't list the story's tasks via Tracker API", http.StatusBadGateway)
+		return false
+	}
+	issueDetails, err := h.gitHubClient.GetIssue(ctx, githubIssueID)
+	if err != nil {
+		logger.Error("Could not get issue from GitHub", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't get GitHub issue details from GitHub", http.StatusBadGateway)
+		return false
+	}
+
+	// Task text is copied to GitHub, so the tasks are translated for GitHub before they are compared with the task list.
+	texts := make([]string, len(tasks))
+	for i, task := range tasks {
+		texts[i] = task.Description
+	}
+	translator, err := translate.ForProjects(ctx, h.trackerAPI, configuration.UserIDMapping, "", []int64{projectID}, texts...)
+	if err != nil {
+		logger.Warn("Could not list the Tracker project's members, so mentions in tasks won't be translated", "error", err)
+	}
+	tasks = tasklist.TranslateTasks(tasks, translator.ToGitHub)
+
+	newBody := tasklist.Rewrite(issueDetails.Body, tasklist.ItemsForTasks(issueDetails.Body, tasks))
+	if newBody == issueDetails.Body {
+		logger.Info("The issue's task list already matches the story's tasks")
+		taskListSyncs.WithLabelValues(taskListUnchanged).Inc()
+		return true
+	}
+	issueRequest := github.IssueRequest{Body: &newBody}
+	if configuration.IsDryRun(projectID) {
+		taskListSyncs.WithLabelValues(taskListUpdated).Inc()
+		return writeDryRunPlan(logger, span, responseWriter, "GitHub API call to update issue",
+			fmt.Sprintf("update for issue #%d", githubIssueID), issueRequest)
+	}
+	unchanged, err := h.issueBodyUnchanged(ctx, githubIssueID, issueDetails.Body)
+	if err != nil {
+		logger.Error("Could not get issue from GitHub", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't get GitHub issue details from GitHub", http.StatusBadGateway)
+		return false
+	}
+	if !unchanged {
+		logger.Info("Not updating the issue's task list: the issue's body was edited since it was read")
+		return true
+	}
+	logger.Info("Calling GitHub API to update the issue's task list")
+	if err := h.rememberedUpdateIssue(ctx, githubIssueID, issueDetails, &issueRequest); err != nil {
+		logger.Error("Error calling GitHub API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't update GitHub issue via GitHub API", http.StatusBadGateway)
+		return false
+	}
+	taskListSyncs.WithLabelValues(taskListUpdated).Inc()
+	return true
+}
+
+// Create tasks in the new story for the items of the task list in its issue's body, and mark the items with their
+// tasks. Failures are only logged, because the story is still usable without its tasks, and editing the issue's
+// task list syncs it again.
+func (h *handler) importTasks(ctx context.Context, logger *logging.Logger, responseWriter http.ResponseWriter,
+	configuration *config.Config, projectID int64, issueNumber int, issueDetails *githubapi.Issue, storyID int64) {
+	items, changes := tasklist.TaskChanges("", issueDetails.Body, nil)
+	if len(changes) == 0 {
+		return
+	}
+	translator, err := translate.ForProjects(ctx, h.trackerAPI, configuration.UserIDMapping, "", []int64{projectID}, issueDetails.Body)
+	if err != nil {
+		logger.Warn("Could not list the Tracker project's members, so mentions in tasks won't be translated", "error", err)
+	}
+	changes = tasklist.TranslateChanges(changes, nil, translator.ToTracker)
+	if configuration.IsDryRun(projectID) {
+		logger.Info("Dry run: skipping creating tasks for the issue's task list", "tasks", len(changes))
+		fmt.Fprintf(responseWriter, "dry run: planned %d new tasks from issue #%d for story #%d\n", len(changes), issueNumber, storyID)
+		return
+	}
+	logger.Info("Calling Tracker API to create tasks for the issue's task list", "tasks", len(changes))
+	items, err = tasklist.Apply(ctx, h.trackerAPI, projectID, storyID, items, changes)
+	if err != nil {
+		logger.Warn("Could not create tasks for the issue's task list", "error", err)
+		return
+	}
+	newBody := tasklist.Rewrite(issueDetails.Body, items)
+	unchanged, err := h.issueBodyUnchanged(ctx, issueNumber, issueDetails.Body)
+	if err != nil {
+		logger.Warn("Could not get issue from GitHub, so not marking the issue's task list with its tasks", "error", err)
+		return
+	}
+	if !unchanged {
+		logger.Info("Not marking the issue's task list with its tasks: the issue's body was edited since it was read")
+		return
+	}
+	issueRequest := github.IssueRequest{Body: &newBody}
+	logger.Info("Calling GitHub API to mark the issue's task list with its tasks")
+	if err := h.rememberedUpdateIssue(ctx, issueNumber, issueDetails, &issueRequest); err != nil {
+		logger.Warn("Could not mark the issue's task list with its tasks", "error", err)
+	}
+}
+
+// Returns whether the issue's body is still the body which was read before the story's tasks were synced. The body
+// is only rewritten when it is, because rewriting a body which was edited since would undo that edit. The edit's
+// own event syncs the task list again.
+func (h *handler) issueBodyUnchanged(ctx context.Context, issueNumber int, body string) (bool, error) {
+	issue, err := h.gitHubClient.GetIssue(ctx, issueNumber)
+	if err != nil {
+		return false, err
+	}
+	return issue.Body == body, nil
+}
@@ -1,227 +1,557 @@
 package trackeractivity
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"sync"
 
 	"github.com/google/go-github/v33/github"
 	"issues2stories/internal/config"
 	"issues2stories/internal/githubapi"
+	"issues2stories/internal/guard"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/tracing"
 	"issues2stories/internal/trackerapi"
+	"issues2stories/internal/translate"
 )
 
 type handler struct {
 	trackerAPI   trackerapi.TrackerAPI
 	gitHubClient githubapi.GitHubAPI
 
-	configuration *config.Config
-	credentials   *config.BasicAuthCredentials
+	// The configuration can be reloaded, so it is read once per event.
+	configuration config.Provider
+	credentials   config.Authenticator
 
-	labelsToRemoveOnStateChange    []string
-	labelsToRemoveOnTypeChange     []string
-	labelsToRemoveOnEstimateChange []string
+	// Optional.
+	users        UserResolver
+	recentWrites *loopguard.RecentWrites
+
+	// The ID of the app's own Tracker user, once it has been found.
+	mu       sync.Mutex
+	personID int64
+
+	auditComments *RecentAuditComments
+}
+
+// A UserResolver finds the GitHub usernames of Tracker users who are not in the configured user ID mapping.
+// It returns an empty string when it finds no GitHub user.
+type UserResolver interface {
+	GitHubUsername(ctx context.Context, settings config.UserResolver, trackerProjectID, trackerUserID int64) (string, error)
+}
+
+// The label mappings used while handling one event.
+type labelMappings struct {
+	perStoryState    map[string][]string
+	perStoryType     map[string][]string
+	perStoryEstimate map[string][]string
+
+	toRemoveOnStateChange    []string
+	toRemoveOnTypeChange     []string
+	toRemoveOnEstimateChange []string
+}
+
+// Returns the configured label mappings, using the defaults for any which are not configured.
+func LabelMappingsWithDefaults(configured config.LabelMappings) config.LabelMappings {
+	if configured.States == nil {
+		configured.States = issueLabelsToApplyPerStoryState
+	}
+	if configured.Types == nil {
+		configured.Types = issueLabelsToApplyPerStoryType
+	}
+	if configured.Estimates == nil {
+		configured.Estimates = issueLabelsToApplyPerStoryEstimate
+	}
+	return configured
+}
+
+func newLabelMappings(configured config.LabelMappings) *labelMappings {
+	withDefaults := LabelMappingsWithDefaults(configured)
+	l := &labelMappings{
+		perStoryState:    withDefaults.States,
+		perStoryType:     withDefaults.Types,
+		perStoryEstimate: withDefaults.Estimates,
+	}
+	l.toRemoveOnStateChange = uniqueValuesFromMapOfSlices(l.perStoryState)
+	l.toRemoveOnTypeChange = uniqueValuesFromMapOfSlices(l.perStoryType)
+	l.toRemoveOnEstimateChange = uniqueValuesFromMapOfSlices(l.perStoryEstimate)
+	return l
 }
 
-func NewHandler(trackerAPI trackerapi.TrackerAPI, gitHubClient githubapi.GitHubAPI, configuration *config.Config, credentials *config.BasicAuthCredentials) http.Handler {
+// The users resolver may be nil, in which case only the configured user ID mapping is used. The recent writes may
+// be nil, in which case the app's own changes are only recognized by its own Tracker user, when that is configured.
+// The recent audit comments may be nil, in which case the handler doesn't share them with any other handler.
+func NewHandler(trackerAPI trackerapi.TrackerAPI, gitHubClient githubapi.GitHubAPI, configuration config.Provider, credentials config.Authenticator, users UserResolver, recentWrites *loopguard.RecentWrites, auditComments *RecentAuditComments) http.Handler {
+	if auditComments == nil {
+		auditComments = NewRecentAuditComments()
+	}
 	return &handler{
 		trackerAPI:    trackerAPI,
 		gitHubClient:  gitHubClient,
 		configuration: configuration,
 		credentials:   credentials,
-
-		labelsToRemoveOnStateChange:    uniqueValuesFromMapOfSlices(issueLabelsToApplyPerStoryState),
-		labelsToRemoveOnTypeChange:     uniqueValuesFromMapOfSlices(issueLabelsToApplyPerStoryType),
-		labelsToRemoveOnEstimateChange: uniqueValuesFromMapOfSlices(issueLabelsToApplyPerStoryEstimate),
+		users:         users,
+		recentWrites:  recentWrites,
+		auditComments: auditComments,
 	}
 }
 
 // This endpoint implements Tracker's "Activity Web Hook" specification.
 // See https://www.pivotaltracker.com/help/articles/activity_webhook
 func (h *handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := logging.FromContext(request.Context())
+
 	if request.Method != "POST" {
 		msg := fmt.Sprintf("Request method is not supported: %s", request.Method)
-		log.Print(msg)
+		logger.Warn(msg)
+		webhookEvents.WithLabelValues(unknownEventKind, "method_not_allowed").Inc()
 		http.Error(responseWriter, msg, http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !h.credentials.Matches(request) {
-		log.Print("Rejecting request due to bad credentials.")
+	credentialLabel, err := h.credentials.Authenticate(request)
+	if err != nil {
+		logger.Warn("Rejecting request due to bad credentials.", "error", err)
+		webhookEvents.WithLabelValues(unknownEventKind, "unauthorized").Inc()
 		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	logger = logger.With("credential_label", credentialLabel)
 
 	contentType := request.Header.Get("Content-Type")
 	if contentType != "application/json" {
 		msg := fmt.Sprintf("Request had wrong Content-Type: %s", contentType)
-		log.Print(msg)
+		logger.Warn(msg)
+		webhookEvents.WithLabelValues(unknownEventKind, "unsupported_media_type").Inc()
 		http.Error(responseWriter, msg, http.StatusUnsupportedMediaType)
 		return
 	}
 
-	log.Printf("Got POST request: %+v", request)
 	body, err := ioutil.ReadAll(request.Body)
+	if errors.Is(err, guard.ErrRequestBodyTooLarge) {
+		logger.Warn("Request body is too large")
+		webhookEvents.WithLabelValues(unknownEventKind, "body_too_large").Inc()
+		http.Error(responseWriter, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		logger.Error("Error reading request body", "error", err)
+		webhookEvents.WithLabelValues(unknownEventKind, "bad_request").Inc()
 		http.Error(responseWriter, "can't read body", http.StatusBadRequest)
 		return
 	}
-	log.Printf("Request body: %+v", string(body))
+	logger.Debug("Request body", "body", string(body))
 
 	var activityEvent TrackerEvent
 	err = json.Unmarshal(body, &activityEvent)
 	if err != nil {
-		log.Printf("Error parsing request body: %v", err)
+		logger.Warn("Error parsing request body", "error", err)
+		webhookEvents.WithLabelValues(unknownEventKind, "bad_request").Inc()
 		http.Error(responseWriter, "can't parse json body", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Saw event: kind %s, project %d", activityEvent.Kind, activityEvent.Project.ID)
+	logger = logger.With("project", activityEvent.Project.ID)
+	logger.Info("Saw event", "kind", activityEvent.Kind)
+
+	// A webhook token only allows events from the Tracker project of the binding which it was issued for.
+	if scoped, ok := h.credentials.(config.ProjectScopedAuthenticator); ok && !scoped.AllowsProject(request, activityEvent.Project.ID) {
+		logger.Warn("Rejecting event from a Tracker project which the credentials were not issued for.")
+		webhookEvents.WithLabelValues(activityEvent.Kind, "forbidden").Inc()
+		http.Error(responseWriter, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// The outcome is "error" when handling any of the event's changes failed.
+	outcome := "ok"
+	defer func() { webhookEvents.WithLabelValues(activityEvent.Kind, outcome).Inc() }()
+
+	configuration := h.configuration.Current()
+
+	// The app's own changes to stories, e.g. moving a story when its issue is closed, must not be synced back to
+	// the issue, or each change could bounce between Tracker and GitHub. Unless the app's Tracker user is
+	// configured to be used only by the app, its own changes are recognized by the recent writes alone.
+	performedBy := activityEvent.PerformedBy.ID
+	if configuration.LoopGuard.SuppressOwnTrackerUser {
+		if appPersonID := h.appPersonID(request.Context(), logger); appPersonID != 0 && performedBy == appPersonID {
+			logger.Info("Suppressing event: it was performed by the app's own Tracker user", "performed_by", performedBy)
+			loopguard.Suppressed(loopguard.SourceTracker, loopguard.ReasonOwnUser)
+			outcome = "suppressed"
+			return
+		}
+	}
 
+	labels := newLabelMappings(configuration.Labels)
 	for _, change := range activityEvent.Changes {
 		if change.Kind != "story" {
 			continue
 		}
+		if !h.handleStoryChange(request.Context(), logger, responseWriter, configuration, labels, activityEvent.Project.ID,
+			activityEvent.PerformedBy, change) {
+			outcome = "error"
+		}
+	}
+	// A story's whole task list is synced once, however many of its tasks the event changed.
+	if configuration.TaskSync.Enabled {
+		for _, storyID := range storiesWithTaskChanges(&activityEvent) {
+			if !h.syncTaskList(request.Context(), logger, responseWriter, configuration, activityEvent.Project.ID, storyID) {
+				outcome = "error"
+			}
+		}
+	}
+}
 
-		log.Printf("Saw story change: kind %s, story %d, story_type %s", change.ChangeType, change.ID, change.StoryType)
+// Returns the ID of the Tracker user whose API token the app uses, or zero when it can't be found. Once found, it
+// is remembered for later events.
+func (h *handler) appPersonID(ctx context.Context, logger *logging.Logger) int64 {
+	h.mu.Lock()
+	personID := h.personID
+	h.mu.Unlock()
+	if personID != 0 {
+		return personID
+	}
 
-		if change.ChangeType == "delete" {
-			// A story that is already deleted cannot be queried via the Tracker API,
-			// so we have no easy way of knowing if it was linked to a GihHub issue.
-			log.Printf("Story was deleted, so skipping: story %d", change.ID)
-			continue
-		}
+	// Concurrent events may each look the user up, but the lock is not held during the API call, so they don't
+	// wait for each other. The first one to find the user wins.
+	person, err := h.trackerAPI.GetAuthenticatedPerson(ctx)
+	if err != nil {
+		logger.Warn("Could not find the app's Tracker user, so can't recognize the app's own changes", "error", err)
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.personID == 0 {
+		h.personID = person.ID
+	}
+	return h.personID
+}
 
-		githubIssueID, err := h.trackerAPI.GetGithubIssueIDLinkedToStory(activityEvent.Project.ID, change.ID)
-		if err != nil {
-			log.Printf("Error calling Tracker API: %v", err)
-			http.Error(responseWriter, "can't get GitHub issue id from Tracker", http.StatusBadGateway)
-			continue
-		}
+// Update the GitHub issue linked to the changed story, if any. Returns false when the change could not be handled,
+// in which case an error has already been written to the response.
+func (h *handler) handleStoryChange(ctx context.Context, logger *logging.Logger, responseWriter http.ResponseWriter,
+	configuration *config.Config, labels *labelMappings, projectID int64, performedBy Person, change Change) bool {
+	ctx, span := tracing.Start(ctx, "process story change", tracing.SpanKindInternal,
+		"tracker.project", projectID,
+		"tracker.story", change.ID,
+		"tracker.change_type", change.ChangeType)
+	defer span.End()
 
-		if githubIssueID == 0 {
-			// This Tracker story is not linked to a GitHub Issue, so skip it.
-			log.Printf("Story is not linked to GitHub issue: story %d", change.ID)
-			continue
-		}
+	logger = logger.With("story", change.ID)
+	logger.Info("Saw story change", "change_type", change.ChangeType, "story_type", change.StoryType)
+	storyChanges.WithLabelValues(change.ChangeType).Inc()
 
-		log.Printf("Story is linked to GitHub issue: story %d, GitHub issuse %d", change.ID, githubIssueID)
+	if change.ChangeType == "delete" {
+		// A story that is already deleted cannot be queried via the Tracker API,
+		// so we have no easy way of knowing if it was linked to a GihHub issue.
+		logger.Info("Story was deleted, so skipping")
+		return true
+	}
 
-		issueDetails, err := h.gitHubClient.GetIssue(request.Context(), githubIssueID)
-		if err != nil {
-			log.Printf("Could not get issue #%d from github: %v", githubIssueID, err)
-			http.Error(responseWriter, "can't get GitHub issue details from GitHub", http.StatusBadGateway)
-			continue
-		}
+	change, echoed := withoutEchoes(h.recentWrites, change)
+	if echoed {
+		logger.Info("Story change echoes a recent update which the app made to the story, so not syncing the fields which the app changed")
+		loopguard.Suppressed(loopguard.SourceTracker, loopguard.ReasonRecentWrite)
+	}
 
-		// Get the GitHub issue's initial list of labels.
-		issueLabels := issueDetails.Labels
-		log.Printf("issue #%d had labels before update: %v", githubIssueID, issueLabels)
+	githubIssueID, err := h.trackerAPI.GetGithubIssueIDLinkedToStory(ctx, projectID, change.ID)
+	if err != nil {
+		logger.Error("Error calling Tracker API", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't get GitHub issue id from Tracker", http.StatusBadGateway)
+		return false
+	}
 
-		issueRequest := github.IssueRequest{}
+	if githubIssueID == 0 {
+		// This Tracker story is not linked to a GitHub Issue, so skip it.
+		logger.Info("Story is not linked to GitHub issue")
+		return true
+	}
 
-		// If an existing story's title has changed, then update the title of the linked issue.
-		newStoryTitle := change.NewValues.Title
-		if newStoryTitle != "" && change.ChangeType != "create" {
-			issueRequest.Title = &newStoryTitle
-		}
+	logger = logger.With("issue", githubIssueID)
+	span.SetAttributes("github.issue", githubIssueID)
+	logger.Info("Story is linked to GitHub issue")
+
+	issueDetails, err := h.gitHubClient.GetIssue(ctx, githubIssueID)
+	if err != nil {
+		logger.Error("Could not get issue from GitHub", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't get GitHub issue details from GitHub", http.StatusBadGateway)
+		return false
+	}
+
+	// Get the GitHub issue's initial list of labels.
+	issueLabels := issueDetails.Labels
+	logger.Debug("Issue labels before update", "labels", issueLabels)
 
-		// If an existing story's description has changed, then update the body of the linked issue.
-		newStoryDescription := change.NewValues.Description
-		if newStoryDescription != "" && change.ChangeType != "create" {
-			issueRequest.Body = &newStoryDescription
+	issueRequest := github.IssueRequest{}
+
+	// Titles and descriptions are copied to GitHub, so their mentions are translated for GitHub. The description is
+	// translated both in the new description and in the previous one which the merge is based on.
+	descriptionSync := configuration.DescriptionSync.WithDefaults()
+	syncTitle := change.NewValues.Title != "" && change.ChangeType != "create"
+	syncDescription := change.NewValues.Description != "" && change.ChangeType != "create" && descriptionSync.Mode != config.DescriptionSyncOff
+	var translator *translate.Translator
+	if syncTitle || syncDescription {
+		translator, err = translate.ForProjects(ctx, h.trackerAPI, configuration.UserIDMapping, "", []int64{projectID},
+			change.NewValues.Title, change.NewValues.Description, change.OriginalValues.Description)
+		if err != nil {
+			logger.Warn("Could not list the Tracker project's members, so mentions in the title and description won't be translated", "error", err)
 		}
+	}
+
+	// If an existing story's title has changed, then update the title of the linked issue.
+	if syncTitle {
+		newIssueTitle := translator.TitleToGitHub(change.NewValues.Title)
+		issueRequest.Title = &newIssueTitle
+	}
 
-		// If the current state of the story has changed, then update the labels of the linked issue.
-		newStoryState := change.NewValues.CurrentState
-		if newStoryState != "" {
-			issueLabels = removeElements(issueLabels, h.labelsToRemoveOnStateChange)
-			labelsForNewState := issueLabelsToApplyPerStoryState[newStoryState]
-			issueLabels = append(issueLabels, labelsForNewState...)
-			if newStoryState == "accepted" {
-				// If the story was accepted then close the linked issue.
-				log.Printf("Closing issue #%d", githubIssueID)
-				issueRequest.State = addressOf("closed")
-			} else if change.OriginalValues.CurrentState == "accepted" {
-				// If the story was previously accepted but is now moving to another state then reopen the linked issue.
-				log.Printf("Reopening issue #%d", githubIssueID)
-				issueRequest.State = addressOf("open")
+	// If an existing story's description has changed, then update the body of the linked issue, unless the
+	// configuration says to leave it unchanged.
+	if syncDescription {
+		translated := change
+		translated.NewValues.Description = translator.ToGitHub(change.NewValues.Description)
+		translated.OriginalValues.Description = translator.ToGitHub(change.OriginalValues.Description)
+		newBody, outcome := planIssueBody(descriptionSync.Mode, issueDetails.Body, translated)
+		descriptionSyncs.WithLabelValues(descriptionSync.Mode, outcome).Inc()
+		switch outcome {
+		case descriptionUpdated:
+			issueRequest.Body = &newBody
+			if _, _, ok := withoutSyncedDescription(newBody); descriptionSync.Mode == config.DescriptionSyncMerge && !ok {
+				logger.Warn("Not keeping the synced description in the issue body, because the body would be too long for GitHub with it. "+
+					"The next merge is based on the story's previous description instead", "max_length", maxIssueBodyLength)
 			}
+		case descriptionConflict:
+			logger.Warn("Not updating the issue body: the story's description and the issue body were both changed in the same place",
+				"mode", descriptionSync.Mode)
+		default:
+			logger.Debug("The issue body already has the story's description", "mode", descriptionSync.Mode)
 		}
+	}
 
-		// If the story type has changed, then update the labels of the linked issue.
-		newStoryType := change.NewValues.StoryType
-		if newStoryType != "" {
-			issueLabels = removeElements(issueLabels, h.labelsToRemoveOnTypeChange)
-			labelsForNewStoryType := issueLabelsToApplyPerStoryType[newStoryType]
-			issueLabels = append(issueLabels, labelsForNewStoryType...)
+	// If the current state of the story has changed, then update the labels of the linked issue.
+	newStoryState := change.NewValues.CurrentState
+	if newStoryState != "" {
+		issueLabels = removeElements(issueLabels, labels.toRemoveOnStateChange)
+		labelsForNewState := labels.perStoryState[newStoryState]
+		issueLabels = append(issueLabels, labelsForNewState...)
+		if newStoryState == "accepted" {
+			// If the story was accepted then close the linked issue.
+			logger.Info("Closing issue")
+			issueRequest.State = addressOf("closed")
+		} else if change.OriginalValues.CurrentState == "accepted" {
+			// If the story was previously accepted but is now moving to another state then reopen the linked issue.
+			logger.Info("Reopening issue")
+			issueRequest.State = addressOf("open")
 		}
+	}
 
-		// If the story's estimate has changed, then update the labels of the linked issue.
-		if change.NewValues.Estimate.Present {
-			issueLabels = removeElements(issueLabels, h.labelsToRemoveOnEstimateChange)
-			// If the new value is nil, then the story was unestimated.
-			newEstimate := change.NewValues.Estimate.Value
-			if newEstimate != nil {
-				// The new value exists, so the story was estimated or re-estimated.
-				labelsForNewStoryType := issueLabelsToApplyPerStoryEstimate[fmt.Sprint(*newEstimate)]
-				issueLabels = append(issueLabels, labelsForNewStoryType...)
-			}
+	// If the story type has changed, then update the labels of the linked issue.
+	newStoryType := change.NewValues.StoryType
+	if newStoryType != "" {
+		issueLabels = removeElements(issueLabels, labels.toRemoveOnTypeChange)
+		labelsForNewStoryType := labels.perStoryType[newStoryType]
+		issueLabels = append(issueLabels, labelsForNewStoryType...)
+	}
+
+	// If the story's estimate has changed, then update the labels of the linked issue.
+	if change.NewValues.Estimate.Present {
+		issueLabels = removeElements(issueLabels, labels.toRemoveOnEstimateChange)
+		// If the new value is nil, then the story was unestimated.
+		newEstimate := change.NewValues.Estimate.Value
+		if newEstimate != nil {
+			// The new value exists, so the story was estimated or re-estimated.
+			labelsForNewStoryType := labels.perStoryEstimate[fmt.Sprint(*newEstimate)]
+			issueLabels = append(issueLabels, labelsForNewStoryType...)
 		}
+	}
 
-		// All label processing is finished, so set the results on the request object if there are any desired differences.
-		if !equalIgnoringOrder(issueDetails.Labels, issueLabels) {
-			log.Printf("New labels for issue #%d: %v", githubIssueID, issueLabels)
-			issueRequest.Labels = &issueLabels
+	// When a story is created for the issue, e.g. from the import panel, label the issue as linked.
+	issueLink := configuration.IssueLink.WithDefaults()
+	if change.ChangeType == "create" && issueLink.Label != "" && !containsIgnoringCase(issueLabels, issueLink.Label) {
+		issueLabels = append(issueLabels, issueLink.Label)
+	}
+
+	// All label processing is finished, so set the results on the request object if there are any desired differences.
+	if !equalIgnoringOrder(issueDetails.Labels, issueLabels) {
+		logger.Info("New labels for issue", "labels", issueLabels)
+		issueRequest.Labels = &issueLabels
+	} else {
+		logger.Debug("No label updates needed for issue")
+	}
+
+	// If the story's owners have changed, then consider overwriting the assignees of the linked issue.
+	// Skip this when a story is initially created, because it will always set the owners to empty list
+	// in the change object, so there's no point in overwriting the current issue assignees just because
+	// the issue was dragged and dropped into the backlog/icebox.
+	resolvingUsers := configuration.UserResolver.Enabled && h.users != nil
+	if change.NewValues.OwnerIDs.Present && (configuration.UserIDMapping != nil || resolvingUsers) && change.ChangeType != "create" {
+		newStoryOwners := *change.NewValues.OwnerIDs.Value
+		if len(newStoryOwners) == 0 {
+			// All of the previous owners were explicitly removed. Clear the issue assignees list on the issue.
+			logger.Info("Previous story owners were explicitly removed. Clearing all assignees on issue")
+			issueRequest.Assignees = &[]string{}
 		} else {
-			log.Printf("No label updates needed for issue #%d", githubIssueID)
-		}
-
-		// If the story's owners have changed, then consider overwriting the assignees of the linked issue.
-		// Skip this when a story is initially created, because it will always set the owners to empty list
-		// in the change object, so there's no point in overwriting the current issue assignees just because
-		// the issue was dragged and dropped into the backlog/icebox.
-		if change.NewValues.OwnerIDs.Present && h.configuration.UserIDMapping != nil && change.ChangeType != "create" {
-			newStoryOwners := *change.NewValues.OwnerIDs.Value
-			if len(newStoryOwners) == 0 {
-				// All of the previous owners were explicitly removed. Clear the issue assignees list on the issue.
-				log.Printf("Previous story owners we explicitly removed. Clearing all assignees on issue #%d", githubIssueID)
-				issueRequest.Assignees = &[]string{}
-			} else {
-				// There are new owners explicitly assigned. Try to find their GitHub usernames.
-				newIssueAssignees := []string{}
-				for _, ownerID := range newStoryOwners {
-					gitHubUsernameOfOwner := h.configuration.UserIDMapping[ownerID]
-					if gitHubUsernameOfOwner != "" {
-						newIssueAssignees = append(newIssueAssignees, gitHubUsernameOfOwner)
-					}
-				}
-				// If none of the new owners had GitHub usernames configured, then skip the update.
-				if len(newIssueAssignees) > 0 {
-					log.Printf("Updating issue assignees on issue #%d to: %v", githubIssueID, newIssueAssignees)
-					issueRequest.Assignees = &newIssueAssignees
-				} else {
-					log.Printf(
-						"Skipping updating issue #%d assignees: none of these new story owners had GitHub usernames configured: %v",
-						githubIssueID, newStoryOwners)
+			// There are new owners explicitly assigned. Try to find their GitHub usernames.
+			newIssueAssignees := []string{}
+			for _, ownerID := range newStoryOwners {
+				gitHubUsernameOfOwner := h.gitHubUsernameOfOwner(ctx, logger, configuration, projectID, ownerID)
+				if gitHubUsernameOfOwner != "" {
+					newIssueAssignees = append(newIssueAssignees, gitHubUsernameOfOwner)
 				}
 			}
+			// If none of the new owners had GitHub usernames configured, then skip the update.
+			if len(newIssueAssignees) > 0 {
+				logger.Info("Updating issue assignees", "assignees", newIssueAssignees)
+				issueRequest.Assignees = &newIssueAssignees
+			} else {
+				logger.Info(
+					"Skipping updating issue assignees: none of the new story owners had GitHub usernames configured",
+					"owners", newStoryOwners)
+			}
 		}
+	}
 
-		// Push the updates back to GitHub, if there are any changes to be made.
-		if (github.IssueRequest{}) == issueRequest {
-			log.Printf("No updates planned. Skipping GitHub API call for issue #%d", githubIssueID)
-			continue
+	// When a story is created for the issue, tell the people who only use GitHub where to find the story.
+	comment := ""
+	if change.ChangeType == "create" && issueLink.Comment {
+		storyType := change.NewValues.StoryType
+		if storyType == "" {
+			storyType = change.StoryType
+		}
+		comment, err = issueLink.RenderComment(config.IssueLinkData{
+			IssueNumber:  githubIssueID,
+			ProjectID:    projectID,
+			StoryID:      change.ID,
+			StoryURL:     fmt.Sprintf("https://www.pivotaltracker.com/story/show/%d", change.ID),
+			StoryTitle:   change.NewValues.Title,
+			StoryType:    storyType,
+			CurrentState: change.NewValues.CurrentState,
+		})
+		if err != nil {
+			// The template was already checked when the configuration was loaded.
+			logger.Error("Error rendering issue link comment", "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't render issue_link.comment_template", http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	// When the story makes a significant transition, tell the issue's reporter why its labels changed.
+	auditLines, err := h.auditLines(ctx, logger, configuration, projectID, githubIssueID, performedBy, change)
+	if err != nil {
+		// The templates were already checked when the configuration was loaded.
+		logger.Error("Error rendering audit comment", "error", err)
+		span.RecordError(err)
+		http.Error(responseWriter, "can't render audit_comments template", http.StatusInternalServerError)
+		return false
+	}
+
+	// When a story is created for the issue, copy the files which the issue links to on GitHub into the story, so
+	// that Tracker users who can't read the repository can see them.
+	if change.ChangeType == "create" && configuration.AttachmentCopy.Enabled {
+		h.copyAttachments(ctx, logger, responseWriter, configuration, projectID, githubIssueID, change)
+	}
+
+	// When a story is created for the issue, the items of the issue's task list become the story's tasks.
+	if change.ChangeType == "create" && configuration.TaskSync.Enabled {
+		h.importTasks(ctx, logger, responseWriter, configuration, projectID, githubIssueID, issueDetails, change.ID)
+	}
+
+	// Push the updates back to GitHub, if there are any changes to be made.
+	if (github.IssueRequest{}) == issueRequest && comment == "" && len(auditLines) == 0 {
+		logger.Info("No updates planned. Skipping GitHub API call for issue")
+		return true
+	}
+	if configuration.IsDryRun(projectID) {
+		// Report the planned update instead of applying it.
+		if (github.IssueRequest{}) != issueRequest &&
+			!writeDryRunPlan(logger, span, responseWriter, "GitHub API call to update issue",
+				fmt.Sprintf("update for issue #%d", githubIssueID), issueRequest) {
+			return false
+		}
+		if comment != "" {
+			writeDryRunPlan(logger, span, responseWriter, "GitHub API call to comment on issue",
+				fmt.Sprintf("comment on issue #%d", githubIssueID), comment)
 		}
-		log.Printf("Calling GitHub API to update issue #%d", githubIssueID)
-		err = h.gitHubClient.UpdateIssue(request.Context(), githubIssueID, &issueRequest)
+		for _, line := range auditLines {
+			writeDryRunPlan(logger, span, responseWriter, "GitHub API call to comment on issue",
+				fmt.Sprintf("comment on issue #%d", githubIssueID), line.text)
+		}
+		return true
+	}
+	if (github.IssueRequest{}) != issueRequest {
+		logger.Info("Calling GitHub API to update issue")
+		err = h.rememberedUpdateIssue(ctx, githubIssueID, issueDetails, &issueRequest)
 		if err != nil {
-			log.Printf("Error calling GitHub API: %v", err)
+			logger.Error("Error calling GitHub API", "error", err)
+			span.RecordError(err)
 			http.Error(responseWriter, "can't update GitHub issue via GitHub API", http.StatusBadGateway)
-			continue
+			return false
+		}
+	}
+	if comment != "" {
+		logger.Info("Calling GitHub API to comment on issue")
+		if _, err := h.gitHubClient.CreateComment(ctx, githubIssueID, comment); err != nil {
+			logger.Error("Error calling GitHub API", "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't comment on GitHub issue via GitHub API", http.StatusBadGateway)
+			return false
+		}
+	}
+	if len(auditLines) > 0 {
+		if err := h.postAuditComment(ctx, logger, configuration.AuditComments, githubIssueID, auditLines); err != nil {
+			logger.Error("Error calling GitHub API", "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't comment on GitHub issue via GitHub API", http.StatusBadGateway)
+			return false
+		}
+	}
+	return true
+}
+
+// Update the issue via the GitHub API, remembering the update so that its webhook events are not synced back to the
+// story.
+func (h *handler) rememberedUpdateIssue(ctx context.Context, issueNumber int, before *githubapi.Issue, update *github.IssueRequest) error {
+	return h.recentWrites.Write(func() error {
+		return h.gitHubClient.UpdateIssue(ctx, issueNumber, update)
+	}, issueUpdateFingerprints(issueNumber, before, update)...)
+}
+
+// Report a planned GitHub API call of a dry run instead of making it, both in the log and in the response. A plan
+// which isn't a string is written as JSON. Returns false when the plan can't be serialized, after responding with
+// an error.
+func writeDryRunPlan(logger *logging.Logger, span *tracing.Span, responseWriter http.ResponseWriter, skipped, planned string, plan interface{}) bool {
+	text, ok := plan.(string)
+	if !ok {
+		serialized, err := json.Marshal(plan)
+		if err != nil {
+			logger.Error("Error serializing planned "+planned, "error", err)
+			span.RecordError(err)
+			http.Error(responseWriter, "can't serialize planned "+planned, http.StatusInternalServerError)
+			return false
+		}
+		text = string(serialized)
+	}
+	logger.Info("Dry run: skipping "+skipped, "plan", text)
+	fmt.Fprintf(responseWriter, "dry run: planned %s: %s\n", planned, text)
+	return true
+}
+
+// Returns the GitHub username of the story owner from the configured user ID mapping, or from the user resolver
+// when it is enabled. Returns an empty string when the owner has no known GitHub user.
+func (h *handler) gitHubUsernameOfOwner(ctx context.Context, logger *logging.Logger, configuration *config.Config, projectID, ownerID int64) string {
+	username := configuration.UserIDMapping[ownerID]
+	if username == "" && configuration.UserResolver.Enabled && h.users != nil {
+		var err error
+		username, err = h.users.GitHubUsername(ctx, configuration.UserResolver, projectID, ownerID)
+		if err != nil {
+			logger.Warn("Could not look up the GitHub user of story owner", "owner", ownerID, "error", err)
 		}
 	}
+	return username
 }
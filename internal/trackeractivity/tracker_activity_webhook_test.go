@@ -1,6 +1,7 @@
 package trackeractivity
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,13 +10,24 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v33/github"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"issues2stories/internal/config"
 	"issues2stories/internal/githubapi"
+	"issues2stories/internal/guard"
 	"issues2stories/internal/importtypes"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/tracing"
+	"issues2stories/internal/trackerapi"
 )
 
 type readerWhichAlwaysErrors int
@@ -24,6 +36,13 @@ func (readerWhichAlwaysErrors) Read(_ []byte) (n int, err error) {
 	return 0, errors.New("some error")
 }
 
+// Behaves like a body which exceeds the limit enforced by the guard package.
+type readerWhichIsTooLarge int
+
+func (readerWhichIsTooLarge) Read(_ []byte) (n int, err error) {
+	return 0, guard.ErrRequestBodyTooLarge
+}
+
 func readFixture(t *testing.T, name string) string {
 	t.Helper()
 	content, err := ioutil.ReadFile("testdata/" + name + ".json")
@@ -64,6 +83,15 @@ type fakeGitHubUpdateIssue struct {
 type fakeGitHubAPI struct {
 	getIssue    *fakeGitHubGetIssue
 	updateIssue *fakeGitHubUpdateIssue
+
+	commentError error
+	comments     []string
+
+	editError error
+	edits     []string
+
+	// The contents of the files which can be downloaded, by URL.
+	files map[string]string
 }
 
 func (f *fakeGitHubAPI) GetIssue(_ context.Context, issueNumber int) (*githubapi.Issue, error) {
@@ -87,10 +115,51 @@ func (f *fakeGitHubAPI) UpdateIssue(_ context.Context, issueNumber int, updates
 	return nil
 }
 
+// The comments' IDs start at 1001.
+func (f *fakeGitHubAPI) CreateComment(_ context.Context, issueNumber int, body string) (int64, error) {
+	f.comments = append(f.comments, fmt.Sprintf("#%d: %s", issueNumber, body))
+	if f.commentError != nil {
+		return 0, f.commentError
+	}
+	return int64(1000 + len(f.comments)), nil
+}
+
+func (f *fakeGitHubAPI) EditComment(_ context.Context, commentID int64, body string) error {
+	f.edits = append(f.edits, fmt.Sprintf("comment %d: %s", commentID, body))
+	return f.editError
+}
+
+func (f *fakeGitHubAPI) DownloadAttachment(_ context.Context, fileURL string, maxBytes int64) (*githubapi.Attachment, error) {
+	content, ok := f.files[fileURL]
+	if !ok {
+		return nil, errors.New("GitHub returned 404 Not Found")
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, githubapi.ErrAttachmentTooLarge
+	}
+	return &githubapi.Attachment{ContentType: "application/octet-stream", Content: []byte(content)}, nil
+}
+
 func (f *fakeGitHubAPI) ListAllOpenIssuesForRepoInImportFormat(_ context.Context) ([]importtypes.Issue, error) {
 	panic("not used by the test subject")
 }
 
+func (f *fakeGitHubAPI) CheckRepoAccess(_ context.Context) error {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) FindUsersByEmail(_ context.Context, _ string) ([]string, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) ListCommitAuthors(_ context.Context, _ int) ([]githubapi.CommitAuthor, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) GetAuthenticatedUser(_ context.Context) (string, error) {
+	panic("not used by the test subject")
+}
+
 type fakeTrackerAPIReturnValues struct {
 	issueIDs []int
 	errors   []error
@@ -105,9 +174,28 @@ type fakeTrackerAPIActivity struct {
 type fakeTrackerAPI struct {
 	returns *fakeTrackerAPIReturnValues
 	actual  *fakeTrackerAPIActivity
+
+	// The ID of the app's own Tracker user, or zero when it can't be found.
+	appPersonID int64
+
+	// The number of the project's current iteration, or zero when it can't be found, and the IDs of its stories.
+	currentIteration  int
+	iterationStoryIDs []int64
+
+	// The project's members, or nil when they can't be listed.
+	members []trackerapi.Person
+
+	uploadError  error
+	uploads      []string
+	comments     []string
+	storyUpdates []*trackerapi.StoryUpdate
+
+	// The story's tasks, or nil when they can't be listed.
+	tasks       []trackerapi.Task
+	taskChanges []string
 }
 
-func (f *fakeTrackerAPI) GetGithubIssueIDLinkedToStory(trackerProjectID, trackerStoryID int64) (githubIssueID int, err error) {
+func (f *fakeTrackerAPI) GetGithubIssueIDLinkedToStory(_ context.Context, trackerProjectID, trackerStoryID int64) (githubIssueID int, err error) {
 	thisCall := f.actual.invocations
 	f.actual.invocations++
 	f.actual.projectIDArgs = append(f.actual.projectIDArgs, trackerProjectID)
@@ -118,11 +206,159 @@ func (f *fakeTrackerAPI) GetGithubIssueIDLinkedToStory(trackerProjectID, tracker
 	return f.returns.issueIDs[thisCall], nil
 }
 
+func (f *fakeTrackerAPI) CheckToken(_ context.Context) error {
+	panic("not used by the test subject")
+}
+
+func (f *fakeTrackerAPI) CheckProjectAccess(_ context.Context, _ int64) error {
+	panic("not used by the test subject")
+}
+
+func (f *fakeTrackerAPI) ListProjectMembers(_ context.Context, _ int64) ([]trackerapi.Person, error) {
+	if f.members == nil {
+		return nil, errors.New("Tracker API request failed")
+	}
+	return f.members, nil
+}
+
+func (f *fakeTrackerAPI) FindStoriesLinkedToGitHubIssue(_ context.Context, _ int64, _ int) ([]trackerapi.Story, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeTrackerAPI) UpdateStory(_ context.Context, _, _ int64, updates *trackerapi.StoryUpdate) error {
+	f.storyUpdates = append(f.storyUpdates, updates)
+	return nil
+}
+
+func (f *fakeTrackerAPI) AddComment(_ context.Context, _, _ int64, _ string) error {
+	panic("not used by the test subject")
+}
+
+// The uploaded files' IDs start at 2001.
+func (f *fakeTrackerAPI) UploadFile(_ context.Context, _ int64, filename, contentType string, content []byte) (*trackerapi.FileAttachment, error) {
+	if f.uploadError != nil {
+		return nil, f.uploadError
+	}
+	f.uploads = append(f.uploads, fmt.Sprintf("%s (%s): %s", filename, contentType, content))
+	id := int64(2000 + len(f.uploads))
+	return &trackerapi.FileAttachment{
+		ID:          id,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		DownloadURL: fmt.Sprintf("/file_attachments/%d/download", id),
+	}, nil
+}
+
+func (f *fakeTrackerAPI) AddCommentWithAttachments(_ context.Context, _, trackerStoryID int64, text string, attachments []trackerapi.FileAttachment) error {
+	ids := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = fmt.Sprintf("%d", attachment.ID)
+	}
+	f.comments = append(f.comments, fmt.Sprintf("#%d: %s [%s]", trackerStoryID, text, strings.Join(ids, ", ")))
+	return nil
+}
+
+func (f *fakeTrackerAPI) ListTasks(_ context.Context, _, _ int64) ([]trackerapi.Task, error) {
+	if f.tasks == nil {
+		return nil, errors.New("Tracker API request failed")
+	}
+	return f.tasks, nil
+}
+
+// The created tasks' IDs start at 3001.
+func (f *fakeTrackerAPI) CreateTask(_ context.Context, _, trackerStoryID int64, task *trackerapi.TaskUpdate) (*trackerapi.Task, error) {
+	f.taskChanges = append(f.taskChanges, fmt.Sprintf("create task for story %d: %s", trackerStoryID, *task.Description))
+	return &trackerapi.Task{ID: int64(3000 + len(f.taskChanges)), StoryID: trackerStoryID, Description: *task.Description}, nil
+}
+
+func (f *fakeTrackerAPI) UpdateTask(_ context.Context, _, _, _ int64, _ *trackerapi.TaskUpdate) error {
+	panic("not used by the test subject")
+}
+
+func (f *fakeTrackerAPI) DeleteTask(_ context.Context, _, _, _ int64) error {
+	panic("not used by the test subject")
+}
+
+func (f *fakeTrackerAPI) GetProject(_ context.Context, _ int64) (*trackerapi.Project, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeTrackerAPI) GetAuthenticatedPerson(_ context.Context) (*trackerapi.Person, error) {
+	if f.appPersonID == 0 {
+		return nil, errors.New("Tracker API request failed")
+	}
+	return &trackerapi.Person{ID: f.appPersonID, Name: "Issues2Stories Bot"}, nil
+}
+
+func (f *fakeTrackerAPI) GetCurrentIteration(_ context.Context, _ int64) (*trackerapi.Iteration, error) {
+	if f.currentIteration == 0 {
+		return nil, errors.New("Tracker API request failed")
+	}
+	return &trackerapi.Iteration{Number: f.currentIteration, StoryIDs: f.iterationStoryIDs}, nil
+}
+
+// Returns the configured GitHub username of each Tracker user, or an error for users who have none.
+type fakeUserResolver struct {
+	usernames map[int64]string
+}
+
+func (f *fakeUserResolver) GitHubUsername(_ context.Context, settings config.UserResolver, trackerProjectID, trackerUserID int64) (string, error) {
+	if !settings.Enabled || trackerProjectID != 2453999 {
+		panic("the user resolver should only be called when it is enabled, for the event's Tracker project")
+	}
+	username, ok := f.usernames[trackerUserID]
+	if !ok {
+		return "", errors.New("Tracker API request failed")
+	}
+	return username, nil
+}
+
+// Accepts every request, but only allows events from one Tracker project, like a webhook token does.
+type fakeProjectScopedAuthenticator struct {
+	allowedProjectID int64
+}
+
+func (f *fakeProjectScopedAuthenticator) Authenticate(_ *http.Request) (string, error) {
+	return "fake_token", nil
+}
+
+func (f *fakeProjectScopedAuthenticator) AllowsProject(_ *http.Request, trackerProjectID int64) bool {
+	return trackerProjectID == f.allowedProjectID
+}
+
 func TestHandleTrackerActivityWebhook(t *testing.T) {
+	// The files which the create_bug_story_with_attachments fixture's description links to.
+	const (
+		screenshotURL = "https://user-images.githubusercontent.com/25013435/106189243-8f1c1a80-615c-11eb-9c6c-1d3c5f1e4a8b.png"
+		logURL        = "https://github.com/vmware-tanzu/pinniped/files/5893017/server.log"
+		zipURL        = "https://github.com/user-attachments/files/15100042/big.zip"
+	)
+	attachmentsDescription := func(screenshot, log string) *string {
+		description := "**What is the problem that you wish to solve?**\n\nFake issue\n\n" +
+			"![screenshot](" + screenshot + ")\n\n" +
+			"Logs: [server.log](" + log + ") and [big.zip](" + zipURL + ").\n\n" +
+			"Same screenshot again: " + screenshot + ".\n\n" +
+			"Not a file: https://github.com/vmware-tanzu/pinniped/issues/155\n\n" +
+			"**What is the best solution to the above problem?**\n\n> Please provide a clear and concise description of what the solution is.\n\n" +
+			"**What are the alternative solutions that you have considered?**\n\nPlease ignore\n\n" +
+			"**How will this project improvement be tested?**\n\nVery well.\n\n" +
+			"**In what environment do you hope to see this improvement?**\n\nAll of them.\n\n" +
+			"**What else is there to know about this improvement?**\n\nYou folks rock!"
+		return &description
+	}
+
 	tests := []struct {
 		name string
 
 		configuration *config.Config
+		credentials   config.Authenticator
+		users         UserResolver
+		appPersonID   int64
+		iteration     int
+		inIteration   []int64
+		members       []trackerapi.Person
+		recentWrites  []string
 
 		method      string
 		contentType string
@@ -142,6 +378,21 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 		gitHubUpdateIssueReturns         *fakeGitHubUpdateIssueReturnValues
 		wantGitHubUpdateIssueInvocations *fakeGitHubUpdateIssueActivity
 		wantGitHubGetIssueInvocations    *fakeGitHubGetIssueActivity
+
+		gitHubCommentError error
+		wantGitHubComments []string
+
+		gitHubFiles            map[string]string
+		trackerUploadError     error
+		wantTrackerUploads     []string
+		wantTrackerComments    []string
+		wantTrackerStoryUpdate []*trackerapi.StoryUpdate
+
+		tasks           []trackerapi.Task
+		wantTaskChanges []string
+
+		// The fingerprints which should be remembered after the event.
+		wantRecentWrites []string
 	}{
 		{
 			name:            "wrong method is an error",
@@ -171,6 +422,28 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 			wantContentType: "text/plain; charset=utf-8",
 			wantBody:        "Unauthorized\n",
 		},
+		{
+			name:            "credentials which were issued for a different Tracker project are forbidden",
+			credentials:     &fakeProjectScopedAuthenticator{allowedProjectID: 99999},
+			bodyFixture:     "create_feature_story_in_icebox",
+			wantStatus:      http.StatusForbidden,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Forbidden\n",
+		},
+		{
+			name:        "credentials which were issued for the event's Tracker project are allowed",
+			credentials: &fakeProjectScopedAuthenticator{allowedProjectID: 2453999},
+			bodyFixture: "create_feature_story_in_icebox",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{0},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176650922},
+			},
+			wantStatus: http.StatusOK,
+		},
 		{
 			name:            "wrong content type is an error",
 			contentType:     "application/wrong-type",
@@ -185,6 +458,13 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 			wantContentType: "text/plain; charset=utf-8",
 			wantBody:        "can't read body\n",
 		},
+		{
+			name:            "body which is too large is an error",
+			bodyReader:      readerWhichIsTooLarge(0),
+			wantStatus:      http.StatusRequestEntityTooLarge,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "request body is too large\n",
+		},
 		{
 			name:            "body is not json is an error",
 			body:            "this is not valid json",
@@ -673,6 +953,95 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:        "story owners who are not in the configuration map are looked up when the user resolver is enabled",
+			bodyFixture: "edit_story_assign_second_owner",
+			configuration: &config.Config{
+				UserIDMapping: map[int64]string{3344175: "github-user2"},
+				UserResolver:  config.UserResolver{Enabled: true},
+			},
+			users: &fakeUserResolver{usernames: map[int64]string{3344177: "resolved-user1"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "estimate/XXL", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176711643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Assignees: &[]string{"resolved-user1", "github-user2"},
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "story owners whose GitHub users can't be looked up are skipped",
+			bodyFixture: "edit_story_assign_second_owner",
+			configuration: &config.Config{
+				UserResolver: config.UserResolver{Enabled: true},
+			},
+			users: &fakeUserResolver{usernames: map[int64]string{3344175: "resolved-user2"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "estimate/XXL", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176711643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Assignees: &[]string{"resolved-user2"},
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "the user resolver is not used unless it is enabled",
+			bodyFixture:   "edit_story_assign_second_owner",
+			configuration: &config.Config{UserIDMapping: map[int64]string{}},
+			users:         &fakeUserResolver{},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "estimate/XXL", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176711643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus: http.StatusOK,
+		},
 		{
 			name:        "changing the owners of a story when some of the new owners are not in the configuration map",
 			bodyFixture: "edit_story_assign_second_owner",
@@ -894,20 +1263,36 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 				},
 			},
 			wantStatus: http.StatusOK,
+			wantRecentWrites: []string{
+				loopguard.IssueFingerprint(42, "label+state/accepted"),
+				loopguard.IssueFingerprint(42, "label-priority/backlog"),
+				loopguard.IssueFingerprint(42, "label-state/delivered"),
+				loopguard.IssueFingerprint(42, "state=closed"),
+			},
 		},
 		{
-			name:        "editing an accepted story back to any other state relabels the issue and also reopens the issue",
-			bodyFixture: "edit_unaccept_story",
+			name:        "events performed by the app's own Tracker user are suppressed when configured",
+			bodyFixture: "edit_accept_story",
+			configuration: &config.Config{
+				LoopGuard: config.LoopGuard{SuppressOwnTrackerUser: true},
+			},
+			appPersonID: 3344177,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "events performed by the app's own Tracker user are synced by default",
+			bodyFixture: "edit_story_change_title",
+			appPersonID: 3344177,
 			trackerReturns: &fakeTrackerAPIReturnValues{
 				issueIDs: []int{42},
 			},
 			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
-				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "estimate/XXL", "state/accepted"}}},
+				issues: []*githubapi.Issue{{Labels: []string{}}},
 			},
 			wantTrackerInvocations: &fakeTrackerAPIActivity{
 				invocations:   1,
 				projectIDArgs: []int64{2453999},
-				storyIDArgs:   []int64{176755643},
+				storyIDArgs:   []int64{176858613},
 			},
 			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
 				invocations:     1,
@@ -917,22 +1302,21 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 				invocations:     1,
 				issueNumberArgs: []int{42},
 				updatesArgs: []*github.IssueRequest{
-					{
-						Labels: &[]string{"initial-unrelated-label", "enhancement", "estimate/XXL", "priority/backlog", "state/started"},
-						State:  addressOf("open"),
-					},
+					{Title: addressOf("New title for Fake issue for testing, please ignore")},
 				},
 			},
 			wantStatus: http.StatusOK,
 		},
 		{
-			name:        "editing the title of a story also edits the title of the issue",
-			bodyFixture: "edit_story_change_title",
+			name:          "the mentions in a story's new title are translated for GitHub",
+			bodyFixture:   "edit_story_change_title_with_mentions",
+			configuration: &config.Config{UserIDMapping: map[int64]string{3344177: "cfryanr"}},
+			members:       []trackerapi.Person{{ID: 3344177, Name: "Ryan Richard", Initials: "RR", Username: "ryan"}},
 			trackerReturns: &fakeTrackerAPIReturnValues{
 				issueIDs: []int{42},
 			},
 			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
-				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog"}}},
+				issues: []*githubapi.Issue{{Labels: []string{}}},
 			},
 			wantTrackerInvocations: &fakeTrackerAPIActivity{
 				invocations:   1,
@@ -947,21 +1331,23 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 				invocations:     1,
 				issueNumberArgs: []int{42},
 				updatesArgs: []*github.IssueRequest{
-					{
-						Title: addressOf("New title for Fake issue for testing, please ignore"),
-					},
+					{Title: addressOf("Pair with @cfryanr and @someone on #176858612")},
 				},
 			},
 			wantStatus: http.StatusOK,
 		},
 		{
-			name:        "editing the description of a story also edits the title of the issue",
-			bodyFixture: "edit_story_change_description",
+			name:        "events performed by other Tracker users are synced",
+			bodyFixture: "edit_story_change_title",
+			configuration: &config.Config{
+				LoopGuard: config.LoopGuard{SuppressOwnTrackerUser: true},
+			},
+			appPersonID: 7777777,
 			trackerReturns: &fakeTrackerAPIReturnValues{
 				issueIDs: []int{42},
 			},
 			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
-				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog"}}},
+				issues: []*githubapi.Issue{{Labels: []string{}}},
 			},
 			wantTrackerInvocations: &fakeTrackerAPIActivity{
 				invocations:   1,
@@ -972,37 +1358,1282 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 				invocations:     1,
 				issueNumberArgs: []int{42},
 			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Title: addressOf("New title for Fake issue for testing, please ignore")},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "when closing an issue accepted its story, the story change still labels the issue as accepted",
+			bodyFixture:  "edit_accept_story",
+			recentWrites: []string{loopguard.StoryFingerprint(176755643, "current_state", "accepted")},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog", "estimate/XXL", "state/delivered"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
 			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
 				invocations:     1,
 				issueNumberArgs: []int{42},
 				updatesArgs: []*github.IssueRequest{
 					{
-						Body: addressOf("This is the UPDATED description.\n"),
+						Labels: &[]string{"initial-unrelated-label", "enhancement", "estimate/XXL", "state/accepted"},
+						State:  addressOf("closed"),
 					},
 				},
 			},
 			wantStatus: http.StatusOK,
 		},
-	}
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			trackerAPI := fakeTrackerAPI{
-				returns: test.trackerReturns,
-				actual:  &fakeTrackerAPIActivity{},
-			}
-			if test.wantTrackerInvocations == nil {
-				test.wantTrackerInvocations = &fakeTrackerAPIActivity{}
-			}
-
-			gitHubAPI := fakeGitHubAPI{
-				getIssue: &fakeGitHubGetIssue{
-					returns: test.gitHubGetIssueReturns,
-					actual:  &fakeGitHubGetIssueActivity{},
-				},
+		{
+			name:        "story owners which the app recently set from the issue's assignees are not synced back to the issue",
+			bodyFixture: "edit_story_assign_second_owner",
+			configuration: &config.Config{UserIDMapping: map[int64]string{
+				3344177: "github-user1",
+				3344175: "github-user2",
+			}},
+			recentWrites: []string{loopguard.StoryFingerprint(176711643, "owner_ids", []int64{3344175, 3344177})},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "estimate/XXL", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176711643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations: 0, // the assignees already match
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "editing an accepted story back to any other state relabels the issue and also reopens the issue",
+			bodyFixture: "edit_unaccept_story",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "estimate/XXL", "state/accepted"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Labels: &[]string{"initial-unrelated-label", "enhancement", "estimate/XXL", "priority/backlog", "state/started"},
+						State:  addressOf("open"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "editing the title of a story also edits the title of the issue",
+			bodyFixture: "edit_story_change_title",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Title: addressOf("New title for Fake issue for testing, please ignore"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "editing the description of a story also edits the title of the issue",
+			bodyFixture: "edit_story_change_description",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Body: addressOf("This is the UPDATED description.\n"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when description sync is off, editing the description of a story leaves the issue body unchanged",
+			bodyFixture:   "edit_story_change_description",
+			configuration: &config.Config{DescriptionSync: config.DescriptionSync{Mode: "off"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}, Body: "Steps to reproduce:\r\n1. Run it"}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations: 0, // the issue body is unchanged
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when description sync uses a managed section, the description is added at the end of the issue body",
+			bodyFixture:   "edit_story_change_description",
+			configuration: &config.Config{DescriptionSync: config.DescriptionSync{Mode: "managed_section"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}, Body: "Steps to reproduce:\r\n1. Run it\r\n"}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Body: addressOf("Steps to reproduce:\r\n1. Run it\n\n" +
+							managedSectionStart + "\nThis is the UPDATED description.\n" + managedSectionEnd),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when description sync uses a managed section, the issue body's managed section is replaced",
+			bodyFixture:   "edit_story_change_description",
+			configuration: &config.Config{DescriptionSync: config.DescriptionSync{Mode: "managed_section"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}, Body: "Steps to reproduce:\r\n1. Run it\r\n\r\n" + managedSectionStart + "\nThis is a fake issue for testing.\n" + managedSectionEnd + "\r\n- [ ] task"}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Body: addressOf("Steps to reproduce:\r\n1. Run it\r\n\r\n" + managedSectionStart + "\nThis is the UPDATED description.\n" + managedSectionEnd + "\r\n- [ ] task"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when a story's description is synced, its mentions and story references are translated for GitHub",
+			bodyFixture:   "edit_story_change_description_mentions",
+			configuration: &config.Config{UserIDMapping: map[int64]string{3344177: "cfryanr"}},
+			members: []trackerapi.Person{
+				{ID: 3344177, Name: "Ryan Richard", Initials: "RR", Username: "ryan"},
+				{ID: 3344178, Name: "Someone Unmapped", Initials: "SU", Username: "unknown"},
+			},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Body: addressOf("@cfryanr please look at [#176858614](https://www.pivotaltracker.com/story/show/176858614). " +
+							"It fails in `@scope/pkg`, says Someone Unmapped.\n"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "when the Tracker project's members can't be listed, the description's mentions don't notify anyone in GitHub",
+			bodyFixture: "edit_story_change_description_mentions",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Body: addressOf("`@ryan` please look at [#176858614](https://www.pivotaltracker.com/story/show/176858614). " +
+							"It fails in `@scope/pkg`, says `@unknown`.\n"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when description sync merges, the description's changes are merged with the changes made in GitHub",
+			bodyFixture:   "edit_story_change_description_paragraphs",
+			configuration: &config.Config{DescriptionSync: config.DescriptionSync{Mode: "merge"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}, Body: "Steps to reproduce:\r\n1. Run it\r\n2. Look at the logs\r\n\r\nExpected: it works."}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Body: addressOf("Steps to reproduce:\r\n1. Run it\r\n2. Look at the logs\r\n\r\nExpected: it works quickly.\r\n\r\n" +
+							withSyncedDescription("", "Steps to reproduce:\n1. Run it\n\nExpected: it works quickly.\n")),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when description sync merges, conflicting changes leave the issue body unchanged",
+			bodyFixture:   "edit_story_change_description",
+			configuration: &config.Config{DescriptionSync: config.DescriptionSync{Mode: "merge"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}, Body: "This is a fake issue for testing, edited in GitHub."}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations: 0, // the issue body is unchanged
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "in global dry-run mode, the planned update is reported in the response body instead of being sent to GitHub",
+			bodyFixture:   "edit_accept_story",
+			configuration: &config.Config{DryRun: true},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog", "estimate/XXL", "state/delivered"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody: `dry run: planned update for issue #42: ` +
+				`{"labels":["initial-unrelated-label","enhancement","estimate/XXL","state/accepted"],"state":"closed"}` + "\n",
+		},
+		{
+			name:          "creating a story copies the files which the issue links to into the story",
+			bodyFixture:   "create_bug_story_with_attachments",
+			configuration: &config.Config{AttachmentCopy: config.AttachmentCopy{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			// The zip file can't be downloaded, so it is left on GitHub.
+			gitHubFiles: map[string]string{screenshotURL: "png bytes", logURL: "log"},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantTrackerUploads: []string{
+				"106189243-8f1c1a80-615c-11eb-9c6c-1d3c5f1e4a8b.png (application/octet-stream): png bytes",
+				"server.log (application/octet-stream): log",
+			},
+			wantTrackerComments: []string{
+				"#176710638: These files were copied from the GitHub issue, so that they can be seen without logging in to GitHub. [2001, 2002]",
+			},
+			wantTrackerStoryUpdate: []*trackerapi.StoryUpdate{{Description: attachmentsDescription(
+				"https://www.pivotaltracker.com/file_attachments/2001/download",
+				"https://www.pivotaltracker.com/file_attachments/2002/download",
+			)}},
+			wantRecentWrites: []string{descriptionFingerprint(176710638, *attachmentsDescription(
+				"https://www.pivotaltracker.com/file_attachments/2001/download",
+				"https://www.pivotaltracker.com/file_attachments/2002/download",
+			))},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "files which are larger than the per-file limit are left on GitHub",
+			bodyFixture: "create_bug_story_with_attachments",
+			configuration: &config.Config{AttachmentCopy: config.AttachmentCopy{Enabled: true,
+				MaxFileBytes: 5}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			gitHubFiles: map[string]string{screenshotURL: "png bytes", logURL: "log"},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantTrackerUploads: []string{"server.log (application/octet-stream): log"},
+			wantTrackerComments: []string{
+				"#176710638: These files were copied from the GitHub issue, so that they can be seen without logging in to GitHub. [2001]",
+			},
+			wantTrackerStoryUpdate: []*trackerapi.StoryUpdate{{Description: attachmentsDescription(
+				screenshotURL, "https://www.pivotaltracker.com/file_attachments/2001/download",
+			)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "files which would exceed the total limit are left on GitHub",
+			bodyFixture: "create_bug_story_with_attachments",
+			configuration: &config.Config{AttachmentCopy: config.AttachmentCopy{Enabled: true,
+				MaxTotalBytes: 10}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			gitHubFiles: map[string]string{screenshotURL: "png bytes", logURL: "log"},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantTrackerUploads: []string{
+				"106189243-8f1c1a80-615c-11eb-9c6c-1d3c5f1e4a8b.png (application/octet-stream): png bytes",
+			},
+			wantTrackerComments: []string{
+				"#176710638: These files were copied from the GitHub issue, so that they can be seen without logging in to GitHub. [2001]",
+			},
+			wantTrackerStoryUpdate: []*trackerapi.StoryUpdate{{Description: attachmentsDescription(
+				"https://www.pivotaltracker.com/file_attachments/2001/download", logURL,
+			)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "when no files can be uploaded, the story is left unchanged",
+			bodyFixture:   "create_bug_story_with_attachments",
+			configuration: &config.Config{AttachmentCopy: config.AttachmentCopy{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			gitHubFiles:        map[string]string{screenshotURL: "png bytes", logURL: "log"},
+			trackerUploadError: errors.New("Tracker API request failed"),
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "in dry-run mode, the planned copy is reported in the response body instead of being made",
+			bodyFixture:   "create_bug_story_with_attachments",
+			configuration: &config.Config{DryRun: true, AttachmentCopy: config.AttachmentCopy{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			gitHubFiles: map[string]string{screenshotURL: "png bytes", logURL: "log"},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "dry run: planned copy of 3 files from issue #42 into story #176710638\n",
+		},
+		{
+			name:        "files are not copied unless attachment copying is enabled",
+			bodyFixture: "create_bug_story_with_attachments",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			gitHubFiles: map[string]string{screenshotURL: "png bytes", logURL: "log"},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "changing a story's tasks updates the task list in the issue's body",
+			bodyFixture:   "create_task",
+			configuration: &config.Config{TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42, 42},
+			},
+			tasks: []trackerapi.Task{
+				{ID: 71234566, StoryID: 176710638, Description: "Fix the bug", Complete: true, Position: 1},
+				{ID: 71234567, StoryID: 176710638, Description: "Write the docs", Position: 2},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\r\n- [ ] Fix the bug <!-- issues2stories: task 71234566 -->\r\n- [ ] GitHub only\r\n\r\nThanks!"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\r\n- [ ] Fix the bug <!-- issues2stories: task 71234566 -->\r\n- [ ] GitHub only\r\n\r\nThanks!"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\r\n- [ ] Fix the bug <!-- issues2stories: task 71234566 -->\r\n- [ ] GitHub only\r\n\r\nThanks!"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   2,
+				projectIDArgs: []int64{2453999, 2453999},
+				storyIDArgs:   []int64{176710638, 176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     3,
+				issueNumberArgs: []int{42, 42, 42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Body: addressOf("Steps:\r\n- [x] Fix the bug <!-- issues2stories: task 71234566 -->\r\n" +
+						"- [ ] Write the docs <!-- issues2stories: task 71234567 -->\r\n- [ ] GitHub only\r\n\r\nThanks!")},
+				},
+			},
+			wantRecentWrites: []string{loopguard.IssueFingerprint(42, "body="+loopguard.Digest(
+				"Steps:\r\n- [x] Fix the bug <!-- issues2stories: task 71234566 -->\r\n"+
+					"- [ ] Write the docs <!-- issues2stories: task 71234567 -->\r\n- [ ] GitHub only\r\n\r\nThanks!"))},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "the mentions in a story's tasks are translated for GitHub",
+			bodyFixture:   "create_task",
+			configuration: &config.Config{UserIDMapping: map[int64]string{3344177: "cfryanr"}, TaskSync: config.TaskSync{Enabled: true}},
+			members:       []trackerapi.Person{{ID: 3344177, Name: "Ryan Richard", Initials: "RR", Username: "ryan"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42, 42},
+			},
+			tasks: []trackerapi.Task{
+				{ID: 71234566, StoryID: 176710638, Description: "Fix the bug with @ryan", Position: 1},
+				{ID: 71234567, StoryID: 176710638, Description: "Write the docs", Position: 2},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "- [ ] Fix the bug with @cfryanr <!-- issues2stories: task 71234566 -->\n"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "- [ ] Fix the bug with @cfryanr <!-- issues2stories: task 71234566 -->\n"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "- [ ] Fix the bug with @cfryanr <!-- issues2stories: task 71234566 -->\n"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   2,
+				projectIDArgs: []int64{2453999, 2453999},
+				storyIDArgs:   []int64{176710638, 176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     3,
+				issueNumberArgs: []int{42, 42, 42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Body: addressOf("- [ ] Fix the bug with @cfryanr <!-- issues2stories: task 71234566 -->\n" +
+						"- [ ] Write the docs <!-- issues2stories: task 71234567 -->\n")},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "the task list is not updated when the issue's body was edited while the tasks were being synced",
+			bodyFixture:   "create_task",
+			configuration: &config.Config{TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42, 42},
+			},
+			tasks: []trackerapi.Task{{ID: 71234567, StoryID: 176710638, Description: "Write the docs", Position: 1}},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Fake issue"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Fake issue"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Fake issue, edited"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   2,
+				projectIDArgs: []int64{2453999, 2453999},
+				storyIDArgs:   []int64{176710638, 176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     3,
+				issueNumberArgs: []int{42, 42, 42},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "in dry-run mode, the planned task list is reported in the response body instead of being sent to GitHub",
+			bodyFixture:   "create_task",
+			configuration: &config.Config{DryRun: true, TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42, 42},
+			},
+			tasks: []trackerapi.Task{{ID: 71234567, StoryID: 176710638, Description: "Write the docs", Position: 1}},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Fake issue"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Fake issue"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   2,
+				projectIDArgs: []int64{2453999, 2453999},
+				storyIDArgs:   []int64{176710638, 176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     2,
+				issueNumberArgs: []int{42, 42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        `dry run: planned update for issue #42: {"body":"Fake issue\n\n- [ ] Write the docs \u003c!-- issues2stories: task 71234567 --\u003e"}` + "\n",
+		},
+		{
+			name:          "when the story's tasks already match the issue's task list, the issue is unchanged",
+			bodyFixture:   "create_task",
+			configuration: &config.Config{TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42, 42},
+			},
+			tasks: []trackerapi.Task{{ID: 71234567, StoryID: 176710638, Description: "Write the docs", Position: 1}},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "- [ ] Write the docs <!-- issues2stories: task 71234567 -->"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   2,
+				projectIDArgs: []int64{2453999, 2453999},
+				storyIDArgs:   []int64{176710638, 176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     2,
+				issueNumberArgs: []int{42, 42},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "listing the story's tasks fails",
+			bodyFixture:   "create_task",
+			configuration: &config.Config{TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42, 42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   2,
+				projectIDArgs: []int64{2453999, 2453999},
+				storyIDArgs:   []int64{176710638, 176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusBadGateway,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "can't list the story's tasks via Tracker API\n",
+		},
+		{
+			name:        "task changes are not synced unless task sync is enabled",
+			bodyFixture: "create_task",
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "creating a story creates its tasks from the issue's task list, and marks the items with their tasks",
+			bodyFixture:   "create_bug_story_in_backlog",
+			configuration: &config.Config{TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\n- [ ] One\n- [x] Two\n"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\n- [ ] One\n- [x] Two\n"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     2,
+				issueNumberArgs: []int{42, 42},
+			},
+			wantTaskChanges: []string{"create task for story 176710638: One", "create task for story 176710638: Two"},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Body: addressOf("Steps:\n- [ ] One <!-- issues2stories: task 3001 -->\n- [x] Two <!-- issues2stories: task 3002 -->\n")},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "the mentions in a new story's tasks are translated for Tracker",
+			bodyFixture:   "create_bug_story_in_backlog",
+			configuration: &config.Config{UserIDMapping: map[int64]string{3344177: "cfryanr"}, TaskSync: config.TaskSync{Enabled: true}},
+			members:       []trackerapi.Person{{ID: 3344177, Name: "Ryan Richard", Initials: "RR", Username: "ryan"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "- [ ] Ask @cfryanr\n"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "- [ ] Ask @cfryanr\n"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     2,
+				issueNumberArgs: []int{42, 42},
+			},
+			wantTaskChanges: []string{"create task for story 176710638: Ask @ryan"},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Body: addressOf("- [ ] Ask @cfryanr <!-- issues2stories: task 3001 -->\n")},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "a new story's tasks are created, but the items are not marked when the issue's body was edited meanwhile",
+			bodyFixture:   "create_bug_story_in_backlog",
+			configuration: &config.Config{TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\n- [ ] One\n"},
+					{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\n- [ ] One\n- [ ] Three\n"},
+				},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     2,
+				issueNumberArgs: []int{42, 42},
+			},
+			wantTaskChanges: []string{"create task for story 176710638: One"},
+			wantStatus:      http.StatusOK,
+		},
+		{
+			name:          "in dry-run mode, the planned tasks for a new story are reported in the response body instead of being created",
+			bodyFixture:   "create_bug_story_in_backlog",
+			configuration: &config.Config{DryRun: true, TaskSync: config.TaskSync{Enabled: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}, Body: "Steps:\n- [ ] One\n- [x] Two\n"}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "dry run: planned 2 new tasks from issue #42 for story #176710638\n",
+		},
+		{
+			name:          "creating a story comments on the issue with a link to the story and labels the issue as linked",
+			bodyFixture:   "create_feature_story_in_icebox",
+			configuration: &config.Config{IssueLink: config.IssueLink{Comment: true, Label: "tracker/linked"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176650922},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Labels: &[]string{"initial-unrelated-label", "priority/undecided", "enhancement", "tracker/linked"}},
+				},
+			},
+			wantGitHubComments: []string{
+				"#42: This issue is linked to Tracker feature [#176650922](https://www.pivotaltracker.com/story/show/176650922), which is unscheduled.",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "creating a story comments on the issue using the configured template",
+			bodyFixture: "create_bug_story_in_backlog",
+			configuration: &config.Config{IssueLink: config.IssueLink{Comment: true,
+				CommentTemplate: `Now tracked as "{{.StoryTitle}}" in project {{.ProjectID}}: {{.StoryURL}}`}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"bug", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176710638},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubComments: []string{
+				`#42: Now tracked as "Fake issue for testing, please ignore" in project 2453999: https://www.pivotaltracker.com/story/show/176710638`,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "in dry-run mode, the planned comment is reported in the response body instead of being sent to GitHub",
+			bodyFixture:   "create_feature_story_in_icebox",
+			configuration: &config.Config{DryRun: true, IssueLink: config.IssueLink{Comment: true}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"priority/undecided", "enhancement"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176650922},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody: "dry run: planned comment on issue #42: This issue is linked to Tracker feature " +
+				"[#176650922](https://www.pivotaltracker.com/story/show/176650922), which is unscheduled.\n",
+		},
+		{
+			name:               "error commenting on the issue",
+			bodyFixture:        "create_feature_story_in_icebox",
+			configuration:      &config.Config{IssueLink: config.IssueLink{Comment: true}},
+			gitHubCommentError: errors.New("fake GitHub error"),
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"priority/undecided", "enhancement"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176650922},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubComments: []string{
+				"#42: This issue is linked to Tracker feature [#176650922](https://www.pivotaltracker.com/story/show/176650922), which is unscheduled.",
+			},
+			wantStatus:      http.StatusBadGateway,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "can't comment on GitHub issue via GitHub API\n",
+		},
+		{
+			name:        "starting a story comments on the issue about the configured transitions",
+			bodyFixture: "edit_start_story_from_icebox",
+			configuration: &config.Config{
+				UserIDMapping: map[int64]string{3344177: "github-user1"},
+				AuditComments: config.AuditComments{Transitions: []string{"started", "owners"}},
+			},
+			iteration:   12,
+			inIteration: []int64{176755643},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"enhancement", "priority/backlog", "state/started"}, Assignees: []string{"github-user1"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Assignees: &[]string{"github-user1"}},
+				},
+			},
+			wantGitHubComments: []string{
+				"#42: Ryan Richard started Tracker story [#176755643](https://www.pivotaltracker.com/story/show/176755643) in iteration 12.\n\n" +
+					"Ryan Richard changed the owners of Tracker story [#176755643](https://www.pivotaltracker.com/story/show/176755643) " +
+					"to github-user1 in iteration 12.",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "audit comments use the configured templates, and leave out the iteration when it can't be found",
+			bodyFixture: "edit_accept_story",
+			configuration: &config.Config{AuditComments: config.AuditComments{
+				Transitions: []string{"accepted"},
+				Templates:   map[string]string{"accepted": "{{.PerformedBy}} moved #{{.StoryID}} from {{.PreviousState}} to {{.CurrentState}} (iteration {{.Iteration}})"},
+			}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"state/accepted"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{State: addressOf("closed")},
+				},
+			},
+			wantGitHubComments: []string{
+				"#42: Ryan Richard moved #176755643 from delivered to accepted (iteration 0)",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "audit comments leave out the current iteration when the story is not in it",
+			bodyFixture:   "edit_accept_story",
+			configuration: &config.Config{AuditComments: config.AuditComments{Transitions: []string{"accepted"}}},
+			iteration:     12,
+			inIteration:   []int64{176755644},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"state/accepted"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{State: addressOf("closed")},
+				},
+			},
+			wantGitHubComments: []string{
+				"#42: Ryan Richard accepted Tracker story [#176755643](https://www.pivotaltracker.com/story/show/176755643).",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "transitions which are not configured are not commented on",
+			bodyFixture:   "edit_accept_story",
+			configuration: &config.Config{AuditComments: config.AuditComments{Transitions: []string{"started", "rejected", "owners"}}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"state/accepted"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{State: addressOf("closed")},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "in dry-run mode, the planned audit comments are reported in the response body instead of being sent to GitHub",
+			bodyFixture: "edit_accept_story",
+			configuration: &config.Config{
+				DryRun:        true,
+				AuditComments: config.AuditComments{Transitions: []string{"accepted"}},
+			},
+			iteration:   12,
+			inIteration: []int64{176755643},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"state/accepted"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody: "dry run: planned update for issue #42: {\"state\":\"closed\"}\n" +
+				"dry run: planned comment on issue #42: Ryan Richard accepted Tracker story " +
+				"[#176755643](https://www.pivotaltracker.com/story/show/176755643) in iteration 12.\n",
+		},
+		{
+			name:          "editing a story doesn't comment on the issue or label it as linked",
+			bodyFixture:   "edit_story_change_title",
+			configuration: &config.Config{IssueLink: config.IssueLink{Comment: true, Label: "tracker/linked"}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{Title: addressOf("New title for Fake issue for testing, please ignore")},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "the configured label mappings replace the default mappings",
+			bodyFixture: "edit_accept_story",
+			configuration: &config.Config{DryRun: true, Labels: config.LabelMappings{States: map[string][]string{
+				"delivered": {"state/delivered"},
+				"accepted":  {"done"},
+			}}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog", "estimate/XXL", "state/delivered"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176755643},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody: `dry run: planned update for issue #42: ` +
+				`{"labels":["initial-unrelated-label","enhancement","priority/backlog","estimate/XXL","done"],"state":"closed"}` + "\n",
+		},
+		{
+			name:        "in per-binding dry-run mode, the planned update is reported in the response body instead of being sent to GitHub",
+			bodyFixture: "edit_story_change_title",
+			configuration: &config.Config{Bindings: []config.Binding{
+				{Name: "some-other-project", TrackerProjectID: 1111111},
+				{Name: "the-project", TrackerProjectID: 2453999, DryRun: true},
+			}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        `dry run: planned update for issue #42: {"title":"New title for Fake issue for testing, please ignore"}` + "\n",
+		},
+		{
+			name:        "dry-run mode for a different binding does not prevent updating the issue",
+			bodyFixture: "edit_story_change_title",
+			configuration: &config.Config{Bindings: []config.Binding{
+				{Name: "some-other-project", TrackerProjectID: 1111111, DryRun: true},
+			}},
+			trackerReturns: &fakeTrackerAPIReturnValues{
+				issueIDs: []int{42},
+			},
+			gitHubGetIssueReturns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{{Labels: []string{"initial-unrelated-label", "enhancement", "priority/backlog"}}},
+			},
+			wantTrackerInvocations: &fakeTrackerAPIActivity{
+				invocations:   1,
+				projectIDArgs: []int64{2453999},
+				storyIDArgs:   []int64{176858613},
+			},
+			wantGitHubGetIssueInvocations: &fakeGitHubGetIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+			},
+			wantGitHubUpdateIssueInvocations: &fakeGitHubUpdateIssueActivity{
+				invocations:     1,
+				issueNumberArgs: []int{42},
+				updatesArgs: []*github.IssueRequest{
+					{
+						Title: addressOf("New title for Fake issue for testing, please ignore"),
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trackerAPI := fakeTrackerAPI{
+				returns:           test.trackerReturns,
+				actual:            &fakeTrackerAPIActivity{},
+				appPersonID:       test.appPersonID,
+				currentIteration:  test.iteration,
+				iterationStoryIDs: test.inIteration,
+				members:           test.members,
+				uploadError:       test.trackerUploadError,
+				tasks:             test.tasks,
+			}
+			if test.wantTrackerInvocations == nil {
+				test.wantTrackerInvocations = &fakeTrackerAPIActivity{}
+			}
+
+			gitHubAPI := fakeGitHubAPI{
+				getIssue: &fakeGitHubGetIssue{
+					returns: test.gitHubGetIssueReturns,
+					actual:  &fakeGitHubGetIssueActivity{},
+				},
 				updateIssue: &fakeGitHubUpdateIssue{
 					returns: test.gitHubUpdateIssueReturns,
 					actual:  &fakeGitHubUpdateIssueActivity{},
 				},
+				commentError: test.gitHubCommentError,
+				files:        test.gitHubFiles,
 			}
 			if test.wantGitHubGetIssueInvocations == nil {
 				test.wantGitHubGetIssueInvocations = &fakeGitHubGetIssueActivity{}
@@ -1021,8 +2652,14 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 				test.configuration = &config.Config{}
 			}
 
-			subject := NewHandler(&trackerAPI, &gitHubAPI, test.configuration,
-				&config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"})
+			if test.credentials == nil {
+				test.credentials = &config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"}
+			}
+
+			recentWrites := loopguard.New(loopguard.DefaultTTL)
+			recentWrites.Remember(test.recentWrites...)
+
+			subject := NewHandler(&trackerAPI, &gitHubAPI, test.configuration, test.credentials, test.users, recentWrites, nil)
 
 			var requestBodyReader io.Reader
 			switch {
@@ -1063,6 +2700,222 @@ func TestHandleTrackerActivityWebhook(t *testing.T) {
 			require.Equal(t, test.wantGitHubUpdateIssueInvocations.invocations, gitHubAPI.updateIssue.actual.invocations, "wrong number of GitHub UpdateIssue() API invocations")
 			require.Equal(t, test.wantGitHubUpdateIssueInvocations.issueNumberArgs, gitHubAPI.updateIssue.actual.issueNumberArgs, "wrong GitHub UpdateIssue() issue arguments")
 			require.Equal(t, test.wantGitHubUpdateIssueInvocations.updatesArgs, gitHubAPI.updateIssue.actual.updatesArgs, "wrong GitHub UpdateIssue() updates arguments")
+			require.Equal(t, test.wantGitHubComments, gitHubAPI.comments, "wrong GitHub CreateComment() arguments")
+			require.Equal(t, test.wantTrackerUploads, trackerAPI.uploads, "wrong Tracker UploadFile() arguments")
+			require.Equal(t, test.wantTrackerComments, trackerAPI.comments, "wrong Tracker AddCommentWithAttachments() arguments")
+			require.Equal(t, test.wantTrackerStoryUpdate, trackerAPI.storyUpdates, "wrong Tracker UpdateStory() arguments")
+			require.Equal(t, test.wantTaskChanges, trackerAPI.taskChanges, "wrong Tracker task changes")
+			if test.wantRecentWrites != nil {
+				require.True(t, recentWrites.Consume(test.wantRecentWrites...), "the update should be remembered")
+			}
 		})
 	}
 }
+
+func TestAuditCommentsAreCoalesced(t *testing.T) {
+	now := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)
+	trackerAPI := fakeTrackerAPI{returns: &fakeTrackerAPIReturnValues{issueIDs: []int{42, 42, 42, 42}}, actual: &fakeTrackerAPIActivity{}}
+	gitHubAPI := fakeGitHubAPI{
+		getIssue: &fakeGitHubGetIssue{
+			returns: &fakeGitHubGetIssueReturnValues{issues: []*githubapi.Issue{
+				{Labels: []string{"state/started"}}, {Labels: []string{"state/accepted"}}, {Labels: []string{"state/started"}}, {Labels: []string{"state/accepted"}},
+			}},
+			actual: &fakeGitHubGetIssueActivity{},
+		},
+		updateIssue: &fakeGitHubUpdateIssue{actual: &fakeGitHubUpdateIssueActivity{}},
+	}
+	configuration := &config.Config{AuditComments: config.AuditComments{
+		Transitions:    []string{"started", "accepted"},
+		Templates:      map[string]string{"started": "started", "accepted": "accepted"},
+		CoalesceWindow: 5 * time.Minute,
+	}}
+	auditComments := NewRecentAuditComments()
+	auditComments.now = func() time.Time { return now }
+	credentials := &config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"}
+	subject := NewHandler(&trackerAPI, &gitHubAPI, configuration, credentials, nil, nil, auditComments)
+	// E.g. the handler of the other Tracker activity endpoint.
+	otherHandler := NewHandler(&trackerAPI, &gitHubAPI, configuration, credentials, nil, nil, auditComments)
+
+	serveWith := func(handler http.Handler, fixture string) {
+		req := httptest.NewRequest(http.MethodPost, "/some/path?username=correct-username&password=correct-password",
+			strings.NewReader(readFixture(t, fixture)))
+		req.Header.Set("Content-Type", "application/json")
+		rsp := httptest.NewRecorder()
+		handler.ServeHTTP(rsp, req)
+		require.Equal(t, http.StatusOK, rsp.Code)
+	}
+	serve := func(fixture string) { serveWith(subject, fixture) }
+
+	// The handlers share the recent audit comments, so either one adds to the other's comment.
+	serve("edit_start_story_from_icebox")
+	now = now.Add(4 * time.Minute)
+	serveWith(otherHandler, "edit_accept_story")
+	require.Equal(t, []string{"#42: started"}, gitHubAPI.comments)
+	require.Equal(t, []string{"comment 1001: started\n\naccepted"}, gitHubAPI.edits)
+
+	// The window starts when the comment is made, so a story which keeps moving still gets another comment.
+	now = now.Add(2 * time.Minute)
+	serve("edit_start_story_from_icebox")
+	require.Equal(t, []string{"#42: started", "#42: started"}, gitHubAPI.comments)
+
+	// When the previous comment can't be edited, e.g. because it was deleted, another one is made.
+	gitHubAPI.editError = errors.New("fake GitHub error")
+	serve("edit_accept_story")
+	require.Equal(t, []string{"#42: started", "#42: started", "#42: accepted"}, gitHubAPI.comments)
+	require.Equal(t, []string{"comment 1001: started\n\naccepted", "comment 1002: started\n\naccepted"}, gitHubAPI.edits)
+}
+
+// Takes a while to comment, so that concurrent events overlap.
+type slowCommentingGitHubAPI struct {
+	*fakeGitHubAPI
+}
+
+func (s slowCommentingGitHubAPI) CreateComment(ctx context.Context, issueNumber int, body string) (int64, error) {
+	time.Sleep(20 * time.Millisecond)
+	return s.fakeGitHubAPI.CreateComment(ctx, issueNumber, body)
+}
+
+func TestConcurrentAuditCommentsAreCoalesced(t *testing.T) {
+	gitHubAPI := fakeGitHubAPI{}
+	subject := NewHandler(&fakeTrackerAPI{}, slowCommentingGitHubAPI{&gitHubAPI}, &config.Config{}, &config.BasicAuthCredentials{}, nil, nil, nil).(*handler)
+	audit := config.AuditComments{CoalesceWindow: 5 * time.Minute}
+	logger := logging.New(ioutil.Discard, logging.LevelInfo)
+
+	var wg sync.WaitGroup
+	for _, transition := range []string{"started", "finished"} {
+		wg.Add(1)
+		go func(transition string) {
+			defer wg.Done()
+			err := subject.postAuditComment(context.Background(), logger, audit, 42, []auditLine{{transition: transition, text: transition}})
+			require.NoError(t, err)
+		}(transition)
+	}
+	wg.Wait()
+
+	// Whichever event comments first, the other one adds to its comment.
+	require.Len(t, gitHubAPI.comments, 1)
+	require.Len(t, gitHubAPI.edits, 1)
+	require.Empty(t, subject.auditComments.issueLocks, "the issue's lock should be forgotten once nobody holds it")
+}
+
+func TestHandleTrackerActivityWebhookMetrics(t *testing.T) {
+	kind := "story_update_activity"
+	okBefore := webhookEvents.Value(kind, "ok")
+	errorBefore := webhookEvents.Value(kind, "error")
+	unauthorizedBefore := webhookEvents.Value(unknownEventKind, "unauthorized")
+	updatesBefore := storyChanges.Value("update")
+
+	serve := func(path string, updateErrors []error) {
+		trackerAPI := fakeTrackerAPI{returns: &fakeTrackerAPIReturnValues{issueIDs: []int{42}}, actual: &fakeTrackerAPIActivity{}}
+		gitHubAPI := fakeGitHubAPI{
+			getIssue: &fakeGitHubGetIssue{
+				returns: &fakeGitHubGetIssueReturnValues{issues: []*githubapi.Issue{{Labels: []string{}}}},
+				actual:  &fakeGitHubGetIssueActivity{},
+			},
+			updateIssue: &fakeGitHubUpdateIssue{
+				returns: &fakeGitHubUpdateIssueReturnValues{errors: updateErrors},
+				actual:  &fakeGitHubUpdateIssueActivity{},
+			},
+		}
+		subject := NewHandler(&trackerAPI, &gitHubAPI, &config.Config{},
+			&config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"}, nil, nil, nil)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(readFixture(t, "edit_story_change_title")))
+		req.Header.Set("Content-Type", "application/json")
+		subject.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/some/path?username=correct-username&password=correct-password", nil)
+	serve("/some/path?username=correct-username&password=correct-password", []error{errors.New("fake GitHub error")})
+	serve("/some/path?username=correct-username&password=wrong", nil)
+
+	require.Equal(t, okBefore+1, webhookEvents.Value(kind, "ok"))
+	require.Equal(t, errorBefore+1, webhookEvents.Value(kind, "error"))
+	require.Equal(t, unauthorizedBefore+1, webhookEvents.Value(unknownEventKind, "unauthorized"))
+	require.Equal(t, updatesBefore+2, storyChanges.Value("update"))
+}
+
+func TestHandleTrackerActivityWebhookLogsCredentialLabel(t *testing.T) {
+	trackerAPI := fakeTrackerAPI{returns: &fakeTrackerAPIReturnValues{issueIDs: []int{42}}, actual: &fakeTrackerAPIActivity{}}
+	gitHubAPI := fakeGitHubAPI{
+		getIssue: &fakeGitHubGetIssue{
+			returns: &fakeGitHubGetIssueReturnValues{issues: []*githubapi.Issue{{Labels: []string{}}}},
+			actual:  &fakeGitHubGetIssueActivity{},
+		},
+		updateIssue: &fakeGitHubUpdateIssue{actual: &fakeGitHubUpdateIssueActivity{}},
+	}
+	subject := NewHandler(&trackerAPI, &gitHubAPI, &config.Config{},
+		&config.BasicAuthCredentials{Label: "tracker-webhook-2021-03", Username: "correct-username", Password: "correct-password"}, nil, nil, nil)
+
+	var logs bytes.Buffer
+	ctx := logging.NewContext(context.Background(), logging.New(&logs, logging.LevelInfo))
+	req := httptest.NewRequest(http.MethodPost, "/some/path?username=correct-username&password=correct-password",
+		strings.NewReader(readFixture(t, "edit_story_change_title"))).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	subject.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Contains(t, logs.String(), `"credential_label":"tracker-webhook-2021-03"`)
+	require.NotContains(t, logs.String(), "correct-password")
+}
+
+func TestHandleTrackerActivityWebhookSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previousProvider := tracing.GetProvider()
+	tracing.SetProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { tracing.SetProvider(previousProvider) })
+
+	trackerAPI := fakeTrackerAPI{returns: &fakeTrackerAPIReturnValues{issueIDs: []int{42, 43}}, actual: &fakeTrackerAPIActivity{}}
+	gitHubAPI := fakeGitHubAPI{
+		getIssue: &fakeGitHubGetIssue{
+			returns: &fakeGitHubGetIssueReturnValues{
+				issues: []*githubapi.Issue{nil, {Labels: []string{"priority/undecided"}}},
+				errors: []error{errors.New("fake GitHub error"), nil},
+			},
+			actual: &fakeGitHubGetIssueActivity{},
+		},
+		updateIssue: &fakeGitHubUpdateIssue{actual: &fakeGitHubUpdateIssueActivity{}},
+	}
+	subject := NewHandler(&trackerAPI, &gitHubAPI, &config.Config{},
+		&config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"}, nil, nil, nil)
+
+	ctx, requestSpan := tracing.Start(context.Background(), "incoming request", tracing.SpanKindServer)
+	req := httptest.NewRequest(http.MethodPost, "/some/path?username=correct-username&password=correct-password",
+		strings.NewReader(readFixture(t, "move_multiple_stories_from_icebox_to_backlog"))).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	subject.ServeHTTP(httptest.NewRecorder(), req)
+	requestSpan.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	for i, wantIssue := range []int{42, 43} {
+		span := spans[i]
+		require.Equal(t, "process story change", span.Name)
+		require.Equal(t, requestSpan.TraceID(), span.SpanContext.TraceID())
+		require.Equal(t, requestSpan.SpanID(), span.Parent.SpanID())
+		require.Contains(t, span.Attributes, attribute.Int64("tracker.project", 2453999))
+		require.Contains(t, span.Attributes, attribute.Int64("tracker.story", trackerAPI.actual.storyIDArgs[i]))
+		require.Contains(t, span.Attributes, attribute.String("tracker.change_type", "update"))
+		require.Contains(t, span.Attributes, attribute.Int("github.issue", wantIssue))
+	}
+	require.Equal(t, sdktrace.Status{Code: codes.Error, Description: "fake GitHub error"}, spans[0].Status)
+	require.Equal(t, codes.Unset, spans[1].Status.Code)
+	require.Equal(t, "incoming request", spans[2].Name)
+}
+
+// The config file's label mappings are validated against config.StoryStates and config.StoryTypes,
+// so they must name the same states and types as the default mappings.
+func TestDefaultLabelMappingsMatchConfigValidation(t *testing.T) {
+	var states, types []string
+	for state := range issueLabelsToApplyPerStoryState {
+		states = append(states, state)
+	}
+	for storyType := range issueLabelsToApplyPerStoryType {
+		types = append(types, storyType)
+	}
+	require.ElementsMatch(t, config.StoryStates, states)
+	require.ElementsMatch(t, config.StoryTypes, types)
+	require.NoError(t, (&config.Config{Labels: config.LabelMappings{
+		States:    issueLabelsToApplyPerStoryState,
+		Types:     issueLabelsToApplyPerStoryType,
+		Estimates: issueLabelsToApplyPerStoryEstimate,
+	}}).Validate())
+}
@@ -3,9 +3,13 @@ package trackeractivity
 import "encoding/json"
 
 type TrackerEvent struct {
-	Kind    string   `json:"kind"`
-	Changes []Change `json:"changes"`
-	Project Project  `json:"project"`
+	Kind        string   `json:"kind"`
+	Changes     []Change `json:"changes"`
+	Project     Project  `json:"project"`
+	PerformedBy Person   `json:"performed_by"`
+
+	// The resources which the event is about, e.g. the story whose task was changed.
+	PrimaryResources []Resource `json:"primary_resources"`
 }
 
 type Change struct {
@@ -26,10 +30,21 @@ type ChangedValues struct {
 	OwnerIDs     OptionalInt64List `json:"owner_ids"`
 }
 
+type Resource struct {
+	Kind string `json:"kind"`
+	ID   int64  `json:"id"`
+}
+
 type Project struct {
 	ID int64 `json:"id"`
 }
 
+// The Tracker user who made the change.
+type Person struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
 type OptionalInt64 struct {
 	Present bool
 	Value   *int64
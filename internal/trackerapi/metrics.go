@@ -0,0 +1,31 @@
+package trackerapi
+
+import (
+	"strconv"
+	"time"
+
+	"issues2stories/internal/metrics"
+)
+
+var (
+	apiRequests = metrics.NewCounterVec(
+		"issues2stories_tracker_api_requests_total",
+		"Tracker API requests, by operation and HTTP status code. The status is \"error\" when there was no response.",
+		"operation", "status")
+
+	apiRequestDuration = metrics.NewHistogramVec(
+		"issues2stories_tracker_api_request_duration_seconds",
+		"Tracker API request latency, by operation.",
+		metrics.DefaultBuckets,
+		"operation")
+)
+
+// Pass a status code of zero when there was no response.
+func observeAPICall(operation string, start time.Time, statusCode int) {
+	apiRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	apiRequests.WithLabelValues(operation, status).Inc()
+}
@@ -0,0 +1,85 @@
+package trackerapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"issues2stories/internal/tracing"
+)
+
+const baseURL = "https://www.pivotaltracker.com/services/v5"
+
+// Make a Tracker API request with an optional JSON request body, and parse the JSON response
+// into responseBody unless it is nil. The operation names the call in metrics and traces.
+func (c *Client) doJSON(ctx context.Context, operation, method, url string, requestBody, responseBody interface{}) error {
+	if requestBody == nil {
+		return c.do(ctx, operation, method, url, "", nil, responseBody)
+	}
+	encoded, err := json.Marshal(requestBody)
+	if err != nil {
+		return fmt.Errorf("could not serialize Tracker API request body: %v", err)
+	}
+	return c.do(ctx, operation, method, url, "application/json", bytes.NewReader(encoded), responseBody)
+}
+
+// Make a Tracker API request with an optional request body of the content type, and parse the JSON response
+// into responseBody unless it is nil.
+func (c *Client) do(ctx context.Context, operation, method, url, contentType string, bodyReader io.Reader, responseBody interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "trackerapi."+operation, tracing.SpanKindClient, "http.method", method)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return fmt.Errorf("could not create Tracker API request: %v", err)
+	}
+	req.Header.Set("X-TrackerToken", c.trackerAPIToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	tracing.InjectHeaders(ctx, req.Header)
+
+	start := time.Now()
+	res, err := c.client.Do(req)
+	if err != nil {
+		observeAPICall(operation, start, 0)
+		return fmt.Errorf("Tracker API request failed: %v", err)
+	}
+	defer res.Body.Close()
+	observeAPICall(operation, start, res.StatusCode)
+	span.SetAttributes("http.status_code", res.StatusCode)
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("Tracker API at %s returned body which cannot be read: %v", url, err)
+	}
+
+	if res.StatusCode/100 != 2 {
+		return &StatusError{URL: url, StatusCode: res.StatusCode}
+	}
+
+	if responseBody != nil {
+		if err := json.Unmarshal(body, responseBody); err != nil {
+			return fmt.Errorf("Tracker API at %s returned body which cannot be parsed as json: %s", url, body)
+		}
+	}
+	return nil
+}
+
+// StatusError is returned when the Tracker API responds with an unsuccessful status code.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Tracker API at %s returned status %d", e.URL, e.StatusCode)
+}
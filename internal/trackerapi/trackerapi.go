@@ -1,17 +1,211 @@
 package trackerapi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
+	"time"
+
+	"issues2stories/internal/tracing"
 )
 
 type TrackerAPI interface {
-	GetGithubIssueIDLinkedToStory(trackerProjectID, trackerStoryID int64) (githubIssueID int, err error)
+	GetGithubIssueIDLinkedToStory(ctx context.Context, trackerProjectID, trackerStoryID int64) (githubIssueID int, err error)
+
+	// Returns an error unless the API token is valid.
+	CheckToken(ctx context.Context) error
+
+	// Returns an error unless the API token can read the project.
+	CheckProjectAccess(ctx context.Context, trackerProjectID int64) error
+
+	// List the people who are members of the project. Internally reads all pages of Tracker's paginated results.
+	ListProjectMembers(ctx context.Context, trackerProjectID int64) ([]Person, error)
+
+	// Returns the stories in the project which the project's "Other" integrations link to the GitHub issue.
+	// Usually there is at most one.
+	FindStoriesLinkedToGitHubIssue(ctx context.Context, trackerProjectID int64, githubIssueID int) ([]Story, error)
+
+	// Overwrite the fields of the story which are set in the update.
+	UpdateStory(ctx context.Context, trackerProjectID, trackerStoryID int64, update *StoryUpdate) error
+
+	// Add a comment to the story.
+	AddComment(ctx context.Context, trackerProjectID, trackerStoryID int64, text string) error
+
+	// Upload a file to the project, so that it can be attached to a comment.
+	UploadFile(ctx context.Context, trackerProjectID int64, filename, contentType string, content []byte) (*FileAttachment, error)
+
+	// Add a comment to the story with the uploaded files attached.
+	AddCommentWithAttachments(ctx context.Context, trackerProjectID, trackerStoryID int64, text string, attachments []FileAttachment) error
+
+	// List the story's tasks, in the order of their positions.
+	ListTasks(ctx context.Context, trackerProjectID, trackerStoryID int64) ([]Task, error)
+
+	// Add a task to the story. The task's description is required.
+	CreateTask(ctx context.Context, trackerProjectID, trackerStoryID int64, task *TaskUpdate) (*Task, error)
+
+	// Overwrite the fields of the task which are set in the update.
+	UpdateTask(ctx context.Context, trackerProjectID, trackerStoryID, trackerTaskID int64, update *TaskUpdate) error
+
+	// Delete the task from the story.
+	DeleteTask(ctx context.Context, trackerProjectID, trackerStoryID, trackerTaskID int64) error
+
+	// Get the project's settings.
+	GetProject(ctx context.Context, trackerProjectID int64) (*Project, error)
+
+	// Returns the Tracker user whose API token is used, e.g. to recognize the app's own changes.
+	GetAuthenticatedPerson(ctx context.Context) (*Person, error)
+
+	// Returns the project's current iteration, with the IDs of its stories.
+	GetCurrentIteration(ctx context.Context, trackerProjectID int64) (*Iteration, error)
+}
+
+// The parts of a Tracker project which are used. See https://www.pivotaltracker.com/help/api/rest/v5#project_resource
+type Project struct {
+	ID int64 `json:"id"`
+
+	// The estimates which the project allows, e.g. "0,1,2,3,5,8".
+	PointScale string `json:"point_scale"`
+}
+
+// The parts of a Tracker iteration which are used. See https://www.pivotaltracker.com/help/api/rest/v5#iteration_resource
+type Iteration struct {
+	Number   int     `json:"number"`
+	Start    string  `json:"start"`
+	Finish   string  `json:"finish"`
+	StoryIDs []int64 `json:"story_ids"`
+}
+
+// Returns true when the story is in the iteration.
+func (i *Iteration) Contains(storyID int64) bool {
+	for _, id := range i.StoryIDs {
+		if id == storyID {
+			return true
+		}
+	}
+	return false
+}
+
+// The parts of a Tracker story which are synced from its linked GitHub issue.
+// See https://www.pivotaltracker.com/help/api/rest/v5#story_resource
+type Story struct {
+	ID            int64    `json:"id"`
+	ExternalID    string   `json:"external_id"`
+	IntegrationID int64    `json:"integration_id"`
+	CurrentState  string   `json:"current_state"`
+	StoryType     string   `json:"story_type"`
+	Estimate      *float64 `json:"estimate"`
+	OwnerIDs      []int64  `json:"owner_ids"`
+}
+
+// A file which was uploaded to a project. See https://www.pivotaltracker.com/help/api/rest/v5#file_attachment_resource
+type FileAttachment struct {
+	ID          int64  `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+
+	// Relative to https://www.pivotaltracker.com, e.g. "/file_attachments/123/download".
+	DownloadURL string `json:"download_url"`
+}
+
+// A task of a story. See https://www.pivotaltracker.com/help/api/rest/v5#task_resource
+type Task struct {
+	ID          int64  `json:"id"`
+	StoryID     int64  `json:"story_id"`
+	Description string `json:"description"`
+	Complete    bool   `json:"complete"`
+
+	// The task's place in the story's list of tasks, starting at 1.
+	Position int `json:"position"`
+}
+
+// The fields of a task to create or update. Fields which are nil are left unchanged. Setting a task's position
+// moves the story's other tasks to make room for it.
+// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_tasks_task_id_put
+type TaskUpdate struct {
+	Description *string `json:"description,omitempty"`
+	Complete    *bool   `json:"complete,omitempty"`
+	Position    *int    `json:"position,omitempty"`
+}
+
+// The fields of a story to update. Fields which are nil are left unchanged.
+// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_put
+type StoryUpdate struct {
+	CurrentState *string
+	StoryType    *string
+	OwnerIDs     *[]int64
+	Description  *string
+
+	// Set Estimate to estimate the story, or Unestimate to remove its estimate.
+	Estimate   *float64
+	Unestimate bool
+}
+
+// Only the fields which are set are included, so that Tracker leaves the others unchanged.
+func (u StoryUpdate) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{}
+	if u.CurrentState != nil {
+		fields["current_state"] = *u.CurrentState
+	}
+	if u.StoryType != nil {
+		fields["story_type"] = *u.StoryType
+	}
+	if u.OwnerIDs != nil {
+		fields["owner_ids"] = *u.OwnerIDs
+	}
+	if u.Description != nil {
+		fields["description"] = *u.Description
+	}
+	if u.Estimate != nil {
+		fields["estimate"] = *u.Estimate
+	}
+	if u.Unestimate {
+		fields["estimate"] = nil
+	}
+	return json.Marshal(fields)
+}
+
+type comment struct {
+	Text            string                `json:"text"`
+	FileAttachments []attachmentReference `json:"file_attachments,omitempty"`
+}
+
+// Refers to an uploaded file, to attach it to a comment.
+type attachmentReference struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+type integration struct {
+	ID   int64  `json:"id"`
+	Kind string `json:"kind"`
 }
 
+// The kind of the "Other" integrations, which are the kind used by the import panel.
+const otherIntegrationKind = "other_integration"
+
+// A Tracker user. See https://www.pivotaltracker.com/help/api/rest/v5#person_resource
+type Person struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Initials string `json:"initials"`
+	Username string `json:"username"`
+}
+
+type membership struct {
+	Person Person `json:"person"`
+}
+
+// The number of memberships to request per page. Tracker allows up to 1000.
+const membershipsPageSize = 500
+
 type trackerResponse struct {
 	ExternalID string `json:"external_id"`
 }
@@ -25,14 +219,27 @@ func New(trackerAPIToken string, client *http.Client) TrackerAPI {
 	return &Client{trackerAPIToken: trackerAPIToken, client: client}
 }
 
-func (c *Client) GetGithubIssueIDLinkedToStory(trackerProjectID, trackerStoryID int64) (githubIssueID int, err error) {
+func (c *Client) GetGithubIssueIDLinkedToStory(ctx context.Context, trackerProjectID, trackerStoryID int64) (githubIssueID int, err error) {
+	ctx, span := tracing.Start(ctx, "trackerapi.GetGithubIssueIDLinkedToStory", tracing.SpanKindClient,
+		"tracker.project", trackerProjectID,
+		"tracker.story", trackerStoryID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	url := fmt.Sprintf("https://www.pivotaltracker.com/services/v5/projects/%d/stories/%d", trackerProjectID, trackerStoryID)
-	req, _ := http.NewRequest("GET", url, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("X-TrackerToken", c.trackerAPIToken)
+	tracing.InjectHeaders(ctx, req.Header)
+	start := time.Now()
 	res, err := c.client.Do(req)
 	if err != nil {
+		observeAPICall("get_story", start, 0)
 		return 0, fmt.Errorf("Tracker API request failed: %v", err)
 	}
+	observeAPICall("get_story", start, res.StatusCode)
+	span.SetAttributes("http.status_code", res.StatusCode)
 
 	if res.StatusCode != http.StatusOK {
 		return 0, fmt.Errorf("Tracker API at %s returned status %d", url, res.StatusCode)
@@ -59,3 +266,174 @@ func (c *Client) GetGithubIssueIDLinkedToStory(trackerProjectID, trackerStoryID
 
 	return 0, nil
 }
+
+func (c *Client) CheckToken(ctx context.Context) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#me_get
+	return c.doJSON(ctx, "get_me", "GET", baseURL+"/me", nil, nil)
+}
+
+func (c *Client) GetAuthenticatedPerson(ctx context.Context) (*Person, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#me_get
+	person := &Person{}
+	if err := c.doJSON(ctx, "get_me", "GET", baseURL+"/me", nil, person); err != nil {
+		return nil, err
+	}
+	return person, nil
+}
+
+func (c *Client) CheckProjectAccess(ctx context.Context, trackerProjectID int64) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_get
+	url := fmt.Sprintf("%s/projects/%d", baseURL, trackerProjectID)
+	return c.doJSON(ctx, "get_project", "GET", url, nil, nil)
+}
+
+func (c *Client) GetProject(ctx context.Context, trackerProjectID int64) (*Project, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_get
+	url := fmt.Sprintf("%s/projects/%d", baseURL, trackerProjectID)
+	project := &Project{}
+	if err := c.doJSON(ctx, "get_project", "GET", url, nil, project); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func (c *Client) GetCurrentIteration(ctx context.Context, trackerProjectID int64) (*Iteration, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_iterations_get
+	// Only the stories' IDs are needed, rather than the stories themselves.
+	url := fmt.Sprintf("%s/projects/%d/iterations?scope=current&fields=number,start,finish,story_ids", baseURL, trackerProjectID)
+	var iterations []Iteration
+	if err := c.doJSON(ctx, "list_iterations", "GET", url, nil, &iterations); err != nil {
+		return nil, err
+	}
+	if len(iterations) == 0 {
+		return nil, fmt.Errorf("Tracker API at %s returned no current iteration", url)
+	}
+	return &iterations[0], nil
+}
+
+func (c *Client) ListProjectMembers(ctx context.Context, trackerProjectID int64) ([]Person, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_memberships_get
+	// and https://www.pivotaltracker.com/help/api#Paginating_List_Responses
+	var people []Person
+	for offset := 0; ; offset += membershipsPageSize {
+		url := fmt.Sprintf("%s/projects/%d/memberships?limit=%d&offset=%d", baseURL, trackerProjectID, membershipsPageSize, offset)
+		var page []membership
+		if err := c.doJSON(ctx, "list_memberships", "GET", url, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, m := range page {
+			people = append(people, m.Person)
+		}
+		if len(page) < membershipsPageSize {
+			return people, nil
+		}
+	}
+}
+
+func (c *Client) FindStoriesLinkedToGitHubIssue(ctx context.Context, trackerProjectID int64, githubIssueID int) ([]Story, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_integrations_get
+	var integrations []integration
+	url := fmt.Sprintf("%s/projects/%d/integrations", baseURL, trackerProjectID)
+	if err := c.doJSON(ctx, "list_integrations", "GET", url, nil, &integrations); err != nil {
+		return nil, err
+	}
+	externalID := strconv.Itoa(githubIssueID)
+	var linked []Story
+	for _, i := range integrations {
+		if i.Kind != otherIntegrationKind {
+			continue
+		}
+		// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_integrations_integration_id_stories_get
+		var stories []Story
+		url := fmt.Sprintf("%s/projects/%d/integrations/%d/stories", baseURL, trackerProjectID, i.ID)
+		if err := c.doJSON(ctx, "list_integration_stories", "GET", url, nil, &stories); err != nil {
+			return nil, err
+		}
+		for _, story := range stories {
+			if story.ExternalID == externalID {
+				linked = append(linked, story)
+			}
+		}
+	}
+	return linked, nil
+}
+
+func (c *Client) UpdateStory(ctx context.Context, trackerProjectID, trackerStoryID int64, update *StoryUpdate) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_put
+	url := fmt.Sprintf("%s/projects/%d/stories/%d", baseURL, trackerProjectID, trackerStoryID)
+	return c.doJSON(ctx, "update_story", "PUT", url, update, nil)
+}
+
+func (c *Client) AddComment(ctx context.Context, trackerProjectID, trackerStoryID int64, text string) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_comments_post
+	url := fmt.Sprintf("%s/projects/%d/stories/%d/comments", baseURL, trackerProjectID, trackerStoryID)
+	return c.doJSON(ctx, "add_comment", "POST", url, &comment{Text: text}, nil)
+}
+
+func (c *Client) ListTasks(ctx context.Context, trackerProjectID, trackerStoryID int64) ([]Task, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_tasks_get
+	url := fmt.Sprintf("%s/projects/%d/stories/%d/tasks", baseURL, trackerProjectID, trackerStoryID)
+	var tasks []Task
+	if err := c.doJSON(ctx, "list_tasks", "GET", url, nil, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (c *Client) CreateTask(ctx context.Context, trackerProjectID, trackerStoryID int64, task *TaskUpdate) (*Task, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_tasks_post
+	url := fmt.Sprintf("%s/projects/%d/stories/%d/tasks", baseURL, trackerProjectID, trackerStoryID)
+	created := &Task{}
+	if err := c.doJSON(ctx, "create_task", "POST", url, task, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *Client) UpdateTask(ctx context.Context, trackerProjectID, trackerStoryID, trackerTaskID int64, update *TaskUpdate) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_tasks_task_id_put
+	url := fmt.Sprintf("%s/projects/%d/stories/%d/tasks/%d", baseURL, trackerProjectID, trackerStoryID, trackerTaskID)
+	return c.doJSON(ctx, "update_task", "PUT", url, update, nil)
+}
+
+func (c *Client) DeleteTask(ctx context.Context, trackerProjectID, trackerStoryID, trackerTaskID int64) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_tasks_task_id_delete
+	url := fmt.Sprintf("%s/projects/%d/stories/%d/tasks/%d", baseURL, trackerProjectID, trackerStoryID, trackerTaskID)
+	return c.doJSON(ctx, "delete_task", "DELETE", url, nil, nil)
+}
+
+func (c *Client) UploadFile(ctx context.Context, trackerProjectID int64, filename, contentType string, content []byte) (*FileAttachment, error) {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_uploads_post
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Tracker API request: %v", err)
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, fmt.Errorf("could not create Tracker API request: %v", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("could not create Tracker API request: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/projects/%d/uploads", baseURL, trackerProjectID)
+	attachment := &FileAttachment{}
+	if err := c.do(ctx, "upload_file", "POST", url, form.FormDataContentType(), &body, attachment); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+func (c *Client) AddCommentWithAttachments(ctx context.Context, trackerProjectID, trackerStoryID int64, text string, attachments []FileAttachment) error {
+	// See https://www.pivotaltracker.com/help/api/rest/v5#projects_project_id_stories_story_id_comments_post
+	references := make([]attachmentReference, len(attachments))
+	for i, attachment := range attachments {
+		references[i] = attachmentReference{ID: attachment.ID, Type: "file_attachment"}
+	}
+	url := fmt.Sprintf("%s/projects/%d/stories/%d/comments", baseURL, trackerProjectID, trackerStoryID)
+	return c.doJSON(ctx, "add_comment", "POST", url, &comment{Text: text, FileAttachments: references}, nil)
+}
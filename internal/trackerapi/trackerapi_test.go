@@ -2,10 +2,12 @@ package trackerapi
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -169,7 +171,7 @@ func TestTrackerAPIClient(t *testing.T) {
 			})
 
 			subject := New(trackerAPIToken, client)
-			issueID, err := subject.GetGithubIssueIDLinkedToStory(test.trackerProjectID, test.trackerStoryID)
+			issueID, err := subject.GetGithubIssueIDLinkedToStory(context.Background(), test.trackerProjectID, test.trackerStoryID)
 
 			require.True(t, clientMadeRequest)
 			require.Equal(t, test.wantError, err)
@@ -177,3 +179,358 @@ func TestTrackerAPIClient(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(subject TrackerAPI) error
+
+		trackerRequestError   error
+		trackerResponseStatus int
+
+		wantURL   string
+		wantError string
+	}{
+		{
+			name:                  "checking the token succeeds",
+			call:                  func(subject TrackerAPI) error { return subject.CheckToken(context.Background()) },
+			trackerResponseStatus: 200,
+			wantURL:               "https://www.pivotaltracker.com/services/v5/me",
+		},
+		{
+			name:                  "checking the token fails when Tracker rejects it",
+			call:                  func(subject TrackerAPI) error { return subject.CheckToken(context.Background()) },
+			trackerResponseStatus: 403,
+			wantURL:               "https://www.pivotaltracker.com/services/v5/me",
+			wantError:             "Tracker API at https://www.pivotaltracker.com/services/v5/me returned status 403",
+		},
+		{
+			name:                  "checking project access succeeds",
+			call:                  func(subject TrackerAPI) error { return subject.CheckProjectAccess(context.Background(), 12345) },
+			trackerResponseStatus: 200,
+			wantURL:               "https://www.pivotaltracker.com/services/v5/projects/12345",
+		},
+		{
+			name:                  "checking project access fails when the project can't be read",
+			call:                  func(subject TrackerAPI) error { return subject.CheckProjectAccess(context.Background(), 12345) },
+			trackerResponseStatus: 404,
+			wantURL:               "https://www.pivotaltracker.com/services/v5/projects/12345",
+			wantError:             "Tracker API at https://www.pivotaltracker.com/services/v5/projects/12345 returned status 404",
+		},
+		{
+			name:                "checking project access fails when the http call to Tracker fails",
+			call:                func(subject TrackerAPI) error { return subject.CheckProjectAccess(context.Background(), 12345) },
+			trackerRequestError: fmt.Errorf("some http error"),
+			wantURL:             "https://www.pivotaltracker.com/services/v5/projects/12345",
+			wantError:           "Tracker API request failed: Get \"https://www.pivotaltracker.com/services/v5/projects/12345\": some http error",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+				require.Equal(t, "GET", req.Method)
+				require.Equal(t, test.wantURL, req.URL.String())
+				require.Equal(t, "fake-token", req.Header.Get("X-TrackerToken"))
+				if test.trackerRequestError != nil {
+					return nil, test.trackerRequestError
+				}
+				return &http.Response{
+					StatusCode: test.trackerResponseStatus,
+					Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+					Header:     make(http.Header),
+				}, nil
+			})
+
+			err := test.call(New("fake-token", client))
+			if test.wantError != "" {
+				require.EqualError(t, err, test.wantError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestListProjectMembers(t *testing.T) {
+	// A full first page, followed by a partial second page.
+	pages := map[string][]string{}
+	var wantPeople []Person
+	for i := 0; i < membershipsPageSize+2; i++ {
+		person := Person{ID: int64(1000 + i), Name: fmt.Sprintf("Person %d", i), Email: fmt.Sprintf("person%d@example.com", i)}
+		wantPeople = append(wantPeople, person)
+		offset := fmt.Sprint(i / membershipsPageSize * membershipsPageSize)
+		pages[offset] = append(pages[offset], fmt.Sprintf(
+			`{"kind": "project_membership", "role": "member", "person": {"kind": "person", "id": %d, "name": %q, "email": %q}}`,
+			person.ID, person.Name, person.Email))
+	}
+
+	var requestedURLs []string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "GET", req.Method)
+		require.Equal(t, "fake-token", req.Header.Get("X-TrackerToken"))
+		requestedURLs = append(requestedURLs, req.URL.String())
+		body := "[" + strings.Join(pages[req.URL.Query().Get("offset")], ",") + "]"
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}, nil
+	})
+
+	people, err := New("fake-token", client).ListProjectMembers(context.Background(), 12345)
+	require.NoError(t, err)
+	require.Equal(t, wantPeople, people)
+	require.Equal(t, []string{
+		"https://www.pivotaltracker.com/services/v5/projects/12345/memberships?limit=500&offset=0",
+		"https://www.pivotaltracker.com/services/v5/projects/12345/memberships?limit=500&offset=500",
+	}, requestedURLs)
+
+	failing := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 403, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}, nil
+	})
+	_, err = New("fake-token", failing).ListProjectMembers(context.Background(), 12345)
+	require.EqualError(t, err, "Tracker API at https://www.pivotaltracker.com/services/v5/projects/12345/memberships?limit=500&offset=0 returned status 403")
+}
+
+func TestFindStoriesLinkedToGitHubIssue(t *testing.T) {
+	responses := map[string]string{
+		"/services/v5/projects/12345/integrations": `[
+			{"kind": "other_integration", "id": 52033, "name": "GitHub issues"},
+			{"kind": "jira_integration", "id": 52034, "name": "Jira"},
+			{"kind": "other_integration", "id": 52035, "name": "Another repository"}]`,
+		"/services/v5/projects/12345/integrations/52033/stories": `[
+			{"kind": "story", "id": 100, "external_id": "347", "integration_id": 52033, "owner_ids": []},
+			{"kind": "story", "id": 101, "external_id": "348", "integration_id": 52033, "current_state": "started", "owner_ids": [3344177, 1234567]}]`,
+		"/services/v5/projects/12345/integrations/52035/stories": `[
+			{"kind": "story", "id": 102, "external_id": "3480", "integration_id": 52035, "owner_ids": []}]`,
+	}
+	var requestedPaths []string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "GET", req.Method)
+		require.Equal(t, "fake-token", req.Header.Get("X-TrackerToken"))
+		requestedPaths = append(requestedPaths, req.URL.Path)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(responses[req.URL.Path])), Header: make(http.Header)}, nil
+	})
+
+	stories, err := New("fake-token", client).FindStoriesLinkedToGitHubIssue(context.Background(), 12345, 348)
+	require.NoError(t, err)
+	require.Equal(t, []Story{{ID: 101, ExternalID: "348", IntegrationID: 52033, CurrentState: "started", OwnerIDs: []int64{3344177, 1234567}}}, stories)
+	require.Equal(t, []string{
+		"/services/v5/projects/12345/integrations",
+		"/services/v5/projects/12345/integrations/52033/stories",
+		"/services/v5/projects/12345/integrations/52035/stories",
+	}, requestedPaths)
+}
+
+func TestUpdateStory(t *testing.T) {
+	var requestBody string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "PUT", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101", req.URL.String())
+		require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		requestBody = string(body)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"kind": "story", "id": 101}`)), Header: make(http.Header)}, nil
+	})
+
+	err := New("fake-token", client).UpdateStory(context.Background(), 12345, 101, &StoryUpdate{OwnerIDs: &[]int64{3344177}})
+	require.NoError(t, err)
+	require.Equal(t, `{"owner_ids":[3344177]}`, requestBody)
+
+	state := "finished"
+	err = New("fake-token", client).UpdateStory(context.Background(), 12345, 101, &StoryUpdate{CurrentState: &state})
+	require.NoError(t, err)
+	require.Equal(t, `{"current_state":"finished"}`, requestBody)
+
+	estimate, storyType := 0.5, "bug"
+	err = New("fake-token", client).UpdateStory(context.Background(), 12345, 101, &StoryUpdate{StoryType: &storyType, Estimate: &estimate})
+	require.NoError(t, err)
+	require.Equal(t, `{"estimate":0.5,"story_type":"bug"}`, requestBody)
+
+	err = New("fake-token", client).UpdateStory(context.Background(), 12345, 101, &StoryUpdate{Unestimate: true})
+	require.NoError(t, err)
+	require.Equal(t, `{"estimate":null}`, requestBody)
+
+	description := "![screenshot](https://www.pivotaltracker.com/file_attachments/123/download)"
+	err = New("fake-token", client).UpdateStory(context.Background(), 12345, 101, &StoryUpdate{Description: &description})
+	require.NoError(t, err)
+	require.Equal(t, `{"description":"![screenshot](https://www.pivotaltracker.com/file_attachments/123/download)"}`, requestBody)
+}
+
+func TestGetProject(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "GET", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345", req.URL.String())
+		body := `{"kind": "project", "id": 12345, "name": "Pinniped", "point_scale": "0,1,2,4,8", "point_scale_is_custom": false}`
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}, nil
+	})
+
+	project, err := New("fake-token", client).GetProject(context.Background(), 12345)
+	require.NoError(t, err)
+	require.Equal(t, &Project{ID: 12345, PointScale: "0,1,2,4,8"}, project)
+}
+
+func TestAddComment(t *testing.T) {
+	var requestBody string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "POST", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101/comments", req.URL.String())
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		requestBody = string(body)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"kind": "comment", "id": 5}`)), Header: make(http.Header)}, nil
+	})
+
+	err := New("fake-token", client).AddComment(context.Background(), 12345, 101, "GitHub issue #348 was closed by @cfryanr.")
+	require.NoError(t, err)
+	require.Equal(t, `{"text":"GitHub issue #348 was closed by @cfryanr."}`, requestBody)
+}
+
+func TestUploadFile(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "POST", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/uploads", req.URL.String())
+		reader, err := req.MultipartReader()
+		require.NoError(t, err)
+		part, err := reader.NextPart()
+		require.NoError(t, err)
+		require.Equal(t, "file", part.FormName())
+		require.Equal(t, "server.log", part.FileName())
+		require.Equal(t, "text/plain", part.Header.Get("Content-Type"))
+		content, err := ioutil.ReadAll(part)
+		require.NoError(t, err)
+		require.Equal(t, "some logs", string(content))
+		body := `{"kind": "file_attachment", "id": 123, "filename": "server.log", "content_type": "text/plain", "size": 9, "download_url": "/file_attachments/123/download", "uploader_id": 3344177}`
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}, nil
+	})
+
+	attachment, err := New("fake-token", client).UploadFile(context.Background(), 12345, "server.log", "text/plain", []byte("some logs"))
+	require.NoError(t, err)
+	require.Equal(t, &FileAttachment{ID: 123, Filename: "server.log", ContentType: "text/plain", Size: 9, DownloadURL: "/file_attachments/123/download"}, attachment)
+}
+
+func TestAddCommentWithAttachments(t *testing.T) {
+	var requestBody string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "POST", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101/comments", req.URL.String())
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		requestBody = string(body)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"kind": "comment", "id": 5}`)), Header: make(http.Header)}, nil
+	})
+
+	err := New("fake-token", client).AddCommentWithAttachments(context.Background(), 12345, 101, "Copied from GitHub.",
+		[]FileAttachment{{ID: 123, Filename: "server.log"}, {ID: 124, Filename: "screenshot.png"}})
+	require.NoError(t, err)
+	require.Equal(t, `{"text":"Copied from GitHub.","file_attachments":[{"id":123,"type":"file_attachment"},{"id":124,"type":"file_attachment"}]}`, requestBody)
+}
+
+func TestListTasks(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "GET", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101/tasks", req.URL.String())
+		body := `[{"kind": "task", "id": 5, "story_id": 101, "description": "Write the docs", "complete": true, "position": 1}]`
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}, nil
+	})
+
+	tasks, err := New("fake-token", client).ListTasks(context.Background(), 12345, 101)
+	require.NoError(t, err)
+	require.Equal(t, []Task{{ID: 5, StoryID: 101, Description: "Write the docs", Complete: true, Position: 1}}, tasks)
+}
+
+func TestCreateTask(t *testing.T) {
+	var requestBody string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "POST", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101/tasks", req.URL.String())
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		requestBody = string(body)
+		body = []byte(`{"kind": "task", "id": 6, "story_id": 101, "description": "Write the docs", "complete": false, "position": 2}`)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBuffer(body)), Header: make(http.Header)}, nil
+	})
+
+	description, position := "Write the docs", 2
+	task, err := New("fake-token", client).CreateTask(context.Background(), 12345, 101,
+		&TaskUpdate{Description: &description, Position: &position})
+	require.NoError(t, err)
+	require.Equal(t, `{"description":"Write the docs","position":2}`, requestBody)
+	require.Equal(t, &Task{ID: 6, StoryID: 101, Description: "Write the docs", Position: 2}, task)
+}
+
+func TestUpdateTask(t *testing.T) {
+	var requestBody string
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "PUT", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101/tasks/6", req.URL.String())
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		requestBody = string(body)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"kind": "task", "id": 6}`)), Header: make(http.Header)}, nil
+	})
+
+	complete := true
+	err := New("fake-token", client).UpdateTask(context.Background(), 12345, 101, 6, &TaskUpdate{Complete: &complete})
+	require.NoError(t, err)
+	require.Equal(t, `{"complete":true}`, requestBody)
+}
+
+func TestDeleteTask(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "DELETE", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/12345/stories/101/tasks/6", req.URL.String())
+		return &http.Response{StatusCode: 204, Body: ioutil.NopCloser(bytes.NewBufferString("")), Header: make(http.Header)}, nil
+	})
+
+	require.NoError(t, New("fake-token", client).DeleteTask(context.Background(), 12345, 101, 6))
+}
+
+func TestGetAuthenticatedPerson(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "GET", req.Method)
+		require.Equal(t, "https://www.pivotaltracker.com/services/v5/me", req.URL.String())
+		body := `{"kind": "me", "id": 3344177, "name": "Issues2Stories Bot", "initials": "IB", "username": "issues2stories", "email": "bot@example.com", "projects": []}`
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}, nil
+	})
+
+	person, err := New("fake-token", client).GetAuthenticatedPerson(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &Person{ID: 3344177, Name: "Issues2Stories Bot", Email: "bot@example.com", Initials: "IB", Username: "issues2stories"}, person)
+}
+
+func TestGetCurrentIteration(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantIteration *Iteration
+		wantError     string
+	}{
+		{
+			name:          "returns the current iteration",
+			body:          `[{"kind": "iteration", "number": 12, "project_id": 2453999, "start": "2021-02-01T08:00:00Z", "finish": "2021-02-08T08:00:00Z", "story_ids": [176755643, 176755644]}]`,
+			wantIteration: &Iteration{Number: 12, Start: "2021-02-01T08:00:00Z", Finish: "2021-02-08T08:00:00Z", StoryIDs: []int64{176755643, 176755644}},
+		},
+		{
+			name:      "no current iteration is an error",
+			body:      `[]`,
+			wantError: "Tracker API at https://www.pivotaltracker.com/services/v5/projects/2453999/iterations?scope=current&fields=number,start,finish,story_ids returned no current iteration",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := NewTestClient(func(req *http.Request) (*http.Response, error) {
+				require.Equal(t, "GET", req.Method)
+				require.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/2453999/iterations?scope=current&fields=number,start,finish,story_ids", req.URL.String())
+				return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(test.body)), Header: make(http.Header)}, nil
+			})
+
+			iteration, err := New("fake-token", client).GetCurrentIteration(context.Background(), 2453999)
+			if test.wantError != "" {
+				require.EqualError(t, err, test.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantIteration, iteration)
+			require.True(t, iteration.Contains(176755644))
+			require.False(t, iteration.Contains(176755645))
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package trackerimport
+
+import "issues2stories/internal/metrics"
+
+var (
+	importRequests = metrics.NewCounterVec(
+		"issues2stories_tracker_import_requests_total",
+		"Tracker import API requests, by outcome.",
+		"outcome")
+
+	importDuration = metrics.NewHistogramVec(
+		"issues2stories_tracker_import_duration_seconds",
+		"Time taken to respond to successful Tracker import API requests.",
+		metrics.DefaultBuckets)
+
+	importIssues = metrics.NewGaugeVec(
+		"issues2stories_tracker_import_issues",
+		"The number of open issues returned by the most recent successful Tracker import API request.")
+)
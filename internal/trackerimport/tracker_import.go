@@ -3,21 +3,33 @@ package trackerimport
 import (
 	"encoding/xml"
 	"fmt"
-	"log"
 	"net/http"
+	"time"
 
 	"issues2stories/internal/config"
 	"issues2stories/internal/githubapi"
 	"issues2stories/internal/importtypes"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/trackerapi"
+	"issues2stories/internal/translate"
 )
 
 type handler struct {
-	gitHubClient githubapi.GitHubAPI
-	credentials  *config.BasicAuthCredentials
+	trackerAPI    trackerapi.TrackerAPI
+	gitHubClient  githubapi.GitHubAPI
+	repositoryURL string
+	configuration config.Provider
+	credentials   config.Authenticator
 }
 
-func NewHandler(gitHubClient githubapi.GitHubAPI, credentials *config.BasicAuthCredentials) http.Handler {
-	return &handler{gitHubClient: gitHubClient, credentials: credentials}
+func NewHandler(trackerAPI trackerapi.TrackerAPI, gitHubClient githubapi.GitHubAPI, gitHubOrg, gitHubRepo string, configuration config.Provider, credentials config.Authenticator) http.Handler {
+	return &handler{
+		trackerAPI:    trackerAPI,
+		gitHubClient:  gitHubClient,
+		repositoryURL: "https://github.com/" + gitHubOrg + "/" + gitHubRepo,
+		configuration: configuration,
+		credentials:   credentials,
+	}
 }
 
 // This endpoint implements Tracker's "Import API URL" specification.
@@ -30,22 +42,30 @@ func NewHandler(gitHubClient githubapi.GitHubAPI, credentials *config.BasicAuthC
 // which have a very, very large number of open issues. GitHub paginates API results, so
 // we need to make an API call to GitHub per 100 issues, adding latency.
 func (h *handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := logging.FromContext(request.Context())
+	start := time.Now()
+
 	if request.Method != "GET" {
 		msg := fmt.Sprintf("Request method is not supported: %s", request.Method)
-		log.Print(msg)
+		logger.Warn(msg)
+		importRequests.WithLabelValues("method_not_allowed").Inc()
 		http.Error(responseWriter, msg, http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !h.credentials.Matches(request) {
-		log.Print("Rejecting request due to bad credentials.")
+	credentialLabel, err := h.credentials.Authenticate(request)
+	if err != nil {
+		logger.Warn("Rejecting request due to bad credentials.", "error", err)
+		importRequests.WithLabelValues("unauthorized").Inc()
 		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	logger = logger.With("credential_label", credentialLabel)
 
 	issues, err := h.gitHubClient.ListAllOpenIssuesForRepoInImportFormat(request.Context())
 	if err != nil {
-		log.Printf("tracker_import: error getting issues from GitHub API: %v", err)
+		logger.Error("tracker_import: error getting issues from GitHub API", "error", err)
+		importRequests.WithLabelValues("github_error").Inc()
 		http.Error(responseWriter, "failed to get issues from GitHub API", http.StatusBadGateway)
 		return
 	}
@@ -53,7 +73,7 @@ func (h *handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	issuesWithPRsRemoved := make([]importtypes.Issue, 0)
 	for _, issue := range issues {
 		if issue.PullRequest == nil {
-			log.Printf("tracker_import: saw issue #%d: %s", issue.Number, issue.Title)
+			logger.Debug("tracker_import: saw issue", "issue", issue.Number, "title", issue.Title)
 			issue.RequestedBy = issue.User.Login // promote this field to top-level for xml output
 			if issue.HasLabel("bug") {
 				issue.StoryType = "bug"
@@ -64,16 +84,48 @@ func (h *handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		}
 	}
 
+	h.translateIssues(request, logger, issuesWithPRsRemoved)
+
+	logger.Info("tracker_import: returning open issues", "issue_count", len(issuesWithPRsRemoved))
+
 	xmlIssues := importtypes.IssueList{Issues: issuesWithPRsRemoved}
 	xmlIssues.XMLTypeAttr = "array" // Tracker docs say that this element should be annotated with type="array"
 
 	out, err := xml.MarshalIndent(xmlIssues, " ", "  ")
 	if err != nil {
-		log.Printf("tracker_import: error serializing issues to XML: %v", err)
+		logger.Error("tracker_import: error serializing issues to XML", "error", err)
+		importRequests.WithLabelValues("error").Inc()
 		http.Error(responseWriter, "error serializing issues to XML", http.StatusInternalServerError)
 		return
 	}
 
 	responseWriter.Write([]byte(xml.Header))
 	responseWriter.Write(out)
+
+	importRequests.WithLabelValues("ok").Inc()
+	importIssues.WithLabelValues().Set(float64(len(issuesWithPRsRemoved)))
+	importDuration.WithLabelValues().Observe(time.Since(start).Seconds())
+}
+
+// Translate the issues' titles and bodies for Tracker, where they become the stories' names and descriptions. The
+// import request doesn't say which Tracker project is importing, so mentions are translated using the members of the
+// bound projects.
+func (h *handler) translateIssues(request *http.Request, logger *logging.Logger, issues []importtypes.Issue) {
+	configuration := h.configuration.Current()
+	projectIDs := make([]int64, len(configuration.Bindings))
+	for i, binding := range configuration.Bindings {
+		projectIDs[i] = binding.TrackerProjectID
+	}
+	texts := make([]string, 0, 2*len(issues))
+	for _, issue := range issues {
+		texts = append(texts, issue.Title, issue.Body)
+	}
+	translator, err := translate.ForProjects(request.Context(), h.trackerAPI, configuration.UserIDMapping, h.repositoryURL, projectIDs, texts...)
+	if err != nil {
+		logger.Warn("tracker_import: could not list the Tracker projects' members, so mentions won't be translated", "error", err)
+	}
+	for i := range issues {
+		issues[i].Title = translator.TitleToTracker(issues[i].Title)
+		issues[i].Body = translator.ToTracker(issues[i].Body)
+	}
 }
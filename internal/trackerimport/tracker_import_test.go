@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"issues2stories/internal/config"
 	"issues2stories/internal/githubapi"
 	"issues2stories/internal/importtypes"
+	"issues2stories/internal/trackerapi"
 )
 
 func readFixture(t *testing.T, name string) string {
@@ -71,7 +73,51 @@ func (f *fakeGitHubAPI) ListAllOpenIssuesForRepoInImportFormat(_ context.Context
 	return f.listIssues.returns.issueLists[thisCall], nil
 }
 
+func (f *fakeGitHubAPI) CheckRepoAccess(_ context.Context) error {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) FindUsersByEmail(_ context.Context, _ string) ([]string, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) ListCommitAuthors(_ context.Context, _ int) ([]githubapi.CommitAuthor, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) GetAuthenticatedUser(_ context.Context) (string, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) DownloadAttachment(_ context.Context, _ string, _ int64) (*githubapi.Attachment, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) CreateComment(_ context.Context, _ int, _ string) (int64, error) {
+	panic("not used by the test subject")
+}
+
+func (f *fakeGitHubAPI) EditComment(_ context.Context, _ int64, _ string) error {
+	panic("not used by the test subject")
+}
+
+// Lists the members of each Tracker project. Other methods are not used by the test subject.
+type fakeTrackerAPI struct {
+	trackerapi.TrackerAPI
+
+	members map[int64][]trackerapi.Person
+}
+
+func (f *fakeTrackerAPI) ListProjectMembers(_ context.Context, trackerProjectID int64) ([]trackerapi.Person, error) {
+	return f.members[trackerProjectID], nil
+}
+
 func TestHandleTrackerImport(t *testing.T) {
+	configuration := &config.Config{
+		Bindings:      []config.Binding{{Name: "pinniped", TrackerProjectID: 2453999}},
+		UserIDMapping: map[int64]string{1234567: "enj"},
+	}
+
 	tests := []struct {
 		name string
 
@@ -145,6 +191,30 @@ func TestHandleTrackerImport(t *testing.T) {
 			wantContentType: "text/xml; charset=utf-8",
 			wantBody:        strings.TrimSpace(readFixture(t, "expected_tracker_import_response_body1.xml")),
 		},
+		{
+			name:        "the mentions in issue titles are translated for Tracker",
+			requestAuth: &config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"},
+			gitHubListIssuesReturns: &fakeGitHubListIssuesReturnValues{
+				issueLists: [][]importtypes.Issue{{
+					{Number: 42, Title: "Pair with @enj on #41", Body: "See #41.", User: importtypes.User{Login: "enj"}},
+				}},
+			},
+			wantGitHubListIssuesInvocations: &fakeGitHubListIssuesActivity{
+				invocations: 1,
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/xml; charset=utf-8",
+			wantBody: xml.Header + ` <external_stories type="array">
+   <external_story>
+     <external_id>42</external_id>
+     <name>Pair with @mo on #41</name>
+     <description>See [#41](https://github.com/vmware-tanzu/pinniped/issues/41).</description>
+     <requested_by>enj</requested_by>
+     <story_type>feature</story_type>
+     <created_at>0001-01-01T00:00:00Z</created_at>
+   </external_story>
+ </external_stories>`,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -164,7 +234,11 @@ func TestHandleTrackerImport(t *testing.T) {
 
 			configuredAuth := &config.BasicAuthCredentials{Username: "correct-username", Password: "correct-password"}
 
-			subject := NewHandler(&gitHubAPI, configuredAuth)
+			trackerAPI := &fakeTrackerAPI{
+				members: map[int64][]trackerapi.Person{2453999: {{ID: 1234567, Name: "Mo Khan", Initials: "MK", Username: "mo"}}},
+			}
+
+			subject := NewHandler(trackerAPI, &gitHubAPI, "vmware-tanzu", "pinniped", configuration, configuredAuth)
 
 			req := httptest.NewRequest(test.method, "/some/path", nil)
 			if test.requestAuth != nil {
@@ -0,0 +1,262 @@
+// Package translate rewrites Markdown text which is copied between Tracker and GitHub, so that its mentions and
+// references still point at the right people and things in the other system.
+package translate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"issues2stories/internal/trackerapi"
+)
+
+// Someone who can be mentioned. Any of the fields may be empty.
+type Person struct {
+	Name            string
+	TrackerUsername string
+	TrackerInitials string
+	GitHubLogin     string
+}
+
+// Returns the Tracker project members as people, with their GitHub logins from the user ID mapping.
+func People(members []trackerapi.Person, userIDMapping map[int64]string) []Person {
+	people := make([]Person, len(members))
+	for i, member := range members {
+		people[i] = Person{
+			Name:            member.Name,
+			TrackerUsername: member.Username,
+			TrackerInitials: member.Initials,
+			GitHubLogin:     userIDMapping[member.ID],
+		}
+	}
+	return people
+}
+
+// A Translator rewrites text for the other system:
+//
+// Mentions of people who are known in both systems are rewritten to mention them in the other system. Other
+// mentions are rewritten to the person's name, or else to inline code, so that nobody in the other system who
+// happens to have the same handle is notified.
+//
+// References like #123 mean a story in Tracker and an issue in GitHub, so they are rewritten to links to the
+// story or issue.
+//
+// Fenced code blocks and inline code are left unchanged.
+type Translator struct {
+	// The URL of the GitHub repository which references like #123 in GitHub text refer to, e.g.
+	// "https://github.com/org/repo".
+	GitHubRepoURL string
+
+	People []Person
+}
+
+// Returns a translator for text which is copied from or to the Tracker projects. The projects' members are only
+// listed when one of the texts may mention someone. When they can't be listed, the translator is returned with the
+// error, and it treats every mention as unknown.
+func ForProjects(ctx context.Context, tracker trackerapi.TrackerAPI, userIDMapping map[int64]string, gitHubRepoURL string,
+	trackerProjectIDs []int64, texts ...string) (*Translator, error) {
+	translator := &Translator{GitHubRepoURL: gitHubRepoURL}
+	if !mayMention(texts) {
+		return translator, nil
+	}
+	listed := map[int64]bool{}
+	for _, projectID := range trackerProjectIDs {
+		if listed[projectID] {
+			continue
+		}
+		listed[projectID] = true
+		members, err := tracker.ListProjectMembers(ctx, projectID)
+		if err != nil {
+			return &Translator{GitHubRepoURL: gitHubRepoURL}, err
+		}
+		translator.People = append(translator.People, People(members, userIDMapping)...)
+	}
+	return translator, nil
+}
+
+func mayMention(texts []string) bool {
+	for _, text := range texts {
+		if strings.Contains(text, "@") {
+			return true
+		}
+	}
+	return false
+}
+
+// Mentions and references must not follow characters which would make them part of a word, an email address, a
+// URL, an HTML entity or a link's text.
+const notAfter = `(^|[^\w@/.&#\[\]-])`
+
+var (
+	// Tracker usernames may contain dots, but not at the end, where the dot usually ends a sentence.
+	trackerMentionPattern = regexp.MustCompile(notAfter + `@([A-Za-z0-9_](?:[A-Za-z0-9_.-]*[A-Za-z0-9_])?)`)
+
+	// GitHub logins have single hyphens between letters and digits. A team is mentioned as @org/team.
+	gitHubMentionPattern = regexp.MustCompile(notAfter + `@([A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?(?:/[A-Za-z0-9_-]+)?)`)
+
+	// Tracker story IDs have at least eight digits, so shorter numbers, e.g. "step #2", are not story references.
+	storyReferencePattern = regexp.MustCompile(notAfter + `#(\d{8,})\b`)
+
+	// Issues can also be referenced in another repository, as owner/repo#123.
+	issueReferencePattern = regexp.MustCompile(notAfter + `(?:([A-Za-z0-9][\w.-]*/[\w.-]+))?#(\d+)\b`)
+)
+
+// Returns the Tracker text rewritten for GitHub.
+func (t *Translator) ToGitHub(text string) string {
+	return outsideCode(text, func(s string) string {
+		s = replaceMentions(s, trackerMentionPattern, t.trackerPerson, gitHubLogin, inlineCode)
+		return storyReferencePattern.ReplaceAllString(s, "${1}[#${2}](https://www.pivotaltracker.com/story/show/${2})")
+	})
+}
+
+// Returns the title of a Tracker story rewritten for its GitHub issue. Titles are plain text, so only the mentions
+// of people who are known in both systems are rewritten, and other mentions and references are left unchanged.
+func (t *Translator) TitleToGitHub(title string) string {
+	return replaceMentions(title, trackerMentionPattern, t.trackerPerson, gitHubLogin, unchanged)
+}
+
+// Returns the GitHub text rewritten for Tracker.
+func (t *Translator) ToTracker(text string) string {
+	return outsideCode(text, func(s string) string {
+		s = replaceMentions(s, gitHubMentionPattern, t.gitHubPerson, trackerUsername, inlineCode)
+		return issueReferencePattern.ReplaceAllStringFunc(s, func(match string) string {
+			parts := issueReferencePattern.FindStringSubmatch(match)
+			prefix, repo, number := parts[1], parts[2], parts[3]
+			repoURL := t.GitHubRepoURL
+			if repo != "" {
+				repoURL = "https://github.com/" + repo
+			}
+			if repoURL == "" {
+				return match
+			}
+			return fmt.Sprintf("%s[%s#%s](%s/issues/%s)", prefix, repo, number, repoURL, number)
+		})
+	})
+}
+
+// Returns the title of a GitHub issue rewritten for its Tracker story, like TitleToGitHub.
+func (t *Translator) TitleToTracker(title string) string {
+	return replaceMentions(title, gitHubMentionPattern, t.gitHubPerson, trackerUsername, unchanged)
+}
+
+// Returns the person with the Tracker username or initials.
+func (t *Translator) trackerPerson(handle string) (Person, bool) {
+	for _, person := range t.People {
+		if strings.EqualFold(person.TrackerUsername, handle) || strings.EqualFold(person.TrackerInitials, handle) {
+			return person, true
+		}
+	}
+	return Person{}, false
+}
+
+// Returns the person with the GitHub login.
+func (t *Translator) gitHubPerson(handle string) (Person, bool) {
+	for _, person := range t.People {
+		if person.GitHubLogin != "" && strings.EqualFold(person.GitHubLogin, handle) {
+			return person, true
+		}
+	}
+	return Person{}, false
+}
+
+func gitHubLogin(person Person) string { return person.GitHubLogin }
+
+func trackerUsername(person Person) string { return person.TrackerUsername }
+
+// Unknown mentions in Markdown become inline code, so that they don't notify anyone.
+func inlineCode(handle string) string { return "`@" + handle + "`" }
+
+// Unknown mentions in titles are left as they are, because titles don't notify anyone, and Tracker doesn't render
+// inline code in them.
+func unchanged(handle string) string { return "@" + handle }
+
+// Rewrites each mention which matches the pattern. The handle of a person who is known in the other system is
+// replaced with their handle there, or else with their name, and other mentions are rewritten by unknown.
+func replaceMentions(text string, pattern *regexp.Regexp, find func(handle string) (Person, bool), otherHandle func(Person) string,
+	unknown func(handle string) string) string {
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := pattern.FindStringSubmatch(match)
+		prefix, handle := parts[1], parts[2]
+		person, ok := find(handle)
+		switch {
+		case ok && otherHandle(person) != "":
+			return prefix + "@" + otherHandle(person)
+		case ok && person.Name != "":
+			return prefix + person.Name
+		default:
+			return prefix + unknown(handle)
+		}
+	})
+}
+
+// A line which opens or closes a fenced code block.
+var fencePattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+
+// Applies the translation to the parts of the Markdown text which are not code.
+func outsideCode(text string, translate func(string) string) string {
+	var result strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		match := fencePattern.FindStringSubmatch(line)
+		switch {
+		case fence == "" && match != nil:
+			fence = match[1]
+			result.WriteString(line)
+		case fence != "":
+			// The closing fence is at least as long as the opening one, and is made of the same character.
+			if match != nil && strings.HasPrefix(match[1], fence) && strings.TrimSpace(line) == match[1] {
+				fence = ""
+			}
+			result.WriteString(line)
+		default:
+			result.WriteString(outsideInlineCode(line, translate))
+		}
+	}
+	return result.String()
+}
+
+// Applies the translation to the parts of the line which are not inline code. Inline code starts with a run of
+// backticks and ends with a run of the same length.
+func outsideInlineCode(line string, translate func(string) string) string {
+	var result strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			break
+		}
+		length := backticksAt(line, start)
+		end := -1
+		for i := start + length; i < len(line); {
+			if line[i] != '`' {
+				i++
+				continue
+			}
+			if n := backticksAt(line, i); n == length {
+				end = i
+				break
+			} else {
+				i += n
+			}
+		}
+		if end < 0 {
+			// The backticks are not inline code.
+			result.WriteString(translate(line[:start+length]))
+			line = line[start+length:]
+			continue
+		}
+		result.WriteString(translate(line[:start]))
+		result.WriteString(line[start : end+length])
+		line = line[end+length:]
+	}
+	result.WriteString(translate(line))
+	return result.String()
+}
+
+func backticksAt(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+	return n
+}
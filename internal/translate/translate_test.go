@@ -0,0 +1,216 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/trackerapi"
+)
+
+var people = []Person{
+	{Name: "Ryan Richard", TrackerUsername: "ryan", TrackerInitials: "RR", GitHubLogin: "cfryanr"},
+	{Name: "Mo Khan", TrackerUsername: "mo.khan", TrackerInitials: "MK", GitHubLogin: "enj"},
+	{Name: "Tracker Only", TrackerUsername: "tracker_only", TrackerInitials: "TO"},
+}
+
+func TestToGitHub(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "mentions by username or initials become GitHub mentions",
+			text: "@ryan and @MK, please review.",
+			want: "@cfryanr and @enj, please review.",
+		},
+		{
+			name: "a dot after a mention ends the sentence",
+			text: "Thanks @mo.khan.",
+			want: "Thanks @enj.",
+		},
+		{
+			name: "people without a GitHub login are named instead of mentioned",
+			text: "Ask @tracker_only",
+			want: "Ask Tracker Only",
+		},
+		{
+			name: "unknown mentions don't notify anyone",
+			text: "cc @stranger",
+			want: "cc `@stranger`",
+		},
+		{
+			name: "email addresses are not mentions",
+			text: "mail ryan@example.com",
+			want: "mail ryan@example.com",
+		},
+		{
+			name: "story references become links to the stories",
+			text: "Blocked by #176858614.",
+			want: "Blocked by [#176858614](https://www.pivotaltracker.com/story/show/176858614).",
+		},
+		{
+			name: "numbers which are too short to be story IDs are not story references",
+			text: "Step #2 of 3, see #1234567 and #12345678x.",
+			want: "Step #2 of 3, see #1234567 and #12345678x.",
+		},
+		{
+			name: "links and HTML entities are not references",
+			text: "See [#176858614](https://example.com/#176858615) and &#39;",
+			want: "See [#176858614](https://example.com/#176858615) and &#39;",
+		},
+		{
+			name: "inline code is unchanged",
+			text: "Run `npm i @ryan/pkg #176858614` for #176858614 and ``a ` @ryan``",
+			want: "Run `npm i @ryan/pkg #176858614` for [#176858614](https://www.pivotaltracker.com/story/show/176858614) and ``a ` @ryan``",
+		},
+		{
+			name: "fenced code blocks are unchanged",
+			text: "@ryan:\n```go\n// @ryan #12\n```\n~~~~\n@ryan\n~~~\n~~~~\n@ryan\n",
+			want: "@cfryanr:\n```go\n// @ryan #12\n```\n~~~~\n@ryan\n~~~\n~~~~\n@cfryanr\n",
+		},
+		{
+			name: "Windows line endings are kept",
+			text: "```\r\n@ryan\r\n```\r\n@ryan\r\n",
+			want: "```\r\n@ryan\r\n```\r\n@cfryanr\r\n",
+		},
+		{
+			name: "unclosed backticks are not code",
+			text: "a ` @ryan",
+			want: "a ` @cfryanr",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			translator := &Translator{GitHubRepoURL: "https://github.com/org/repo", People: people}
+			require.Equal(t, test.want, translator.ToGitHub(test.text))
+		})
+	}
+}
+
+func TestToTracker(t *testing.T) {
+	tests := []struct {
+		name         string
+		noRepository bool
+		text         string
+		want         string
+	}{
+		{
+			name: "mentions of mapped users become Tracker mentions",
+			text: "@cfryanr and @ENJ, please review.",
+			want: "@ryan and @mo.khan, please review.",
+		},
+		{
+			name: "unmapped users and teams don't notify anyone",
+			text: "cc @outside-contributor and @org/maintainers.",
+			want: "cc `@outside-contributor` and `@org/maintainers`.",
+		},
+		{
+			name: "issue references become links to the issues",
+			text: "Fixes #339, and other/repo#7.",
+			want: "Fixes [#339](https://github.com/org/repo/issues/339), and [other/repo#7](https://github.com/other/repo/issues/7).",
+		},
+		{
+			name:         "without a repository, only references to other repositories become links",
+			noRepository: true,
+			text:         "Fixes #339 and other/repo#7.",
+			want:         "Fixes #339 and [other/repo#7](https://github.com/other/repo/issues/7).",
+		},
+		{
+			name: "URLs are not references",
+			text: "https://github.com/org/repo/pull/3#issuecomment-1 and https://example.com/a/b#12",
+			want: "https://github.com/org/repo/pull/3#issuecomment-1 and https://example.com/a/b#12",
+		},
+		{
+			name: "code is unchanged",
+			text: "`@cfryanr #1`\n```\n@cfryanr #1\n```\n",
+			want: "`@cfryanr #1`\n```\n@cfryanr #1\n```\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			translator := &Translator{GitHubRepoURL: "https://github.com/org/repo", People: people}
+			if test.noRepository {
+				translator.GitHubRepoURL = ""
+			}
+			require.Equal(t, test.want, translator.ToTracker(test.text))
+		})
+	}
+}
+
+func TestTitles(t *testing.T) {
+	translator := &Translator{GitHubRepoURL: "https://github.com/org/repo", People: people}
+
+	require.Equal(t, "Pair with @cfryanr and Tracker Only on #176651069 and @someone",
+		translator.TitleToGitHub("Pair with @RR and @tracker_only on #176651069 and @someone"))
+	require.Equal(t, "Pair with @mo.khan on #339 and @outside-contributor",
+		translator.TitleToTracker("Pair with @enj on #339 and @outside-contributor"))
+}
+
+type fakeTrackerAPI struct {
+	trackerapi.TrackerAPI
+
+	members      map[int64][]trackerapi.Person
+	membersError error
+	listed       []int64
+}
+
+func (f *fakeTrackerAPI) ListProjectMembers(_ context.Context, trackerProjectID int64) ([]trackerapi.Person, error) {
+	f.listed = append(f.listed, trackerProjectID)
+	return f.members[trackerProjectID], f.membersError
+}
+
+func TestForProjects(t *testing.T) {
+	members := map[int64][]trackerapi.Person{
+		1: {{ID: 11, Name: "Ryan Richard", Initials: "RR", Username: "ryan"}},
+		2: {{ID: 22, Name: "Mo Khan", Initials: "MK", Username: "mo"}},
+	}
+	mapping := map[int64]string{11: "cfryanr"}
+
+	tests := []struct {
+		name         string
+		texts        []string
+		membersError error
+		wantListed   []int64
+		wantPeople   []Person
+		wantError    string
+	}{
+		{
+			name:       "members of each project are listed once",
+			texts:      []string{"no mentions", "cc @cfryanr"},
+			wantListed: []int64{1, 2},
+			wantPeople: []Person{
+				{Name: "Ryan Richard", TrackerUsername: "ryan", TrackerInitials: "RR", GitHubLogin: "cfryanr"},
+				{Name: "Mo Khan", TrackerUsername: "mo", TrackerInitials: "MK"},
+			},
+		},
+		{
+			name:  "members are not listed when the texts can't mention anyone",
+			texts: []string{"no mentions", "#12"},
+		},
+		{
+			name:         "when members can't be listed, nobody is known",
+			texts:        []string{"@ryan"},
+			membersError: errors.New("Tracker is down"),
+			wantListed:   []int64{1},
+			wantError:    "Tracker is down",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := &fakeTrackerAPI{members: members, membersError: test.membersError}
+			translator, err := ForProjects(context.Background(), tracker, mapping, "https://github.com/org/repo",
+				[]int64{1, 2, 1}, test.texts...)
+			if test.wantError != "" {
+				require.EqualError(t, err, test.wantError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.wantListed, tracker.listed)
+			require.Equal(t, test.wantPeople, translator.People)
+			require.Equal(t, "https://github.com/org/repo", translator.GitHubRepoURL)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package usermapping
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/trackerapi"
+)
+
+// How confident a Matcher is that a GitHub user is the same person as a Tracker user.
+const (
+	// The GitHub profile shows the Tracker user's email address, which GitHub has verified.
+	High = "high"
+
+	// Commits in the repository by the Tracker user's email address are linked to the GitHub user.
+	Medium = "medium"
+
+	// The Tracker user's name or username is the same as a commit author's.
+	Low = "low"
+)
+
+var confidenceRanks = map[string]int{High: 3, Medium: 2, Low: 1}
+
+// Returns true when the text is one of the confidences, i.e. high, medium or low.
+func ValidConfidence(text string) bool {
+	return confidenceRanks[text] > 0
+}
+
+// Returns true when the confidence is at least the minimum confidence. No confidence, e.g. for a Match which
+// found no GitHub user, is never enough.
+func AtLeast(confidence, minConfidence string) bool {
+	return confidenceRanks[confidence] > 0 && confidenceRanks[confidence] >= confidenceRanks[minConfidence]
+}
+
+// A Match is the GitHub user which a Matcher proposes for a Tracker user, and why.
+type Match struct {
+	Person trackerapi.Person
+
+	// Both are empty when no GitHub user was found.
+	GitHubUsername string
+	Confidence     string
+
+	// Explains how the GitHub user was found, or why none was found.
+	Note string
+}
+
+// A Matcher finds the GitHub users of Tracker users. It tries the verified email addresses on GitHub profiles
+// first, then the email addresses of the repository's commit authors, and then their names.
+type Matcher struct {
+	gitHub        githubapi.GitHubAPI
+	commitAuthors []githubapi.CommitAuthor
+}
+
+// Returns a Matcher which compares Tracker users to the authors of up to maxCommits of the repository's most recent
+// commits, as well as searching GitHub users.
+func NewMatcher(ctx context.Context, gitHub githubapi.GitHubAPI, maxCommits int) (*Matcher, error) {
+	commitAuthors, err := gitHub.ListCommitAuthors(ctx, maxCommits)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the repository's commit authors: %w", err)
+	}
+	return &Matcher{gitHub: gitHub, commitAuthors: commitAuthors}, nil
+}
+
+func (m *Matcher) Match(ctx context.Context, person trackerapi.Person) Match {
+	var notes []string
+	if person.Email != "" {
+		logins, err := m.gitHub.FindUsersByEmail(ctx, person.Email)
+		switch {
+		case err != nil:
+			notes = append(notes, fmt.Sprintf("could not search GitHub users by email: %v", err))
+		case len(logins) == 1:
+			return Match{Person: person, GitHubUsername: logins[0], Confidence: High,
+				Note: fmt.Sprintf("the GitHub profile shows the Tracker email address %s", person.Email)}
+		case len(logins) > 1:
+			notes = append(notes, fmt.Sprintf("several GitHub profiles show the Tracker email address: %s", strings.Join(logins, ", ")))
+		}
+
+		logins = m.commitAuthorLogins(func(author githubapi.CommitAuthor) bool {
+			return strings.EqualFold(author.Email, person.Email)
+		})
+		switch {
+		case len(logins) == 1:
+			return Match{Person: person, GitHubUsername: logins[0], Confidence: Medium,
+				Note: fmt.Sprintf("commits in the repository by %s are linked to the GitHub user", person.Email)}
+		case len(logins) > 1:
+			notes = append(notes, fmt.Sprintf("commits by the Tracker email address are linked to several GitHub users: %s", strings.Join(logins, ", ")))
+		}
+	}
+
+	if name := normalizeName(person.Name); name != "" {
+		logins := m.commitAuthorLogins(func(author githubapi.CommitAuthor) bool {
+			return normalizeName(author.Name) == name
+		})
+		switch {
+		case len(logins) == 1:
+			return Match{Person: person, GitHubUsername: logins[0], Confidence: Low,
+				Note: fmt.Sprintf("the Tracker name %q is the name of a commit author in the repository", person.Name)}
+		case len(logins) > 1:
+			notes = append(notes, fmt.Sprintf("several commit authors are named %q: %s", person.Name, strings.Join(logins, ", ")))
+		}
+	}
+
+	if person.Username != "" {
+		logins := m.commitAuthorLogins(func(author githubapi.CommitAuthor) bool {
+			return strings.EqualFold(author.Login, person.Username)
+		})
+		if len(logins) == 1 {
+			return Match{Person: person, GitHubUsername: logins[0], Confidence: Low,
+				Note: fmt.Sprintf("the Tracker username %q is the GitHub login of a commit author in the repository", person.Username)}
+		}
+	}
+
+	if len(notes) == 0 {
+		notes = append(notes, "no GitHub user found")
+	}
+	return Match{Person: person, Note: strings.Join(notes, "; ")}
+}
+
+// Returns the distinct, sorted GitHub logins of the commit authors which match.
+func (m *Matcher) commitAuthorLogins(matches func(githubapi.CommitAuthor) bool) []string {
+	seen := map[string]bool{}
+	var logins []string
+	for _, author := range m.commitAuthors {
+		if author.Login == "" || seen[author.Login] || !matches(author) {
+			continue
+		}
+		seen[author.Login] = true
+		logins = append(logins, author.Login)
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// Lower cases the name, and removes punctuation and extra spaces, e.g. "Ryan  Richard." becomes "ryan richard".
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,127 @@
+package usermapping
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/trackerapi"
+)
+
+// Only implements the methods used by the Matcher.
+type fakeGitHubAPI struct {
+	githubapi.GitHubAPI
+
+	usersByEmail            map[string][]string
+	searchErr               error
+	commitAuthors           []githubapi.CommitAuthor
+	listCommitAuthorsCalls  int
+	findUsersByEmailQueries []string
+}
+
+func (f *fakeGitHubAPI) FindUsersByEmail(_ context.Context, email string) ([]string, error) {
+	f.findUsersByEmailQueries = append(f.findUsersByEmailQueries, email)
+	return f.usersByEmail[email], f.searchErr
+}
+
+func (f *fakeGitHubAPI) ListCommitAuthors(_ context.Context, maxCommits int) ([]githubapi.CommitAuthor, error) {
+	f.listCommitAuthorsCalls++
+	if len(f.commitAuthors) > maxCommits {
+		return f.commitAuthors[:maxCommits], nil
+	}
+	return f.commitAuthors, nil
+}
+
+func TestMatch(t *testing.T) {
+	commitAuthors := []githubapi.CommitAuthor{
+		{Login: "cfryanr", Name: "Ryan Richard", Email: "ryan@work.example.com"},
+		{Login: "", Name: "Unlinked Author", Email: "unlinked@example.com"},
+		{Login: "twin-a", Name: "Pat Smith", Email: "pat.a@example.com"},
+		{Login: "twin-b", Name: "Pat Smith", Email: "pat.b@example.com"},
+		{Login: "shared-1", Name: "Shared One", Email: "team@example.com"},
+		{Login: "shared-2", Name: "Shared Two", Email: "team@example.com"},
+		{Login: "jdoe", Name: "Jane Q. Doe", Email: "jane@personal.example.com"},
+		{Login: "hacker42", Name: "Someone Else", Email: "someone@example.com"},
+	}
+	tests := []struct {
+		name         string
+		person       trackerapi.Person
+		usersByEmail map[string][]string
+		searchErr    error
+		want         Match
+	}{
+		{
+			name:         "a GitHub profile with the Tracker email address is a high confidence match",
+			person:       trackerapi.Person{ID: 1, Name: "Ryan Richard", Email: "ryan@example.com"},
+			usersByEmail: map[string][]string{"ryan@example.com": {"cfryanr"}},
+			want:         Match{GitHubUsername: "cfryanr", Confidence: High, Note: "the GitHub profile shows the Tracker email address ryan@example.com"},
+		},
+		{
+			name:   "a commit author with the Tracker email address is a medium confidence match",
+			person: trackerapi.Person{ID: 1, Name: "Ryan", Email: "Ryan@Work.example.com"},
+			want:   Match{GitHubUsername: "cfryanr", Confidence: Medium, Note: "commits in the repository by Ryan@Work.example.com are linked to the GitHub user"},
+		},
+		{
+			name:   "a commit author with the Tracker name is a low confidence match",
+			person: trackerapi.Person{ID: 1, Name: "jane q doe", Email: "jane@work.example.com"},
+			want:   Match{GitHubUsername: "jdoe", Confidence: Low, Note: `the Tracker name "jane q doe" is the name of a commit author in the repository`},
+		},
+		{
+			name:   "a commit author whose GitHub login is the Tracker username is a low confidence match",
+			person: trackerapi.Person{ID: 1, Name: "H. Acker", Username: "Hacker42"},
+			want:   Match{GitHubUsername: "hacker42", Confidence: Low, Note: `the Tracker username "Hacker42" is the GitHub login of a commit author in the repository`},
+		},
+		{
+			name:         "ambiguous matches are not used",
+			person:       trackerapi.Person{ID: 1, Name: "Pat Smith", Email: "team@example.com"},
+			usersByEmail: map[string][]string{"team@example.com": {"shared-1", "shared-2"}},
+			want: Match{Note: "several GitHub profiles show the Tracker email address: shared-1, shared-2; " +
+				"commits by the Tracker email address are linked to several GitHub users: shared-1, shared-2; " +
+				`several commit authors are named "Pat Smith": twin-a, twin-b`},
+		},
+		{
+			name:      "search errors are reported, and the other methods are still tried",
+			person:    trackerapi.Person{ID: 1, Name: "Nobody", Email: "nobody@example.com"},
+			searchErr: errors.New("rate limited"),
+			want:      Match{Note: "could not search GitHub users by email: rate limited"},
+		},
+		{
+			name:   "commit authors which are not linked to GitHub users are never matched",
+			person: trackerapi.Person{ID: 1, Name: "Unlinked Author", Email: "unlinked@example.com"},
+			want:   Match{Note: "no GitHub user found"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			gitHub := &fakeGitHubAPI{usersByEmail: test.usersByEmail, searchErr: test.searchErr, commitAuthors: commitAuthors}
+			subject, err := NewMatcher(context.Background(), gitHub, 100)
+			require.NoError(t, err)
+			test.want.Person = test.person
+			require.Equal(t, test.want, subject.Match(context.Background(), test.person))
+		})
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	require.True(t, AtLeast(High, Medium))
+	require.True(t, AtLeast(Medium, Medium))
+	require.False(t, AtLeast(Low, Medium))
+	require.False(t, AtLeast("", Low))
+}
+
+func TestValidConfidence(t *testing.T) {
+	require.True(t, ValidConfidence(High))
+	require.True(t, ValidConfidence(Low))
+	require.False(t, ValidConfidence(""))
+	require.False(t, ValidConfidence("High"))
+
+	// The config file accepts the same confidences.
+	for _, confidence := range config.Confidences {
+		require.True(t, ValidConfidence(confidence), confidence)
+	}
+	require.Len(t, config.Confidences, len(confidenceRanks))
+}
@@ -0,0 +1,8 @@
+package usermapping
+
+import "issues2stories/internal/metrics"
+
+var lookups = metrics.NewCounterVec(
+	"issues2stories_user_lookups_total",
+	"Lookups of the GitHub users of Tracker users who are not in the user ID mapping, by outcome: matched, unmatched or error.",
+	"outcome")
@@ -0,0 +1,62 @@
+package usermapping
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Returns a config file snippet with the proposed tracker_id_to_github_username_mapping, with a comment on each
+// entry which explains the match. Matches with less than the minimum confidence, and GitHub users which were
+// matched to more than one Tracker user, are commented out so they can be reviewed. Entries which are already
+// in the existing mapping are kept as they are.
+func ProposedYAML(trackerProjectID int64, matches []Match, minConfidence string, existing map[int64]string) string {
+	matches = append([]Match{}, matches...)
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Person.ID < matches[j].Person.ID })
+
+	trackerIDsByUsername := map[string][]int64{}
+	for _, match := range matches {
+		username := match.GitHubUsername
+		if existingUsername, ok := existing[match.Person.ID]; ok {
+			username = existingUsername
+		}
+		if username != "" {
+			key := strings.ToLower(username)
+			trackerIDsByUsername[key] = append(trackerIDsByUsername[key], match.Person.ID)
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Proposed by \"issues2stories generate-user-mapping\" for Tracker project %d.\n", trackerProjectID)
+	fmt.Fprintf(&out, "# Check each entry before using it. Entries with less than %s confidence, or whose GitHub user\n", minConfidence)
+	fmt.Fprintf(&out, "# was matched to more than one Tracker user, are commented out.\n")
+	fmt.Fprintf(&out, "tracker_id_to_github_username_mapping:\n")
+	for _, match := range matches {
+		person := fmt.Sprintf("%s <%s>", match.Person.Name, match.Person.Email)
+		if existingUsername, ok := existing[match.Person.ID]; ok {
+			fmt.Fprintf(&out, "  %d: %s # already configured: %s\n", match.Person.ID, existingUsername, comment(person))
+			continue
+		}
+		if match.GitHubUsername == "" {
+			fmt.Fprintf(&out, "  # %d: # no match: %s: %s\n", match.Person.ID, comment(person), comment(match.Note))
+			continue
+		}
+		prefix := ""
+		note := match.Note
+		switch {
+		case !AtLeast(match.Confidence, minConfidence):
+			prefix = "# "
+		case len(trackerIDsByUsername[strings.ToLower(match.GitHubUsername)]) > 1:
+			prefix = "# "
+			note += "; the GitHub user was also matched to another Tracker user"
+		}
+		fmt.Fprintf(&out, "  %s%d: %s # %s confidence: %s: %s\n",
+			prefix, match.Person.ID, match.GitHubUsername, match.Confidence, comment(person), comment(note))
+	}
+	return out.String()
+}
+
+// Keeps text from ending the comment which it is in.
+func comment(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
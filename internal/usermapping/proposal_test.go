@@ -0,0 +1,41 @@
+package usermapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"issues2stories/internal/trackerapi"
+)
+
+func TestProposedYAML(t *testing.T) {
+	matches := []Match{
+		{Person: trackerapi.Person{ID: 5, Name: "Low Match", Email: "low@example.com"},
+			GitHubUsername: "low", Confidence: Low, Note: "name matches"},
+		{Person: trackerapi.Person{ID: 1, Name: "Ryan Richard", Email: "ryan@example.com"},
+			GitHubUsername: "cfryanr", Confidence: High, Note: "email matches"},
+		{Person: trackerapi.Person{ID: 3, Name: "No Match", Email: "none@example.com"},
+			Note: "no GitHub user found"},
+		{Person: trackerapi.Person{ID: 2, Name: "Configured", Email: "configured@example.com"}},
+		{Person: trackerapi.Person{ID: 4, Name: "Also Ryan", Email: "ryan@work.example.com"},
+			GitHubUsername: "CFRyanR", Confidence: Medium, Note: "commit email\nmatches"},
+	}
+	got := ProposedYAML(2453999, matches, Medium, map[int64]string{2: "already-set"})
+	require.Equal(t, `# Proposed by "issues2stories generate-user-mapping" for Tracker project 2453999.
+# Check each entry before using it. Entries with less than medium confidence, or whose GitHub user
+# was matched to more than one Tracker user, are commented out.
+tracker_id_to_github_username_mapping:
+  # 1: cfryanr # high confidence: Ryan Richard <ryan@example.com>: email matches; the GitHub user was also matched to another Tracker user
+  2: already-set # already configured: Configured <configured@example.com>
+  # 3: # no match: No Match <none@example.com>: no GitHub user found
+  # 4: CFRyanR # medium confidence: Also Ryan <ryan@work.example.com>: commit email matches; the GitHub user was also matched to another Tracker user
+  # 5: low # low confidence: Low Match <low@example.com>: name matches
+`, got)
+
+	// The proposal is a valid config file snippet.
+	var parsed struct {
+		Mapping map[int64]string `yaml:"tracker_id_to_github_username_mapping"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(got), &parsed))
+	require.Equal(t, map[int64]string{2: "already-set"}, parsed.Mapping)
+}
@@ -0,0 +1,150 @@
+package usermapping
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/trackerapi"
+)
+
+// A Resolver finds the GitHub usernames of Tracker users while the app is running, e.g. for story owners who are
+// not in the configured user ID mapping, the same way as the generate-user-mapping subcommand. To limit the API
+// calls, it remembers each project's members, the repository's commit authors and each result for the configured
+// cache duration.
+type Resolver struct {
+	tracker trackerapi.TrackerAPI
+	gitHub  githubapi.GitHubAPI
+	now     func() time.Time
+
+	// Lookups are rare, so they are simply done one at a time.
+	mu               sync.Mutex
+	matcher          *Matcher
+	matcherCreatedAt time.Time
+	members          map[int64]cachedMembers
+	results          map[int64]cachedResult
+}
+
+type cachedMembers struct {
+	people    []trackerapi.Person
+	fetchedAt time.Time
+}
+
+type cachedResult struct {
+	match     Match
+	matchedAt time.Time
+}
+
+func NewResolver(tracker trackerapi.TrackerAPI, gitHub githubapi.GitHubAPI) *Resolver {
+	return &Resolver{
+		tracker: tracker,
+		gitHub:  gitHub,
+		now:     time.Now,
+		members: map[int64]cachedMembers{},
+		results: map[int64]cachedResult{},
+	}
+}
+
+// Returns the GitHub username of the Tracker user, who must be a member of the Tracker project, or an empty
+// string when no GitHub user was found with at least the configured minimum confidence.
+func (r *Resolver) GitHubUsername(ctx context.Context, settings config.UserResolver, trackerProjectID, trackerUserID int64) (string, error) {
+	settings = settings.WithDefaults()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match, err := r.result(ctx, settings, trackerProjectID, trackerUserID)
+	if err != nil || !AtLeast(match.Confidence, settings.MinConfidence) {
+		return "", err
+	}
+	return match.GitHubUsername, nil
+}
+
+// Returns the ID of the member of the Tracker project whose GitHub username is the given one, ignoring case, or 0
+// when no member was found with at least the configured minimum confidence. Every member of the project is looked
+// up, so the first call for a project can take a while, but the results are cached as usual.
+func (r *Resolver) TrackerUserID(ctx context.Context, settings config.UserResolver, trackerProjectID int64, gitHubUsername string) (int64, error) {
+	settings = settings.WithDefaults()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	people, err := r.projectMembers(ctx, settings, trackerProjectID)
+	if err != nil {
+		lookups.WithLabelValues("error").Inc()
+		return 0, err
+	}
+	for _, person := range people {
+		match, err := r.result(ctx, settings, trackerProjectID, person.ID)
+		if err != nil {
+			return 0, err
+		}
+		if AtLeast(match.Confidence, settings.MinConfidence) && strings.EqualFold(match.GitHubUsername, gitHubUsername) {
+			return person.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// Returns the cached result for the Tracker user, or looks it up when it is missing or too old.
+func (r *Resolver) result(ctx context.Context, settings config.UserResolver, trackerProjectID, trackerUserID int64) (Match, error) {
+	now := r.now()
+	result, ok := r.results[trackerUserID]
+	if ok && now.Sub(result.matchedAt) < settings.CacheDuration {
+		return result.match, nil
+	}
+	match, err := r.match(ctx, settings, trackerProjectID, trackerUserID)
+	if err != nil {
+		lookups.WithLabelValues("error").Inc()
+		return Match{}, err
+	}
+	r.results[trackerUserID] = cachedResult{match: match, matchedAt: now}
+	outcome := "unmatched"
+	if match.GitHubUsername != "" {
+		outcome = "matched"
+	}
+	lookups.WithLabelValues(outcome).Inc()
+	logging.FromContext(ctx).Info("Looked up GitHub user for Tracker user",
+		"tracker_user_id", trackerUserID, "github_username", match.GitHubUsername,
+		"confidence", match.Confidence, "note", match.Note)
+	return match, nil
+}
+
+func (r *Resolver) match(ctx context.Context, settings config.UserResolver, trackerProjectID, trackerUserID int64) (Match, error) {
+	people, err := r.projectMembers(ctx, settings, trackerProjectID)
+	if err != nil {
+		return Match{}, err
+	}
+	now := r.now()
+	if r.matcher == nil || now.Sub(r.matcherCreatedAt) >= settings.CacheDuration {
+		matcher, err := NewMatcher(ctx, r.gitHub, settings.MaxCommits)
+		if err != nil {
+			return Match{}, err
+		}
+		r.matcher, r.matcherCreatedAt = matcher, now
+	}
+
+	for _, person := range people {
+		if person.ID == trackerUserID {
+			return r.matcher.Match(ctx, person), nil
+		}
+	}
+	return Match{Person: trackerapi.Person{ID: trackerUserID}, Note: "not a member of the Tracker project"}, nil
+}
+
+// Returns the cached members of the Tracker project, or lists them when they are missing or too old.
+func (r *Resolver) projectMembers(ctx context.Context, settings config.UserResolver, trackerProjectID int64) ([]trackerapi.Person, error) {
+	now := r.now()
+	members, ok := r.members[trackerProjectID]
+	if !ok || now.Sub(members.fetchedAt) >= settings.CacheDuration {
+		people, err := r.tracker.ListProjectMembers(ctx, trackerProjectID)
+		if err != nil {
+			return nil, err
+		}
+		members = cachedMembers{people: people, fetchedAt: now}
+		r.members[trackerProjectID] = members
+	}
+	return members.people, nil
+}
@@ -0,0 +1,122 @@
+package usermapping
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"issues2stories/internal/config"
+	"issues2stories/internal/githubapi"
+	"issues2stories/internal/trackerapi"
+)
+
+// Only implements the methods used by the Resolver.
+type fakeTrackerAPI struct {
+	trackerapi.TrackerAPI
+
+	members                 map[int64][]trackerapi.Person
+	err                     error
+	listProjectMembersCalls int
+}
+
+func (f *fakeTrackerAPI) ListProjectMembers(_ context.Context, trackerProjectID int64) ([]trackerapi.Person, error) {
+	f.listProjectMembersCalls++
+	return f.members[trackerProjectID], f.err
+}
+
+func TestResolver(t *testing.T) {
+	tracker := &fakeTrackerAPI{members: map[int64][]trackerapi.Person{
+		123: {
+			{ID: 1, Name: "Ryan Richard", Email: "ryan@example.com"},
+			{ID: 2, Name: "Jane Doe", Email: "jane@example.com"},
+		},
+	}}
+	gitHub := &fakeGitHubAPI{
+		usersByEmail:  map[string][]string{"ryan@example.com": {"cfryanr"}},
+		commitAuthors: []githubapi.CommitAuthor{{Login: "jdoe", Name: "Jane Doe", Email: "jane@personal.example.com"}},
+	}
+	currentTime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	subject := NewResolver(tracker, gitHub)
+	subject.now = func() time.Time { return currentTime }
+	ctx := context.Background()
+	settings := config.UserResolver{Enabled: true}
+	matchedBefore, unmatchedBefore, errorBefore := lookups.Value("matched"), lookups.Value("unmatched"), lookups.Value("error")
+
+	username, err := subject.GitHubUsername(ctx, settings, 123, 1)
+	require.NoError(t, err)
+	require.Equal(t, "cfryanr", username)
+
+	// Jane only has a low confidence match, which is not used by default.
+	username, err = subject.GitHubUsername(ctx, settings, 123, 2)
+	require.NoError(t, err)
+	require.Equal(t, "", username)
+	username, err = subject.GitHubUsername(ctx, config.UserResolver{Enabled: true, MinConfidence: "low"}, 123, 2)
+	require.NoError(t, err)
+	require.Equal(t, "jdoe", username)
+
+	username, err = subject.GitHubUsername(ctx, settings, 123, 3)
+	require.NoError(t, err)
+	require.Equal(t, "", username)
+
+	// Everything was cached, so the APIs were only called once each, apart from the searches for each email address.
+	require.Equal(t, 1, tracker.listProjectMembersCalls)
+	require.Equal(t, 1, gitHub.listCommitAuthorsCalls)
+	require.Equal(t, []string{"ryan@example.com", "jane@example.com"}, gitHub.findUsersByEmailQueries)
+
+	// After the cache duration, the lookups are done again.
+	currentTime = currentTime.Add(time.Hour)
+	tracker.err = errors.New("Tracker is down")
+	_, err = subject.GitHubUsername(ctx, settings, 123, 1)
+	require.EqualError(t, err, "Tracker is down")
+	tracker.err = nil
+	username, err = subject.GitHubUsername(ctx, settings, 123, 1)
+	require.NoError(t, err)
+	require.Equal(t, "cfryanr", username)
+	require.Equal(t, 3, tracker.listProjectMembersCalls)
+	require.Equal(t, 2, gitHub.listCommitAuthorsCalls)
+
+	require.Equal(t, matchedBefore+3, lookups.Value("matched"))
+	require.Equal(t, unmatchedBefore+1, lookups.Value("unmatched"))
+	require.Equal(t, errorBefore+1, lookups.Value("error"))
+}
+
+func TestResolverTrackerUserID(t *testing.T) {
+	tracker := &fakeTrackerAPI{members: map[int64][]trackerapi.Person{
+		123: {
+			{ID: 1, Name: "Ryan Richard", Email: "ryan@example.com"},
+			{ID: 2, Name: "Jane Doe", Email: "jane@example.com"},
+		},
+	}}
+	gitHub := &fakeGitHubAPI{
+		usersByEmail:  map[string][]string{"ryan@example.com": {"cfryanr"}},
+		commitAuthors: []githubapi.CommitAuthor{{Login: "jdoe", Name: "Jane Doe", Email: "jane@personal.example.com"}},
+	}
+	subject := NewResolver(tracker, gitHub)
+	ctx := context.Background()
+	settings := config.UserResolver{Enabled: true}
+
+	trackerUserID, err := subject.TrackerUserID(ctx, settings, 123, "CFRyanR")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), trackerUserID)
+
+	// Jane only has a low confidence match, which is not used by default.
+	trackerUserID, err = subject.TrackerUserID(ctx, settings, 123, "jdoe")
+	require.NoError(t, err)
+	require.Zero(t, trackerUserID)
+	trackerUserID, err = subject.TrackerUserID(ctx, config.UserResolver{Enabled: true, MinConfidence: "low"}, 123, "jdoe")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), trackerUserID)
+
+	// The results are shared with GitHubUsername.
+	username, err := subject.GitHubUsername(ctx, settings, 123, 1)
+	require.NoError(t, err)
+	require.Equal(t, "cfryanr", username)
+	require.Equal(t, 1, tracker.listProjectMembersCalls)
+	require.Equal(t, []string{"ryan@example.com", "jane@example.com"}, gitHub.findUsersByEmailQueries)
+
+	tracker.err = errors.New("Tracker is down")
+	_, err = subject.TrackerUserID(ctx, settings, 456, "cfryanr")
+	require.EqualError(t, err, "Tracker is down")
+}
@@ -0,0 +1,46 @@
+package webhooktoken
+
+import (
+	"fmt"
+	"net/http"
+
+	"issues2stories/internal/config"
+)
+
+// Authenticator accepts requests whose URL path ends with a valid token, e.g. /tracker_activity/i2swh_...
+// Each token only allows requests for the Tracker project of the binding which it was issued for.
+type Authenticator struct {
+	keys            Keys
+	revokedTokenIDs map[string]bool
+}
+
+var _ config.ProjectScopedAuthenticator = &Authenticator{}
+
+func NewAuthenticator(keys Keys, revokedTokenIDs []string) *Authenticator {
+	revoked := map[string]bool{}
+	for _, id := range revokedTokenIDs {
+		revoked[id] = true
+	}
+	return &Authenticator{keys: keys, revokedTokenIDs: revoked}
+}
+
+func (a *Authenticator) Authenticate(request *http.Request) (string, error) {
+	claims, err := a.verify(request)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("webhook_token/%s/%s", claims.KeyID, claims.TokenID), nil
+}
+
+func (a *Authenticator) AllowsProject(request *http.Request, trackerProjectID int64) bool {
+	claims, err := a.verify(request)
+	return err == nil && claims.TrackerProjectID == trackerProjectID
+}
+
+func (a *Authenticator) verify(request *http.Request) (*Claims, error) {
+	token, ok := FromURL(request.URL.Path)
+	if !ok {
+		return nil, config.ErrMissingCredentials
+	}
+	return Verify(a.keys, a.revokedTokenIDs, token)
+}
@@ -0,0 +1,190 @@
+package webhooktoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Every token starts with this prefix, so that tokens can be recognized and redacted wherever they appear.
+	Prefix = "i2swh_"
+
+	// The environment variable which holds the signing keys, as comma-separated "<key id>:<base64 key>" pairs.
+	KeysEnvVar = "WEBHOOK_TOKEN_KEYS"
+
+	version      = 1
+	tokenIDLen   = 8
+	signatureLen = 32
+	minKeyLen    = 32
+)
+
+var (
+	ErrMalformed  = errors.New("webhook token is malformed")
+	ErrUnknownKey = errors.New("webhook token was signed with an unknown key")
+	ErrSignature  = errors.New("webhook token has an invalid signature")
+	ErrRevoked    = errors.New("webhook token has been revoked")
+
+	validKeyID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+)
+
+// Claims are the contents of a token.
+type Claims struct {
+	// The ID of the key which signed the token.
+	KeyID string
+
+	// The Tracker project of the binding which the token was issued for.
+	TrackerProjectID int64
+
+	// A random ID which identifies this token, e.g. for revoking it.
+	TokenID string
+}
+
+// Keys holds the signing keys by key ID. Tokens signed by a key stop working when it is removed.
+type Keys map[string][]byte
+
+// Parse keys in the format of the WEBHOOK_TOKEN_KEYS environment variable, e.g. "2021-03:<base64>,2021-01:<base64>".
+// Also returns the ID of the first key, which is used to sign new tokens.
+func ParseKeys(value string) (Keys, string, error) {
+	keys := Keys{}
+	firstKeyID := ""
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, "", fmt.Errorf("webhook token key must be formatted as <key id>:<base64 key>")
+		}
+		keyID := parts[0]
+		if !validKeyID.MatchString(keyID) {
+			return nil, "", fmt.Errorf("webhook token key ID %q must be 1 to 32 letters, digits, underscores or hyphens", keyID)
+		}
+		if _, exists := keys[keyID]; exists {
+			return nil, "", fmt.Errorf("webhook token key ID %q is used more than once", keyID)
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, "", fmt.Errorf("webhook token key %q is not valid base64", keyID)
+		}
+		if len(key) < minKeyLen {
+			return nil, "", fmt.Errorf("webhook token key %q must be at least %d bytes", keyID, minKeyLen)
+		}
+		keys[keyID] = key
+		if firstKeyID == "" {
+			firstKeyID = keyID
+		}
+	}
+	return keys, firstKeyID, nil
+}
+
+// Returns a new random key in the format of the WEBHOOK_TOKEN_KEYS environment variable.
+func NewKey(keyID string) (string, error) {
+	if !validKeyID.MatchString(keyID) {
+		return "", fmt.Errorf("webhook token key ID %q must be 1 to 32 letters, digits, underscores or hyphens", keyID)
+	}
+	key := make([]byte, minKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return keyID + ":" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Returns the sorted key IDs, e.g. for logging which keys are configured.
+func (k Keys) IDs() []string {
+	ids := make([]string, 0, len(k))
+	for id := range k {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Returns a new token for the given binding's Tracker project, signed with the given key.
+func Issue(keys Keys, keyID string, trackerProjectID int64) (string, *Claims, error) {
+	key, ok := keys[keyID]
+	if !ok {
+		return "", nil, ErrUnknownKey
+	}
+	tokenID := make([]byte, tokenIDLen)
+	if _, err := rand.Read(tokenID); err != nil {
+		return "", nil, err
+	}
+
+	// The payload is: version, key ID length, key ID, project ID, token ID.
+	payload := []byte{version, byte(len(keyID))}
+	payload = append(payload, keyID...)
+	payload = append(payload, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(payload[len(payload)-8:], uint64(trackerProjectID))
+	payload = append(payload, tokenID...)
+
+	token := Prefix + base64.RawURLEncoding.EncodeToString(append(payload, sign(key, payload)...))
+	return token, &Claims{KeyID: keyID, TrackerProjectID: trackerProjectID, TokenID: hex.EncodeToString(tokenID)}, nil
+}
+
+// Returns the claims of the token when it was signed by one of the keys and it has not been revoked.
+func Verify(keys Keys, revokedTokenIDs map[string]bool, token string) (*Claims, error) {
+	claims, payload, signature, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[claims.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !hmac.Equal(signature, sign(key, payload)) {
+		return nil, ErrSignature
+	}
+	if revokedTokenIDs[claims.TokenID] {
+		return nil, ErrRevoked
+	}
+	return claims, nil
+}
+
+// Returns the token from a webhook URL or path, or the argument itself when it is already a token.
+func FromURL(webhookURL string) (string, bool) {
+	if i := strings.LastIndex(webhookURL, "/"); i >= 0 {
+		webhookURL = webhookURL[i+1:]
+	}
+	if i := strings.IndexAny(webhookURL, "?#"); i >= 0 {
+		webhookURL = webhookURL[:i]
+	}
+	return webhookURL, strings.HasPrefix(webhookURL, Prefix)
+}
+
+func parse(token string) (*Claims, []byte, []byte, error) {
+	if !strings.HasPrefix(token, Prefix) {
+		return nil, nil, nil, ErrMalformed
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, Prefix))
+	if err != nil || len(decoded) < 2 || decoded[0] != version {
+		return nil, nil, nil, ErrMalformed
+	}
+	keyIDLen := int(decoded[1])
+	payloadLen := 2 + keyIDLen + 8 + tokenIDLen
+	if len(decoded) != payloadLen+signatureLen {
+		return nil, nil, nil, ErrMalformed
+	}
+	payload, signature := decoded[:payloadLen], decoded[payloadLen:]
+	rest := payload[2+keyIDLen:]
+	return &Claims{
+		KeyID:            string(payload[2 : 2+keyIDLen]),
+		TrackerProjectID: int64(binary.BigEndian.Uint64(rest[:8])),
+		TokenID:          hex.EncodeToString(rest[8:]),
+	}, payload, signature, nil
+}
+
+func sign(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,257 @@
+package webhooktoken
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey      = strings.Repeat("k", 32)
+	otherTestKey = strings.Repeat("o", 32)
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	keys := Keys{"2021-03": []byte(testKey), "2021-01": []byte(otherTestKey)}
+
+	token, claims, err := Issue(keys, "2021-03", 12345)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(token, Prefix))
+	require.Equal(t, "2021-03", claims.KeyID)
+	require.Equal(t, int64(12345), claims.TrackerProjectID)
+	require.Len(t, claims.TokenID, 16)
+
+	otherToken, _, err := Issue(keys, "2021-03", 12345)
+	require.NoError(t, err)
+	require.NotEqual(t, token, otherToken)
+
+	tamperedPayload, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, Prefix))
+	require.NoError(t, err)
+	tamperedPayload[len(tamperedPayload)-signatureLen-tokenIDLen-1]++ // change the project ID
+	tampered := Prefix + base64.RawURLEncoding.EncodeToString(tamperedPayload)
+
+	tests := []struct {
+		name    string
+		keys    Keys
+		revoked map[string]bool
+		token   string
+
+		wantClaims *Claims
+		wantErr    error
+	}{
+		{
+			name:       "valid",
+			keys:       keys,
+			token:      token,
+			wantClaims: claims,
+		},
+		{
+			name:    "revoked",
+			keys:    keys,
+			revoked: map[string]bool{claims.TokenID: true},
+			token:   token,
+			wantErr: ErrRevoked,
+		},
+		{
+			name:       "a different token is revoked",
+			keys:       keys,
+			revoked:    map[string]bool{"0000000000000000": true},
+			token:      token,
+			wantClaims: claims,
+		},
+		{
+			name:    "signing key was removed",
+			keys:    Keys{"2021-01": []byte(otherTestKey)},
+			token:   token,
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "signing key was replaced",
+			keys:    Keys{"2021-03": []byte(otherTestKey)},
+			token:   token,
+			wantErr: ErrSignature,
+		},
+		{
+			name:    "tampered",
+			keys:    keys,
+			token:   tampered,
+			wantErr: ErrSignature,
+		},
+		{
+			name:    "truncated",
+			keys:    keys,
+			token:   token[:len(token)-4],
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "no prefix",
+			keys:    keys,
+			token:   strings.TrimPrefix(token, Prefix),
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "not base64",
+			keys:    keys,
+			token:   Prefix + "!!!",
+			wantErr: ErrMalformed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actualClaims, err := Verify(test.keys, test.revoked, test.token)
+			if test.wantErr != nil {
+				require.Equal(t, test.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantClaims, actualClaims)
+		})
+	}
+
+	_, _, err = Issue(keys, "unknown", 12345)
+	require.Equal(t, ErrUnknownKey, err)
+}
+
+func TestParseKeys(t *testing.T) {
+	encodedKey := base64.StdEncoding.EncodeToString([]byte(testKey))
+	encodedOtherKey := base64.StdEncoding.EncodeToString([]byte(otherTestKey))
+
+	tests := []struct {
+		name           string
+		value          string
+		wantKeys       Keys
+		wantFirstKeyID string
+		wantErr        string
+	}{
+		{
+			name:     "empty",
+			value:    "",
+			wantKeys: Keys{},
+		},
+		{
+			name:           "several keys",
+			value:          "2021-03:" + encodedKey + ", 2021-01:" + encodedOtherKey,
+			wantKeys:       Keys{"2021-03": []byte(testKey), "2021-01": []byte(otherTestKey)},
+			wantFirstKeyID: "2021-03",
+		},
+		{
+			name:    "missing key ID",
+			value:   encodedKey,
+			wantErr: "webhook token key must be formatted as <key id>:<base64 key>",
+		},
+		{
+			name:    "invalid key ID",
+			value:   "2021/03:" + encodedKey,
+			wantErr: `webhook token key ID "2021/03" must be 1 to 32 letters, digits, underscores or hyphens`,
+		},
+		{
+			name:    "duplicate key ID",
+			value:   "a:" + encodedKey + ",a:" + encodedOtherKey,
+			wantErr: `webhook token key ID "a" is used more than once`,
+		},
+		{
+			name:    "not base64",
+			value:   "a:not base64",
+			wantErr: `webhook token key "a" is not valid base64`,
+		},
+		{
+			name:    "too short",
+			value:   "a:" + base64.StdEncoding.EncodeToString([]byte("short")),
+			wantErr: `webhook token key "a" must be at least 32 bytes`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, firstKeyID, err := ParseKeys(test.value)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantKeys, keys)
+			require.Equal(t, test.wantFirstKeyID, firstKeyID)
+		})
+	}
+
+	newKey, err := NewKey("2021-04")
+	require.NoError(t, err)
+	keys, firstKeyID, err := ParseKeys(newKey)
+	require.NoError(t, err)
+	require.Equal(t, "2021-04", firstKeyID)
+	require.Len(t, keys["2021-04"], 32)
+}
+
+func TestAuthenticator(t *testing.T) {
+	keys := Keys{"2021-03": []byte(testKey)}
+	token, claims, err := Issue(keys, "2021-03", 12345)
+	require.NoError(t, err)
+	revokedToken, revokedClaims, err := Issue(keys, "2021-03", 12345)
+	require.NoError(t, err)
+	subject := NewAuthenticator(keys, []string{revokedClaims.TokenID})
+
+	tests := []struct {
+		name      string
+		path      string
+		projectID int64
+
+		wantLabel        string
+		wantErr          string
+		wantAllowProject bool
+	}{
+		{
+			name:             "valid token for the event's project",
+			path:             "/tracker_activity/" + token,
+			projectID:        12345,
+			wantLabel:        "webhook_token/2021-03/" + claims.TokenID,
+			wantAllowProject: true,
+		},
+		{
+			name:      "valid token for a different project",
+			path:      "/tracker_activity/" + token,
+			projectID: 99999,
+			wantLabel: "webhook_token/2021-03/" + claims.TokenID,
+		},
+		{
+			name:      "revoked token",
+			path:      "/tracker_activity/" + revokedToken,
+			projectID: 12345,
+			wantErr:   "webhook token has been revoked",
+		},
+		{
+			name:      "no token",
+			path:      "/tracker_activity/",
+			projectID: 12345,
+			wantErr:   "request had no credentials",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, test.path, nil)
+			label, err := subject.Authenticate(request)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.wantLabel, label)
+			}
+			require.Equal(t, test.wantAllowProject, subject.AllowsProject(request, test.projectID))
+		})
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	token, ok := FromURL("https://issues2stories.example.com/tracker_activity/" + Prefix + "abc?x=y")
+	require.True(t, ok)
+	require.Equal(t, Prefix+"abc", token)
+
+	token, ok = FromURL(Prefix + "abc")
+	require.True(t, ok)
+	require.Equal(t, Prefix+"abc", token)
+
+	_, ok = FromURL("https://issues2stories.example.com/tracker_activity?username=a&password=b")
+	require.False(t, ok)
+}
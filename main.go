@@ -1,82 +1,896 @@
 package main
 
 import (
-	"gopkg.in/yaml.v3"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/crypto/acme"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"issues2stories/internal/config"
 	"issues2stories/internal/githubapi"
+	"issues2stories/internal/githubwebhook"
+	"issues2stories/internal/guard"
+	"issues2stories/internal/health"
+	"issues2stories/internal/logging"
+	"issues2stories/internal/loopguard"
+	"issues2stories/internal/metrics"
+	"issues2stories/internal/passwordhash"
+	"issues2stories/internal/reload"
+	"issues2stories/internal/server"
+	"issues2stories/internal/simulate"
+	"issues2stories/internal/tlscert"
+	"issues2stories/internal/tracing"
 	"issues2stories/internal/trackeractivity"
 	"issues2stories/internal/trackerapi"
 	"issues2stories/internal/trackerimport"
+	"issues2stories/internal/usermapping"
+	"issues2stories/internal/webhooktoken"
 )
 
+const defaultConfigFilePath = "/etc/config/config.yaml"
+
 func main() {
-	log.Println("Starting server at port 8080")
+	// Until the config file has been read, log at the level from the environment.
+	logLevel, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		fatal("invalid LOG_LEVEL", "error", err)
+	}
+	logging.SetDefault(logging.New(os.Stderr, logLevel))
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			simulateCommand(os.Args[2:])
+			return
+		case "hash-password":
+			hashPasswordCommand(os.Args[2:])
+			return
+		case "webhook-url":
+			webhookURLCommand(os.Args[2:])
+			return
+		case "validate-config":
+			validateConfigCommand(os.Args[2:])
+			return
+		case "generate-user-mapping":
+			generateUserMappingCommand(os.Args[2:])
+			return
+		}
+	}
+
+	configPath := flag.String("config", defaultConfigFilePath, "path to the config file")
+	flag.Parse()
+	configuration := readConfig(*configPath)
+
+	// Settings come from the environment, then from secret files, then from the config file.
+	settings := config.NewSettings(os.LookupEnv, ioutil.ReadFile)
+	logLevel, err = logging.ParseLevel(settings.Get("LOG_LEVEL", configuration.LogLevel, "info"))
+	if err != nil {
+		fatal("invalid log level", "error", err)
+	}
+	logging.SetDefault(logging.New(os.Stderr, logLevel))
+	logger := logging.Default()
+
+	serverSettings := configuration.Server.WithDefaults()
+	logger.Info("Starting server", "listen_address", serverSettings.ListenAddress, "config_file", *configPath)
+	logger.Info("Read user ID mapping config", "tracker_id_to_github_username_mapping", configuration.UserIDMapping)
+
+	gitHubOrg := requireSetting(settings, "GITHUB_ORG", configuration.GitHub.Org, "github.org")
+	gitHubRepo := requireSetting(settings, "GITHUB_REPO", configuration.GitHub.Repo, "github.repo")
+	logging.RegisterSecretPathSegmentPrefix(webhooktoken.Prefix)
+	loaded, err := loadReloadable(configuration, settings)
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
 
-	const configFilePath = "/etc/config/config.yaml"
-	configYAML, err := ioutil.ReadFile(configFilePath)
+	tracingProvider, exportingSpans, err := tracing.NewProviderFromEnv(tracingSettings(settings, configuration.Tracing), func(err error) {
+		logger.Warn("Could not export trace spans", "error", err)
+	})
 	if err != nil {
-		log.Fatalf("could not read config file: %s", configFilePath)
+		fatal("invalid tracing settings", "error", err)
+	}
+	tracing.SetProvider(tracingProvider)
+	logger.Info("Configured tracing", "exporting_spans", exportingSpans)
+
+	// Every setting has been resolved, so report where each value came from.
+	logger.Info("Settings precedence", "order", config.SettingsPrecedence)
+	for _, source := range settings.Sources() {
+		if source.Secret {
+			logger.Info("Resolved secret", "name", source.Name, "source", source.Source)
+		} else {
+			logger.Info("Resolved setting", "name", source.Name, "source", source.Source, "value", source.Value)
+		}
 	}
-	configuration := config.Config{}
-	err = yaml.Unmarshal(configYAML, &configuration)
+
+	trackerClient := trackerapi.New(loaded.secrets["TRACKER_API_TOKEN"], &http.Client{})
+	gitHubClient := githubapi.New(loaded.secrets["GITHUB_API_TOKEN"], gitHubOrg, gitHubRepo)
+
+	readinessCheckInterval := configuration.ReadinessCheckInterval
+	if readinessCheckInterval <= 0 {
+		readinessCheckInterval = config.DefaultReadinessCheckInterval
+	}
+	readiness := health.NewChecker(readinessChecks(configuration, gitHubClient, trackerClient), readinessCheckInterval, 10*time.Second)
+	readiness.Start(logging.NewContext(context.Background(), logger))
+
+	// The guard locks out clients after repeated failed authentication, and enforces each endpoint's allowed
+	// CIDRs and body size limit. The health endpoints are not guarded, because they are called by Kubernetes.
+	inbound, err := guard.New(configuration.Inbound)
 	if err != nil {
-		log.Fatalf("could not parse config file (%s) as YAML: %v", configFilePath, err)
+		fatal("invalid inbound settings in config file", "error", err)
 	}
-	log.Printf("Read user ID mapping config: %v", configuration.UserIDMapping)
+	inboundSettings := configuration.Inbound.WithDefaults()
+	logger.Info("Configured inbound protection",
+		"trusted_proxies", inboundSettings.TrustedProxies,
+		"max_failed_auth", inboundSettings.MaxFailedAuth,
+		"failed_auth_window", inboundSettings.FailedAuthWindow.String(),
+		"lockout_duration", inboundSettings.LockoutDuration.String())
 
-	gitHubOrg := requireEnv("GITHUB_ORG")
-	gitHubRepo := requireEnv("GITHUB_REPO")
-	gitAPIToken := requireEnv("GITHUB_API_TOKEN")
-	trackerAPIToken := requireEnv("TRACKER_API_TOKEN")
-	basicAuthCredentials := &config.BasicAuthCredentials{
-		Username: requireEnv("BASIC_AUTH_USERNAME"),
-		Password: requireEnv("BASIC_AUTH_PASSWORD"),
+	// When the configuration is reloaded, the handlers start using the new configuration and credentials while
+	// requests are being handled, so they are given the reloader's current configuration and credentials.
+	reloader := &reloader{
+		configPath:     *configPath,
+		servingMetrics: loaded.metricsCredentials != nil,
+		readiness:      readiness,
+		readinessChecks: func(configuration *config.Config) []health.Check {
+			return readinessChecks(configuration, gitHubClient, trackerClient)
+		},
 	}
+	reloader.loaded.Store(loaded)
+	currentConfig := config.ProviderFunc(func() *config.Config { return reloader.current().configuration })
+	trackerActivityCredentials := reloader.credentials(func(l *reloadableConfig) config.Authenticator { return l.trackerActivityCredentials })
+	webhookTokenCredentials := reloader.credentials(func(l *reloadableConfig) config.Authenticator { return l.webhookTokenCredentials })
+	trackerImportCredentials := reloader.credentials(func(l *reloadableConfig) config.Authenticator { return l.trackerImportCredentials })
+	gitHubWebhookCredentials := reloader.credentials(func(l *reloadableConfig) config.Authenticator { return l.gitHubWebhookCredentials })
+	metricsCredentials := reloader.credentials(func(l *reloadableConfig) config.Authenticator { return l.metricsCredentials })
+
+	// Finds the GitHub users of story owners who are not in the user ID mapping, when user_resolver is enabled.
+	users := usermapping.NewResolver(trackerClient, gitHubClient)
 
-	trackerClient := trackerapi.New(trackerAPIToken, &http.Client{})
-	gitHubClient := githubapi.New(gitAPIToken, gitHubOrg, gitHubRepo)
+	// Shared by the webhooks of both directions, so that each one recognizes the events caused by the other's writes.
+	recentWrites := loopguard.New(loopguard.DefaultTTL)
+
+	// Shared by both Tracker activity endpoints, which can receive events about the same stories.
+	auditComments := trackeractivity.NewRecentAuditComments()
 
 	mux := http.NewServeMux()
-	mux.Handle("/tracker_activity",
-		trackeractivity.NewHandler(trackerClient, gitHubClient, &configuration, basicAuthCredentials))
-	mux.Handle("/tracker_import",
-		trackerimport.NewHandler(gitHubClient, basicAuthCredentials))
+	mux.Handle("/tracker_activity", inbound.Protect(guard.EndpointTrackerActivity,
+		trackeractivity.NewHandler(trackerClient, gitHubClient, currentConfig, trackerActivityCredentials, users, recentWrites, auditComments)))
+	mux.Handle("/tracker_activity/", inbound.Protect(guard.EndpointTrackerActivity,
+		trackeractivity.NewHandler(trackerClient, gitHubClient, currentConfig, webhookTokenCredentials, users, recentWrites, auditComments)))
+	mux.Handle("/tracker_import", inbound.Protect(guard.EndpointTrackerImport,
+		trackerimport.NewHandler(trackerClient, gitHubClient, gitHubOrg, gitHubRepo, currentConfig, trackerImportCredentials)))
+	// Rejects every request until GITHUB_WEBHOOK_SECRET is set.
+	mux.Handle("/github_webhook", inbound.Protect(guard.EndpointGitHubWebhook,
+		githubwebhook.NewHandler(trackerClient, gitHubClient, gitHubOrg, gitHubRepo, currentConfig, gitHubWebhookCredentials, users, recentWrites)))
+	mux.Handle("/livez",
+		health.LiveHandler())
+	mux.Handle("/readyz",
+		readiness.ReadyHandler())
 	mux.Handle("/",
 		http.HandlerFunc(defaultHandler))
 
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		log.Fatal(err)
+	// The metrics endpoint is only served when it has its own credentials, separate from the Tracker-facing ones.
+	if reloader.servingMetrics {
+		mux.Handle("/metrics", inbound.Protect(guard.EndpointMetrics,
+			metrics.NewHandler(metrics.DefaultRegistry, metricsCredentials)))
+	} else {
+		logger.Info("Not serving /metrics because METRICS_USERNAME and METRICS_PASSWORD are not both set")
+	}
+
+	ctx, cancel := context.WithCancel(logging.NewContext(context.Background(), logger))
+	defer cancel()
+
+	// Reload when the config file or any secret file changes, or on SIGHUP.
+	reloadInterval := configuration.ReloadInterval
+	if reloadInterval == 0 {
+		reloadInterval = config.DefaultReloadInterval
+	}
+	watcher := reload.NewWatcher(append([]string{*configPath}, secretFiles(settings)...), reloader.reload)
+	watcher.Start(ctx, reloadInterval)
+	logger.Info("Watching for configuration changes", "reload_interval", reloadInterval.String())
+
+	// Kubernetes sends SIGTERM before killing the pod, e.g. during a rollout.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			logger.Info("Received signal", "signal", sig.String())
+			if sig == syscall.SIGHUP {
+				watcher.Trigger()
+				continue
+			}
+			cancel()
+			return
+		}
+	}()
+
+	listener, err := net.Listen("tcp", serverSettings.ListenAddress)
+	if err != nil {
+		fatal("could not listen", "listen_address", serverSettings.ListenAddress, "error", err)
+	}
+	tlsConfig, httpChallengeSolver := configureTLS(ctx, serverSettings)
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		logger.Info("Serving HTTPS")
+	}
+	if httpChallengeSolver != nil {
+		go serveHTTPChallenges(ctx, serverSettings.ACME.HTTPChallengeAddress, httpChallengeSolver)
+	}
+	srv := &http.Server{
+		Handler:      logging.Middleware(logger, tracing.Middleware(mux)),
+		ReadTimeout:  serverSettings.ReadTimeout,
+		WriteTimeout: serverSettings.WriteTimeout,
+		IdleTimeout:  serverSettings.IdleTimeout,
+	}
+	err = server.Run(ctx, srv, listener, server.Options{
+		ShutdownDelay:   serverSettings.ShutdownDelay,
+		ShutdownTimeout: serverSettings.ShutdownTimeout,
+		BeforeShutdown:  readiness.SetShuttingDown,
+		OnShutdown:      []func(ctx context.Context) error{tracingProvider.Shutdown},
+	})
+	if err != nil {
+		fatal("server failed", "error", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// The configuration and secrets which are read again when the configuration is reloaded, and the credentials
+// for each endpoint which are built from them.
+type reloadableConfig struct {
+	configuration *config.Config
+
+	// The values of the secrets by name, to report which secrets changed.
+	secrets map[string]string
+
+	// Each is nil when there are no credentials for it.
+	trackerActivityCredentials config.Authenticator
+	webhookTokenCredentials    config.Authenticator
+	trackerImportCredentials   config.Authenticator
+	metricsCredentials         config.Authenticator
+	gitHubWebhookCredentials   config.Authenticator
+}
+
+// Reads the secrets and builds the credentials for each endpoint, for a configuration which has already been
+// validated by config.Parse. Returns an error, rather than exiting, when a secret is missing or invalid, so that
+// a reload can keep using the previous configuration.
+func loadReloadable(configuration *config.Config, settings *config.Settings) (*reloadableConfig, error) {
+	logger := logging.Default()
+
+	secrets := map[string]string{}
+	for _, name := range []string{"GITHUB_API_TOKEN", "TRACKER_API_TOKEN"} {
+		value, err := settings.RequireSecret(name)
+		if err != nil {
+			return nil, err
+		}
+		secrets[name] = value
+	}
+	for _, name := range []string{"BASIC_AUTH_USERNAME", "BASIC_AUTH_PASSWORD", "METRICS_USERNAME", "METRICS_PASSWORD", webhooktoken.KeysEnvVar, githubwebhook.SecretEnvVar} {
+		value, err := settings.Secret(name)
+		if err != nil {
+			return nil, err
+		}
+		secrets[name] = value
+	}
+	logger.RegisterSecrets(secrets["GITHUB_API_TOKEN"], secrets["TRACKER_API_TOKEN"], secrets["BASIC_AUTH_PASSWORD"], secrets["METRICS_PASSWORD"],
+		secrets[githubwebhook.SecretEnvVar])
+	loaded := &reloadableConfig{configuration: configuration, secrets: secrets}
+
+	// The plaintext credentials from the environment are accepted by both Tracker-facing endpoints, in addition to
+	// the hashed credentials from the config file.
+	var envCredentials *config.BasicAuthCredentials
+	if username, password := secrets["BASIC_AUTH_USERNAME"], secrets["BASIC_AUTH_PASSWORD"]; username != "" && password != "" {
+		envCredentials = &config.BasicAuthCredentials{Label: "basic_auth_env", Username: username, Password: password}
+	}
+	loaded.trackerActivityCredentials = endpointCredentials("tracker_activity", configuration.Credentials.TrackerActivity, envCredentials)
+	loaded.trackerImportCredentials = endpointCredentials("tracker_import", configuration.Credentials.TrackerImport, envCredentials)
+
+	// Signed webhook tokens are an alternative to credentials for the activity webhook, which keep passwords out of URLs.
+	webhookTokenKeys, _, err := webhooktoken.ParseKeys(secrets[webhooktoken.KeysEnvVar])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", webhooktoken.KeysEnvVar, err)
+	}
+	for _, key := range webhookTokenKeys {
+		logger.RegisterSecrets(string(key))
+	}
+	logger.Info("Configured webhook token keys", "key_ids", webhookTokenKeys.IDs(),
+		"revoked_token_ids", configuration.WebhookTokens.RevokedTokenIDs)
+	if len(webhookTokenKeys) > 0 {
+		loaded.webhookTokenCredentials = webhooktoken.NewAuthenticator(webhookTokenKeys, configuration.WebhookTokens.RevokedTokenIDs)
+	}
+
+	if loaded.trackerActivityCredentials == nil && loaded.webhookTokenCredentials == nil {
+		return nil, errors.New("no credentials configured for endpoint tracker_activity: set credentials.tracker_activity " +
+			"in the config file, the BASIC_AUTH_USERNAME and BASIC_AUTH_PASSWORD environment variables, or " + webhooktoken.KeysEnvVar)
+	}
+	if loaded.trackerImportCredentials == nil {
+		return nil, errors.New("no credentials configured for endpoint tracker_import: set credentials.tracker_import " +
+			"in the config file, or the BASIC_AUTH_USERNAME and BASIC_AUTH_PASSWORD environment variables")
+	}
+	if username, password := secrets["METRICS_USERNAME"], secrets["METRICS_PASSWORD"]; username != "" && password != "" {
+		loaded.metricsCredentials = &config.BasicAuthCredentials{Label: "metrics_env", Username: username, Password: password}
+	}
+	// GitHub signs the body of each webhook request with the webhook's secret.
+	if secret := secrets[githubwebhook.SecretEnvVar]; secret != "" {
+		loaded.gitHubWebhookCredentials = githubwebhook.NewSignatureAuthenticator(secret)
+	}
+	return loaded, nil
+}
+
+// Returns the authenticator for one of the Tracker-facing endpoints, or nil when there are no credentials for it.
+// The configured credentials must already be valid.
+func endpointCredentials(endpoint string, configured config.Credentials, envCredentials *config.BasicAuthCredentials) config.Authenticator {
+	labels := make([]string, 0, len(configured)+1)
+	authenticators := make([]config.Authenticator, 0, 2)
+	if len(configured) > 0 {
+		for _, credential := range configured {
+			labels = append(labels, credential.Label)
+		}
+		authenticators = append(authenticators, configured)
+	}
+	if envCredentials != nil {
+		labels = append(labels, envCredentials.Label)
+		authenticators = append(authenticators, envCredentials)
+	}
+	if len(authenticators) == 0 {
+		return nil
+	}
+	logging.Default().Info("Configured credentials", "endpoint", endpoint, "labels", labels)
+	return config.AnyOf(authenticators...)
+}
+
+// Config file sections and secrets which are only read at startup.
+var (
+	restartRequiredSections = []string{"github", "log_level", "tracing", "readiness_check_interval", "server", "inbound", "reload_interval"}
+	restartRequiredSecrets  = []string{"GITHUB_API_TOKEN", "TRACKER_API_TOKEN"}
+)
+
+// A reloader reads the config file and the secrets again, and swaps the configuration, credentials and readiness
+// checks which the handlers use. Only the Watcher calls reload, so calls never overlap.
+type reloader struct {
+	configPath string
+	// Holds the current *reloadableConfig. The configuration and the credentials of every endpoint are swapped
+	// in one step, so that a request never sees the credentials of one version with the configuration of another.
+	loaded atomic.Value
+	// Whether /metrics is served, which only changes after a restart.
+	servingMetrics bool
+
+	readiness       *health.Checker
+	readinessChecks func(*config.Config) []health.Check
+}
+
+func (r *reloader) current() *reloadableConfig {
+	return r.loaded.Load().(*reloadableConfig)
+}
+
+// Returns an Authenticator which uses the credentials of an endpoint from the current configuration.
+func (r *reloader) credentials(endpoint func(*reloadableConfig) config.Authenticator) config.CurrentAuthenticator {
+	return func() config.Authenticator {
+		return endpoint(r.current())
+	}
+}
+
+// The files are the content of the config file and the secret files which the Watcher read.
+func (r *reloader) reload(ctx context.Context, files reload.Files) error {
+	logger := logging.FromContext(ctx)
+	configuration, err := loadConfig(r.configPath, files.ReadFile)
+	var loaded *reloadableConfig
+	if err == nil {
+		loaded, err = loadReloadable(configuration, config.NewSettings(os.LookupEnv, files.ReadFile))
+	}
+	if err != nil {
+		logger.Error("Could not reload configuration, so continuing to use the previous one", "error", err)
+		return err
+	}
+
+	previous := r.current()
+	r.loaded.Store(loaded)
+	r.readiness.SetChecks(r.readinessChecks(configuration))
+
+	changedSections := config.Diff(previous.configuration, configuration)
+	var changedSecrets []string
+	for name, value := range loaded.secrets {
+		if previous.secrets[name] != value {
+			changedSecrets = append(changedSecrets, name)
+		}
+	}
+	sort.Strings(changedSecrets)
+	logger.Info("Reloaded configuration", "changed_sections", changedSections, "changed_secrets", changedSecrets)
+
+	var needRestart []string
+	for _, changed := range append(changedSections, changedSecrets...) {
+		for _, name := range append(restartRequiredSections, restartRequiredSecrets...) {
+			if changed == name {
+				needRestart = append(needRestart, changed)
+			}
+		}
+	}
+	if !r.servingMetrics && loaded.metricsCredentials != nil {
+		needRestart = append(needRestart, "METRICS_USERNAME", "METRICS_PASSWORD")
+	}
+	if len(needRestart) > 0 {
+		logger.Warn("Some changes only take effect after a restart", "changed", needRestart)
+	}
+	return nil
+}
+
+// Returns the files which secrets were read from.
+func secretFiles(settings *config.Settings) []string {
+	var files []string
+	for _, source := range settings.Sources() {
+		if source.File != "" {
+			files = append(files, source.File)
+		}
+	}
+	return files
+}
+
+// Check config files before deploying them, e.g. in CI. Prints each problem with its file and line number, and
+// exits with status 1 when any file is invalid.
+// e.g. issues2stories validate-config config.yaml
+func validateConfigCommand(args []string) {
+	flags := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	checkSecrets := flags.Bool("secrets", false, "also check that the other secrets which the config needs, e.g. credentials, are set in the environment, as for the app")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: issues2stories validate-config [flags] [config file ...]\n"+
+			"Checks %s when no config files are given.\n", defaultConfigFilePath)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{defaultConfigFilePath}
+	}
+	valid := true
+	for _, path := range paths {
+		configYAML, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Printf("%s: could not read config file: %v\n", path, err)
+			valid = false
+			continue
+		}
+		configuration, err := config.Parse(configYAML)
+		if validationErr, ok := err.(*config.ValidationError); ok {
+			printProblems(path, validationErr.Problems)
+			valid = false
+			continue
+		}
+		// Bindings can't be synced without the API tokens, so they are always checked, unlike the other secrets.
+		settings := config.NewSettings(os.LookupEnv, ioutil.ReadFile)
+		if problems := configuration.TokenProblems(configYAML, settings); len(problems) > 0 {
+			printProblems(path, problems)
+			valid = false
+			continue
+		}
+		if *checkSecrets {
+			if _, err := loadReloadable(configuration, settings); err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				valid = false
+				continue
+			}
+		}
+		fmt.Printf("%s: ok\n", path)
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// Prints each problem with the config file's path and the problem's line number.
+func printProblems(path string, problems []config.Problem) {
+	for _, problem := range problems {
+		location := path
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", path, problem.Line)
+		}
+		if problem.Key != "" {
+			fmt.Printf("%s: %s: %s\n", location, problem.Key, problem.Message)
+		} else {
+			fmt.Printf("%s: %s\n", location, problem.Message)
+		}
+	}
+}
+
+// Propose a tracker_id_to_github_username_mapping for the members of a Tracker project, by matching them to GitHub
+// users by email address and name. Progress is logged to stderr, and the proposal is printed to stdout.
+// e.g. issues2stories generate-user-mapping -project 2453999 -config config.yaml > mapping.yaml
+func generateUserMappingCommand(args []string) {
+	flags := flag.NewFlagSet("generate-user-mapping", flag.ExitOnError)
+	projectID := flags.Int64("project", 0, "the ID of the Tracker project whose members to map (required)")
+	minConfidence := flags.String("min-confidence", usermapping.Medium, "comment out matches with less confidence than this: high, medium or low")
+	maxCommits := flags.Int("max-commits", config.UserResolver{}.WithDefaults().MaxCommits, "how many of the repository's most recent commits to compare with the Tracker users")
+	configPath := flags.String("config", "", "optional path to the app's config file, for the GitHub repository and to keep its existing mapping")
+	_ = flags.Parse(args)
+	if *projectID == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if !usermapping.ValidConfidence(*minConfidence) {
+		fatal("invalid -min-confidence, must be high, medium or low", "min_confidence", *minConfidence)
+	}
+
+	configuration := &config.Config{}
+	if *configPath != "" {
+		configuration = readConfig(*configPath)
+	}
+	settings := config.NewSettings(os.LookupEnv, ioutil.ReadFile)
+	gitHubClient := githubapi.New(requireSecret(settings, "GITHUB_API_TOKEN"),
+		requireSetting(settings, "GITHUB_ORG", configuration.GitHub.Org, "github.org"),
+		requireSetting(settings, "GITHUB_REPO", configuration.GitHub.Repo, "github.repo"))
+	trackerClient := trackerapi.New(requireSecret(settings, "TRACKER_API_TOKEN"), &http.Client{})
+
+	ctx := context.Background()
+	logger := logging.Default()
+	people, err := trackerClient.ListProjectMembers(ctx, *projectID)
+	if err != nil {
+		fatal("could not list the Tracker project's members", "tracker_project_id", *projectID, "error", err)
+	}
+	logger.Info("Listed Tracker project members", "count", len(people))
+	matcher, err := usermapping.NewMatcher(ctx, gitHubClient, *maxCommits)
+	if err != nil {
+		fatal("could not read the repository's commits", "error", err)
+	}
+	matches := make([]usermapping.Match, 0, len(people))
+	for _, person := range people {
+		if _, ok := configuration.UserIDMapping[person.ID]; ok {
+			matches = append(matches, usermapping.Match{Person: person})
+			continue
+		}
+		match := matcher.Match(ctx, person)
+		logger.Info("Matched Tracker user", "tracker_user_id", person.ID, "github_username", match.GitHubUsername,
+			"confidence", match.Confidence)
+		matches = append(matches, match)
+	}
+	fmt.Print(usermapping.ProposedYAML(*projectID, matches, *minConfidence, configuration.UserIDMapping))
+}
+
+// Print a password hash for the credentials in the config file. The password is read from stdin, so that it
+// doesn't end up in the shell history. e.g. issues2stories hash-password -algorithm argon2id < password.txt
+func hashPasswordCommand(args []string) {
+	flags := flag.NewFlagSet("hash-password", flag.ExitOnError)
+	algorithm := flags.String("algorithm", passwordhash.Bcrypt, "the hash algorithm: bcrypt or argon2id")
+	_ = flags.Parse(args)
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fatal("could not read password from stdin", "error", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		fatal("no password on stdin")
+	}
+	hash, err := passwordhash.Hash(password, *algorithm)
+	if err != nil {
+		fatal("could not hash password", "error", err)
+	}
+	fmt.Println(hash)
+}
+
+// Generate and revoke the signed tokens which can be embedded in activity webhook URLs, e.g.
+//
+//	issues2stories webhook-url new-key -key-id 2021-03
+//	WEBHOOK_TOKEN_KEYS=... issues2stories webhook-url generate -project 123 -base-url https://issues2stories.your-zone.com
+//	WEBHOOK_TOKEN_KEYS=... issues2stories webhook-url revoke -config config.yaml https://issues2stories.your-zone.com/tracker_activity/i2swh_...
+func webhookURLCommand(args []string) {
+	usage := "usage: issues2stories webhook-url new-key|generate|revoke [flags]"
+	if len(args) == 0 {
+		fatal(usage)
+	}
+	flags := flag.NewFlagSet("webhook-url "+args[0], flag.ExitOnError)
+	switch args[0] {
+	case "new-key":
+		keyID := flags.String("key-id", "", "an ID for the new key, e.g. the current date (required)")
+		_ = flags.Parse(args[1:])
+		key, err := webhooktoken.NewKey(*keyID)
+		if err != nil {
+			fatal("could not create key", "error", err)
+		}
+		fmt.Printf("Add this key to the start of %s, separated from any existing keys by a comma:\n%s\n", webhooktoken.KeysEnvVar, key)
+
+	case "generate":
+		projectID := flags.Int64("project", 0, "the Tracker project ID of the binding which the webhook URL is for (required)")
+		baseURL := flags.String("base-url", "", "the app's base URL, e.g. https://issues2stories.your-zone.com (required)")
+		keyID := flags.String("key-id", "", "the ID of the key to sign with; defaults to the first key in "+webhooktoken.KeysEnvVar)
+		configPath := flags.String("config", "", "optional path to the app's config file, to check that the binding exists")
+		_ = flags.Parse(args[1:])
+		if *projectID == 0 || *baseURL == "" {
+			flags.Usage()
+			os.Exit(2)
+		}
+		if *configPath != "" && readConfig(*configPath).BindingForProject(*projectID) == nil {
+			fatal("the config file has no binding for the Tracker project", "tracker_project_id", *projectID)
+		}
+		keys, firstKeyID := requireWebhookTokenKeys()
+		if *keyID == "" {
+			*keyID = firstKeyID
+		}
+		token, claims, err := webhooktoken.Issue(keys, *keyID, *projectID)
+		if err != nil {
+			fatal("could not generate webhook token", "key_id", *keyID, "error", err)
+		}
+		fmt.Printf("Webhook URL for Tracker project %d (key ID %s, token ID %s):\n%s/tracker_activity/%s\n",
+			claims.TrackerProjectID, claims.KeyID, claims.TokenID, strings.TrimSuffix(*baseURL, "/"), token)
+
+	case "revoke":
+		configPath := flags.String("config", "", "optional path to the app's config file, to add the token ID to webhook_tokens.revoked_token_ids")
+		_ = flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			fatal("expected one webhook URL or token to revoke")
+		}
+		token, ok := webhooktoken.FromURL(flags.Arg(0))
+		if !ok {
+			fatal("not a webhook URL or token")
+		}
+		keys, _ := requireWebhookTokenKeys()
+		claims, err := webhooktoken.Verify(keys, nil, token)
+		if err != nil {
+			fatal("could not verify webhook token", "error", err)
+		}
+		if *configPath == "" {
+			fmt.Printf("Add token ID %s to webhook_tokens.revoked_token_ids in the app's config file, e.g.\n"+
+				"webhook_tokens:\n  revoked_token_ids:\n    - %q\n", claims.TokenID, claims.TokenID)
+			return
+		}
+		configYAML, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			fatal("could not read config file", "path", *configPath, "error", err)
+		}
+		updatedYAML, err := config.AddRevokedWebhookTokenID(configYAML, claims.TokenID)
+		if err != nil {
+			fatal("could not update config file", "path", *configPath, "error", err)
+		}
+		if err := config.WriteFile(*configPath, updatedYAML); err != nil {
+			fatal("could not write config file", "path", *configPath, "error", err)
+		}
+		fmt.Printf("Revoked token ID %s for Tracker project %d in %s. Deploy the updated config to apply it.\n",
+			claims.TokenID, claims.TrackerProjectID, *configPath)
+
+	default:
+		fatal(usage)
+	}
+}
+
+func requireWebhookTokenKeys() (webhooktoken.Keys, string) {
+	settings := config.NewSettings(os.LookupEnv, ioutil.ReadFile)
+	keys, firstKeyID, err := webhooktoken.ParseKeys(requireSecret(settings, webhooktoken.KeysEnvVar))
+	if err != nil {
+		fatal("invalid "+webhooktoken.KeysEnvVar, "error", err)
+	}
+	return keys, firstKeyID
+}
+
+// Returns the TLS config for serving HTTPS, or nil to serve HTTP. When the certificate is obtained using the ACME
+// "http-01" challenge, also returns the solver which must be served on port 80.
+func configureTLS(ctx context.Context, settings config.Server) (*tls.Config, *tlscert.HTTP01Solver) {
+	logger := logging.FromContext(ctx)
+	switch {
+	case settings.TLS != nil && settings.ACME != nil:
+		fatal("server.tls and server.acme cannot both be configured")
+	case settings.TLS != nil:
+		reloader, err := tlscert.NewReloader(settings.TLS.CertFile, settings.TLS.KeyFile)
+		if err != nil {
+			fatal("could not load TLS certificate", "error", err)
+		}
+		reloadInterval := settings.TLS.ReloadInterval
+		if reloadInterval <= 0 {
+			reloadInterval = time.Minute
+		}
+		reloader.Start(ctx, reloadInterval)
+		return &tls.Config{GetCertificate: reloader.GetCertificate, NextProtos: []string{"h2", "http/1.1"}}, nil
+	case settings.ACME != nil:
+		httpClient, err := tlscert.HTTPClientTrustingRoots(settings.ACME.CARootFile)
+		if err != nil {
+			fatal("could not read ACME CA root file", "path", settings.ACME.CARootFile, "error", err)
+		}
+		opts := tlscert.ACMEOptions{
+			Domains:      settings.ACME.Domains,
+			DirectoryURL: settings.ACME.DirectoryURL,
+			Email:        settings.ACME.Email,
+			CacheDir:     settings.ACME.CacheDir,
+			RenewBefore:  settings.ACME.RenewBefore,
+			HTTPClient:   httpClient,
+		}
+		nextProtos := []string{"h2", "http/1.1"}
+		var httpChallengeSolver *tlscert.HTTP01Solver
+		switch settings.ACME.Challenge {
+		case "", "tls-alpn-01":
+			opts.Solver = tlscert.NewTLSALPN01Solver()
+			nextProtos = append(nextProtos, acme.ALPNProto)
+		case "http-01":
+			httpChallengeSolver = tlscert.NewHTTP01Solver(http.HandlerFunc(redirectToHTTPS))
+			opts.Solver = httpChallengeSolver
+		default:
+			fatal("unsupported server.acme.challenge, must be tls-alpn-01 or http-01", "challenge", settings.ACME.Challenge)
+		}
+		manager, err := tlscert.NewACMEManager(opts)
+		if err != nil {
+			fatal("invalid server.acme configuration", "error", err)
+		}
+		if settings.ACME.CacheDir == "" {
+			logger.Warn("server.acme.cache_dir is not set, so a new certificate will be requested every time the app starts")
+		}
+		manager.Start(ctx)
+		return &tls.Config{GetCertificate: manager.GetCertificate, NextProtos: nextProtos}, httpChallengeSolver
+	}
+	return nil, nil
+}
+
+// Serve the ACME "http-01" challenge responses, and redirect all other requests to HTTPS.
+func serveHTTPChallenges(ctx context.Context, address string, solver *tlscert.HTTP01Solver) {
+	if address == "" {
+		address = ":80"
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		fatal("could not listen for ACME http-01 challenges", "listen_address", address, "error", err)
+	}
+	srv := &http.Server{Handler: solver, ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
+	if err := server.Run(ctx, srv, listener, server.Options{ShutdownTimeout: 5 * time.Second}); err != nil {
+		logging.FromContext(ctx).Error("ACME http-01 challenge server failed", "error", err)
+	}
+}
+
+func redirectToHTTPS(responseWriter http.ResponseWriter, request *http.Request) {
+	host, _, err := net.SplitHostPort(request.Host)
+	if err != nil {
+		host = request.Host
+	}
+	http.Redirect(responseWriter, request, "https://"+host+request.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// Check that the GitHub token can read the repository, that the Tracker token is valid,
+// and that the Tracker token can read each configured project.
+func readinessChecks(configuration *config.Config, gitHubClient githubapi.GitHubAPI, trackerClient trackerapi.TrackerAPI) []health.Check {
+	checks := []health.Check{
+		{Name: "github_repo_access", Run: gitHubClient.CheckRepoAccess},
+		{Name: "tracker_token", Run: trackerClient.CheckToken},
+	}
+	for _, binding := range configuration.Bindings {
+		projectID := binding.TrackerProjectID
+		checks = append(checks, health.Check{
+			Name: fmt.Sprintf("tracker_project_access/%d", projectID),
+			Run:  func(ctx context.Context) error { return trackerClient.CheckProjectAccess(ctx, projectID) },
+		})
+	}
+	return checks
+}
+
+// Run a Tracker activity event through the webhook handler offline and print the planned GitHub issue updates.
+// e.g. issues2stories simulate -event internal/trackeractivity/testdata/edit_accept_story.json -issue-fixture labels.json -diff
+func simulateCommand(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	eventFile := flags.String("event", "", "path to a Tracker activity webhook JSON payload (required)")
+	issueNumber := flags.Int("issue", 1, "the GitHub issue number which the stories in the event are linked to")
+	issueFixture := flags.String("issue-fixture", "", `path to a JSON file with the current issue, e.g. {"labels": ["bug"]}`)
+	live := flags.Bool("live", false, "read the current issue from GitHub, using GITHUB_ORG, GITHUB_REPO, and GITHUB_API_TOKEN")
+	diff := flags.Bool("diff", false, "print the planned changes as a diff")
+	configPath := flags.String("config", "", "optional path to the app's config file, e.g. for the user ID mapping")
+	_ = flags.Parse(args)
+
+	if *eventFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	opts := &simulate.Options{
+		EventFile:        *eventFile,
+		IssueNumber:      *issueNumber,
+		IssueFixtureFile: *issueFixture,
+		Diff:             *diff,
+	}
+	configuration := &config.Config{}
+	if *configPath != "" {
+		configuration = readConfig(*configPath)
+		opts.Configuration = configuration
+	}
+	if *live {
+		settings := config.NewSettings(os.LookupEnv, ioutil.ReadFile)
+		opts.LiveGitHubClient = githubapi.New(requireSecret(settings, "GITHUB_API_TOKEN"),
+			requireSetting(settings, "GITHUB_ORG", configuration.GitHub.Org, "github.org"),
+			requireSetting(settings, "GITHUB_REPO", configuration.GitHub.Repo, "github.repo"))
+	}
+
+	if err := simulate.Run(context.Background(), opts, os.Stdout); err != nil {
+		fatal("simulate failed", "error", err)
+	}
+}
+
+// Like loadConfig, but exits when the config file can't be loaded.
+func readConfig(path string) *config.Config {
+	configuration, err := loadConfig(path, ioutil.ReadFile)
+	if err != nil {
+		fatal("could not load config file", "path", path, "error", err)
+	}
+	return configuration
+}
+
+func loadConfig(path string, readFile func(string) ([]byte, error)) (*config.Config, error) {
+	configYAML, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	return config.Parse(configYAML)
+}
+
+// Returns the setting from the environment variable or the config file, or exits when it is not set in either.
+func requireSetting(settings *config.Settings, name, configFileValue, configFileKey string) string {
+	value := settings.Get(name, configFileValue, "")
+	if value == "" {
+		fatal("setting not found: set the environment variable or the config file key",
+			"name", name, "config_file_key", configFileKey)
+	}
+	return value
+}
+
+// Returns the secret from the environment variable or the file named by <NAME>_FILE, or exits when it is not set.
+func requireSecret(settings *config.Settings, name string) string {
+	value, err := settings.RequireSecret(name)
+	if err != nil {
+		fatal("could not read secret", "error", err)
 	}
+	return value
 }
 
-func requireEnv(envVarName string) string {
-	value, ok := os.LookupEnv(envVarName)
-	if !ok || value == "" {
-		log.Fatalf("environment variable not found or empty: %s", envVarName)
+// Like requireSecret, but returns an empty string when the secret is not set.
+func optionalSecret(settings *config.Settings, name string) string {
+	value, err := settings.Secret(name)
+	if err != nil {
+		fatal("could not read secret", "error", err)
 	}
 	return value
 }
 
+// Returns a lookup function for the OTEL_* settings, which reads them from the environment, secret files and the
+// config file. The OTLP headers are a secret, because they usually contain credentials.
+func tracingSettings(settings *config.Settings, configured config.Tracing) func(string) (string, bool) {
+	values := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT":        settings.Get("OTEL_EXPORTER_OTLP_ENDPOINT", configured.OTLPEndpoint, ""),
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": settings.Get("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "", ""),
+		"OTEL_SERVICE_NAME":                  settings.Get("OTEL_SERVICE_NAME", configured.ServiceName, ""),
+		"OTEL_EXPORTER_OTLP_HEADERS":         optionalSecret(settings, "OTEL_EXPORTER_OTLP_HEADERS"),
+	}
+	logging.Default().RegisterSecrets(values["OTEL_EXPORTER_OTLP_HEADERS"])
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok && value != ""
+	}
+}
+
+func fatal(msg string, keysAndValues ...interface{}) {
+	logging.Default().Error(msg, keysAndValues...)
+	os.Exit(1)
+}
+
 // Respond to heath checks at the root path. GKE Ingress default health check is GET "/".
 func defaultHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := logging.FromContext(request.Context())
+
 	if request.URL.Path != "/" {
-		log.Printf("defaultHandler: path not found: %s", request.URL.Path)
+		logger.Info("defaultHandler: path not found", "path", request.URL.Path)
 		http.Error(responseWriter, "404. Not found.", http.StatusNotFound)
 		return
 	}
 
 	if request.Method != "GET" {
 		msg := "Method is not supported"
-		log.Printf("defaultHandler: %v", msg)
+		logger.Info("defaultHandler: " + msg)
 		http.Error(responseWriter, msg, http.StatusMethodNotAllowed)
 		return
 	}
 
-	log.Print("defaultHandler: responding ok to GET /")
+	logger.Debug("defaultHandler: responding ok to GET /")
 	responseWriter.Write([]byte("ok"))
 }